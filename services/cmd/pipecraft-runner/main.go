@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"pipecraft/internal/config"
+	"pipecraft/internal/logger"
+	"pipecraft/internal/runner"
+	"syscall"
+	"time"
+)
+
+func main() {
+	cfg := config.MustParseRunner()
+	logger.BuildLogger(cfg.IsDebug)
+
+	slog.Info("runner config parsed", slog.Any("config", cfg))
+
+	r := runner.New(*cfg)
+	if err := r.Register(os.Getenv(runner.REGISTRATION_TOKEN_ENV)); err != nil {
+		slog.Error("error while registering runner", logger.Err(err))
+		panic(err)
+	}
+
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+	go r.Start(ctx)
+
+	// Graceful shutdown
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	sign := <-signals
+
+	slog.Info("Graceful shutdown runner...", slog.String("signal", sign.String()))
+	stop()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.ShutdownGracePeriod)*time.Second)
+	defer cancel()
+	if err := r.Shutdown(shutdownCtx); err != nil {
+		slog.Warn("running pipelines are interrupted", logger.Err(err))
+	}
+}
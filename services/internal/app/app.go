@@ -1,16 +1,22 @@
 package app
 
 import (
+	"context"
 	"log/slog"
 	"os"
 	"os/signal"
 	"pipecraft/internal/config"
 	"pipecraft/internal/handlers"
+	"pipecraft/internal/logger"
+	"pipecraft/internal/runner"
+	"pipecraft/internal/secrets"
 	"pipecraft/internal/server"
 	"pipecraft/internal/services"
 	"pipecraft/internal/storage"
+	"pipecraft/internal/vcs"
 	"pipecraft/internal/worker"
 	"syscall"
+	"time"
 )
 
 type App struct {
@@ -25,17 +31,87 @@ func (app *App) Run() {
 	storage := storage.MustInit()
 	slog.Info("Database connected")
 
-	pipelineService := services.NewPipelineService(storage)
+	cipher, err := secrets.NewCipherFromEnv()
+	if err != nil {
+		slog.Error("error while creating credentials cipher", logger.Err(err))
+		panic(err)
+	}
+	if cipher == nil {
+		slog.Warn("credentials encryption key is not set, private repositories are disabled")
+	}
+
+	credentialsService := services.NewCredentialsService(storage, cipher)
+	pipelineService := services.NewPipelineService(storage, vcs.NewResolver(credentialsService), app.Config.CI)
 	redisService := services.NewRedisService()
 	slog.Info("redis connected")
 
-	handlers := handlers.New(redisService, pipelineService)
-	server := server.New(handlers)
+	settingsService := services.NewSettingsService(storage, app.Config.CI)
+	scheduleService := services.NewScheduleService(storage)
+	pool := worker.NewPool(app.Config.Worker.PoolSize)
+	poolService := services.NewPoolService(pool)
+
+	registrationToken := os.Getenv(runner.REGISTRATION_TOKEN_ENV)
+	if registrationToken == "" {
+		slog.Warn("runner registration token is not set, runners are disabled")
+	}
+	// NOTE: nil labels tell that no pipeline runs on server, empty ones that pipelines without runs-on do
+	var localLabels []string
+	if !app.Config.Worker.Disabled {
+		localLabels = append([]string{}, app.Config.Worker.Labels...)
+	}
+	runnerService := services.NewRunnerService(storage, storage, credentialsService, registrationToken, app.Config.CI, app.Config.Runners, localLabels)
+
+	var mirrors *vcs.MirrorCache
+	if app.Config.Mirrors.Enabled {
+		mirrors, err = vcs.NewMirrorCache(app.Config.Mirrors.Dir, app.Config.Mirrors.MaxSizeMb*1024*1024, credentialsService)
+		if err != nil {
+			slog.Error("error while creating mirror cache", logger.Err(err))
+			panic(err)
+		}
+		go mirrors.StartGC(time.Duration(app.Config.Mirrors.GcInterval) * time.Second)
+	}
+
+	var listener *worker.Listener
+	var reaper *worker.Reaper
+	reaperService := services.NewReaperService(nil)
+	if !app.Config.Worker.Disabled {
+		listenInterval := time.Duration(app.Config.Worker.ListenInterval) * time.Second
+		listener = worker.NewListener(worker.NewLocalBackend(storage, credentialsService, localLabels), mirrors, app.Config.CI, app.Config.Worker.Resources, app.Config.Worker.Docker, app.Config.Worker.InstanceId, pool, listenInterval)
+		reaper = worker.NewReaper(listener)
+		reaperService = services.NewReaperService(reaper)
+	}
+
+	handlers := handlers.New(redisService, pipelineService, credentialsService, settingsService, scheduleService, poolService, runnerService, reaperService)
+	server := server.New(handlers, app.Config.Http)
 
 	slog.Info("server listening", slog.Int("port", app.Config.Http.Port))
-	go server.Listen(app.Config.Http)
+	go server.Listen()
+
+	// NOTE: canceling listen ctx stops claiming and scheduling of new pipelines, running ones are drained separately
+	listenCtx, stopListening := context.WithCancel(context.Background())
+	defer stopListening()
 
-	go worker.StartListener(storage)
+	if listener != nil {
+		// NOTE: leftovers of previous process are removed before pipelines are claimed, so they don't clash with new ones
+		reaper.Reap(listenCtx)
+		go reaper.Start(listenCtx, time.Duration(app.Config.Worker.ReaperInterval)*time.Second)
+		go listener.Start(listenCtx)
+	} else {
+		slog.Info("worker is disabled, pipelines are run only by runners")
+	}
+
+	go runnerService.StartReaper(listenCtx)
+
+	schedulerStopped := make(chan struct{})
+	if app.Config.Scheduler.Enabled {
+		scheduler := services.NewScheduler(storage, pipelineService)
+		go func() {
+			defer close(schedulerStopped)
+			scheduler.Start(listenCtx, time.Duration(app.Config.Scheduler.Interval)*time.Second)
+		}()
+	} else {
+		close(schedulerStopped)
+	}
 
 	// Graceful shutdown
 	stop := make(chan os.Signal, 1)
@@ -44,6 +120,27 @@ func (app *App) Run() {
 
 	slog.Info("Graceful shutdown application...", slog.String("signal", sign.String()))
 
+	stopListening()
+	<-schedulerStopped
+
+	gracePeriod := time.Duration(app.Config.Worker.ShutdownGracePeriod) * time.Second
+	slog.Info("waiting for running pipelines", slog.Int("running", pool.Busy()), slog.Duration("grace_period", gracePeriod))
+
+	workerCtx, cancelWorker := context.WithTimeout(context.Background(), gracePeriod)
+	defer cancelWorker()
+	if listener != nil {
+		if err := listener.Shutdown(workerCtx); err != nil {
+			slog.Warn("running pipelines are interrupted", logger.Err(err))
+		}
+	}
+
+	// NOTE: http server is stopped after pipelines are drained, runners call server api for pipelines they run
+	httpCtx, cancelHttp := context.WithTimeout(context.Background(), time.Duration(app.Config.Http.ShutdownTimeout)*time.Second)
+	defer cancelHttp()
+	if err := server.Shutdown(httpCtx); err != nil {
+		slog.Warn("http-server is not shut down gracefully", logger.Err(err))
+	}
+
 	redisService.Close()
 	storage.Db.Close()
 }
@@ -3,21 +3,192 @@ package config
 import (
 	"fmt"
 	"os"
+	"path"
+	"slices"
 
+	"github.com/docker/go-units"
 	"gopkg.in/yaml.v3"
 )
 
-const DEFAULT_CONFIG_PATH = "config.yml"
+const (
+	DEFAULT_CONFIG_PATH        = "config.yml"
+	DEFAULT_RUNNER_CONFIG_PATH = "runner.yml"
+
+	DEFAULT_CI_CONFIG_PATH   = "ci.yaml"
+	DEFAULT_CI_PIPELINES_DIR = ".pipecraft"
+
+	DEFAULT_SCHEDULER_INTERVAL = 30
+
+	DEFAULT_HTTP_SHUTDOWN_TIMEOUT = 10
+
+	DEFAULT_WORKER_POOL_SIZE             = 5
+	DEFAULT_WORKER_LISTEN_INTERVAL       = 10
+	DEFAULT_WORKER_SHUTDOWN_GRACE_PERIOD = 60
+	DEFAULT_WORKER_REAPER_INTERVAL       = 300
+	DEFAULT_WORKER_INSTANCE_ID           = "pipecraft"
+
+	DEFAULT_RUNNERS_HEARTBEAT_TIMEOUT = 60
+	DEFAULT_RUNNERS_POLL_TIMEOUT      = 30
+	DEFAULT_RUNNERS_ACK_TIMEOUT       = 30
+
+	DEFAULT_RUNNER_LISTEN_INTERVAL = 1
+
+	DEFAULT_DOCKER_IMAGE = "docker:28-dind"
+)
 
 type Http struct {
-	Port         int `yaml:"port"`
-	ReadTimeout  int `yaml:"read_timeout"`
-	WriteTimeout int `yaml:"write_timeout"`
+	Port            int `yaml:"port"`
+	ReadTimeout     int `yaml:"read_timeout"`
+	WriteTimeout    int `yaml:"write_timeout"`
+	ShutdownTimeout int `yaml:"shutdown_timeout"`
+}
+
+// NOTE: mirrors dir is mounted into pipeline containers, so it has to have the same path on docker host
+type Mirrors struct {
+	Enabled    bool   `yaml:"enabled"`
+	Dir        string `yaml:"dir"`
+	MaxSizeMb  int64  `yaml:"max_size_mb"`
+	GcInterval int    `yaml:"gc_interval"`
+}
+
+// NOTE: paths are relative to repository root, protected branches are glob patterns
+// NOTE: pipelines of privileged repositories get docker socket of host, which is root on host for whoever pushes to
+// them, so repositories are made privileged only by config of server and never by its api. Credentials of trusted
+// repositories are used by ci configs of other repositories, other repositories are read by them anonymously.
+type CI struct {
+	ConfigPath             string   `yaml:"config_path"`
+	PipelinesDir           string   `yaml:"pipelines_dir"`
+	ProtectedBranches      []string `yaml:"protected_branches"`
+	PrivilegedRepositories []string `yaml:"privileged_repositories"`
+	TrustedRepositories    []string `yaml:"trusted_repositories"`
+}
+
+// IsProtectedBranch reports whether pipelines of branch are never superseded by newer ones.
+func (ci CI) IsProtectedBranch(branch string) bool {
+	for _, pattern := range ci.ProtectedBranches {
+		if matched, err := path.Match(pattern, branch); err == nil && matched {
+			return true
+		}
+	}
+	return false
+}
+
+// IsPrivilegedRepository reports whether pipelines of repository get docker socket of host.
+func (ci CI) IsPrivilegedRepository(repository string) bool {
+	return slices.Contains(ci.PrivilegedRepositories, repository)
+}
+
+// IsTrustedRepository reports whether ci configs of other repositories include files of repository with its
+// credentials.
+func (ci CI) IsTrustedRepository(repository string) bool {
+	return slices.Contains(ci.TrustedRepositories, repository)
+}
+
+// NOTE: interval is in seconds, schedules are fired with at most this delay
+type Scheduler struct {
+	Enabled  bool `yaml:"enabled"`
+	Interval int  `yaml:"interval"`
+}
+
+// NOTE: pool size is the number of pipelines run at a time, it can be changed at runtime by admin api.
+// Pipelines still running after shutdown grace period are interrupted and put back to the queue.
+// Server with disabled worker runs pipelines only on runners, so it doesn't need docker.
+// Instance id labels containers, networks and volumes of pipelines, reaper removes the ones of pipelines which are
+// not run anymore every reaper interval. Id has to stay the same across restarts, so instance which is recreated
+// reaps what it left, instances sharing docker host need different ids.
+type Worker struct {
+	Disabled            bool      `yaml:"disabled"`
+	InstanceId          string    `yaml:"instance_id"`
+	Labels              []string  `yaml:"labels"`
+	PoolSize            int       `yaml:"pool_size"`
+	ListenInterval      int       `yaml:"listen_interval"`
+	ShutdownGracePeriod int       `yaml:"shutdown_grace_period"`
+	ReaperInterval      int       `yaml:"reaper_interval"`
+	Resources           Resources `yaml:"resources"`
+	Docker              Docker    `yaml:"docker"`
+}
+
+// NOTE: every pipeline gets its own docker daemon in a sidecar container, sidecar is privileged unless runtime
+// which isolates nested containers, like sysbox-runc, is set. Container is the one worker runs in, if it runs in a
+// container, it is connected to pipeline network while docker-build step builds with daemon of pipeline.
+type Docker struct {
+	Image     string `yaml:"image"`
+	Runtime   string `yaml:"runtime"`
+	Container string `yaml:"container"`
+}
+
+// NOTE: limits are defaults of pipeline containers, jobs override cpus, memory and pids up to their maximums, job
+// which asks for more fails. Limit which is not set is not applied, unless its maximum is set. Disk limits root
+// filesystem of container and works only on storage drivers with quotas.
+type Resources struct {
+	Cpus      float64 `yaml:"cpus"`
+	Memory    string  `yaml:"memory"`
+	Pids      int64   `yaml:"pids"`
+	Disk      string  `yaml:"disk"`
+	MaxCpus   float64 `yaml:"max_cpus"`
+	MaxMemory string  `yaml:"max_memory"`
+	MaxPids   int64   `yaml:"max_pids"`
+}
+
+func (r Resources) validate() error {
+	if r.Cpus < 0 || r.Pids < 0 || r.MaxCpus < 0 || r.MaxPids < 0 {
+		return fmt.Errorf("cpus and pids of resources can't be negative")
+	}
+	sizes := map[string]int64{}
+	for _, size := range []string{r.Memory, r.Disk, r.MaxMemory} {
+		if size == "" {
+			continue
+		}
+		bytes, err := units.RAMInBytes(size)
+		if err != nil {
+			return fmt.Errorf("invalid size of resources: %w", err)
+		}
+		sizes[size] = bytes
+	}
+
+	if r.MaxCpus > 0 && r.Cpus > r.MaxCpus {
+		return fmt.Errorf("cpus of resources exceed max_cpus")
+	}
+	if r.MaxPids > 0 && r.Pids > r.MaxPids {
+		return fmt.Errorf("pids of resources exceed max_pids")
+	}
+	if r.MaxMemory != "" && sizes[r.Memory] > sizes[r.MaxMemory] {
+		return fmt.Errorf("memory of resources exceeds max_memory")
+	}
+	return nil
+}
+
+// NOTE: timeouts are in seconds, pipelines of runner which misses heartbeats for heartbeat timeout are requeued, as
+// are pipelines runner doesn't acknowledge for ack timeout after it was given them
+type Runners struct {
+	HeartbeatTimeout int `yaml:"heartbeat_timeout"`
+	PollTimeout      int `yaml:"poll_timeout"`
+	AckTimeout       int `yaml:"ack_timeout"`
 }
 
 type Config struct {
-	IsDebug bool `yaml:"is_debug"`
-	Http    Http `yaml:"http"`
+	IsDebug   bool      `yaml:"is_debug"`
+	Http      Http      `yaml:"http"`
+	Mirrors   Mirrors   `yaml:"mirrors"`
+	CI        CI        `yaml:"ci"`
+	Scheduler Scheduler `yaml:"scheduler"`
+	Worker    Worker    `yaml:"worker"`
+	Runners   Runners   `yaml:"runners"`
+}
+
+// Runner is config of pipecraft-runner, ci config and intervals of heartbeats come from server on registration.
+type Runner struct {
+	IsDebug             bool      `yaml:"is_debug"`
+	ServerUrl           string    `yaml:"server_url"`
+	Name                string    `yaml:"name"`
+	InstanceId          string    `yaml:"instance_id"`
+	Labels              []string  `yaml:"labels"`
+	PoolSize            int       `yaml:"pool_size"`
+	ListenInterval      int       `yaml:"listen_interval"`
+	ShutdownGracePeriod int       `yaml:"shutdown_grace_period"`
+	ReaperInterval      int       `yaml:"reaper_interval"`
+	Resources           Resources `yaml:"resources"`
+	Docker              Docker    `yaml:"docker"`
 }
 
 func MustParse() *Config {
@@ -36,5 +207,97 @@ func MustParseByPath(cfgPath string) *Config {
 		panic(fmt.Errorf("error while unmarshaling config file: %w", err))
 	}
 
+	if cfg.CI.ConfigPath == "" {
+		cfg.CI.ConfigPath = DEFAULT_CI_CONFIG_PATH
+	}
+	if cfg.CI.PipelinesDir == "" {
+		cfg.CI.PipelinesDir = DEFAULT_CI_PIPELINES_DIR
+	}
+	if cfg.Scheduler.Interval <= 0 {
+		cfg.Scheduler.Interval = DEFAULT_SCHEDULER_INTERVAL
+	}
+	if cfg.Worker.PoolSize <= 0 {
+		cfg.Worker.PoolSize = DEFAULT_WORKER_POOL_SIZE
+	}
+	if cfg.Worker.ListenInterval <= 0 {
+		cfg.Worker.ListenInterval = DEFAULT_WORKER_LISTEN_INTERVAL
+	}
+	if cfg.Worker.ShutdownGracePeriod <= 0 {
+		cfg.Worker.ShutdownGracePeriod = DEFAULT_WORKER_SHUTDOWN_GRACE_PERIOD
+	}
+	if cfg.Worker.ReaperInterval <= 0 {
+		cfg.Worker.ReaperInterval = DEFAULT_WORKER_REAPER_INTERVAL
+	}
+	// NOTE: hostname isn't used, container of server gets a new one when it is recreated
+	if cfg.Worker.InstanceId == "" {
+		cfg.Worker.InstanceId = DEFAULT_WORKER_INSTANCE_ID
+	}
+	if cfg.Http.ShutdownTimeout <= 0 {
+		cfg.Http.ShutdownTimeout = DEFAULT_HTTP_SHUTDOWN_TIMEOUT
+	}
+	if cfg.Runners.HeartbeatTimeout <= 0 {
+		cfg.Runners.HeartbeatTimeout = DEFAULT_RUNNERS_HEARTBEAT_TIMEOUT
+	}
+	if cfg.Runners.PollTimeout <= 0 {
+		cfg.Runners.PollTimeout = DEFAULT_RUNNERS_POLL_TIMEOUT
+	}
+	if cfg.Runners.AckTimeout <= 0 {
+		cfg.Runners.AckTimeout = DEFAULT_RUNNERS_ACK_TIMEOUT
+	}
+	if cfg.Worker.Docker.Image == "" {
+		cfg.Worker.Docker.Image = DEFAULT_DOCKER_IMAGE
+	}
+	if err := cfg.Worker.Resources.validate(); err != nil {
+		panic(fmt.Errorf("error while validating worker config: %w", err))
+	}
+
+	return &cfg
+}
+
+func MustParseRunner() *Runner {
+	return MustParseRunnerByPath(DEFAULT_RUNNER_CONFIG_PATH)
+}
+
+func MustParseRunnerByPath(cfgPath string) *Runner {
+	data, err := os.ReadFile(cfgPath)
+	if err != nil {
+		panic(fmt.Errorf("error while reading runner config file: %w", err))
+	}
+
+	var cfg Runner
+	err = yaml.Unmarshal(data, &cfg)
+	if err != nil {
+		panic(fmt.Errorf("error while unmarshaling runner config file: %w", err))
+	}
+
+	if cfg.ServerUrl == "" {
+		panic(fmt.Errorf("server_url of runner is not set"))
+	}
+	if cfg.Name == "" {
+		cfg.Name, _ = os.Hostname()
+	}
+	if cfg.PoolSize <= 0 {
+		cfg.PoolSize = DEFAULT_WORKER_POOL_SIZE
+	}
+	if cfg.ListenInterval <= 0 {
+		cfg.ListenInterval = DEFAULT_RUNNER_LISTEN_INTERVAL
+	}
+	if cfg.ShutdownGracePeriod <= 0 {
+		cfg.ShutdownGracePeriod = DEFAULT_WORKER_SHUTDOWN_GRACE_PERIOD
+	}
+	if cfg.ReaperInterval <= 0 {
+		cfg.ReaperInterval = DEFAULT_WORKER_REAPER_INTERVAL
+	}
+	// NOTE: runner gets its own id by default, so it doesn't reap pipelines of server running on the same host
+	if cfg.InstanceId == "" {
+		cfg.InstanceId = "runner-" + cfg.Name
+	}
+	if cfg.Docker.Image == "" {
+		cfg.Docker.Image = DEFAULT_DOCKER_IMAGE
+	}
+	if err := cfg.Resources.validate(); err != nil {
+		panic(fmt.Errorf("error while validating runner config: %w", err))
+	}
+
 	return &cfg
 }
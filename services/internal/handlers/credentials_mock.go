@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"errors"
+	"pipecraft/internal/models"
+	"pipecraft/internal/services"
+	"time"
+)
+
+type MockCredentialsService struct {
+	credentials map[string]*models.RepositoryCredentialsResponse
+	registries  map[[2]string]*models.RegistryCredentialsResponse
+}
+
+func NewMockCredentialsService() *MockCredentialsService {
+	return &MockCredentialsService{
+		credentials: make(map[string]*models.RepositoryCredentialsResponse),
+		registries:  make(map[[2]string]*models.RegistryCredentialsResponse),
+	}
+}
+
+func (m *MockCredentialsService) Save(dto *models.RepositoryCredentialsRequest) error {
+	if dto.RepositoryUrl == "" || (dto.Kind != "ssh" && dto.Kind != "https") {
+		return services.ErrInvalidCredentials
+	}
+
+	m.credentials[dto.RepositoryUrl] = &models.RepositoryCredentialsResponse{
+		RepositoryUrl: dto.RepositoryUrl,
+		Kind:          dto.Kind,
+		UpdatedAt:     time.Now(),
+	}
+
+	return nil
+}
+
+func (m *MockCredentialsService) Info(repository string) (*models.RepositoryCredentialsResponse, error) {
+	credentials, ok := m.credentials[repository]
+	if !ok {
+		return nil, services.ErrCredentialsNotFound
+	}
+
+	return credentials, nil
+}
+
+func (m *MockCredentialsService) Delete(repository string) error {
+	if _, ok := m.credentials[repository]; !ok {
+		return services.ErrCredentialsNotFound
+	}
+
+	delete(m.credentials, repository)
+	return nil
+}
+
+func (m *MockCredentialsService) SaveRegistry(dto *models.RegistryCredentialsRequest) error {
+	if dto.RepositoryUrl == "" || dto.Registry == "" || dto.Username == "" || dto.Password == "" {
+		return services.ErrInvalidCredentials
+	}
+
+	m.registries[[2]string{dto.RepositoryUrl, dto.Registry}] = &models.RegistryCredentialsResponse{
+		RepositoryUrl: dto.RepositoryUrl,
+		Registry:      dto.Registry,
+		UpdatedAt:     time.Now(),
+	}
+
+	return nil
+}
+
+func (m *MockCredentialsService) RegistryInfo(repository, registry string) (*models.RegistryCredentialsResponse, error) {
+	credentials, ok := m.registries[[2]string{repository, registry}]
+	if !ok {
+		return nil, services.ErrCredentialsNotFound
+	}
+
+	return credentials, nil
+}
+
+func (m *MockCredentialsService) DeleteRegistry(repository, registry string) error {
+	if _, ok := m.registries[[2]string{repository, registry}]; !ok {
+		return services.ErrCredentialsNotFound
+	}
+
+	delete(m.registries, [2]string{repository, registry})
+	return nil
+}
+
+type ErrorMockCredentialsService struct{}
+
+func NewErrorMockCredentialsService() *ErrorMockCredentialsService {
+	return &ErrorMockCredentialsService{}
+}
+
+func (m ErrorMockCredentialsService) Save(dto *models.RepositoryCredentialsRequest) error {
+	return errors.New("mock error")
+}
+
+func (m ErrorMockCredentialsService) Info(repository string) (*models.RepositoryCredentialsResponse, error) {
+	return nil, errors.New("mock error")
+}
+
+func (m ErrorMockCredentialsService) Delete(repository string) error {
+	return errors.New("mock error")
+}
+
+func (m ErrorMockCredentialsService) SaveRegistry(dto *models.RegistryCredentialsRequest) error {
+	return errors.New("mock error")
+}
+
+func (m ErrorMockCredentialsService) RegistryInfo(repository, registry string) (*models.RegistryCredentialsResponse, error) {
+	return nil, errors.New("mock error")
+}
+
+func (m ErrorMockCredentialsService) DeleteRegistry(repository, registry string) error {
+	return errors.New("mock error")
+}
@@ -1,23 +1,37 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"io"
 	"log/slog"
 	"net/http"
+	"pipecraft/internal/jobs"
 	"pipecraft/internal/logger"
 	"pipecraft/internal/models"
 	"pipecraft/internal/services"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
 )
 
 type PipelineService interface {
 	Run(dto *models.RunPipelineRequest) (*models.RunPipelineResponse, error)
+	Rerun(id int64, failedOnly bool, triggeredBy string) (*models.RunPipelineResponse, error)
+	List(dto *models.ListPipelinesRequest) (*models.PipelinesListResponse, error)
+	Queue() (*models.QueueResponse, error)
+	Get(id int64) (*models.PipelineDetailsResponse, error)
 	GetStatus(id int64) (*models.PipelineStatusResponse, error)
 	GetLogs(id int64) (*models.PipelineLogsResponse, error)
+	GetDiagnostics(id int64) (*models.LintResponse, error)
+	GetConfig(id int64) (*models.PipelineConfigResponse, error)
+	Approve(id int64, jobName string, dto *models.ApprovalRequest) error
+	Reject(id int64, jobName string, dto *models.ApprovalRequest) error
+	ListApprovals(id int64) (*models.ApprovalsListResponse, error)
+	Lint(data []byte) *models.LintResponse
 }
 
 type RedisService interface {
@@ -27,13 +41,76 @@ type RedisService interface {
 	GetPipelineLogs(id int64) string
 }
 
+type CredentialsService interface {
+	Save(dto *models.RepositoryCredentialsRequest) error
+	Info(repository string) (*models.RepositoryCredentialsResponse, error)
+	Delete(repository string) error
+	SaveRegistry(dto *models.RegistryCredentialsRequest) error
+	RegistryInfo(repository, registry string) (*models.RegistryCredentialsResponse, error)
+	DeleteRegistry(repository, registry string) error
+}
+
+type SettingsService interface {
+	Save(dto *models.RepositorySettingsRequest) error
+	Get(repository string) (*models.RepositorySettingsResponse, error)
+}
+
+type ScheduleService interface {
+	Create(dto *models.ScheduleRequest) (*models.ScheduleResponse, error)
+	Update(id int64, dto *models.ScheduleRequest) (*models.ScheduleResponse, error)
+	Get(id int64) (*models.ScheduleResponse, error)
+	List(repository string) (*models.SchedulesListResponse, error)
+	Delete(id int64) error
+}
+
+type PoolService interface {
+	Get() *models.PoolResponse
+	Update(dto *models.PoolRequest) (*models.PoolResponse, error)
+}
+
+type RunnerService interface {
+	Register(dto *models.RegisterRunnerRequest) (*models.RegisterRunnerResponse, error)
+	Authenticate(token string) (int64, error)
+	Heartbeat(runnerId int64) error
+	RequestPipeline(ctx context.Context, runnerId int64) (*models.RunnerPipelineResponse, error)
+	Call(runnerId, pipelineId int64, dto *models.RunnerCallRequest) (*models.RunnerCallResponse, error)
+}
+
+type ReaperService interface {
+	Orphans(ctx context.Context) (*models.OrphansResponse, error)
+}
+
 type Handlers struct {
-	PipelineService PipelineService
-	RedisService    RedisService
+	PipelineService    PipelineService
+	RedisService       RedisService
+	CredentialsService CredentialsService
+	SettingsService    SettingsService
+	ScheduleService    ScheduleService
+	PoolService        PoolService
+	RunnerService      RunnerService
+	ReaperService      ReaperService
 }
 
-func New(redisService RedisService, pipelineService PipelineService) *Handlers {
-	return &Handlers{PipelineService: pipelineService, RedisService: redisService}
+func New(
+	redisService RedisService,
+	pipelineService PipelineService,
+	credentialsService CredentialsService,
+	settingsService SettingsService,
+	scheduleService ScheduleService,
+	poolService PoolService,
+	runnerService RunnerService,
+	reaperService ReaperService,
+) *Handlers {
+	return &Handlers{
+		PipelineService:    pipelineService,
+		RedisService:       redisService,
+		CredentialsService: credentialsService,
+		SettingsService:    settingsService,
+		ScheduleService:    scheduleService,
+		PoolService:        poolService,
+		RunnerService:      runnerService,
+		ReaperService:      reaperService,
+	}
 }
 
 func (h *Handlers) RunPipeline(w http.ResponseWriter, r *http.Request) {
@@ -64,6 +141,18 @@ func (h *Handlers) RunPipeline(w http.ResponseWriter, r *http.Request) {
 			writeJson(responseDto, w, http.StatusOK)
 			return
 		}
+		if errors.Is(err, services.ErrInvalidCheckout) || errors.Is(err, services.ErrInvalidRef) ||
+			errors.Is(err, services.ErrInvalidInputs) || errors.Is(err, services.ErrInvalidPriority) ||
+			errors.Is(err, services.ErrInvalidConfig) {
+			errorResponse := models.ErrorResponse{Error: err.Error()}
+			writeJson(errorResponse, w, http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, services.ErrRefNotFound) {
+			errorResponse := models.ErrorResponse{Error: "ref doesn't exist in repository"}
+			writeJson(errorResponse, w, http.StatusUnprocessableEntity)
+			return
+		}
 		slog.Error("error while running pipeline", logger.Err(err))
 		w.WriteHeader(http.StatusInternalServerError)
 		return
@@ -73,6 +162,107 @@ func (h *Handlers) RunPipeline(w http.ResponseWriter, r *http.Request) {
 	writeJson(responseDto, w, http.StatusCreated) //NOTE: means that pipeline doesn't exist
 }
 
+func (h *Handlers) RerunPipeline(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	params := mux.Vars(r)
+	strPipelineId, ok := params["id"]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	pipelineId, err := strconv.ParseInt(strPipelineId, 10, 64)
+	if err != nil {
+		slog.Error("error while parsing pipelineId to int", logger.Err(err))
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	failedOnly := false
+	if strFailedOnly := r.URL.Query().Get("failed_only"); strFailedOnly != "" {
+		failedOnly, err = strconv.ParseBool(strFailedOnly)
+		if err != nil {
+			errorResponse := models.ErrorResponse{Error: "invalid failed_only value"}
+			writeJson(errorResponse, w, http.StatusBadRequest)
+			return
+		}
+	}
+
+	triggeredBy := r.URL.Query().Get("triggered_by")
+
+	responseDto, err := h.PipelineService.Rerun(pipelineId, failedOnly, triggeredBy)
+	if err != nil {
+		if errors.Is(err, services.ErrNotFound) {
+			errorResponseDto := models.ErrorResponse{Error: "pipeline with such id doesn't exist"}
+			writeJson(errorResponseDto, w, http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, services.ErrNotFinished) {
+			errorResponseDto := models.ErrorResponse{Error: "pipeline is still waiting or running"}
+			writeJson(errorResponseDto, w, http.StatusConflict)
+			return
+		}
+		slog.Error("error while rerunning pipeline", logger.Err(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeJson(responseDto, w, http.StatusCreated)
+}
+
+func (h *Handlers) ListPipelines(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	dto := models.ListPipelinesRequest{
+		RepositoryUrl: query.Get("repository_url"),
+		RefType:       query.Get("ref_type"),
+		Status:        query.Get("status"),
+	}
+
+	if strLimit := query.Get("limit"); strLimit != "" {
+		limit, err := strconv.Atoi(strLimit)
+		if err != nil {
+			errorResponse := models.ErrorResponse{Error: "invalid limit value"}
+			writeJson(errorResponse, w, http.StatusBadRequest)
+			return
+		}
+		dto.Limit = limit
+	}
+
+	responseDto, err := h.PipelineService.List(&dto)
+	if err != nil {
+		slog.Error("error while listing pipelines", logger.Err(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeJson(responseDto, w, http.StatusOK)
+}
+
+func (h *Handlers) Queue(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	responseDto, err := h.PipelineService.Queue()
+	if err != nil {
+		slog.Error("error while getting queue", logger.Err(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeJson(responseDto, w, http.StatusOK)
+}
+
 func (h *Handlers) PipelineStatus(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "GET" {
 		w.WriteHeader(http.StatusMethodNotAllowed)
@@ -178,15 +368,799 @@ func (h *Handlers) PipelineLogs(w http.ResponseWriter, r *http.Request) {
 	w.Write(response)
 }
 
-func writeJson(v any, w http.ResponseWriter, status int) {
-	response, err := json.Marshal(v)
+func (h *Handlers) PipelineDiagnostics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	params := mux.Vars(r)
+	strPipelineId, ok := params["id"]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	pipelineId, err := strconv.ParseInt(strPipelineId, 10, 64)
 	if err != nil {
-		slog.Error("error while marshaling json", logger.Err(err))
+		slog.Error("error while parsing pipelineId to int", logger.Err(err))
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	diagnosticsDto, err := h.PipelineService.GetDiagnostics(pipelineId)
+	if err != nil {
+		if errors.Is(err, services.ErrNotFound) {
+			errorResponseDto := models.ErrorResponse{Error: "pipeline with such id doesn't exist"}
+			writeJson(errorResponseDto, w, http.StatusNotFound)
+			return
+		}
+		slog.Error("error while getting pipeline diagnostics", logger.Err(err))
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(status)
-	w.Write(response)
+	writeJson(diagnosticsDto, w, http.StatusOK)
+}
+
+func (h *Handlers) Pipeline(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	params := mux.Vars(r)
+	strPipelineId, ok := params["id"]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	pipelineId, err := strconv.ParseInt(strPipelineId, 10, 64)
+	if err != nil {
+		slog.Error("error while parsing pipelineId to int", logger.Err(err))
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	pipelineDto, err := h.PipelineService.Get(pipelineId)
+	if err != nil {
+		if errors.Is(err, services.ErrNotFound) {
+			errorResponseDto := models.ErrorResponse{Error: "pipeline with such id doesn't exist"}
+			writeJson(errorResponseDto, w, http.StatusNotFound)
+			return
+		}
+		slog.Error("error while getting pipeline", logger.Err(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeJson(pipelineDto, w, http.StatusOK)
+}
+
+func (h *Handlers) PipelineConfig(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	params := mux.Vars(r)
+	strPipelineId, ok := params["id"]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	pipelineId, err := strconv.ParseInt(strPipelineId, 10, 64)
+	if err != nil {
+		slog.Error("error while parsing pipelineId to int", logger.Err(err))
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	configDto, err := h.PipelineService.GetConfig(pipelineId)
+	if err != nil {
+		if errors.Is(err, services.ErrNotFound) {
+			errorResponseDto := models.ErrorResponse{Error: "pipeline with such id doesn't exist"}
+			writeJson(errorResponseDto, w, http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, services.ErrConfigNotRead) {
+			errorResponseDto := models.ErrorResponse{Error: "ci config of pipeline is not read yet"}
+			writeJson(errorResponseDto, w, http.StatusNotFound)
+			return
+		}
+		slog.Error("error while getting pipeline config", logger.Err(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeJson(configDto, w, http.StatusOK)
+}
+
+func (h *Handlers) ApproveJob(w http.ResponseWriter, r *http.Request) {
+	h.decideApproval(w, r, h.PipelineService.Approve)
+}
+
+func (h *Handlers) RejectJob(w http.ResponseWriter, r *http.Request) {
+	h.decideApproval(w, r, h.PipelineService.Reject)
+}
+
+func (h *Handlers) decideApproval(w http.ResponseWriter, r *http.Request, decide func(int64, string, *models.ApprovalRequest) error) {
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	params := mux.Vars(r)
+	strPipelineId, ok := params["id"]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	jobName, ok := params["job"]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	pipelineId, err := strconv.ParseInt(strPipelineId, 10, 64)
+	if err != nil {
+		slog.Error("error while parsing pipelineId to int", logger.Err(err))
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	jsonData, err := io.ReadAll(r.Body)
+	if err != nil {
+		slog.Error("error while reading json", logger.Err(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	var dto models.ApprovalRequest
+	err = json.Unmarshal(jsonData, &dto)
+	if err != nil {
+		errorResponse := models.ErrorResponse{Error: "invalid json"}
+		writeJson(errorResponse, w, http.StatusBadRequest)
+		return
+	}
+
+	err = decide(pipelineId, jobName, &dto)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidApproval) {
+			errorResponse := models.ErrorResponse{Error: err.Error()}
+			writeJson(errorResponse, w, http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, services.ErrApprovalNotFound) {
+			errorResponse := models.ErrorResponse{Error: "job of pipeline is not waiting for approval"}
+			writeJson(errorResponse, w, http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, services.ErrApprovalDecided) {
+			errorResponse := models.ErrorResponse{Error: "approval is already decided"}
+			writeJson(errorResponse, w, http.StatusConflict)
+			return
+		}
+		slog.Error("error while deciding approval", logger.Err(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handlers) PipelineApprovals(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	params := mux.Vars(r)
+	strPipelineId, ok := params["id"]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	pipelineId, err := strconv.ParseInt(strPipelineId, 10, 64)
+	if err != nil {
+		slog.Error("error while parsing pipelineId to int", logger.Err(err))
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	approvalsDto, err := h.PipelineService.ListApprovals(pipelineId)
+	if err != nil {
+		if errors.Is(err, services.ErrNotFound) {
+			errorResponseDto := models.ErrorResponse{Error: "pipeline with such id doesn't exist"}
+			writeJson(errorResponseDto, w, http.StatusNotFound)
+			return
+		}
+		slog.Error("error while listing pipeline approvals", logger.Err(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeJson(approvalsDto, w, http.StatusOK)
+}
+
+func (h *Handlers) Lint(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		slog.Error("error while reading config", logger.Err(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeJson(h.PipelineService.Lint(data), w, http.StatusOK)
+}
+
+func (h *Handlers) Schema(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	writeJson(jobs.Schema(), w, http.StatusOK)
+}
+
+func (h *Handlers) RepositoryCredentials(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "PUT":
+		jsonData, err := io.ReadAll(r.Body)
+		if err != nil {
+			slog.Error("error while reading json", logger.Err(err))
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		var dto models.RepositoryCredentialsRequest
+		err = json.Unmarshal(jsonData, &dto)
+		if err != nil {
+			errorResponse := models.ErrorResponse{Error: "invalid json"}
+			writeJson(errorResponse, w, http.StatusBadRequest)
+			return
+		}
+
+		err = h.CredentialsService.Save(&dto)
+		if err != nil {
+			if errors.Is(err, services.ErrInvalidCredentials) {
+				errorResponse := models.ErrorResponse{Error: err.Error()}
+				writeJson(errorResponse, w, http.StatusBadRequest)
+				return
+			}
+			if errors.Is(err, services.ErrEncryptionDisabled) {
+				errorResponse := models.ErrorResponse{Error: err.Error()}
+				writeJson(errorResponse, w, http.StatusServiceUnavailable)
+				return
+			}
+			slog.Error("error while saving credentials", logger.Err(err))
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	case "GET":
+		infoDto, err := h.CredentialsService.Info(r.URL.Query().Get("repository_url"))
+		if err != nil {
+			if errors.Is(err, services.ErrCredentialsNotFound) {
+				errorResponse := models.ErrorResponse{Error: "repository has no credentials"}
+				writeJson(errorResponse, w, http.StatusNotFound)
+				return
+			}
+			slog.Error("error while getting credentials", logger.Err(err))
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		writeJson(infoDto, w, http.StatusOK)
+	case "DELETE":
+		err := h.CredentialsService.Delete(r.URL.Query().Get("repository_url"))
+		if err != nil {
+			if errors.Is(err, services.ErrCredentialsNotFound) {
+				errorResponse := models.ErrorResponse{Error: "repository has no credentials"}
+				writeJson(errorResponse, w, http.StatusNotFound)
+				return
+			}
+			slog.Error("error while deleting credentials", logger.Err(err))
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *Handlers) RegistryCredentials(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "PUT":
+		jsonData, err := io.ReadAll(r.Body)
+		if err != nil {
+			slog.Error("error while reading json", logger.Err(err))
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		var dto models.RegistryCredentialsRequest
+		err = json.Unmarshal(jsonData, &dto)
+		if err != nil {
+			errorResponse := models.ErrorResponse{Error: "invalid json"}
+			writeJson(errorResponse, w, http.StatusBadRequest)
+			return
+		}
+
+		err = h.CredentialsService.SaveRegistry(&dto)
+		if err != nil {
+			if errors.Is(err, services.ErrInvalidCredentials) {
+				errorResponse := models.ErrorResponse{Error: err.Error()}
+				writeJson(errorResponse, w, http.StatusBadRequest)
+				return
+			}
+			if errors.Is(err, services.ErrEncryptionDisabled) {
+				errorResponse := models.ErrorResponse{Error: err.Error()}
+				writeJson(errorResponse, w, http.StatusServiceUnavailable)
+				return
+			}
+			slog.Error("error while saving registry credentials", logger.Err(err))
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	case "GET":
+		infoDto, err := h.CredentialsService.RegistryInfo(r.URL.Query().Get("repository_url"), r.URL.Query().Get("registry"))
+		if err != nil {
+			if errors.Is(err, services.ErrCredentialsNotFound) {
+				errorResponse := models.ErrorResponse{Error: "repository has no credentials of registry"}
+				writeJson(errorResponse, w, http.StatusNotFound)
+				return
+			}
+			slog.Error("error while getting registry credentials", logger.Err(err))
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		writeJson(infoDto, w, http.StatusOK)
+	case "DELETE":
+		err := h.CredentialsService.DeleteRegistry(r.URL.Query().Get("repository_url"), r.URL.Query().Get("registry"))
+		if err != nil {
+			if errors.Is(err, services.ErrCredentialsNotFound) {
+				errorResponse := models.ErrorResponse{Error: "repository has no credentials of registry"}
+				writeJson(errorResponse, w, http.StatusNotFound)
+				return
+			}
+			slog.Error("error while deleting registry credentials", logger.Err(err))
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *Handlers) RepositorySettings(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "PUT":
+		jsonData, err := io.ReadAll(r.Body)
+		if err != nil {
+			slog.Error("error while reading json", logger.Err(err))
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		var dto models.RepositorySettingsRequest
+		err = json.Unmarshal(jsonData, &dto)
+		if err != nil {
+			errorResponse := models.ErrorResponse{Error: "invalid json"}
+			writeJson(errorResponse, w, http.StatusBadRequest)
+			return
+		}
+
+		err = h.SettingsService.Save(&dto)
+		if err != nil {
+			if errors.Is(err, services.ErrInvalidConfigPath) || errors.Is(err, services.ErrInvalidSettings) {
+				errorResponse := models.ErrorResponse{Error: err.Error()}
+				writeJson(errorResponse, w, http.StatusBadRequest)
+				return
+			}
+			slog.Error("error while saving repository settings", logger.Err(err))
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	case "GET":
+		settingsDto, err := h.SettingsService.Get(r.URL.Query().Get("repository_url"))
+		if err != nil {
+			if errors.Is(err, services.ErrSettingsNotFound) {
+				errorResponse := models.ErrorResponse{Error: "repository has no settings"}
+				writeJson(errorResponse, w, http.StatusNotFound)
+				return
+			}
+			slog.Error("error while getting repository settings", logger.Err(err))
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		writeJson(settingsDto, w, http.StatusOK)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *Handlers) Schedules(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "POST":
+		dto, ok := readScheduleRequest(w, r)
+		if !ok {
+			return
+		}
+
+		scheduleDto, err := h.ScheduleService.Create(dto)
+		if err != nil {
+			if errors.Is(err, services.ErrInvalidSchedule) {
+				errorResponse := models.ErrorResponse{Error: err.Error()}
+				writeJson(errorResponse, w, http.StatusBadRequest)
+				return
+			}
+			slog.Error("error while creating schedule", logger.Err(err))
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		writeJson(scheduleDto, w, http.StatusCreated)
+	case "GET":
+		schedulesDto, err := h.ScheduleService.List(r.URL.Query().Get("repository_url"))
+		if err != nil {
+			slog.Error("error while listing schedules", logger.Err(err))
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		writeJson(schedulesDto, w, http.StatusOK)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *Handlers) Schedule(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	strScheduleId, ok := params["id"]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	scheduleId, err := strconv.ParseInt(strScheduleId, 10, 64)
+	if err != nil {
+		slog.Error("error while parsing scheduleId to int", logger.Err(err))
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var scheduleDto *models.ScheduleResponse
+	switch r.Method {
+	case "GET":
+		scheduleDto, err = h.ScheduleService.Get(scheduleId)
+	case "PUT":
+		dto, ok := readScheduleRequest(w, r)
+		if !ok {
+			return
+		}
+		scheduleDto, err = h.ScheduleService.Update(scheduleId, dto)
+	case "DELETE":
+		err = h.ScheduleService.Delete(scheduleId)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err != nil {
+		if errors.Is(err, services.ErrScheduleNotFound) {
+			errorResponse := models.ErrorResponse{Error: "schedule with such id doesn't exist"}
+			writeJson(errorResponse, w, http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, services.ErrInvalidSchedule) {
+			errorResponse := models.ErrorResponse{Error: err.Error()}
+			writeJson(errorResponse, w, http.StatusBadRequest)
+			return
+		}
+		slog.Error("error while handling schedule", logger.Err(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if scheduleDto == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	writeJson(scheduleDto, w, http.StatusOK)
+}
+
+func readScheduleRequest(w http.ResponseWriter, r *http.Request) (*models.ScheduleRequest, bool) {
+	jsonData, err := io.ReadAll(r.Body)
+	if err != nil {
+		slog.Error("error while reading json", logger.Err(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return nil, false
+	}
+
+	var dto models.ScheduleRequest
+	err = json.Unmarshal(jsonData, &dto)
+	if err != nil {
+		errorResponse := models.ErrorResponse{Error: "invalid json"}
+		writeJson(errorResponse, w, http.StatusBadRequest)
+		return nil, false
+	}
+
+	return &dto, true
+}
+
+func writeJson(v any, w http.ResponseWriter, status int) {
+	response, err := json.Marshal(v)
+	if err != nil {
+		slog.Error("error while marshaling json", logger.Err(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(response)
+}
+
+func (h *Handlers) Pool(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		writeJson(h.PoolService.Get(), w, http.StatusOK)
+	case "PUT":
+		jsonData, err := io.ReadAll(r.Body)
+		if err != nil {
+			slog.Error("error while reading json", logger.Err(err))
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		var dto models.PoolRequest
+		err = json.Unmarshal(jsonData, &dto)
+		if err != nil {
+			errorResponse := models.ErrorResponse{Error: "invalid json"}
+			writeJson(errorResponse, w, http.StatusBadRequest)
+			return
+		}
+
+		poolDto, err := h.PoolService.Update(&dto)
+		if err != nil {
+			if errors.Is(err, services.ErrInvalidPoolSize) {
+				errorResponse := models.ErrorResponse{Error: err.Error()}
+				writeJson(errorResponse, w, http.StatusBadRequest)
+				return
+			}
+			slog.Error("error while updating worker pool", logger.Err(err))
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		slog.Info("worker pool is updated", slog.Int("size", poolDto.Size), slog.Bool("paused", poolDto.Paused))
+		writeJson(poolDto, w, http.StatusOK)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// Orphans lists containers, networks and volumes which reaper would remove, it doesn't remove them.
+func (h *Handlers) Orphans(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	orphans, err := h.ReaperService.Orphans(r.Context())
+	if err != nil {
+		if errors.Is(err, services.ErrReaperDisabled) {
+			errorResponse := models.ErrorResponse{Error: err.Error()}
+			writeJson(errorResponse, w, http.StatusNotFound)
+			return
+		}
+		slog.Error("error while listing orphans", logger.Err(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeJson(orphans, w, http.StatusOK)
+}
+
+func (h *Handlers) RegisterRunner(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	jsonData, err := io.ReadAll(r.Body)
+	if err != nil {
+		slog.Error("error while reading json", logger.Err(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	var dto models.RegisterRunnerRequest
+	err = json.Unmarshal(jsonData, &dto)
+	if err != nil {
+		errorResponse := models.ErrorResponse{Error: "invalid json"}
+		writeJson(errorResponse, w, http.StatusBadRequest)
+		return
+	}
+
+	runnerDto, err := h.RunnerService.Register(&dto)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrRunnersDisabled):
+			errorResponse := models.ErrorResponse{Error: err.Error()}
+			writeJson(errorResponse, w, http.StatusNotFound)
+		case errors.Is(err, services.ErrInvalidRunnerToken):
+			errorResponse := models.ErrorResponse{Error: err.Error()}
+			writeJson(errorResponse, w, http.StatusForbidden)
+		case errors.Is(err, services.ErrInvalidRunner):
+			errorResponse := models.ErrorResponse{Error: err.Error()}
+			writeJson(errorResponse, w, http.StatusBadRequest)
+		default:
+			slog.Error("error while registering runner", logger.Err(err))
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+
+	slog.Info("runner is registered", slog.Int64("runner_id", runnerDto.RunnerId), slog.String("name", dto.Name))
+	writeJson(runnerDto, w, http.StatusCreated)
+}
+
+func (h *Handlers) RunnerHeartbeat(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	runnerId, ok := h.authenticateRunner(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.RunnerService.Heartbeat(runnerId); err != nil {
+		if errors.Is(err, services.ErrInvalidRunnerToken) {
+			errorResponse := models.ErrorResponse{Error: err.Error()}
+			writeJson(errorResponse, w, http.StatusUnauthorized)
+			return
+		}
+		slog.Error("error while updating heartbeat of runner", logger.Err(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RequestRunnerPipeline is long polled by runner, it responds with no content when there is nothing to run.
+func (h *Handlers) RequestRunnerPipeline(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	runnerId, ok := h.authenticateRunner(w, r)
+	if !ok {
+		return
+	}
+
+	// NOTE: write timeout of server is shorter than poll timeout, so it is lifted for this request
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	pipelineDto, err := h.RunnerService.RequestPipeline(r.Context(), runnerId)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrNoPipeline):
+			w.WriteHeader(http.StatusNoContent)
+		case errors.Is(err, context.Canceled):
+		case errors.Is(err, services.ErrInvalidRunnerToken):
+			errorResponse := models.ErrorResponse{Error: err.Error()}
+			writeJson(errorResponse, w, http.StatusUnauthorized)
+		default:
+			slog.Error("error while claiming pipeline for runner", logger.Err(err))
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+
+	slog.Debug("pipeline is given to runner", slog.Int64("runner_id", runnerId), slog.Int64("pipeline_id", pipelineDto.PipelineId))
+	writeJson(pipelineDto, w, http.StatusOK)
+}
+
+func (h *Handlers) RunnerCall(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	runnerId, ok := h.authenticateRunner(w, r)
+	if !ok {
+		return
+	}
+
+	params := mux.Vars(r)
+	pipelineId, err := strconv.ParseInt(params["id"], 10, 64)
+	if err != nil {
+		slog.Error("error while parsing pipelineId to int", logger.Err(err))
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	jsonData, err := io.ReadAll(r.Body)
+	if err != nil {
+		slog.Error("error while reading json", logger.Err(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	var dto models.RunnerCallRequest
+	err = json.Unmarshal(jsonData, &dto)
+	if err != nil {
+		errorResponse := models.ErrorResponse{Error: "invalid json"}
+		writeJson(errorResponse, w, http.StatusBadRequest)
+		return
+	}
+
+	callDto, err := h.RunnerService.Call(runnerId, pipelineId, &dto)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrNotFound):
+			errorResponse := models.ErrorResponse{Error: "pipeline with such id doesn't exist"}
+			writeJson(errorResponse, w, http.StatusNotFound)
+		case errors.Is(err, services.ErrPipelineNotAssigned):
+			errorResponse := models.ErrorResponse{Error: err.Error()}
+			writeJson(errorResponse, w, http.StatusForbidden)
+		case errors.Is(err, services.ErrInvalidRunnerCall):
+			errorResponse := models.ErrorResponse{Error: err.Error()}
+			writeJson(errorResponse, w, http.StatusBadRequest)
+		default:
+			slog.Error("error while running call of runner", logger.Err(err))
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+
+	writeJson(callDto, w, http.StatusOK)
+}
+
+// authenticateRunner returns id of runner by bearer token of request, response is written when it fails.
+func (h *Handlers) authenticateRunner(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+	runnerId, err := h.RunnerService.Authenticate(token)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrRunnersDisabled):
+			errorResponse := models.ErrorResponse{Error: err.Error()}
+			writeJson(errorResponse, w, http.StatusNotFound)
+		case errors.Is(err, services.ErrInvalidRunnerToken):
+			errorResponse := models.ErrorResponse{Error: err.Error()}
+			writeJson(errorResponse, w, http.StatusUnauthorized)
+		default:
+			slog.Error("error while authenticating runner", logger.Err(err))
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return 0, false
+	}
+
+	return runnerId, true
 }
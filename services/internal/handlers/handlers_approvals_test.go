@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"pipecraft/internal/models"
+	"pipecraft/internal/storage"
+	"strconv"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+)
+
+func newApprovalRequest(method string, pipelineId int64, job, action, user string) *http.Request {
+	body, _ := json.Marshal(models.ApprovalRequest{User: user})
+	req, _ := http.NewRequest(method, fmt.Sprintf("/pipeline/%d/jobs/%s/%s", pipelineId, job, action), bytes.NewReader(body))
+	return mux.SetURLVars(req, map[string]string{"id": strconv.Itoa(int(pipelineId)), "job": job})
+}
+
+func TestHandlers_ApproveJob_HappyPath(t *testing.T) {
+	suite, pipelineId := NewSuiteWithPipeline()
+	pipelineService := suite.handlers.PipelineService.(*MockPipelineService)
+	pipelineService.approvals[pipelineId] = map[string]*storage.ApprovalsTable{
+		"deploy": {PipelineId: pipelineId, JobName: "deploy", Status: storage.APPROVAL_STATUS_PENDING},
+	}
+
+	rr := httptest.NewRecorder()
+	suite.handlers.ApproveJob(rr, newApprovalRequest(http.MethodPost, pipelineId, "deploy", "approve", "alice"))
+	require.Equal(t, http.StatusNoContent, rr.Code)
+
+	rr = httptest.NewRecorder()
+	suite.handlers.RejectJob(rr, newApprovalRequest(http.MethodPost, pipelineId, "deploy", "reject", "bob"))
+	require.Equal(t, http.StatusConflict, rr.Code)
+
+	req, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("/pipeline/%d/approvals", pipelineId), nil)
+	req = mux.SetURLVars(req, map[string]string{"id": strconv.Itoa(int(pipelineId))})
+	rr = httptest.NewRecorder()
+	suite.handlers.PipelineApprovals(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	var response models.ApprovalsListResponse
+	err := json.Unmarshal(rr.Body.Bytes(), &response)
+	require.NoError(t, err)
+	require.Len(t, response.Approvals, 1)
+	require.Equal(t, storage.APPROVAL_STATUS_APPROVED, response.Approvals[0].Status)
+	require.Equal(t, "alice", response.Approvals[0].DecidedBy)
+}
+
+func TestHandlers_ApproveJob_Errors(t *testing.T) {
+	suite, pipelineId := NewSuiteWithPipeline()
+
+	rr := httptest.NewRecorder()
+	suite.handlers.ApproveJob(rr, newApprovalRequest(http.MethodGet, pipelineId, "deploy", "approve", "alice"))
+	require.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+
+	rr = httptest.NewRecorder()
+	suite.handlers.ApproveJob(rr, newApprovalRequest(http.MethodPost, pipelineId, "deploy", "approve", ""))
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+
+	rr = httptest.NewRecorder()
+	suite.handlers.RejectJob(rr, newApprovalRequest(http.MethodPost, pipelineId, "deploy", "reject", "alice"))
+	require.Equal(t, http.StatusNotFound, rr.Code)
+
+	req, _ := http.NewRequest(http.MethodPost, "/pipeline/smth/jobs/deploy/approve", bytes.NewReader([]byte(`{"user":"alice"}`)))
+	req = mux.SetURLVars(req, map[string]string{"id": "smth", "job": "deploy"})
+	rr = httptest.NewRecorder()
+	suite.handlers.ApproveJob(rr, req)
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+
+	req, _ = http.NewRequest(http.MethodGet, "/pipeline/100/approvals", nil)
+	req = mux.SetURLVars(req, map[string]string{"id": "100"})
+	rr = httptest.NewRecorder()
+	suite.handlers.PipelineApprovals(rr, req)
+	require.Equal(t, http.StatusNotFound, rr.Code)
+
+	handlers := New(NewMockRedisServie(), NewErrorMockPipelineService(), NewMockCredentialsService(), NewMockSettingsService(), NewMockScheduleService(), NewMockPoolService(), NewMockRunnerService(), NewMockReaperService())
+	rr = httptest.NewRecorder()
+	handlers.ApproveJob(rr, newApprovalRequest(http.MethodPost, 1, "deploy", "approve", "alice"))
+	require.Equal(t, http.StatusInternalServerError, rr.Code)
+}
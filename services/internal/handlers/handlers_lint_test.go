@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"pipecraft/internal/models"
+	"strconv"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandlers_Lint_HappyPath(t *testing.T) {
+	suite := NewSuite()
+
+	config := []byte("jobs:\n  build:\n    steps:\n      - name: build\n        run: make\n")
+	req, _ := http.NewRequest(http.MethodPost, "/lint", bytes.NewReader(config))
+	rr := httptest.NewRecorder()
+
+	suite.handlers.Lint(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	var response models.LintResponse
+	err := json.Unmarshal(rr.Body.Bytes(), &response)
+	require.NoError(t, err)
+	require.True(t, response.Valid)
+	require.Empty(t, response.Diagnostics)
+}
+
+func TestHandlers_Lint_Invalid(t *testing.T) {
+	suite := NewSuite()
+
+	req, _ := http.NewRequest(http.MethodGet, "/lint", nil)
+	rr := httptest.NewRecorder()
+	suite.handlers.Lint(rr, req)
+	require.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+
+	config := []byte("jobs:\n  build:\n    steps:\n      - name: build\n")
+	req, _ = http.NewRequest(http.MethodPost, "/lint", bytes.NewReader(config))
+	rr = httptest.NewRecorder()
+
+	suite.handlers.Lint(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	var response models.LintResponse
+	err := json.Unmarshal(rr.Body.Bytes(), &response)
+	require.NoError(t, err)
+	require.False(t, response.Valid)
+	require.Len(t, response.Diagnostics, 1)
+	require.Equal(t, 4, response.Diagnostics[0].Line)
+	require.Equal(t, "error", response.Diagnostics[0].Severity)
+}
+
+func TestHandlers_PipelineDiagnostics(t *testing.T) {
+	suite, pipelineId := NewSuiteWithPipeline()
+
+	req, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("/pipeline/%d/diagnostics", pipelineId), nil)
+	req = mux.SetURLVars(req, map[string]string{"id": strconv.Itoa(int(pipelineId))})
+	rr := httptest.NewRecorder()
+	suite.handlers.PipelineDiagnostics(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	req, _ = http.NewRequest(http.MethodGet, "/pipeline/100/diagnostics", nil)
+	req = mux.SetURLVars(req, map[string]string{"id": "100"})
+	rr = httptest.NewRecorder()
+	suite.handlers.PipelineDiagnostics(rr, req)
+	require.Equal(t, http.StatusNotFound, rr.Code)
+
+	req, _ = http.NewRequest(http.MethodGet, "/pipeline/smth/diagnostics", nil)
+	req = mux.SetURLVars(req, map[string]string{"id": "smth"})
+	rr = httptest.NewRecorder()
+	suite.handlers.PipelineDiagnostics(rr, req)
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+
+	handlers := New(NewMockRedisServie(), NewErrorMockPipelineService(), NewMockCredentialsService(), NewMockSettingsService(), NewMockScheduleService(), NewMockPoolService(), NewMockRunnerService(), NewMockReaperService())
+	req, _ = http.NewRequest(http.MethodGet, "/pipeline/1/diagnostics", nil)
+	req = mux.SetURLVars(req, map[string]string{"id": "1"})
+	rr = httptest.NewRecorder()
+	handlers.PipelineDiagnostics(rr, req)
+	require.Equal(t, http.StatusInternalServerError, rr.Code)
+}
+
+func TestHandlers_Schema(t *testing.T) {
+	suite := NewSuite()
+
+	req, _ := http.NewRequest(http.MethodGet, "/schema", nil)
+	rr := httptest.NewRecorder()
+	suite.handlers.Schema(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	var schema map[string]any
+	err := json.Unmarshal(rr.Body.Bytes(), &schema)
+	require.NoError(t, err)
+	require.Contains(t, schema, "$schema")
+	require.Contains(t, schema, "properties")
+
+	req, _ = http.NewRequest(http.MethodPost, "/schema", nil)
+	rr = httptest.NewRecorder()
+	suite.handlers.Schema(rr, req)
+	require.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+}
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"pipecraft/internal/models"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandlers_ListPipelines_HappyPath(t *testing.T) {
+	suite, _ := NewSuiteWithPipeline()
+
+	pipeline := models.RunPipelineRequest{
+		RepositoryUrl: "ysayonnar/pipecraft",
+		Ref:           "v1.0.0",
+		RefType:       "tag",
+		Commit:        "e4r3e2",
+	}
+
+	requestBody, _ := json.Marshal(pipeline)
+	req, _ := http.NewRequest(http.MethodPost, "/run-pipeline", bytes.NewReader(requestBody))
+	rr := httptest.NewRecorder()
+	suite.handlers.RunPipeline(rr, req)
+	require.Equal(t, http.StatusCreated, rr.Code)
+
+	req, _ = http.NewRequest(http.MethodGet, "/pipelines?ref_type=tag", nil)
+	rr = httptest.NewRecorder()
+	suite.handlers.ListPipelines(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	var response models.PipelinesListResponse
+	err := json.Unmarshal(rr.Body.Bytes(), &response)
+	require.NoError(t, err)
+	require.Len(t, response.Pipelines, 1)
+	require.Equal(t, "v1.0.0", response.Pipelines[0].Ref)
+}
+
+func TestHandlers_ListPipelines_BadRequest_Error(t *testing.T) {
+	suite := NewSuite()
+
+	req, _ := http.NewRequest(http.MethodPost, "/pipelines", nil)
+	rr := httptest.NewRecorder()
+	suite.handlers.ListPipelines(rr, req)
+	require.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+
+	req, _ = http.NewRequest(http.MethodGet, "/pipelines?limit=smth", nil)
+	rr = httptest.NewRecorder()
+	suite.handlers.ListPipelines(rr, req)
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+
+	handlers := New(NewMockRedisServie(), NewErrorMockPipelineService(), NewMockCredentialsService(), NewMockSettingsService(), NewMockScheduleService(), NewMockPoolService(), NewMockRunnerService(), NewMockReaperService())
+
+	req, _ = http.NewRequest(http.MethodGet, "/pipelines", nil)
+	rr = httptest.NewRecorder()
+	handlers.ListPipelines(rr, req)
+	require.Equal(t, http.StatusInternalServerError, rr.Code)
+}
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"pipecraft/internal/models"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandlers_Orphans_HappyPath(t *testing.T) {
+	suite := NewSuite()
+
+	req, _ := http.NewRequest(http.MethodGet, "/admin/orphans", nil)
+	rr := httptest.NewRecorder()
+	suite.handlers.Orphans(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	var response models.OrphansResponse
+	err := json.Unmarshal(rr.Body.Bytes(), &response)
+	require.NoError(t, err)
+	require.Len(t, response.Orphans, 1)
+	require.Equal(t, "pipeline-1", response.Orphans[0].Name)
+	require.Equal(t, int64(1), response.Orphans[0].PipelineId)
+}
+
+func TestHandlers_Orphans_Error(t *testing.T) {
+	suite := NewSuite()
+
+	req, _ := http.NewRequest(http.MethodDelete, "/admin/orphans", nil)
+	rr := httptest.NewRecorder()
+	suite.handlers.Orphans(rr, req)
+	require.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+
+	handlers := New(NewMockRedisServie(), NewMockPipelineService(), NewMockCredentialsService(), NewMockSettingsService(), NewMockScheduleService(), NewMockPoolService(), NewMockRunnerService(), NewDisabledMockReaperService())
+
+	req, _ = http.NewRequest(http.MethodGet, "/admin/orphans", nil)
+	rr = httptest.NewRecorder()
+	handlers.Orphans(rr, req)
+	require.Equal(t, http.StatusNotFound, rr.Code)
+
+	handlers = New(NewMockRedisServie(), NewMockPipelineService(), NewMockCredentialsService(), NewMockSettingsService(), NewMockScheduleService(), NewMockPoolService(), NewMockRunnerService(), NewErrorMockReaperService())
+
+	req, _ = http.NewRequest(http.MethodGet, "/admin/orphans", nil)
+	rr = httptest.NewRecorder()
+	handlers.Orphans(rr, req)
+	require.Equal(t, http.StatusInternalServerError, rr.Code)
+}
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"pipecraft/internal/models"
+	"strconv"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandlers_PipelineConfig_HappyPath(t *testing.T) {
+	suite, pipelineId := NewSuiteWithPipeline()
+
+	req, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("/pipeline/%d/config", pipelineId), nil)
+	req = mux.SetURLVars(req, map[string]string{"id": strconv.Itoa(int(pipelineId))})
+	rr := httptest.NewRecorder()
+	suite.handlers.PipelineConfig(rr, req)
+	require.Equal(t, http.StatusNotFound, rr.Code)
+
+	pipelineService := suite.handlers.PipelineService.(*MockPipelineService)
+	pipelineService.pipelines[pipelineId].ConfigFile = "ci.yaml"
+	pipelineService.pipelines[pipelineId].Config = "jobs:\n  build:\n    steps:\n      - run: make\n"
+
+	rr = httptest.NewRecorder()
+	suite.handlers.PipelineConfig(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	var response models.PipelineConfigResponse
+	err := json.Unmarshal(rr.Body.Bytes(), &response)
+	require.NoError(t, err)
+	require.Equal(t, "ci.yaml", response.ConfigFile)
+	require.Contains(t, response.Config, "run: make")
+}
+
+func TestHandlers_PipelineConfig_Errors(t *testing.T) {
+	suite := NewSuite()
+
+	req, _ := http.NewRequest(http.MethodPost, "/pipeline/1/config", nil)
+	req = mux.SetURLVars(req, map[string]string{"id": "1"})
+	rr := httptest.NewRecorder()
+	suite.handlers.PipelineConfig(rr, req)
+	require.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+
+	req, _ = http.NewRequest(http.MethodGet, "/pipeline/smth/config", nil)
+	req = mux.SetURLVars(req, map[string]string{"id": "smth"})
+	rr = httptest.NewRecorder()
+	suite.handlers.PipelineConfig(rr, req)
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+
+	req, _ = http.NewRequest(http.MethodGet, "/pipeline/100/config", nil)
+	req = mux.SetURLVars(req, map[string]string{"id": "100"})
+	rr = httptest.NewRecorder()
+	suite.handlers.PipelineConfig(rr, req)
+	require.Equal(t, http.StatusNotFound, rr.Code)
+
+	handlers := New(NewMockRedisServie(), NewErrorMockPipelineService(), NewMockCredentialsService(), NewMockSettingsService(), NewMockScheduleService(), NewMockPoolService(), NewMockRunnerService(), NewMockReaperService())
+	req, _ = http.NewRequest(http.MethodGet, "/pipeline/1/config", nil)
+	req = mux.SetURLVars(req, map[string]string{"id": "1"})
+	rr = httptest.NewRecorder()
+	handlers.PipelineConfig(rr, req)
+	require.Equal(t, http.StatusInternalServerError, rr.Code)
+}
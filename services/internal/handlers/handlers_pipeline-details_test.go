@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"pipecraft/internal/models"
+	"pipecraft/internal/storage"
+	"strconv"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandlers_Pipeline_HappyPath(t *testing.T) {
+	suite, pipelineId := NewSuiteWithPipeline()
+
+	pipelineService := suite.handlers.PipelineService.(*MockPipelineService)
+	child, err := pipelineService.Run(&models.RunPipelineRequest{
+		RepositoryUrl: "ysayonnar/service",
+		Branch:        "main",
+		Commit:        "a1b2c3",
+		Trigger:       storage.TRIGGER_UPSTREAM,
+	})
+	require.NoError(t, err)
+	pipelineService.pipelines[child.PipelineId].ParentPipelineId = pipelineId
+	pipelineService.pipelines[child.PipelineId].ParentJob = "deploy"
+
+	req, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("/pipeline/%d", pipelineId), nil)
+	req = mux.SetURLVars(req, map[string]string{"id": strconv.Itoa(int(pipelineId))})
+	rr := httptest.NewRecorder()
+	suite.handlers.Pipeline(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	var response models.PipelineDetailsResponse
+	err = json.Unmarshal(rr.Body.Bytes(), &response)
+	require.NoError(t, err)
+	require.Equal(t, pipelineId, response.PipelineId)
+	require.Len(t, response.Downstream, 1)
+	require.Equal(t, child.PipelineId, response.Downstream[0].PipelineId)
+	require.Equal(t, "deploy", response.Downstream[0].Job)
+
+	req, _ = http.NewRequest(http.MethodGet, fmt.Sprintf("/pipeline/%d", child.PipelineId), nil)
+	req = mux.SetURLVars(req, map[string]string{"id": strconv.Itoa(int(child.PipelineId))})
+	rr = httptest.NewRecorder()
+	suite.handlers.Pipeline(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	err = json.Unmarshal(rr.Body.Bytes(), &response)
+	require.NoError(t, err)
+	require.Equal(t, pipelineId, response.ParentPipelineId)
+	require.Equal(t, "deploy", response.ParentJob)
+	require.Equal(t, storage.TRIGGER_UPSTREAM, response.Trigger)
+	require.Empty(t, response.Downstream)
+}
+
+func TestHandlers_Pipeline_Errors(t *testing.T) {
+	suite := NewSuite()
+
+	req, _ := http.NewRequest(http.MethodPost, "/pipeline/1", nil)
+	req = mux.SetURLVars(req, map[string]string{"id": "1"})
+	rr := httptest.NewRecorder()
+	suite.handlers.Pipeline(rr, req)
+	require.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+
+	req, _ = http.NewRequest(http.MethodGet, "/pipeline/smth", nil)
+	req = mux.SetURLVars(req, map[string]string{"id": "smth"})
+	rr = httptest.NewRecorder()
+	suite.handlers.Pipeline(rr, req)
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+
+	req, _ = http.NewRequest(http.MethodGet, "/pipeline/100", nil)
+	req = mux.SetURLVars(req, map[string]string{"id": "100"})
+	rr = httptest.NewRecorder()
+	suite.handlers.Pipeline(rr, req)
+	require.Equal(t, http.StatusNotFound, rr.Code)
+
+	handlers := New(NewMockRedisServie(), NewErrorMockPipelineService(), NewMockCredentialsService(), NewMockSettingsService(), NewMockScheduleService(), NewMockPoolService(), NewMockRunnerService(), NewMockReaperService())
+	req, _ = http.NewRequest(http.MethodGet, "/pipeline/1", nil)
+	req = mux.SetURLVars(req, map[string]string{"id": "1"})
+	rr = httptest.NewRecorder()
+	handlers.Pipeline(rr, req)
+	require.Equal(t, http.StatusInternalServerError, rr.Code)
+}
@@ -69,7 +69,7 @@ func TestHandlers_PipelineLogs_CachedResponse(t *testing.T) {
 func TestHandlers_PipelineLogs_PipelineServiceError(t *testing.T) {
 	redisService := NewMockRedisServie()
 	errorPipelineService := NewErrorMockPipelineService()
-	handlers := New(redisService, errorPipelineService)
+	handlers := New(redisService, errorPipelineService, NewMockCredentialsService(), NewMockSettingsService(), NewMockScheduleService(), NewMockPoolService(), NewMockRunnerService(), NewMockReaperService())
 
 	pipelineId := 1
 
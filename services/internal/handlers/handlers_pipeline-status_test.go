@@ -123,7 +123,7 @@ func TestHandlers_PipelineStatus_PipelineService_Error(t *testing.T) {
 
 	redisService := NewMockRedisServie()
 	errorPipelineService := NewErrorMockPipelineService()
-	handlers := New(redisService, errorPipelineService)
+	handlers := New(redisService, errorPipelineService, NewMockCredentialsService(), NewMockSettingsService(), NewMockScheduleService(), NewMockPoolService(), NewMockRunnerService(), NewMockReaperService())
 
 	req, _ = http.NewRequest(http.MethodGet, fmt.Sprintf("/pipeline/%d/status", pipelineId), nil)
 	rr = httptest.NewRecorder()
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"pipecraft/internal/models"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandlers_Pool_HappyPath(t *testing.T) {
+	suite := NewSuite()
+
+	req, _ := http.NewRequest(http.MethodGet, "/admin/pool", nil)
+	rr := httptest.NewRecorder()
+	suite.handlers.Pool(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	var response models.PoolResponse
+	err := json.Unmarshal(rr.Body.Bytes(), &response)
+	require.NoError(t, err)
+	require.Equal(t, 5, response.Size)
+	require.False(t, response.Paused)
+
+	size, paused := 2, true
+	requestBody, _ := json.Marshal(models.PoolRequest{Size: &size, Paused: &paused})
+	req, _ = http.NewRequest(http.MethodPut, "/admin/pool", bytes.NewReader(requestBody))
+	rr = httptest.NewRecorder()
+	suite.handlers.Pool(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	err = json.Unmarshal(rr.Body.Bytes(), &response)
+	require.NoError(t, err)
+	require.Equal(t, 2, response.Size)
+	require.True(t, response.Paused)
+}
+
+func TestHandlers_Pool_BadRequest_Error(t *testing.T) {
+	suite := NewSuite()
+
+	req, _ := http.NewRequest(http.MethodDelete, "/admin/pool", nil)
+	rr := httptest.NewRecorder()
+	suite.handlers.Pool(rr, req)
+	require.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+
+	req, _ = http.NewRequest(http.MethodPut, "/admin/pool", bytes.NewBufferString("size"))
+	rr = httptest.NewRecorder()
+	suite.handlers.Pool(rr, req)
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+
+	size := 0
+	requestBody, _ := json.Marshal(models.PoolRequest{Size: &size})
+	req, _ = http.NewRequest(http.MethodPut, "/admin/pool", bytes.NewReader(requestBody))
+	rr = httptest.NewRecorder()
+	suite.handlers.Pool(rr, req)
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+
+	handlers := New(NewMockRedisServie(), NewMockPipelineService(), NewMockCredentialsService(), NewMockSettingsService(), NewMockScheduleService(), NewErrorMockPoolService(), NewMockRunnerService(), NewMockReaperService())
+
+	size = 3
+	requestBody, _ = json.Marshal(models.PoolRequest{Size: &size})
+	req, _ = http.NewRequest(http.MethodPut, "/admin/pool", bytes.NewReader(requestBody))
+	rr = httptest.NewRecorder()
+	handlers.Pool(rr, req)
+	require.Equal(t, http.StatusInternalServerError, rr.Code)
+}
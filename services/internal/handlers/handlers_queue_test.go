@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"pipecraft/internal/models"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandlers_Queue_HappyPath(t *testing.T) {
+	suite := NewSuite()
+
+	low, high := -10, 10
+	for i, priority := range []*int{&low, nil, &high} {
+		pipeline := models.RunPipelineRequest{
+			RepositoryUrl: "ysayonnar/pipecraft",
+			Branch:        "main",
+			Commit:        string(rune('a' + i)),
+			Priority:      priority,
+		}
+
+		requestBody, _ := json.Marshal(pipeline)
+		req, _ := http.NewRequest(http.MethodPost, "/run-pipeline", bytes.NewReader(requestBody))
+		rr := httptest.NewRecorder()
+		suite.handlers.RunPipeline(rr, req)
+		require.Equal(t, http.StatusCreated, rr.Code)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, "/queue", nil)
+	rr := httptest.NewRecorder()
+	suite.handlers.Queue(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	var response models.QueueResponse
+	err := json.Unmarshal(rr.Body.Bytes(), &response)
+	require.NoError(t, err)
+	require.Empty(t, response.Running)
+	require.Len(t, response.Waiting, 3)
+
+	for i, pipelineId := range []int64{3, 2, 1} {
+		require.Equal(t, pipelineId, response.Waiting[i].PipelineId)
+		require.Equal(t, i+1, response.Waiting[i].Position)
+	}
+}
+
+func TestHandlers_Queue_BadRequest_Error(t *testing.T) {
+	suite := NewSuite()
+
+	req, _ := http.NewRequest(http.MethodPost, "/queue", nil)
+	rr := httptest.NewRecorder()
+	suite.handlers.Queue(rr, req)
+	require.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+
+	priority := 1000
+	requestBody, _ := json.Marshal(models.RunPipelineRequest{RepositoryUrl: "repo", Branch: "main", Commit: "a", Priority: &priority})
+	req, _ = http.NewRequest(http.MethodPost, "/run-pipeline", bytes.NewReader(requestBody))
+	rr = httptest.NewRecorder()
+	suite.handlers.RunPipeline(rr, req)
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+
+	handlers := New(NewMockRedisServie(), NewErrorMockPipelineService(), NewMockCredentialsService(), NewMockSettingsService(), NewMockScheduleService(), NewMockPoolService(), NewMockRunnerService(), NewMockReaperService())
+
+	req, _ = http.NewRequest(http.MethodGet, "/queue", nil)
+	rr = httptest.NewRecorder()
+	handlers.Queue(rr, req)
+	require.Equal(t, http.StatusInternalServerError, rr.Code)
+}
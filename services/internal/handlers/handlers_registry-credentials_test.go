@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"pipecraft/internal/models"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandlers_RegistryCredentials_HappyPath(t *testing.T) {
+	suite := NewSuite()
+
+	credentials := models.RegistryCredentialsRequest{
+		RepositoryUrl: "https://github.com/ysayonnar/pipecraft.git",
+		Registry:      "ghcr.io",
+		Username:      "ysayonnar",
+		Password:      "password",
+	}
+	query := "?repository_url=" + credentials.RepositoryUrl + "&registry=" + credentials.Registry
+
+	requestBody, _ := json.Marshal(credentials)
+	req, _ := http.NewRequest(http.MethodPut, "/repository/registry-credentials", bytes.NewReader(requestBody))
+	rr := httptest.NewRecorder()
+
+	suite.handlers.RegistryCredentials(rr, req)
+	require.Equal(t, http.StatusNoContent, rr.Code)
+
+	req, _ = http.NewRequest(http.MethodGet, "/repository/registry-credentials"+query, nil)
+	rr = httptest.NewRecorder()
+
+	suite.handlers.RegistryCredentials(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+	require.NotContains(t, rr.Body.String(), credentials.Password)
+
+	var response models.RegistryCredentialsResponse
+	err := json.Unmarshal(rr.Body.Bytes(), &response)
+	require.NoError(t, err)
+	require.Equal(t, credentials.RepositoryUrl, response.RepositoryUrl)
+	require.Equal(t, credentials.Registry, response.Registry)
+
+	req, _ = http.NewRequest(http.MethodDelete, "/repository/registry-credentials"+query, nil)
+	rr = httptest.NewRecorder()
+
+	suite.handlers.RegistryCredentials(rr, req)
+	require.Equal(t, http.StatusNoContent, rr.Code)
+
+	req, _ = http.NewRequest(http.MethodGet, "/repository/registry-credentials"+query, nil)
+	rr = httptest.NewRecorder()
+
+	suite.handlers.RegistryCredentials(rr, req)
+	require.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+func TestHandlers_RegistryCredentials_BadRequest(t *testing.T) {
+	suite := NewSuite()
+
+	req, _ := http.NewRequest(http.MethodPost, "/repository/registry-credentials", nil)
+	rr := httptest.NewRecorder()
+	suite.handlers.RegistryCredentials(rr, req)
+	require.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+
+	req, _ = http.NewRequest(http.MethodPut, "/repository/registry-credentials", bytes.NewBuffer([]byte("")))
+	rr = httptest.NewRecorder()
+	suite.handlers.RegistryCredentials(rr, req)
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+
+	requestBody, _ := json.Marshal(models.RegistryCredentialsRequest{RepositoryUrl: "repo", Registry: "ghcr.io"})
+	req, _ = http.NewRequest(http.MethodPut, "/repository/registry-credentials", bytes.NewReader(requestBody))
+	rr = httptest.NewRecorder()
+	suite.handlers.RegistryCredentials(rr, req)
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+
+	req, _ = http.NewRequest(http.MethodDelete, "/repository/registry-credentials?repository_url=repo&registry=ghcr.io", nil)
+	rr = httptest.NewRecorder()
+	suite.handlers.RegistryCredentials(rr, req)
+	require.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+func TestHandlers_RegistryCredentials_ServiceError(t *testing.T) {
+	handlers := New(NewMockRedisServie(), NewMockPipelineService(), NewErrorMockCredentialsService(), NewMockSettingsService(), NewMockScheduleService(), NewMockPoolService(), NewMockRunnerService(), NewMockReaperService())
+
+	requestBody, _ := json.Marshal(models.RegistryCredentialsRequest{RepositoryUrl: "repo", Registry: "ghcr.io", Username: "user", Password: "password"})
+	req, _ := http.NewRequest(http.MethodPut, "/repository/registry-credentials", bytes.NewReader(requestBody))
+	rr := httptest.NewRecorder()
+	handlers.RegistryCredentials(rr, req)
+	require.Equal(t, http.StatusInternalServerError, rr.Code)
+
+	req, _ = http.NewRequest(http.MethodGet, "/repository/registry-credentials?repository_url=repo&registry=ghcr.io", nil)
+	rr = httptest.NewRecorder()
+	handlers.RegistryCredentials(rr, req)
+	require.Equal(t, http.StatusInternalServerError, rr.Code)
+}
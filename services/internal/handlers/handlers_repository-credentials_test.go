@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"pipecraft/internal/models"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandlers_RepositoryCredentials_HappyPath(t *testing.T) {
+	suite := NewSuite()
+
+	credentials := models.RepositoryCredentialsRequest{
+		RepositoryUrl: "https://github.com/ysayonnar/pipecraft.git",
+		Kind:          "https",
+		Username:      "ysayonnar",
+		Token:         "token",
+	}
+
+	requestBody, _ := json.Marshal(credentials)
+	req, _ := http.NewRequest(http.MethodPut, "/repository/credentials", bytes.NewReader(requestBody))
+	rr := httptest.NewRecorder()
+
+	suite.handlers.RepositoryCredentials(rr, req)
+	require.Equal(t, http.StatusNoContent, rr.Code)
+
+	req, _ = http.NewRequest(http.MethodGet, "/repository/credentials?repository_url="+credentials.RepositoryUrl, nil)
+	rr = httptest.NewRecorder()
+
+	suite.handlers.RepositoryCredentials(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+	require.NotContains(t, rr.Body.String(), credentials.Token)
+
+	var response models.RepositoryCredentialsResponse
+	err := json.Unmarshal(rr.Body.Bytes(), &response)
+	require.NoError(t, err)
+	require.Equal(t, credentials.RepositoryUrl, response.RepositoryUrl)
+	require.Equal(t, credentials.Kind, response.Kind)
+
+	req, _ = http.NewRequest(http.MethodDelete, "/repository/credentials?repository_url="+credentials.RepositoryUrl, nil)
+	rr = httptest.NewRecorder()
+
+	suite.handlers.RepositoryCredentials(rr, req)
+	require.Equal(t, http.StatusNoContent, rr.Code)
+
+	req, _ = http.NewRequest(http.MethodGet, "/repository/credentials?repository_url="+credentials.RepositoryUrl, nil)
+	rr = httptest.NewRecorder()
+
+	suite.handlers.RepositoryCredentials(rr, req)
+	require.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+func TestHandlers_RepositoryCredentials_BadRequest(t *testing.T) {
+	suite := NewSuite()
+
+	req, _ := http.NewRequest(http.MethodPost, "/repository/credentials", nil)
+	rr := httptest.NewRecorder()
+	suite.handlers.RepositoryCredentials(rr, req)
+	require.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+
+	req, _ = http.NewRequest(http.MethodPut, "/repository/credentials", bytes.NewBuffer([]byte("")))
+	rr = httptest.NewRecorder()
+	suite.handlers.RepositoryCredentials(rr, req)
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+
+	requestBody, _ := json.Marshal(models.RepositoryCredentialsRequest{RepositoryUrl: "repo", Kind: "ftp"})
+	req, _ = http.NewRequest(http.MethodPut, "/repository/credentials", bytes.NewReader(requestBody))
+	rr = httptest.NewRecorder()
+	suite.handlers.RepositoryCredentials(rr, req)
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+
+	req, _ = http.NewRequest(http.MethodDelete, "/repository/credentials?repository_url=repo", nil)
+	rr = httptest.NewRecorder()
+	suite.handlers.RepositoryCredentials(rr, req)
+	require.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+func TestHandlers_RepositoryCredentials_ServiceError(t *testing.T) {
+	handlers := New(NewMockRedisServie(), NewMockPipelineService(), NewErrorMockCredentialsService(), NewMockSettingsService(), NewMockScheduleService(), NewMockPoolService(), NewMockRunnerService(), NewMockReaperService())
+
+	requestBody, _ := json.Marshal(models.RepositoryCredentialsRequest{RepositoryUrl: "repo", Kind: "ssh"})
+	req, _ := http.NewRequest(http.MethodPut, "/repository/credentials", bytes.NewReader(requestBody))
+	rr := httptest.NewRecorder()
+	handlers.RepositoryCredentials(rr, req)
+	require.Equal(t, http.StatusInternalServerError, rr.Code)
+
+	req, _ = http.NewRequest(http.MethodGet, "/repository/credentials?repository_url=repo", nil)
+	rr = httptest.NewRecorder()
+	handlers.RepositoryCredentials(rr, req)
+	require.Equal(t, http.StatusInternalServerError, rr.Code)
+}
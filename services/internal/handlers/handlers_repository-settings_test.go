@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"pipecraft/internal/models"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandlers_RepositorySettings_HappyPath(t *testing.T) {
+	suite := NewSuite()
+
+	ciConfigPath := "build/pipeline.yaml"
+	settings := models.RepositorySettingsRequest{
+		RepositoryUrl: "https://github.com/ysayonnar/pipecraft.git",
+		CiConfigPath:  &ciConfigPath,
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, "/repository/settings?repository_url="+settings.RepositoryUrl, nil)
+	rr := httptest.NewRecorder()
+
+	suite.handlers.RepositorySettings(rr, req)
+	require.Equal(t, http.StatusNotFound, rr.Code)
+
+	requestBody, _ := json.Marshal(settings)
+	req, _ = http.NewRequest(http.MethodPut, "/repository/settings", bytes.NewReader(requestBody))
+	rr = httptest.NewRecorder()
+
+	suite.handlers.RepositorySettings(rr, req)
+	require.Equal(t, http.StatusNoContent, rr.Code)
+
+	req, _ = http.NewRequest(http.MethodGet, "/repository/settings?repository_url="+settings.RepositoryUrl, nil)
+	rr = httptest.NewRecorder()
+
+	suite.handlers.RepositorySettings(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	var response models.RepositorySettingsResponse
+	err := json.Unmarshal(rr.Body.Bytes(), &response)
+	require.NoError(t, err)
+	require.Equal(t, settings.RepositoryUrl, response.RepositoryUrl)
+	require.Equal(t, ciConfigPath, response.CiConfigPath)
+}
+
+func TestHandlers_RepositorySettings_BadRequest(t *testing.T) {
+	suite := NewSuite()
+
+	req, _ := http.NewRequest(http.MethodDelete, "/repository/settings", nil)
+	rr := httptest.NewRecorder()
+	suite.handlers.RepositorySettings(rr, req)
+	require.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+
+	req, _ = http.NewRequest(http.MethodPut, "/repository/settings", bytes.NewBuffer([]byte("")))
+	rr = httptest.NewRecorder()
+	suite.handlers.RepositorySettings(rr, req)
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+
+	requestBody := []byte(`{"repository_url":"repo","ci_config_path":"../ci.yaml"}`)
+	req, _ = http.NewRequest(http.MethodPut, "/repository/settings", bytes.NewReader(requestBody))
+	rr = httptest.NewRecorder()
+	suite.handlers.RepositorySettings(rr, req)
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+func TestHandlers_RepositorySettings_ServiceError(t *testing.T) {
+	handlers := New(NewMockRedisServie(), NewMockPipelineService(), NewMockCredentialsService(), NewErrorMockSettingsService(), NewMockScheduleService(), NewMockPoolService(), NewMockRunnerService(), NewMockReaperService())
+
+	requestBody := []byte(`{"repository_url":"repo","ci_config_path":"ci.yaml"}`)
+	req, _ := http.NewRequest(http.MethodPut, "/repository/settings", bytes.NewReader(requestBody))
+	rr := httptest.NewRecorder()
+	handlers.RepositorySettings(rr, req)
+	require.Equal(t, http.StatusInternalServerError, rr.Code)
+
+	req, _ = http.NewRequest(http.MethodGet, "/repository/settings?repository_url=repo", nil)
+	rr = httptest.NewRecorder()
+	handlers.RepositorySettings(rr, req)
+	require.Equal(t, http.StatusInternalServerError, rr.Code)
+}
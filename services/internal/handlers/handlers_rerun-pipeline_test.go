@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"pipecraft/internal/models"
+	"pipecraft/internal/storage"
+	"strconv"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandlers_RerunPipeline_HappyPath(t *testing.T) {
+	suite, pipelineId := NewSuiteWithPipeline()
+	suite.handlers.PipelineService.(*MockPipelineService).pipelines[pipelineId].Status = storage.PIPELINE_STATUS_FAILED
+
+	req, _ := http.NewRequest(http.MethodPost, fmt.Sprintf("/pipeline/%d/rerun?failed_only=true&triggered_by=alice", pipelineId), nil)
+	rr := httptest.NewRecorder()
+	req = mux.SetURLVars(req, map[string]string{"id": strconv.Itoa(int(pipelineId))})
+
+	suite.handlers.RerunPipeline(rr, req)
+	require.Equal(t, http.StatusCreated, rr.Code)
+
+	var response models.RunPipelineResponse
+	err := json.Unmarshal(rr.Body.Bytes(), &response)
+	require.NoError(t, err)
+	require.Equal(t, int64(2), response.PipelineId)
+
+	rerun := suite.handlers.PipelineService.(*MockPipelineService).pipelines[response.PipelineId]
+	require.Equal(t, pipelineId, rerun.RerunOf)
+	require.True(t, rerun.FailedOnly)
+	require.Equal(t, storage.TRIGGER_RERUN, rerun.Trigger)
+	require.Equal(t, "alice", rerun.TriggeredBy)
+}
+
+func TestHandlers_RerunPipeline_NotFinished(t *testing.T) {
+	suite, pipelineId := NewSuiteWithPipeline()
+
+	req, _ := http.NewRequest(http.MethodPost, fmt.Sprintf("/pipeline/%d/rerun", pipelineId), nil)
+	rr := httptest.NewRecorder()
+	req = mux.SetURLVars(req, map[string]string{"id": strconv.Itoa(int(pipelineId))})
+
+	suite.handlers.RerunPipeline(rr, req)
+	require.Equal(t, http.StatusConflict, rr.Code)
+}
+
+func TestHandlers_RerunPipeline_BadRequest(t *testing.T) {
+	suite, pipelineId := NewSuiteWithPipeline()
+
+	req, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("/pipeline/%d/rerun", pipelineId), nil)
+	rr := httptest.NewRecorder()
+	req = mux.SetURLVars(req, map[string]string{"id": strconv.Itoa(int(pipelineId))})
+
+	suite.handlers.RerunPipeline(rr, req)
+	require.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+
+	req, _ = http.NewRequest(http.MethodPost, fmt.Sprintf("/pipeline/%d/rerun?failed_only=smth", pipelineId), nil)
+	rr = httptest.NewRecorder()
+	req = mux.SetURLVars(req, map[string]string{"id": strconv.Itoa(int(pipelineId))})
+
+	suite.handlers.RerunPipeline(rr, req)
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+
+	req, _ = http.NewRequest(http.MethodPost, "/pipeline/smth/rerun", nil)
+	rr = httptest.NewRecorder()
+	req = mux.SetURLVars(req, map[string]string{"id": "smth"})
+
+	suite.handlers.RerunPipeline(rr, req)
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+func TestHandlers_RerunPipeline_NotFound_Error(t *testing.T) {
+	suite := NewSuite()
+
+	req, _ := http.NewRequest(http.MethodPost, "/pipeline/1/rerun", nil)
+	rr := httptest.NewRecorder()
+	req = mux.SetURLVars(req, map[string]string{"id": "1"})
+
+	suite.handlers.RerunPipeline(rr, req)
+	require.Equal(t, http.StatusNotFound, rr.Code)
+
+	handlers := New(NewMockRedisServie(), NewErrorMockPipelineService(), NewMockCredentialsService(), NewMockSettingsService(), NewMockScheduleService(), NewMockPoolService(), NewMockRunnerService(), NewMockReaperService())
+
+	req, _ = http.NewRequest(http.MethodPost, "/pipeline/1/rerun", nil)
+	rr = httptest.NewRecorder()
+	req = mux.SetURLVars(req, map[string]string{"id": "1"})
+
+	handlers.RerunPipeline(rr, req)
+	require.Equal(t, http.StatusInternalServerError, rr.Code)
+}
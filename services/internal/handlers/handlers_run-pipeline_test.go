@@ -19,7 +19,7 @@ type Suite struct {
 func NewSuite() *Suite {
 	redisMock := NewMockRedisServie()
 	pipelinesMock := NewMockPipelineService()
-	handlers := New(redisMock, pipelinesMock)
+	handlers := New(redisMock, pipelinesMock, NewMockCredentialsService(), NewMockSettingsService(), NewMockScheduleService(), NewMockPoolService(), NewMockRunnerService(), NewMockReaperService())
 	return &Suite{handlers: handlers}
 }
 
@@ -91,7 +91,7 @@ func TestHandlers_RunPipeline_MethodNotAllowed_EmptyBody(t *testing.T) {
 func TestHandlers_RunPipeline_ErrorPipelineService(t *testing.T) {
 	redisMock := NewMockRedisServie()
 	pipelinesMock := NewErrorMockPipelineService()
-	handlers := New(redisMock, pipelinesMock)
+	handlers := New(redisMock, pipelinesMock, NewMockCredentialsService(), NewMockSettingsService(), NewMockScheduleService(), NewMockPoolService(), NewMockRunnerService(), NewMockReaperService())
 
 	pipeline := models.RunPipelineRequest{
 		RepositoryUrl: "ysayonnar/pipecraft",
@@ -107,3 +107,41 @@ func TestHandlers_RunPipeline_ErrorPipelineService(t *testing.T) {
 	handlers.RunPipeline(rr, req)
 	require.Equal(t, http.StatusInternalServerError, rr.Code)
 }
+
+func TestHandlers_RunPipeline_BranchNotFound(t *testing.T) {
+	redisMock := NewMockRedisServie()
+	pipelinesMock := NewMockPipelineService()
+	handlers := New(redisMock, pipelinesMock, NewMockCredentialsService(), NewMockSettingsService(), NewMockScheduleService(), NewMockPoolService(), NewMockRunnerService(), NewMockReaperService())
+
+	pipeline := models.RunPipelineRequest{
+		RepositoryUrl: "ysayonnar/pipecraft",
+		Branch:        "unknown",
+	}
+
+	requestBody, _ := json.Marshal(pipeline)
+	req, _ := http.NewRequest(http.MethodPost, "/run-pipeline", bytes.NewReader(requestBody))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+
+	handlers.RunPipeline(rr, req)
+	require.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+}
+
+func TestHandlers_RunPipeline_InvalidInputs(t *testing.T) {
+	suite := NewSuite()
+
+	pipeline := models.RunPipelineRequest{
+		RepositoryUrl: "ysayonnar/pipecraft",
+		Branch:        "main",
+		Commit:        "e4r3e2",
+		Inputs:        map[string]any{"unknown": "value"},
+	}
+
+	requestBody, _ := json.Marshal(pipeline)
+	req, _ := http.NewRequest(http.MethodPost, "/run-pipeline", bytes.NewReader(requestBody))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+
+	suite.handlers.RunPipeline(rr, req)
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+}
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"pipecraft/internal/models"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+)
+
+func runnerRequest(method, url string, body any) *http.Request {
+	var requestBody []byte
+	if body != nil {
+		requestBody, _ = json.Marshal(body)
+	}
+	req, _ := http.NewRequest(method, url, bytes.NewReader(requestBody))
+	req.Header.Set("Authorization", "Bearer "+MOCK_RUNNER_TOKEN)
+	return req
+}
+
+func TestHandlers_RegisterRunner(t *testing.T) {
+	suite := NewSuite()
+
+	req := runnerRequest(http.MethodPost, "/runners/register", models.RegisterRunnerRequest{Name: "runner-1", RegistrationToken: MOCK_REGISTRATION_TOKEN})
+	rr := httptest.NewRecorder()
+	suite.handlers.RegisterRunner(rr, req)
+	require.Equal(t, http.StatusCreated, rr.Code)
+
+	var response models.RegisterRunnerResponse
+	err := json.Unmarshal(rr.Body.Bytes(), &response)
+	require.NoError(t, err)
+	require.Equal(t, MOCK_RUNNER_TOKEN, response.Token)
+
+	req = runnerRequest(http.MethodPost, "/runners/register", models.RegisterRunnerRequest{Name: "runner-1", RegistrationToken: "wrong"})
+	rr = httptest.NewRecorder()
+	suite.handlers.RegisterRunner(rr, req)
+	require.Equal(t, http.StatusForbidden, rr.Code)
+
+	req = runnerRequest(http.MethodPost, "/runners/register", models.RegisterRunnerRequest{RegistrationToken: MOCK_REGISTRATION_TOKEN})
+	rr = httptest.NewRecorder()
+	suite.handlers.RegisterRunner(rr, req)
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+func TestHandlers_RunnerHeartbeat(t *testing.T) {
+	suite := NewSuite()
+
+	req := runnerRequest(http.MethodPost, "/runner/heartbeat", nil)
+	rr := httptest.NewRecorder()
+	suite.handlers.RunnerHeartbeat(rr, req)
+	require.Equal(t, http.StatusNoContent, rr.Code)
+
+	req.Header.Set("Authorization", "Bearer wrong")
+	rr = httptest.NewRecorder()
+	suite.handlers.RunnerHeartbeat(rr, req)
+	require.Equal(t, http.StatusUnauthorized, rr.Code)
+}
+
+func TestHandlers_RequestRunnerPipeline(t *testing.T) {
+	suite := NewSuite()
+
+	req := runnerRequest(http.MethodPost, "/runner/pipelines/request", nil)
+	rr := httptest.NewRecorder()
+	suite.handlers.RequestRunnerPipeline(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	var response models.RunnerPipelineResponse
+	err := json.Unmarshal(rr.Body.Bytes(), &response)
+	require.NoError(t, err)
+	require.Equal(t, int64(MOCK_RUNNER_PIPELINE_ID), response.PipelineId)
+
+	rr = httptest.NewRecorder()
+	suite.handlers.RequestRunnerPipeline(rr, req)
+	require.Equal(t, http.StatusNoContent, rr.Code)
+}
+
+func TestHandlers_RunnerCall(t *testing.T) {
+	suite := NewSuite()
+
+	call := func(pipelineId string, dto models.RunnerCallRequest) *httptest.ResponseRecorder {
+		req := runnerRequest(http.MethodPost, "/runner/pipelines/"+pipelineId+"/call", dto)
+		req = mux.SetURLVars(req, map[string]string{"id": pipelineId})
+		rr := httptest.NewRecorder()
+		suite.handlers.RunnerCall(rr, req)
+		return rr
+	}
+
+	rr := call("7", models.RunnerCallRequest{Method: "GetPipelineInfo", Params: []byte(`{"id":7}`)})
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	var response models.RunnerCallResponse
+	err := json.Unmarshal(rr.Body.Bytes(), &response)
+	require.NoError(t, err)
+	require.JSONEq(t, `"ok"`, string(response.Result))
+
+	rr = call("8", models.RunnerCallRequest{Method: "GetPipelineInfo"})
+	require.Equal(t, http.StatusForbidden, rr.Code)
+
+	rr = call("7", models.RunnerCallRequest{})
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+
+	rr = call("abc", models.RunnerCallRequest{Method: "GetPipelineInfo"})
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+func TestHandlers_Runners_InternalError(t *testing.T) {
+	handlers := New(NewMockRedisServie(), NewMockPipelineService(), NewMockCredentialsService(), NewMockSettingsService(), NewMockScheduleService(), NewMockPoolService(), NewErrorMockRunnerService(), NewMockReaperService())
+
+	req := runnerRequest(http.MethodPost, "/runner/pipelines/request", nil)
+	rr := httptest.NewRecorder()
+	handlers.RequestRunnerPipeline(rr, req)
+	require.Equal(t, http.StatusInternalServerError, rr.Code)
+
+	req = runnerRequest(http.MethodPost, "/runner/pipelines/7/call", models.RunnerCallRequest{Method: "GetPipelineInfo"})
+	req = mux.SetURLVars(req, map[string]string{"id": "7"})
+	rr = httptest.NewRecorder()
+	handlers.RunnerCall(rr, req)
+	require.Equal(t, http.StatusInternalServerError, rr.Code)
+}
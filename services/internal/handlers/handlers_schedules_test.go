@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"pipecraft/internal/models"
+	"strconv"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+)
+
+func newScheduleRequest(method, url string, dto any) *http.Request {
+	var body []byte
+	if dto != nil {
+		body, _ = json.Marshal(dto)
+	}
+	req, _ := http.NewRequest(method, url, bytes.NewReader(body))
+	return req
+}
+
+func TestHandlers_Schedules_HappyPath(t *testing.T) {
+	suite := NewSuite()
+
+	dto := models.ScheduleRequest{RepositoryUrl: "ysayonnar/pipecraft", Branch: "main", CronExpression: "0 2 * * *"}
+	rr := httptest.NewRecorder()
+	suite.handlers.Schedules(rr, newScheduleRequest(http.MethodPost, "/schedules", dto))
+	require.Equal(t, http.StatusCreated, rr.Code)
+
+	var created models.ScheduleResponse
+	err := json.Unmarshal(rr.Body.Bytes(), &created)
+	require.NoError(t, err)
+	require.NotNil(t, created.NextRunAt)
+	require.Equal(t, "UTC", created.Timezone)
+
+	scheduleUrl := fmt.Sprintf("/schedules/%d", created.ScheduleId)
+	vars := map[string]string{"id": strconv.Itoa(int(created.ScheduleId))}
+
+	disabled := false
+	dto.Enabled = &disabled
+	rr = httptest.NewRecorder()
+	suite.handlers.Schedule(rr, mux.SetURLVars(newScheduleRequest(http.MethodPut, scheduleUrl, dto), vars))
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	rr = httptest.NewRecorder()
+	suite.handlers.Schedule(rr, mux.SetURLVars(newScheduleRequest(http.MethodGet, scheduleUrl, nil), vars))
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	var schedule models.ScheduleResponse
+	err = json.Unmarshal(rr.Body.Bytes(), &schedule)
+	require.NoError(t, err)
+	require.False(t, schedule.Enabled)
+	require.Nil(t, schedule.NextRunAt)
+
+	rr = httptest.NewRecorder()
+	suite.handlers.Schedules(rr, newScheduleRequest(http.MethodGet, "/schedules?repository_url=ysayonnar/pipecraft", nil))
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	var list models.SchedulesListResponse
+	err = json.Unmarshal(rr.Body.Bytes(), &list)
+	require.NoError(t, err)
+	require.Len(t, list.Schedules, 1)
+
+	rr = httptest.NewRecorder()
+	suite.handlers.Schedule(rr, mux.SetURLVars(newScheduleRequest(http.MethodDelete, scheduleUrl, nil), vars))
+	require.Equal(t, http.StatusNoContent, rr.Code)
+
+	rr = httptest.NewRecorder()
+	suite.handlers.Schedule(rr, mux.SetURLVars(newScheduleRequest(http.MethodGet, scheduleUrl, nil), vars))
+	require.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+func TestHandlers_Schedules_BadRequest(t *testing.T) {
+	suite := NewSuite()
+
+	rr := httptest.NewRecorder()
+	suite.handlers.Schedules(rr, newScheduleRequest(http.MethodPost, "/schedules", models.ScheduleRequest{
+		RepositoryUrl:  "ysayonnar/pipecraft",
+		Branch:         "main",
+		CronExpression: "nightly",
+	}))
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+
+	req, _ := http.NewRequest(http.MethodPost, "/schedules", bytes.NewReader([]byte("{")))
+	rr = httptest.NewRecorder()
+	suite.handlers.Schedules(rr, req)
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+
+	rr = httptest.NewRecorder()
+	suite.handlers.Schedules(rr, newScheduleRequest(http.MethodDelete, "/schedules", nil))
+	require.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+
+	rr = httptest.NewRecorder()
+	suite.handlers.Schedule(rr, mux.SetURLVars(newScheduleRequest(http.MethodGet, "/schedules/smth", nil), map[string]string{"id": "smth"}))
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+
+	rr = httptest.NewRecorder()
+	suite.handlers.Schedule(rr, mux.SetURLVars(newScheduleRequest(http.MethodPost, "/schedules/1", nil), map[string]string{"id": "1"}))
+	require.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+}
+
+func TestHandlers_Schedules_ServiceError(t *testing.T) {
+	handlers := New(NewMockRedisServie(), NewMockPipelineService(), NewMockCredentialsService(), NewMockSettingsService(), NewErrorMockScheduleService(), NewMockPoolService(), NewMockRunnerService(), NewMockReaperService())
+
+	rr := httptest.NewRecorder()
+	handlers.Schedules(rr, newScheduleRequest(http.MethodGet, "/schedules", nil))
+	require.Equal(t, http.StatusInternalServerError, rr.Code)
+
+	rr = httptest.NewRecorder()
+	handlers.Schedule(rr, mux.SetURLVars(newScheduleRequest(http.MethodDelete, "/schedules/1", nil), map[string]string{"id": "1"}))
+	require.Equal(t, http.StatusInternalServerError, rr.Code)
+}
@@ -2,15 +2,18 @@ package handlers
 
 import (
 	"errors"
+	"pipecraft/internal/jobs"
 	"pipecraft/internal/models"
 	"pipecraft/internal/services"
 	"pipecraft/internal/storage"
+	"sort"
 	"time"
 )
 
 type MockPipelineService struct {
 	pipelines      map[int64]*storage.PipelinesTable
 	logs           map[int64]*storage.LogsTable
+	approvals      map[int64]map[string]*storage.ApprovalsTable
 	lastPipelineId int64
 	lastLogId      int64
 }
@@ -19,28 +22,59 @@ func NewMockPipelineService() *MockPipelineService {
 	return &MockPipelineService{
 		pipelines:      make(map[int64]*storage.PipelinesTable),
 		logs:           make(map[int64]*storage.LogsTable),
+		approvals:      make(map[int64]map[string]*storage.ApprovalsTable),
 		lastPipelineId: 0,
 		lastLogId:      0,
 	}
 }
 
-func (m MockPipelineService) Run(dto *models.RunPipelineRequest) (*models.RunPipelineResponse, error) {
+func (m *MockPipelineService) Run(dto *models.RunPipelineRequest) (*models.RunPipelineResponse, error) {
+	if dto.Commit == "" && dto.Branch == "unknown" {
+		return nil, services.ErrRefNotFound
+	}
+	if _, ok := dto.Inputs["unknown"]; ok {
+		return nil, services.ErrInvalidInputs
+	}
+	priority := storage.TriggerPriority(dto.Trigger)
+	if dto.Priority != nil {
+		if *dto.Priority < services.MIN_PRIORITY || *dto.Priority > services.MAX_PRIORITY {
+			return nil, services.ErrInvalidPriority
+		}
+		priority = *dto.Priority
+	}
+
+	attempt := 1
 	for _, pipeline := range m.pipelines {
-		if pipeline.Repository == dto.RepositoryUrl && pipeline.Commit == dto.Commit && pipeline.Branch == dto.Branch {
-			return &models.RunPipelineResponse{PipelineId: pipeline.PipelineId}, services.ErrAlreadyExists
+		if pipeline.Repository == dto.RepositoryUrl && pipeline.Commit == dto.Commit &&
+			pipeline.Branch == dto.Branch && pipeline.Ref == dto.Ref && pipeline.RefType == dto.RefType {
+			if !dto.Force {
+				return &models.RunPipelineResponse{PipelineId: pipeline.PipelineId}, services.ErrAlreadyExists
+			}
+			attempt = max(attempt, pipeline.Attempt+1)
 		}
 	}
 
 	m.lastPipelineId++
 	m.lastLogId++
 
+	trigger := dto.Trigger
+	if trigger == "" {
+		trigger = storage.TRIGGER_API
+	}
+
 	m.pipelines[m.lastPipelineId] = &storage.PipelinesTable{
-		PipelineId: m.lastPipelineId,
-		Status:     storage.PIPELINE_STATUS_WAITING,
-		Repository: dto.RepositoryUrl,
-		Branch:     dto.Branch,
-		Commit:     dto.Commit,
-		CreatedAt:  time.Now(),
+		PipelineId:  m.lastPipelineId,
+		Status:      storage.PIPELINE_STATUS_WAITING,
+		Repository:  dto.RepositoryUrl,
+		Branch:      dto.Branch,
+		Ref:         dto.Ref,
+		RefType:     dto.RefType,
+		Commit:      dto.Commit,
+		Attempt:     attempt,
+		Trigger:     trigger,
+		TriggeredBy: dto.TriggeredBy,
+		Priority:    priority,
+		CreatedAt:   time.Now(),
 	}
 
 	m.logs[m.lastLogId] = &storage.LogsTable{
@@ -56,7 +90,137 @@ func (m MockPipelineService) Run(dto *models.RunPipelineRequest) (*models.RunPip
 	return &models.RunPipelineResponse{PipelineId: m.lastPipelineId}, nil
 }
 
-func (m MockPipelineService) GetStatus(id int64) (*models.PipelineStatusResponse, error) {
+func (m *MockPipelineService) Rerun(id int64, failedOnly bool, triggeredBy string) (*models.RunPipelineResponse, error) {
+	original, ok := m.pipelines[id]
+	if !ok {
+		return nil, services.ErrNotFound
+	}
+
+	if original.Status == storage.PIPELINE_STATUS_WAITING || original.Status == storage.PIPELINE_STATUS_RUNNING {
+		return nil, services.ErrNotFinished
+	}
+
+	response, err := m.Run(&models.RunPipelineRequest{
+		RepositoryUrl: original.Repository,
+		Branch:        original.Branch,
+		Ref:           original.Ref,
+		RefType:       original.RefType,
+		Commit:        original.Commit,
+		Force:         true,
+		Trigger:       storage.TRIGGER_RERUN,
+		TriggeredBy:   triggeredBy,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	m.pipelines[response.PipelineId].RerunOf = id
+	m.pipelines[response.PipelineId].FailedOnly = failedOnly
+
+	return response, nil
+}
+
+func (m *MockPipelineService) List(dto *models.ListPipelinesRequest) (*models.PipelinesListResponse, error) {
+	response := &models.PipelinesListResponse{Pipelines: make([]models.PipelineResponse, 0)}
+	for id := m.lastPipelineId; id > 0; id-- {
+		pipeline := m.pipelines[id]
+		if dto.RefType != "" && pipeline.RefType != dto.RefType {
+			continue
+		}
+		response.Pipelines = append(response.Pipelines, models.PipelineResponse{
+			PipelineId:    pipeline.PipelineId,
+			Status:        pipeline.Status,
+			RepositoryUrl: pipeline.Repository,
+			Branch:        pipeline.Branch,
+			Ref:           pipeline.Ref,
+			RefType:       pipeline.RefType,
+			Commit:        pipeline.Commit,
+			Attempt:       pipeline.Attempt,
+			RerunOf:       pipeline.RerunOf,
+			Trigger:       pipeline.Trigger,
+			TriggeredBy:   pipeline.TriggeredBy,
+			CreatedAt:     pipeline.CreatedAt,
+		})
+	}
+
+	return response, nil
+}
+
+func (m *MockPipelineService) Get(id int64) (*models.PipelineDetailsResponse, error) {
+	pipeline, ok := m.pipelines[id]
+	if !ok {
+		return nil, services.ErrNotFound
+	}
+
+	response := &models.PipelineDetailsResponse{
+		PipelineResponse: models.PipelineResponse{
+			PipelineId:       pipeline.PipelineId,
+			Status:           pipeline.Status,
+			RepositoryUrl:    pipeline.Repository,
+			Branch:           pipeline.Branch,
+			Ref:              pipeline.Ref,
+			RefType:          pipeline.RefType,
+			Commit:           pipeline.Commit,
+			Attempt:          pipeline.Attempt,
+			Trigger:          pipeline.Trigger,
+			ParentPipelineId: pipeline.ParentPipelineId,
+			CreatedAt:        pipeline.CreatedAt,
+		},
+		ParentJob:  pipeline.ParentJob,
+		Downstream: make([]models.DownstreamPipelineResponse, 0),
+	}
+	for childId := int64(1); childId <= m.lastPipelineId; childId++ {
+		child := m.pipelines[childId]
+		if child.ParentPipelineId != id {
+			continue
+		}
+		response.Downstream = append(response.Downstream, models.DownstreamPipelineResponse{
+			PipelineId:    child.PipelineId,
+			Job:           child.ParentJob,
+			Status:        child.Status,
+			RepositoryUrl: child.Repository,
+			Branch:        child.Branch,
+			Commit:        child.Commit,
+		})
+	}
+
+	return response, nil
+}
+
+func (m *MockPipelineService) Queue() (*models.QueueResponse, error) {
+	response := &models.QueueResponse{
+		Running: make([]models.QueuedPipelineResponse, 0),
+		Waiting: make([]models.QueuedPipelineResponse, 0),
+	}
+	for id := int64(1); id <= m.lastPipelineId; id++ {
+		pipeline := m.pipelines[id]
+		queued := models.QueuedPipelineResponse{
+			PipelineId:    pipeline.PipelineId,
+			RepositoryUrl: pipeline.Repository,
+			Ref:           pipeline.Ref,
+			Trigger:       pipeline.Trigger,
+			Priority:      pipeline.Priority,
+			CreatedAt:     pipeline.CreatedAt,
+		}
+		switch pipeline.Status {
+		case storage.PIPELINE_STATUS_RUNNING:
+			response.Running = append(response.Running, queued)
+		case storage.PIPELINE_STATUS_WAITING:
+			response.Waiting = append(response.Waiting, queued)
+		}
+	}
+
+	sort.SliceStable(response.Waiting, func(i, j int) bool {
+		return response.Waiting[i].Priority > response.Waiting[j].Priority
+	})
+	for i := range response.Waiting {
+		response.Waiting[i].Position = i + 1
+	}
+
+	return response, nil
+}
+
+func (m *MockPipelineService) GetStatus(id int64) (*models.PipelineStatusResponse, error) {
 	pipeline, ok := m.pipelines[id]
 	if !ok {
 		return nil, services.ErrNotFound
@@ -65,7 +229,7 @@ func (m MockPipelineService) GetStatus(id int64) (*models.PipelineStatusResponse
 	return &models.PipelineStatusResponse{Status: pipeline.Status}, nil
 }
 
-func (m MockPipelineService) GetLogs(id int64) (*models.PipelineLogsResponse, error) {
+func (m *MockPipelineService) GetLogs(id int64) (*models.PipelineLogsResponse, error) {
 	pipeline, ok := m.pipelines[id]
 	if !ok {
 		return nil, services.ErrNotFound
@@ -89,6 +253,73 @@ func (m MockPipelineService) GetLogs(id int64) (*models.PipelineLogsResponse, er
 	return nil, services.ErrNotFound
 }
 
+func (m *MockPipelineService) GetDiagnostics(id int64) (*models.LintResponse, error) {
+	if _, ok := m.pipelines[id]; !ok {
+		return nil, services.ErrNotFound
+	}
+
+	return &models.LintResponse{Valid: true, Diagnostics: []jobs.Diagnostic{}}, nil
+}
+
+func (m *MockPipelineService) GetConfig(id int64) (*models.PipelineConfigResponse, error) {
+	pipeline, ok := m.pipelines[id]
+	if !ok {
+		return nil, services.ErrNotFound
+	}
+	if pipeline.Config == "" {
+		return nil, services.ErrConfigNotRead
+	}
+
+	return &models.PipelineConfigResponse{ConfigFile: pipeline.ConfigFile, Config: pipeline.Config}, nil
+}
+
+func (m *MockPipelineService) Approve(id int64, jobName string, dto *models.ApprovalRequest) error {
+	return m.decide(id, jobName, storage.APPROVAL_STATUS_APPROVED, dto)
+}
+
+func (m *MockPipelineService) Reject(id int64, jobName string, dto *models.ApprovalRequest) error {
+	return m.decide(id, jobName, storage.APPROVAL_STATUS_REJECTED, dto)
+}
+
+func (m *MockPipelineService) decide(id int64, jobName, status string, dto *models.ApprovalRequest) error {
+	if dto.User == "" {
+		return services.ErrInvalidApproval
+	}
+
+	approval, ok := m.approvals[id][jobName]
+	if !ok {
+		return services.ErrApprovalNotFound
+	}
+	if approval.Status != storage.APPROVAL_STATUS_PENDING {
+		return services.ErrApprovalDecided
+	}
+
+	approval.Status = status
+	approval.DecidedBy = dto.User
+	return nil
+}
+
+func (m *MockPipelineService) ListApprovals(id int64) (*models.ApprovalsListResponse, error) {
+	if _, ok := m.pipelines[id]; !ok {
+		return nil, services.ErrNotFound
+	}
+
+	response := &models.ApprovalsListResponse{Approvals: []models.ApprovalResponse{}}
+	for _, approval := range m.approvals[id] {
+		response.Approvals = append(response.Approvals, models.ApprovalResponse{
+			JobName:   approval.JobName,
+			Status:    approval.Status,
+			DecidedBy: approval.DecidedBy,
+		})
+	}
+	return response, nil
+}
+
+func (m *MockPipelineService) Lint(data []byte) *models.LintResponse {
+	diagnostics := jobs.Lint(data)
+	return &models.LintResponse{Valid: !jobs.HasErrors(diagnostics), Diagnostics: diagnostics}
+}
+
 type ErrorMockPipelineService struct{}
 
 func NewErrorMockPipelineService() *ErrorMockPipelineService {
@@ -106,3 +337,43 @@ func (m ErrorMockPipelineService) GetLogs(id int64) (*models.PipelineLogsRespons
 func (m ErrorMockPipelineService) Run(dto *models.RunPipelineRequest) (*models.RunPipelineResponse, error) {
 	return nil, errors.New("mock error")
 }
+
+func (m ErrorMockPipelineService) List(dto *models.ListPipelinesRequest) (*models.PipelinesListResponse, error) {
+	return nil, errors.New("mock error")
+}
+
+func (m ErrorMockPipelineService) Get(id int64) (*models.PipelineDetailsResponse, error) {
+	return nil, errors.New("mock error")
+}
+
+func (m ErrorMockPipelineService) Queue() (*models.QueueResponse, error) {
+	return nil, errors.New("mock error")
+}
+
+func (m ErrorMockPipelineService) Rerun(id int64, failedOnly bool, triggeredBy string) (*models.RunPipelineResponse, error) {
+	return nil, errors.New("mock error")
+}
+
+func (m ErrorMockPipelineService) GetDiagnostics(id int64) (*models.LintResponse, error) {
+	return nil, errors.New("mock error")
+}
+
+func (m ErrorMockPipelineService) GetConfig(id int64) (*models.PipelineConfigResponse, error) {
+	return nil, errors.New("mock error")
+}
+
+func (m ErrorMockPipelineService) Approve(id int64, jobName string, dto *models.ApprovalRequest) error {
+	return errors.New("mock error")
+}
+
+func (m ErrorMockPipelineService) Reject(id int64, jobName string, dto *models.ApprovalRequest) error {
+	return errors.New("mock error")
+}
+
+func (m ErrorMockPipelineService) ListApprovals(id int64) (*models.ApprovalsListResponse, error) {
+	return nil, errors.New("mock error")
+}
+
+func (m ErrorMockPipelineService) Lint(data []byte) *models.LintResponse {
+	return &models.LintResponse{Valid: true, Diagnostics: []jobs.Diagnostic{}}
+}
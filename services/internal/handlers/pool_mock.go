@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"errors"
+	"pipecraft/internal/models"
+	"pipecraft/internal/services"
+)
+
+type MockPoolService struct {
+	pool models.PoolResponse
+}
+
+func NewMockPoolService() *MockPoolService {
+	return &MockPoolService{pool: models.PoolResponse{Size: 5}}
+}
+
+func (m *MockPoolService) Get() *models.PoolResponse {
+	pool := m.pool
+	return &pool
+}
+
+func (m *MockPoolService) Update(dto *models.PoolRequest) (*models.PoolResponse, error) {
+	if dto.Size != nil {
+		if *dto.Size <= 0 || *dto.Size > services.MAX_POOL_SIZE {
+			return nil, services.ErrInvalidPoolSize
+		}
+		m.pool.Size = *dto.Size
+	}
+	if dto.Paused != nil {
+		m.pool.Paused = *dto.Paused
+	}
+
+	return m.Get(), nil
+}
+
+type ErrorMockPoolService struct {
+	MockPoolService
+}
+
+func NewErrorMockPoolService() *ErrorMockPoolService {
+	return &ErrorMockPoolService{}
+}
+
+func (m *ErrorMockPoolService) Update(dto *models.PoolRequest) (*models.PoolResponse, error) {
+	return nil, errors.New("mock error")
+}
@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"pipecraft/internal/models"
+	"pipecraft/internal/services"
+)
+
+type MockReaperService struct{}
+
+func NewMockReaperService() *MockReaperService {
+	return &MockReaperService{}
+}
+
+func (m *MockReaperService) Orphans(ctx context.Context) (*models.OrphansResponse, error) {
+	return &models.OrphansResponse{Orphans: []models.OrphanResponse{
+		{Kind: "container", Name: "pipeline-1", PipelineId: 1, Reason: "finished"},
+	}}, nil
+}
+
+type DisabledMockReaperService struct{}
+
+func NewDisabledMockReaperService() *DisabledMockReaperService {
+	return &DisabledMockReaperService{}
+}
+
+func (m *DisabledMockReaperService) Orphans(ctx context.Context) (*models.OrphansResponse, error) {
+	return nil, services.ErrReaperDisabled
+}
+
+type ErrorMockReaperService struct{}
+
+func NewErrorMockReaperService() *ErrorMockReaperService {
+	return &ErrorMockReaperService{}
+}
+
+func (m *ErrorMockReaperService) Orphans(ctx context.Context) (*models.OrphansResponse, error) {
+	return nil, errors.New("mock error")
+}
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"pipecraft/internal/models"
+	"pipecraft/internal/services"
+)
+
+const (
+	MOCK_REGISTRATION_TOKEN = "registration-token"
+	MOCK_RUNNER_TOKEN       = "runner-token"
+	MOCK_RUNNER_ID          = 1
+	MOCK_RUNNER_PIPELINE_ID = 7
+)
+
+type MockRunnerService struct {
+	heartbeats int
+	claimed    bool
+}
+
+func NewMockRunnerService() *MockRunnerService {
+	return &MockRunnerService{}
+}
+
+func (m *MockRunnerService) Register(dto *models.RegisterRunnerRequest) (*models.RegisterRunnerResponse, error) {
+	if dto.RegistrationToken != MOCK_REGISTRATION_TOKEN {
+		return nil, services.ErrInvalidRunnerToken
+	}
+	if dto.Name == "" {
+		return nil, services.ErrInvalidRunner
+	}
+
+	return &models.RegisterRunnerResponse{RunnerId: MOCK_RUNNER_ID, Token: MOCK_RUNNER_TOKEN, HeartbeatInterval: 1, PollTimeout: 1}, nil
+}
+
+func (m *MockRunnerService) Authenticate(token string) (int64, error) {
+	if token != MOCK_RUNNER_TOKEN {
+		return 0, services.ErrInvalidRunnerToken
+	}
+	return MOCK_RUNNER_ID, nil
+}
+
+func (m *MockRunnerService) Heartbeat(runnerId int64) error {
+	m.heartbeats++
+	return nil
+}
+
+// NOTE: mock gives its only pipeline once, the following requests find nothing to run
+func (m *MockRunnerService) RequestPipeline(ctx context.Context, runnerId int64) (*models.RunnerPipelineResponse, error) {
+	if m.claimed {
+		return nil, services.ErrNoPipeline
+	}
+	m.claimed = true
+	return &models.RunnerPipelineResponse{PipelineId: MOCK_RUNNER_PIPELINE_ID}, nil
+}
+
+func (m *MockRunnerService) Call(runnerId, pipelineId int64, dto *models.RunnerCallRequest) (*models.RunnerCallResponse, error) {
+	if pipelineId != MOCK_RUNNER_PIPELINE_ID {
+		return nil, services.ErrPipelineNotAssigned
+	}
+	if dto.Method == "" {
+		return nil, services.ErrInvalidRunnerCall
+	}
+	return &models.RunnerCallResponse{Result: []byte(`"ok"`)}, nil
+}
+
+type ErrorMockRunnerService struct {
+	MockRunnerService
+}
+
+func NewErrorMockRunnerService() *ErrorMockRunnerService {
+	return &ErrorMockRunnerService{}
+}
+
+func (m *ErrorMockRunnerService) RequestPipeline(ctx context.Context, runnerId int64) (*models.RunnerPipelineResponse, error) {
+	return nil, errors.New("mock error")
+}
+
+func (m *ErrorMockRunnerService) Call(runnerId, pipelineId int64, dto *models.RunnerCallRequest) (*models.RunnerCallResponse, error) {
+	return nil, errors.New("mock error")
+}
@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"errors"
+	"pipecraft/internal/models"
+	"pipecraft/internal/services"
+	"time"
+)
+
+type MockScheduleService struct {
+	schedules      map[int64]*models.ScheduleResponse
+	lastScheduleId int64
+}
+
+func NewMockScheduleService() *MockScheduleService {
+	return &MockScheduleService{schedules: make(map[int64]*models.ScheduleResponse)}
+}
+
+func (m *MockScheduleService) Create(dto *models.ScheduleRequest) (*models.ScheduleResponse, error) {
+	m.lastScheduleId++
+	return m.save(m.lastScheduleId, dto)
+}
+
+func (m *MockScheduleService) Update(id int64, dto *models.ScheduleRequest) (*models.ScheduleResponse, error) {
+	if _, ok := m.schedules[id]; !ok {
+		return nil, services.ErrScheduleNotFound
+	}
+	return m.save(id, dto)
+}
+
+func (m *MockScheduleService) save(id int64, dto *models.ScheduleRequest) (*models.ScheduleResponse, error) {
+	if dto.RepositoryUrl == "" || dto.Branch == "" {
+		return nil, services.ErrInvalidSchedule
+	}
+
+	timezone := dto.Timezone
+	if timezone == "" {
+		timezone = services.DEFAULT_SCHEDULE_TIMEZONE
+	}
+	nextRunAt, err := services.NextRun(dto.CronExpression, timezone, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	schedule := &models.ScheduleResponse{
+		ScheduleId:     id,
+		RepositoryUrl:  dto.RepositoryUrl,
+		Branch:         dto.Branch,
+		CronExpression: dto.CronExpression,
+		Timezone:       timezone,
+		Enabled:        dto.Enabled == nil || *dto.Enabled,
+		CreatedAt:      time.Now(),
+		UpdatedAt:      time.Now(),
+	}
+	if schedule.Enabled {
+		schedule.NextRunAt = &nextRunAt
+	}
+	m.schedules[id] = schedule
+
+	return schedule, nil
+}
+
+func (m *MockScheduleService) Get(id int64) (*models.ScheduleResponse, error) {
+	schedule, ok := m.schedules[id]
+	if !ok {
+		return nil, services.ErrScheduleNotFound
+	}
+
+	return schedule, nil
+}
+
+func (m *MockScheduleService) List(repository string) (*models.SchedulesListResponse, error) {
+	response := &models.SchedulesListResponse{Schedules: []models.ScheduleResponse{}}
+	for id := int64(1); id <= m.lastScheduleId; id++ {
+		schedule, ok := m.schedules[id]
+		if ok && (repository == "" || schedule.RepositoryUrl == repository) {
+			response.Schedules = append(response.Schedules, *schedule)
+		}
+	}
+
+	return response, nil
+}
+
+func (m *MockScheduleService) Delete(id int64) error {
+	if _, ok := m.schedules[id]; !ok {
+		return services.ErrScheduleNotFound
+	}
+
+	delete(m.schedules, id)
+	return nil
+}
+
+type ErrorMockScheduleService struct{}
+
+func NewErrorMockScheduleService() *ErrorMockScheduleService {
+	return &ErrorMockScheduleService{}
+}
+
+func (m ErrorMockScheduleService) Create(dto *models.ScheduleRequest) (*models.ScheduleResponse, error) {
+	return nil, errors.New("mock error")
+}
+
+func (m ErrorMockScheduleService) Update(id int64, dto *models.ScheduleRequest) (*models.ScheduleResponse, error) {
+	return nil, errors.New("mock error")
+}
+
+func (m ErrorMockScheduleService) Get(id int64) (*models.ScheduleResponse, error) {
+	return nil, errors.New("mock error")
+}
+
+func (m ErrorMockScheduleService) List(repository string) (*models.SchedulesListResponse, error) {
+	return nil, errors.New("mock error")
+}
+
+func (m ErrorMockScheduleService) Delete(id int64) error {
+	return errors.New("mock error")
+}
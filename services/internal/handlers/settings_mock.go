@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"errors"
+	"pipecraft/internal/jobs"
+	"pipecraft/internal/models"
+	"pipecraft/internal/services"
+	"time"
+)
+
+type MockSettingsService struct {
+	settings map[string]*models.RepositorySettingsResponse
+}
+
+func NewMockSettingsService() *MockSettingsService {
+	return &MockSettingsService{settings: make(map[string]*models.RepositorySettingsResponse)}
+}
+
+func (m *MockSettingsService) Save(dto *models.RepositorySettingsRequest) error {
+	if dto.RepositoryUrl == "" {
+		return services.ErrInvalidConfigPath
+	}
+
+	settings := models.RepositorySettingsResponse{RepositoryUrl: dto.RepositoryUrl}
+	if saved, ok := m.settings[dto.RepositoryUrl]; ok {
+		settings = *saved
+	}
+	if dto.CiConfigPath != nil {
+		settings.CiConfigPath = *dto.CiConfigPath
+	}
+	if dto.MaxConcurrentPipelines != nil {
+		settings.MaxConcurrentPipelines = *dto.MaxConcurrentPipelines
+	}
+	if dto.AutoCancel != nil {
+		settings.AutoCancel = *dto.AutoCancel
+	}
+	if dto.AutoCancelRunning != nil {
+		settings.AutoCancelRunning = *dto.AutoCancelRunning
+	}
+
+	if settings.CiConfigPath != "" {
+		if err := jobs.ValidateConfigPath(settings.CiConfigPath); err != nil {
+			return err
+		}
+	}
+	if settings.MaxConcurrentPipelines < 0 || (settings.AutoCancelRunning && !settings.AutoCancel) {
+		return services.ErrInvalidSettings
+	}
+
+	settings.UpdatedAt = time.Now()
+	m.settings[dto.RepositoryUrl] = &settings
+
+	return nil
+}
+
+func (m *MockSettingsService) Get(repository string) (*models.RepositorySettingsResponse, error) {
+	settings, ok := m.settings[repository]
+	if !ok {
+		return nil, services.ErrSettingsNotFound
+	}
+
+	return settings, nil
+}
+
+type ErrorMockSettingsService struct{}
+
+func NewErrorMockSettingsService() *ErrorMockSettingsService {
+	return &ErrorMockSettingsService{}
+}
+
+func (m ErrorMockSettingsService) Save(dto *models.RepositorySettingsRequest) error {
+	return errors.New("mock error")
+}
+
+func (m ErrorMockSettingsService) Get(repository string) (*models.RepositorySettingsResponse, error) {
+	return nil, errors.New("mock error")
+}
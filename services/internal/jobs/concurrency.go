@@ -0,0 +1,94 @@
+package jobs
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	GROUP_VARIABLE_REPOSITORY = "repository"
+	GROUP_VARIABLE_BRANCH     = "branch"
+	GROUP_VARIABLE_REF        = "ref"
+	GROUP_VARIABLE_REF_TYPE   = "ref_type"
+)
+
+var (
+	ErrInvalidConcurrency = errors.New("invalid concurrency")
+
+	groupVariable = regexp.MustCompile(`\$\{([^}]*)\}`)
+)
+
+// Concurrency puts pipeline or job into a group where only one member runs at a time.
+// Group may contain ${repository}, ${branch}, ${ref} and ${ref_type} which are replaced with values of pipeline.
+type Concurrency struct {
+	Group            string `yaml:"group"`
+	CancelInProgress bool   `yaml:"cancel-in-progress,omitempty"`
+}
+
+func (c Concurrency) Validate() error {
+	if strings.TrimSpace(c.Group) == "" {
+		return fmt.Errorf("%w: empty group", ErrInvalidConcurrency)
+	}
+
+	for _, match := range groupVariable.FindAllStringSubmatch(c.Group, -1) {
+		switch match[1] {
+		case GROUP_VARIABLE_REPOSITORY, GROUP_VARIABLE_BRANCH, GROUP_VARIABLE_REF, GROUP_VARIABLE_REF_TYPE:
+		default:
+			return fmt.Errorf("%w: unknown variable %q in group, expected one of: %s", ErrInvalidConcurrency, match[1],
+				strings.Join([]string{GROUP_VARIABLE_REPOSITORY, GROUP_VARIABLE_BRANCH, GROUP_VARIABLE_REF, GROUP_VARIABLE_REF_TYPE}, ", "))
+		}
+	}
+
+	return nil
+}
+
+// ExpandGroup returns group with variables replaced by their values.
+func (c Concurrency) ExpandGroup(variables map[string]string) string {
+	return groupVariable.ReplaceAllStringFunc(c.Group, func(variable string) string {
+		return variables[variable[2:len(variable)-1]]
+	})
+}
+
+// AutoCancel supersedes waiting pipelines of older commits of branch once pipeline of a newer one starts, pipelines
+// which already started are canceled only with running set. It is written either as a boolean or as a mapping.
+type AutoCancel struct {
+	Enabled bool `yaml:"-"`
+	Running bool `yaml:"running,omitempty"`
+}
+
+func (a *AutoCancel) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		var enabled bool
+		if err := node.Decode(&enabled); err != nil {
+			return err
+		}
+		*a = AutoCancel{Enabled: enabled}
+		return nil
+	}
+
+	type autoCancel AutoCancel
+	var config autoCancel
+	if err := node.Decode(&config); err != nil {
+		return err
+	}
+	*a = AutoCancel(config)
+	a.Enabled = true
+	return nil
+}
+
+func (AutoCancel) JSONSchema() map[string]any {
+	return map[string]any{
+		"oneOf": []any{
+			map[string]any{"type": "boolean"},
+			map[string]any{
+				"type":                 "object",
+				"properties":           map[string]any{"running": map[string]any{"type": "boolean"}},
+				"additionalProperties": false,
+			},
+		},
+	}
+}
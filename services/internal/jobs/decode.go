@@ -0,0 +1,246 @@
+package jobs
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const MERGE_KEY = "<<"
+
+var ErrInvalidConfig = errors.New("invalid ci config")
+
+// ConfigError points to the node of ci config which doesn't match the pipeline format.
+type ConfigError struct {
+	File    string
+	Path    string
+	Line    int
+	Column  int
+	Message string
+}
+
+func (e *ConfigError) Error() string {
+	location := fmt.Sprintf("line %d", e.Line)
+	if e.File != "" {
+		location = fmt.Sprintf("%s: %s", e.File, location)
+	}
+	if e.Path == "" {
+		return fmt.Sprintf("%s: %s", location, e.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s", location, e.Path, e.Message)
+}
+
+func (e *ConfigError) Unwrap() error {
+	return ErrInvalidConfig
+}
+
+func newConfigError(node *yaml.Node, path, format string, args ...any) *ConfigError {
+	configErr := &ConfigError{Path: path, Message: fmt.Sprintf(format, args...)}
+	if node != nil {
+		configErr.Line = node.Line
+		configErr.Column = node.Column
+	}
+	return configErr
+}
+
+// DecodeStrict decodes document node into out and fails on the first unknown field, missing required field
+// or value of wrong type.
+func DecodeStrict(node *yaml.Node, out any) error {
+	var first *ConfigError
+	checkNode(node, reflect.TypeOf(out), "", func(configErr *ConfigError) {
+		if first == nil {
+			first = configErr
+		}
+	})
+	if first != nil {
+		return first
+	}
+
+	if err := node.Decode(out); err != nil {
+		return newConfigError(node, "", "%s", yamlErrorMessage(err))
+	}
+	return nil
+}
+
+// checkNode walks node along with type it is decoded into and reports every mismatch with its path.
+func checkNode(node *yaml.Node, t reflect.Type, path string, report func(*ConfigError)) {
+	node = resolveAlias(node)
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	// NOTE: types with custom decoding are checked as a whole, except mappings of structs which still can't have unknown fields
+	if reflect.PointerTo(t).Implements(reflect.TypeOf((*yaml.Unmarshaler)(nil)).Elem()) {
+		if err := node.Decode(reflect.New(t).Interface()); err != nil {
+			report(newConfigError(node, path, "%s", yamlErrorMessage(err)))
+			return
+		}
+		if t.Kind() != reflect.Struct || node.Kind != yaml.MappingNode {
+			return
+		}
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		if node.Kind != yaml.MappingNode {
+			report(newConfigError(node, path, "expected mapping"))
+			return
+		}
+
+		fields := yamlFields(t)
+		names := make([]string, len(fields))
+		byName := make(map[string]yamlField, len(fields))
+		for i, field := range fields {
+			names[i] = field.name
+			byName[field.name] = field
+		}
+
+		checkDuplicateKeys(node, path, report)
+
+		seen := make(map[string]bool)
+		for _, pair := range mappingPairs(node) {
+			key := pair[0].Value
+			field, ok := byName[key]
+			if !ok {
+				report(newConfigError(pair[0], joinPath(path, key), "unknown field, expected one of: %s", strings.Join(names, ", ")))
+				continue
+			}
+			seen[key] = true
+			checkNode(pair[1], field.typ, joinPath(path, key), report)
+		}
+
+		for _, field := range fields {
+			if field.required && !seen[field.name] {
+				report(newConfigError(node, path, "missing required field %q", field.name))
+			}
+		}
+	case reflect.Map:
+		if node.Kind != yaml.MappingNode {
+			report(newConfigError(node, path, "expected mapping"))
+			return
+		}
+
+		checkDuplicateKeys(node, path, report)
+		for _, pair := range mappingPairs(node) {
+			checkNode(pair[1], t.Elem(), joinPath(path, pair[0].Value), report)
+		}
+	case reflect.Slice:
+		if node.Kind != yaml.SequenceNode {
+			report(newConfigError(node, path, "expected list"))
+			return
+		}
+		for i, item := range node.Content {
+			checkNode(item, t.Elem(), fmt.Sprintf("%s[%d]", path, i), report)
+		}
+	case reflect.Interface:
+		if node.Kind != yaml.ScalarNode {
+			report(newConfigError(node, path, "expected scalar"))
+		}
+	default:
+		if node.Kind != yaml.ScalarNode {
+			report(newConfigError(node, path, "expected %s", schemaType(t)))
+			return
+		}
+		if err := node.Decode(reflect.New(t).Interface()); err != nil {
+			report(newConfigError(node, path, "expected %s", schemaType(t)))
+		}
+	}
+}
+
+type yamlField struct {
+	name     string
+	typ      reflect.Type
+	required bool
+}
+
+func yamlFields(t reflect.Type) []yamlField {
+	var fields []yamlField
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("yaml")
+		if !field.IsExported() || tag == "-" {
+			continue
+		}
+
+		name, options, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = strings.ToLower(field.Name)
+		}
+		fields = append(fields, yamlField{name: name, typ: field.Type, required: !strings.Contains(options, "omitempty")})
+	}
+	return fields
+}
+
+func checkDuplicateKeys(node *yaml.Node, path string, report func(*ConfigError)) {
+	seen := make(map[string]*yaml.Node)
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		keyNode := node.Content[i]
+		if keyNode.Value == MERGE_KEY {
+			continue
+		}
+		if first, ok := seen[keyNode.Value]; ok {
+			report(newConfigError(keyNode, joinPath(path, keyNode.Value), "duplicate key, first defined at line %d", first.Line))
+			continue
+		}
+		seen[keyNode.Value] = keyNode
+	}
+}
+
+// mappingPairs returns key and value nodes of mapping with merge keys expanded, explicit keys win over merged ones.
+// Duplicate explicit keys are all kept, so each of them can be checked.
+func mappingPairs(node *yaml.Node) [][2]*yaml.Node {
+	node = resolveAlias(node)
+
+	var pairs [][2]*yaml.Node
+	explicit := make(map[string]bool)
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		if key.Value != MERGE_KEY {
+			explicit[key.Value] = true
+			pairs = append(pairs, [2]*yaml.Node{key, value})
+		}
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], resolveAlias(node.Content[i+1])
+		if key.Value != MERGE_KEY {
+			continue
+		}
+
+		merged := []*yaml.Node{value}
+		if value.Kind == yaml.SequenceNode {
+			merged = value.Content
+		}
+		for _, mergedNode := range merged {
+			mergedNode = resolveAlias(mergedNode)
+			if mergedNode.Kind != yaml.MappingNode {
+				continue
+			}
+			for _, pair := range mappingPairs(mergedNode) {
+				if !explicit[pair[0].Value] {
+					explicit[pair[0].Value] = true
+					pairs = append(pairs, pair)
+				}
+			}
+		}
+	}
+
+	return pairs
+}
+
+func resolveAlias(node *yaml.Node) *yaml.Node {
+	for node.Kind == yaml.AliasNode && node.Alias != nil {
+		node = node.Alias
+	}
+	return node
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
@@ -0,0 +1,143 @@
+package jobs
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/distribution/reference"
+)
+
+const (
+	TAG_VARIABLE_COMMIT       = "commit"
+	TAG_VARIABLE_COMMIT_SHORT = "commit_short"
+	TAG_VARIABLE_BRANCH       = "branch"
+	TAG_VARIABLE_REF          = "ref"
+	TAG_VARIABLE_PIPELINE_ID  = "pipeline_id"
+
+	COMMIT_SHORT_LENGTH = 7
+
+	DEFAULT_DOCKER_CONTEXT    = "."
+	DEFAULT_DOCKERFILE        = "Dockerfile"
+	DEFAULT_REGISTRY          = "docker.io"
+	DOCKER_BUILD_STEP_COMMAND = "docker-build"
+)
+
+var (
+	ErrInvalidDockerBuild = errors.New("invalid docker-build")
+
+	// NOTE: values of variables end up in tags, so characters tags can't have are replaced
+	invalidTagCharacter = regexp.MustCompile(`[^A-Za-z0-9_.-]`)
+)
+
+// DockerBuild builds image from Dockerfile of workspace and pushes its tags to their registries when push is set.
+// Tags may contain ${commit}, ${commit_short}, ${branch}, ${ref} and ${pipeline_id}. Context is relative to
+// repository root and Dockerfile is relative to context.
+type DockerBuild struct {
+	Context    string            `yaml:"context,omitempty"`
+	Dockerfile string            `yaml:"dockerfile,omitempty"`
+	Args       map[string]string `yaml:"args,omitempty"`
+	Tags       []string          `yaml:"tags"`
+	Push       bool              `yaml:"push,omitempty"`
+}
+
+func (b DockerBuild) Validate() error {
+	if len(b.Tags) == 0 {
+		return fmt.Errorf("%w: at least one tag is required", ErrInvalidDockerBuild)
+	}
+
+	if !isRelativeInside(b.ContextDir()) {
+		return fmt.Errorf("%w: context has to be inside repository", ErrInvalidDockerBuild)
+	}
+	if !isRelativeInside(b.DockerfileName()) {
+		return fmt.Errorf("%w: dockerfile has to be inside context", ErrInvalidDockerBuild)
+	}
+
+	for _, tag := range b.Tags {
+		for _, match := range groupVariable.FindAllStringSubmatch(tag, -1) {
+			switch match[1] {
+			case TAG_VARIABLE_COMMIT, TAG_VARIABLE_COMMIT_SHORT, TAG_VARIABLE_BRANCH, TAG_VARIABLE_REF, TAG_VARIABLE_PIPELINE_ID:
+			default:
+				return fmt.Errorf("%w: unknown variable %q in tag, expected one of: %s", ErrInvalidDockerBuild, match[1],
+					strings.Join([]string{TAG_VARIABLE_COMMIT, TAG_VARIABLE_COMMIT_SHORT, TAG_VARIABLE_BRANCH, TAG_VARIABLE_REF, TAG_VARIABLE_PIPELINE_ID}, ", "))
+			}
+		}
+
+		// tag is checked with every variable set to a value which is valid anywhere in a tag
+		if _, err := expandTag(tag, func(string) string { return "x" }); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func isRelativeInside(file string) bool {
+	cleaned := path.Clean(file)
+	return !path.IsAbs(file) && cleaned != ".." && !strings.HasPrefix(cleaned, "../")
+}
+
+func (b DockerBuild) ContextDir() string {
+	if b.Context == "" {
+		return DEFAULT_DOCKER_CONTEXT
+	}
+	return b.Context
+}
+
+// DockerfileName returns path of Dockerfile inside context, it has to be sent with context to docker daemon.
+func (b DockerBuild) DockerfileName() string {
+	if b.Dockerfile == "" {
+		return DEFAULT_DOCKERFILE
+	}
+	return b.Dockerfile
+}
+
+// ExpandTags returns tags with variables replaced by their values, tag without tag part gets latest.
+func (b DockerBuild) ExpandTags(variables map[string]string) ([]string, error) {
+	tags := make([]string, 0, len(b.Tags))
+	for _, tag := range b.Tags {
+		expanded, err := expandTag(tag, func(name string) string {
+			return invalidTagCharacter.ReplaceAllString(variables[name], "-")
+		})
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, expanded)
+	}
+	return tags, nil
+}
+
+func expandTag(tag string, value func(name string) string) (string, error) {
+	expanded := groupVariable.ReplaceAllStringFunc(tag, func(variable string) string {
+		return value(variable[2 : len(variable)-1])
+	})
+
+	named, err := reference.ParseNormalizedNamed(expanded)
+	if err != nil {
+		return "", fmt.Errorf("%w: tag %q: %w", ErrInvalidDockerBuild, expanded, err)
+	}
+	if _, ok := named.(reference.Digested); ok {
+		return "", fmt.Errorf("%w: tag %q can't have digest", ErrInvalidDockerBuild, expanded)
+	}
+
+	return reference.FamiliarString(reference.TagNameOnly(named)), nil
+}
+
+// Registry returns host of registry which tag is pushed to, tags without one are pushed to docker hub.
+func Registry(tag string) string {
+	named, err := reference.ParseNormalizedNamed(tag)
+	if err != nil {
+		return DEFAULT_REGISTRY
+	}
+	return reference.Domain(named)
+}
+
+// Command returns how step is shown in logs.
+func (s Step) Command() string {
+	if s.DockerBuild == nil {
+		return s.Run
+	}
+	return fmt.Sprintf("%s %s", DOCKER_BUILD_STEP_COMMAND, strings.Join(s.DockerBuild.Tags, " "))
+}
@@ -0,0 +1,399 @@
+package jobs
+
+import (
+	"errors"
+	"fmt"
+	"path"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	MAX_INCLUDE_DEPTH = 10
+	HIDDEN_JOB_PREFIX = "."
+)
+
+var ErrInvalidInclude = errors.New("invalid include")
+
+// Include is either a path of file in pipeline repository or a file of another repository at pinned ref.
+type Include struct {
+	Local      string `yaml:"local,omitempty"`
+	Repository string `yaml:"repository,omitempty"`
+	Ref        string `yaml:"ref,omitempty"`
+	File       string `yaml:"file,omitempty"`
+}
+
+func (i *Include) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*i = Include{Local: node.Value}
+		return nil
+	}
+
+	type plain Include
+	return node.Decode((*plain)(i))
+}
+
+func (Include) JSONSchema() map[string]any {
+	return map[string]any{
+		"oneOf": []any{
+			map[string]any{"type": "string"},
+			map[string]any{
+				"type":                 "object",
+				"properties":           map[string]any{"local": map[string]any{"type": "string"}},
+				"required":             []string{"local"},
+				"additionalProperties": false,
+			},
+			map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"repository": map[string]any{"type": "string"},
+					"ref":        map[string]any{"type": "string"},
+					"file":       map[string]any{"type": "string"},
+				},
+				"required":             []string{"repository", "ref", "file"},
+				"additionalProperties": false,
+			},
+		},
+	}
+}
+
+func (i Include) Validate() error {
+	if i.Local != "" {
+		if i.Repository != "" || i.Ref != "" || i.File != "" {
+			return fmt.Errorf("%w: local include can't have repository, ref or file", ErrInvalidInclude)
+		}
+		return ValidateConfigPath(i.Local)
+	}
+
+	if i.Repository == "" || i.Ref == "" || i.File == "" {
+		return fmt.Errorf("%w: include has to have either local or repository, ref and file", ErrInvalidInclude)
+	}
+	return ValidateConfigPath(i.File)
+}
+
+// Loader reads included files, empty repository means repository of pipeline at its commit.
+type Loader interface {
+	Load(repository, ref, file string) ([]byte, error)
+}
+
+type source struct {
+	repository string
+	ref        string
+	file       string
+}
+
+func (s source) String() string {
+	if s.repository == "" {
+		return s.file
+	}
+	return fmt.Sprintf("%s@%s:%s", s.repository, s.ref, s.file)
+}
+
+type expander struct {
+	loader  Loader
+	loading map[source]bool
+}
+
+// Expand resolves includes, extends, anchors and merge keys of ci config and returns config which has none of them.
+// Config without includes and extends is returned as is, so diagnostics point to lines of the original file.
+func Expand(data []byte, loader Loader) ([]byte, error) {
+	const op = "jobs.Expand"
+
+	document, err := parseDocument(data)
+	if err != nil {
+		return nil, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+	if !needsExpansion(document) {
+		return data, nil
+	}
+
+	expanded, err := newExpander(loader).expandDocument(document)
+	if err != nil {
+		return nil, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	result, err := yaml.Marshal(&yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{expanded}})
+	if err != nil {
+		return nil, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	return result, nil
+}
+
+func newExpander(loader Loader) *expander {
+	return &expander{loader: loader, loading: make(map[source]bool)}
+}
+
+func (e *expander) expandDocument(document *yaml.Node) (*yaml.Node, error) {
+	expanded, err := e.expand(document, source{}, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	_, jobsNode := findKeyNode(expanded, "jobs")
+	if jobsNode != nil && jobsNode.Kind == yaml.MappingNode {
+		if err := resolveExtends(jobsNode); err != nil {
+			return nil, err
+		}
+	}
+
+	return expanded, nil
+}
+
+func needsExpansion(document *yaml.Node) bool {
+	if includeKey, _ := findKeyNode(document, "include"); includeKey != nil {
+		return true
+	}
+
+	_, jobsNode := findKeyNode(document, "jobs")
+	if jobsNode == nil || jobsNode.Kind != yaml.MappingNode {
+		return false
+	}
+	for _, pair := range mappingPairs(jobsNode) {
+		body := resolveAlias(pair[1])
+		if body.Kind != yaml.MappingNode {
+			continue
+		}
+		if extendsKey, _ := findKeyNode(body, "extends"); extendsKey != nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+// expand returns document with included files merged in, keys of including file win over included ones.
+func (e *expander) expand(document *yaml.Node, from source, depth int) (*yaml.Node, error) {
+	document = flatten(document)
+
+	result := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	jobs := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+
+	if includeKey, includeNode := findKeyNode(document, "include"); includeNode != nil {
+		var includes []Include
+		if err := DecodeStrict(includeNode, &includes); err != nil {
+			return nil, err
+		}
+		if depth >= MAX_INCLUDE_DEPTH {
+			return nil, newConfigError(includeKey, "include", "includes are nested deeper than %d files", MAX_INCLUDE_DEPTH)
+		}
+
+		for i, include := range includes {
+			includePath := fmt.Sprintf("include[%d]", i)
+			if err := include.Validate(); err != nil {
+				return nil, newConfigError(includeNode.Content[i], includePath, "%s", err.Error())
+			}
+
+			// NOTE: local includes of other repository files are resolved in that repository
+			included := source{repository: from.repository, ref: from.ref, file: include.Local}
+			if include.Local == "" {
+				included = source{repository: include.Repository, ref: include.Ref, file: include.File}
+			}
+			included.file = path.Clean(included.file)
+
+			if e.loading[included] {
+				return nil, newConfigError(includeNode.Content[i], includePath, "include cycle through %s", included)
+			}
+
+			data, err := e.loader.Load(included.repository, included.ref, included.file)
+			if err != nil {
+				return nil, newConfigError(includeNode.Content[i], includePath, "can't load %s: %s", included, err.Error())
+			}
+
+			e.loading[included] = true
+			expanded, err := e.expandFile(data, included, depth+1)
+			delete(e.loading, included)
+			if err != nil {
+				return nil, err
+			}
+
+			mergeDocument(result, jobs, expanded)
+		}
+	}
+
+	mergeDocument(result, jobs, document)
+
+	return result, nil
+}
+
+// expandFile expands included file, errors in it point to the file they are found in.
+func (e *expander) expandFile(data []byte, from source, depth int) (*yaml.Node, error) {
+	document, err := parseDocument(data)
+	if err == nil {
+		document, err = e.expand(document, from, depth)
+	}
+
+	var configErr *ConfigError
+	if errors.As(err, &configErr) && configErr.File == "" {
+		configErr.File = from.String()
+	}
+
+	return document, err
+}
+
+// mergeDocument merges top-level keys of document into result, jobs are merged one by one.
+func mergeDocument(result, jobs, document *yaml.Node) {
+	for _, pair := range mappingPairs(document) {
+		switch pair[0].Value {
+		case "include":
+			continue
+		case "jobs":
+			if !hasKey(result, "jobs") {
+				setKey(result, "jobs", jobs)
+			}
+			if pair[1].Kind != yaml.MappingNode {
+				setKey(result, "jobs", pair[1])
+				continue
+			}
+			for _, job := range mappingPairs(pair[1]) {
+				setKey(jobs, job[0].Value, job[1])
+			}
+		default:
+			_, existing := findKeyNode(result, pair[0].Value)
+			if existing != nil && existing.Kind == yaml.MappingNode && pair[1].Kind == yaml.MappingNode {
+				setKey(result, pair[0].Value, mergeMappings(existing, pair[1]))
+				continue
+			}
+			setKey(result, pair[0].Value, pair[1])
+		}
+	}
+}
+
+// resolveExtends replaces body of every job which extends other jobs with bodies of those jobs merged with its own.
+func resolveExtends(jobsNode *yaml.Node) error {
+	bodies := make(map[string]*yaml.Node)
+	var names []string
+	for _, pair := range mappingPairs(jobsNode) {
+		bodies[pair[0].Value] = pair[1]
+		names = append(names, pair[0].Value)
+	}
+
+	resolved := make(map[string]*yaml.Node)
+	resolving := make(map[string]bool)
+
+	var resolve func(name string) (*yaml.Node, error)
+	resolve = func(name string) (*yaml.Node, error) {
+		if body, ok := resolved[name]; ok {
+			return body, nil
+		}
+
+		body := bodies[name]
+		extendsKey, extendsNode := findKeyNode(body, "extends")
+		if body.Kind != yaml.MappingNode || extendsNode == nil {
+			resolved[name] = body
+			return body, nil
+		}
+
+		var extends Needs
+		if err := DecodeStrict(extendsNode, &extends); err != nil {
+			return nil, err
+		}
+
+		resolving[name] = true
+		merged := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		for _, base := range extends {
+			path := joinPath("jobs."+name, "extends")
+			if _, ok := bodies[base]; !ok {
+				return nil, newConfigError(extendsKey, path, "job %q extends unknown job %q", name, base)
+			}
+			if resolving[base] {
+				return nil, newConfigError(extendsKey, path, "extends cycle through job %q", base)
+			}
+
+			baseBody, err := resolve(base)
+			if err != nil {
+				return nil, err
+			}
+			merged = mergeMappings(merged, baseBody)
+		}
+		resolving[name] = false
+
+		own := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Line: body.Line, Column: body.Column}
+		for _, pair := range mappingPairs(body) {
+			if pair[0].Value != "extends" {
+				own.Content = append(own.Content, pair[0], pair[1])
+			}
+		}
+		merged = mergeMappings(merged, own)
+
+		resolved[name] = merged
+		return merged, nil
+	}
+
+	for _, name := range names {
+		body, err := resolve(name)
+		if err != nil {
+			return err
+		}
+		setKey(jobsNode, name, body)
+	}
+
+	// NOTE: hidden jobs are only templates for extends, so they are dropped once extends are resolved
+	content := make([]*yaml.Node, 0, len(jobsNode.Content))
+	for i := 0; i+1 < len(jobsNode.Content); i += 2 {
+		if !isHiddenJob(jobsNode.Content[i].Value) {
+			content = append(content, jobsNode.Content[i], jobsNode.Content[i+1])
+		}
+	}
+	jobsNode.Content = content
+
+	return nil
+}
+
+// mergeMappings returns base with keys of override, nested mappings are merged, any other value is replaced.
+func mergeMappings(base, override *yaml.Node) *yaml.Node {
+	result := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Line: override.Line, Column: override.Column}
+	result.Content = append(result.Content, base.Content...)
+
+	for _, pair := range mappingPairs(override) {
+		_, existing := findKeyNode(result, pair[0].Value)
+		if existing != nil && existing.Kind == yaml.MappingNode && pair[1].Kind == yaml.MappingNode {
+			setKey(result, pair[0].Value, mergeMappings(existing, pair[1]))
+			continue
+		}
+		setKey(result, pair[0].Value, pair[1])
+	}
+
+	return result
+}
+
+// flatten returns copy of node where aliases are replaced with nodes they point to and merge keys are expanded.
+func flatten(node *yaml.Node) *yaml.Node {
+	node = resolveAlias(node)
+
+	copied := *node
+	copied.Anchor = ""
+	switch node.Kind {
+	case yaml.MappingNode:
+		copied.Content = nil
+		for _, pair := range mappingPairs(node) {
+			copied.Content = append(copied.Content, flatten(pair[0]), flatten(pair[1]))
+		}
+	case yaml.SequenceNode:
+		copied.Content = make([]*yaml.Node, len(node.Content))
+		for i, item := range node.Content {
+			copied.Content[i] = flatten(item)
+		}
+	}
+
+	return &copied
+}
+
+func isHiddenJob(name string) bool {
+	return len(name) > 0 && name[:1] == HIDDEN_JOB_PREFIX
+}
+
+func hasKey(mapping *yaml.Node, key string) bool {
+	keyNode, _ := findKeyNode(mapping, key)
+	return keyNode != nil
+}
+
+func setKey(mapping *yaml.Node, key string, value *yaml.Node) {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			mapping.Content[i+1] = value
+			return
+		}
+	}
+	mapping.Content = append(mapping.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, value)
+}
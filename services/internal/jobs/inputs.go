@@ -0,0 +1,183 @@
+package jobs
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	INPUT_TYPE_STRING  = "string"
+	INPUT_TYPE_BOOLEAN = "boolean"
+	INPUT_TYPE_NUMBER  = "number"
+	INPUT_TYPE_CHOICE  = "choice"
+
+	INPUT_ENV_PREFIX = "INPUT_"
+)
+
+var (
+	ErrInvalidInputs = errors.New("invalid pipeline inputs")
+
+	inputName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+)
+
+type InputType string
+
+func (t *InputType) UnmarshalYAML(node *yaml.Node) error {
+	var value string
+	if err := node.Decode(&value); err != nil {
+		return err
+	}
+
+	switch value {
+	case INPUT_TYPE_STRING, INPUT_TYPE_BOOLEAN, INPUT_TYPE_NUMBER, INPUT_TYPE_CHOICE:
+		*t = InputType(value)
+		return nil
+	}
+	return fmt.Errorf("unknown input type %q, expected one of: %s", value, strings.Join(inputTypes(), ", "))
+}
+
+func (InputType) JSONSchema() map[string]any {
+	return map[string]any{
+		"type": "string",
+		"enum": inputTypes(),
+	}
+}
+
+func inputTypes() []string {
+	return []string{INPUT_TYPE_STRING, INPUT_TYPE_BOOLEAN, INPUT_TYPE_NUMBER, INPUT_TYPE_CHOICE}
+}
+
+// Input is a parameter of pipeline which is given when pipeline is run and is passed to steps as env variable.
+type Input struct {
+	Type        InputType `yaml:"type"`
+	Description string    `yaml:"description,omitempty"`
+	Default     any       `yaml:"default,omitempty"`
+	Options     []string  `yaml:"options,omitempty"`
+	Required    bool      `yaml:"required,omitempty"`
+}
+
+func (i Input) Validate(name string) error {
+	if !inputName.MatchString(name) {
+		return fmt.Errorf("%w: input name %q has to contain only letters, digits and underscores", ErrInvalidInputs, name)
+	}
+
+	if i.Type == INPUT_TYPE_CHOICE && len(i.Options) == 0 {
+		return fmt.Errorf("%w: choice input %q has no options", ErrInvalidInputs, name)
+	}
+	if i.Type != INPUT_TYPE_CHOICE && len(i.Options) > 0 {
+		return fmt.Errorf("%w: only choice input can have options", ErrInvalidInputs)
+	}
+
+	if i.Default != nil {
+		if _, err := i.value(name, i.Default); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// value returns input value as it is passed to steps.
+func (i Input) value(name string, value any) (string, error) {
+	switch i.Type {
+	case INPUT_TYPE_BOOLEAN:
+		switch v := value.(type) {
+		case bool:
+			return strconv.FormatBool(v), nil
+		case string:
+			if parsed, err := strconv.ParseBool(v); err == nil {
+				return strconv.FormatBool(parsed), nil
+			}
+		}
+		return "", fmt.Errorf("%w: input %q has to be a boolean", ErrInvalidInputs, name)
+	case INPUT_TYPE_NUMBER:
+		var number float64
+		switch v := value.(type) {
+		case int:
+			number = float64(v)
+		case int64:
+			number = float64(v)
+		case float64:
+			number = v
+		case string:
+			parsed, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return "", fmt.Errorf("%w: input %q has to be a number", ErrInvalidInputs, name)
+			}
+			number = parsed
+		default:
+			return "", fmt.Errorf("%w: input %q has to be a number", ErrInvalidInputs, name)
+		}
+		return strconv.FormatFloat(number, 'f', -1, 64), nil
+	case INPUT_TYPE_CHOICE:
+		v, ok := value.(string)
+		if !ok || !slices.Contains(i.Options, v) {
+			return "", fmt.Errorf("%w: input %q has to be one of: %s", ErrInvalidInputs, name, strings.Join(i.Options, ", "))
+		}
+		return v, nil
+	default:
+		v, ok := value.(string)
+		if !ok {
+			return "", fmt.Errorf("%w: input %q has to be a string", ErrInvalidInputs, name)
+		}
+		return v, nil
+	}
+}
+
+// ResolveInputs checks provided inputs against declared ones and returns values of all inputs with defaults applied.
+func ResolveInputs(declared map[string]Input, provided map[string]any) (map[string]string, error) {
+	for _, name := range sortedKeys(provided) {
+		if _, ok := declared[name]; !ok {
+			return nil, fmt.Errorf("%w: unknown input %q", ErrInvalidInputs, name)
+		}
+	}
+
+	values := make(map[string]string, len(declared))
+	for _, name := range sortedKeys(declared) {
+		input := declared[name]
+
+		value, ok := provided[name]
+		if !ok || value == nil {
+			if input.Default == nil {
+				if input.Required {
+					return nil, fmt.Errorf("%w: missing required input %q", ErrInvalidInputs, name)
+				}
+				continue
+			}
+			value = input.Default
+		}
+
+		resolved, err := input.value(name, value)
+		if err != nil {
+			return nil, err
+		}
+		values[name] = resolved
+	}
+
+	return values, nil
+}
+
+// InputsEnv returns env variables of inputs, name of input is upper cased and prefixed with INPUT_.
+func InputsEnv(values map[string]string) []string {
+	env := make([]string, 0, len(values))
+	for _, name := range sortedKeys(values) {
+		env = append(env, INPUT_ENV_PREFIX+strings.ToUpper(name)+"="+values[name])
+	}
+	return env
+}
+
+func sortedKeys[V any](values map[string]V) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -1,65 +1,318 @@
 package jobs
 
 import (
+	"errors"
 	"fmt"
+	"pipecraft/internal/vcs"
+	"reflect"
+	"slices"
+	"strings"
 
 	"gopkg.in/yaml.v3"
 )
 
+// Step either runs command in pipeline container or builds docker image.
 type Step struct {
-	Name string `yaml:"name"`
-	Run  string `yaml:"run"`
+	Name        string       `yaml:"name,omitempty"`
+	Run         string       `yaml:"run,omitempty"`
+	DockerBuild *DockerBuild `yaml:"docker-build,omitempty"`
+}
+
+func (Step) JSONSchema() map[string]any {
+	schema := structSchema(reflect.TypeOf(Step{}))
+	schema["oneOf"] = []any{
+		map[string]any{"required": []string{"run"}},
+		map[string]any{"required": []string{"docker-build"}},
+	}
+	return schema
+}
+
+// Needs accepts both single job name and list of job names.
+type Needs []string
+
+func (n *Needs) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*n = Needs{node.Value}
+		return nil
+	}
+
+	var needs []string
+	if err := node.Decode(&needs); err != nil {
+		return err
+	}
+	*n = needs
+	return nil
+}
+
+func (Needs) JSONSchema() map[string]any {
+	return map[string]any{
+		"oneOf": []any{
+			map[string]any{"type": "string"},
+			map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+		},
+	}
+}
+
+const (
+	WHEN_ON_SUCCESS = "on_success"
+	WHEN_MANUAL     = "manual"
+)
+
+// When is condition of running job, manual jobs wait for approval before they start.
+type When string
+
+func (w *When) UnmarshalYAML(node *yaml.Node) error {
+	var value string
+	if err := node.Decode(&value); err != nil {
+		return err
+	}
+
+	switch value {
+	case WHEN_ON_SUCCESS, WHEN_MANUAL:
+		*w = When(value)
+		return nil
+	}
+	return fmt.Errorf("unknown when %q, expected one of: %s, %s", value, WHEN_ON_SUCCESS, WHEN_MANUAL)
+}
+
+func (When) JSONSchema() map[string]any {
+	return map[string]any{
+		"type": "string",
+		"enum": []string{WHEN_ON_SUCCESS, WHEN_MANUAL},
+	}
+}
+
+// Trigger runs pipeline of branch of another repository, job waiting for it gets its result.
+type Trigger struct {
+	Repository string         `yaml:"repository"`
+	Branch     string         `yaml:"branch"`
+	Inputs     map[string]any `yaml:"inputs,omitempty"`
+	Wait       bool           `yaml:"wait,omitempty"`
+}
+
+type JobConfig struct {
+	Extends     Needs        `yaml:"extends,omitempty"`
+	Needs       Needs        `yaml:"needs,omitempty"`
+	When        When         `yaml:"when,omitempty"`
+	RunsOn      []string     `yaml:"runs-on,omitempty"`
+	Resources   *Resources   `yaml:"resources,omitempty"`
+	Concurrency *Concurrency `yaml:"concurrency,omitempty"`
+	Trigger     *Trigger     `yaml:"trigger,omitempty"`
+	Steps       []Step       `yaml:"steps,omitempty"`
+}
+
+// Config is the format of ci config file, schema of the format is generated from it.
+// Jobs with names starting with a dot are templates for extends and are never run.
+type Config struct {
+	Include     []Include            `yaml:"include,omitempty"`
+	Inputs      map[string]Input     `yaml:"inputs,omitempty"`
+	Concurrency *Concurrency         `yaml:"concurrency,omitempty"`
+	AutoCancel  *AutoCancel          `yaml:"auto-cancel,omitempty"`
+	Checkout    vcs.CheckoutOptions  `yaml:"checkout,omitempty"`
+	Jobs        map[string]JobConfig `yaml:"jobs"`
 }
 
 type Job struct {
-	Name  string
-	Steps []Step
+	Name        string
+	Needs       []string
+	Manual      bool
+	RunsOn      []string
+	Resources   *Resources
+	Concurrency *Concurrency
+	Trigger     *Trigger
+	Steps       []Step
 }
 
-func ParseJobsOrdered(data []byte) ([]Job, error) {
-	const op = "jobs.ParseJobsOrdered"
+type Pipeline struct {
+	Inputs      map[string]Input
+	Concurrency *Concurrency
+	AutoCancel  *AutoCancel
+	Checkout    vcs.CheckoutOptions
+	Jobs        []Job
+}
 
-	var root yaml.Node
-	if err := yaml.Unmarshal(data, &root); err != nil {
-		return nil, fmt.Errorf("op: %s, err: %w", op, err)
+var ErrDependencyCycle = errors.New("jobs dependency cycle")
+
+// RunsOn returns sorted labels which runner of pipeline has to have, jobs of pipeline share workspace, so the whole
+// pipeline runs on runner which has labels of every job.
+func (p *Pipeline) RunsOn() []string {
+	labels := make([]string, 0)
+	for _, job := range p.Jobs {
+		for _, label := range job.RunsOn {
+			if !slices.Contains(labels, label) {
+				labels = append(labels, label)
+			}
+		}
 	}
+	slices.Sort(labels)
+	return labels
+}
 
-	var jobsNode *yaml.Node
-	for i := 0; i < len(root.Content[0].Content); i += 2 {
-		if root.Content[0].Content[i].Value == "jobs" {
-			jobsNode = root.Content[0].Content[i+1]
-			break
+// HasLabels reports whether labels include every required label.
+func HasLabels(labels, required []string) bool {
+	for _, label := range required {
+		if !slices.Contains(labels, label) {
+			return false
 		}
 	}
+	return true
+}
+
+func ParsePipeline(data []byte) (*Pipeline, error) {
+	const op = "jobs.ParsePipeline"
 
-	if jobsNode == nil {
-		return nil, fmt.Errorf("op: %s, err: no jobs found", op)
+	document, err := parseDocument(data)
+	if err != nil {
+		return nil, fmt.Errorf("op: %s, err: %w", op, err)
 	}
 
-	var jobs []Job
-	for i := 0; i < len(jobsNode.Content); i += 2 {
-		jobName := jobsNode.Content[i].Value
-		jobBody := jobsNode.Content[i+1]
+	var config Config
+	if err := DecodeStrict(document, &config); err != nil {
+		return nil, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+	if err := config.Checkout.Validate(); err != nil {
+		return nil, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+	if config.Concurrency != nil {
+		if err := config.Concurrency.Validate(); err != nil {
+			concurrencyKey, _ := findKeyNode(document, "concurrency")
+			return nil, fmt.Errorf("op: %s, err: %w", op, newConfigError(concurrencyKey, "concurrency", "%s", err.Error()))
+		}
+	}
 
-		var steps []Step
-		for j := 0; j < len(jobBody.Content); j += 2 {
-			if jobBody.Content[j].Value == "steps" {
-				stepsNode := jobBody.Content[j+1]
-				for _, stepNode := range stepsNode.Content {
-					var step Step
-					if err := stepNode.Decode(&step); err != nil {
-						return nil, fmt.Errorf("op: %s, err: %w", op, err)
-					}
-					steps = append(steps, step)
-				}
+	if _, inputsNode := findKeyNode(document, "inputs"); inputsNode != nil {
+		for _, pair := range mappingPairs(inputsNode) {
+			name := pair[0].Value
+			if err := config.Inputs[name].Validate(name); err != nil {
+				return nil, fmt.Errorf("op: %s, err: %w", op, newConfigError(pair[0], "inputs."+name, "%s", err.Error()))
 			}
 		}
+	}
 
+	// NOTE: map loses order of jobs, so it is taken from document
+	_, jobsNode := findKeyNode(document, "jobs")
+	jobs := make([]Job, 0, len(config.Jobs))
+	for _, pair := range mappingPairs(jobsNode) {
+		name := pair[0].Value
+		if isHiddenJob(name) {
+			continue
+		}
+		if len(config.Jobs[name].Extends) > 0 || len(config.Include) > 0 {
+			return nil, fmt.Errorf("op: %s, err: %w", op, newConfigError(pair[0], "jobs."+name, "config has to be expanded before parsing"))
+		}
+		jobConfig := config.Jobs[name]
+		if jobConfig.Trigger != nil && len(jobConfig.Steps) > 0 {
+			return nil, fmt.Errorf("op: %s, err: %w", op, newConfigError(pair[0], "jobs."+name, "job can't have both trigger and steps"))
+		}
+		for _, label := range jobConfig.RunsOn {
+			if strings.TrimSpace(label) == "" {
+				return nil, fmt.Errorf("op: %s, err: %w", op, newConfigError(pair[0], "jobs."+name+".runs-on", "runner label can't be empty"))
+			}
+		}
+		if jobConfig.Resources != nil {
+			if err := jobConfig.Resources.Validate(); err != nil {
+				return nil, fmt.Errorf("op: %s, err: %w", op, newConfigError(pair[0], "jobs."+name+".resources", "%s", err.Error()))
+			}
+		}
+		if jobConfig.Concurrency != nil {
+			if err := jobConfig.Concurrency.Validate(); err != nil {
+				return nil, fmt.Errorf("op: %s, err: %w", op, newConfigError(pair[0], "jobs."+name+".concurrency", "%s", err.Error()))
+			}
+		}
+		_, stepsNode := findKeyNode(pair[1], "steps")
+		for i, step := range jobConfig.Steps {
+			stepNode := stepsNode.Content[i]
+			stepPath := fmt.Sprintf("jobs.%s.steps[%d]", name, i)
+			if (step.Run == "") == (step.DockerBuild == nil) {
+				return nil, fmt.Errorf("op: %s, err: %w", op, newConfigError(stepNode, stepPath, "step has to have either run or docker-build"))
+			}
+			if step.DockerBuild != nil {
+				if err := step.DockerBuild.Validate(); err != nil {
+					return nil, fmt.Errorf("op: %s, err: %w", op, newConfigError(stepNode, stepPath+".docker-build", "%s", err.Error()))
+				}
+			}
+		}
 		jobs = append(jobs, Job{
-			Name:  jobName,
-			Steps: steps,
+			Name:        name,
+			Needs:       jobConfig.Needs,
+			Manual:      jobConfig.When == WHEN_MANUAL,
+			RunsOn:      jobConfig.RunsOn,
+			Resources:   jobConfig.Resources,
+			Concurrency: jobConfig.Concurrency,
+			Trigger:     jobConfig.Trigger,
+			Steps:       jobConfig.Steps,
 		})
 	}
+	if len(jobs) == 0 {
+		return nil, fmt.Errorf("op: %s, err: %w", op, newConfigError(jobsNode, "jobs", "no jobs found"))
+	}
+
+	jobs, err = OrderJobs(jobs)
+	if err != nil {
+		return nil, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	return &Pipeline{
+		Inputs:      config.Inputs,
+		Concurrency: config.Concurrency,
+		AutoCancel:  config.AutoCancel,
+		Checkout:    config.Checkout,
+		Jobs:        jobs,
+	}, nil
+}
+
+// parseDocument returns root mapping of ci config.
+func parseDocument(data []byte) (*yaml.Node, error) {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, syntaxError(err)
+	}
+
+	if root.Kind != yaml.DocumentNode || len(root.Content) == 0 {
+		return nil, &ConfigError{Line: 1, Message: "config is empty"}
+	}
+
+	document := resolveAlias(root.Content[0])
+	if document.Kind != yaml.MappingNode {
+		return nil, newConfigError(document, "", "config has to be a mapping")
+	}
+
+	return document, nil
+}
+
+// OrderJobs sorts jobs so every job runs after jobs it needs, keeping order of config otherwise.
+func OrderJobs(jobs []Job) ([]Job, error) {
+	done := make(map[string]bool, len(jobs))
+	ordered := make([]Job, 0, len(jobs))
+
+	for len(ordered) < len(jobs) {
+		progress := false
+		for _, job := range jobs {
+			if done[job.Name] {
+				continue
+			}
+
+			ready := true
+			for _, need := range job.Needs {
+				if !done[need] {
+					ready = false
+					break
+				}
+			}
+			if !ready {
+				continue
+			}
+
+			done[job.Name] = true
+			ordered = append(ordered, job)
+			progress = true
+			break
+		}
+
+		if !progress {
+			return nil, ErrDependencyCycle
+		}
+	}
 
-	return jobs, nil
+	return ordered, nil
 }
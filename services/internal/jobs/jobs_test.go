@@ -0,0 +1,688 @@
+package jobs
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const PUBLISHED_SCHEMA_PATH = "../../schema/ci.schema.json"
+
+var updateSchema = flag.Bool("update-schema", false, "regenerate published ci config schema")
+
+type mapLoader map[string]string
+
+func (l mapLoader) Load(repository, ref, file string) ([]byte, error) {
+	key := file
+	if repository != "" {
+		key = repository + "@" + ref + ":" + file
+	}
+
+	data, ok := l[key]
+	if !ok {
+		return nil, errors.New("file not found")
+	}
+	return []byte(data), nil
+}
+
+func findDiagnostic(diagnostics []Diagnostic, line int, severity string) *Diagnostic {
+	for _, diagnostic := range diagnostics {
+		if diagnostic.Line == line && diagnostic.Severity == severity {
+			return &diagnostic
+		}
+	}
+	return nil
+}
+
+func TestLint_Valid(t *testing.T) {
+	data := []byte(`checkout:
+  depth: 10
+jobs:
+  build:
+    steps:
+      - name: build
+        run: go build ./...
+  test:
+    needs: build
+    steps:
+      - name: test
+        run: go test ./...
+`)
+
+	diagnostics := Lint(data)
+	require.Empty(t, diagnostics)
+	require.False(t, HasErrors(diagnostics))
+}
+
+func TestLint_SyntaxError(t *testing.T) {
+	data := []byte(`jobs:
+  build:
+    steps: [
+`)
+
+	diagnostics := Lint(data)
+	require.True(t, HasErrors(diagnostics))
+	require.NotZero(t, diagnostics[0].Line)
+
+	for _, data := range [][]byte{[]byte(""), []byte("- build"), []byte("jobs: build")} {
+		require.True(t, HasErrors(Lint(data)), string(data))
+	}
+}
+
+func TestLint_Problems(t *testing.T) {
+	data := []byte(`image: alpine
+jobs:
+  build:
+    steps:
+      - name: build
+        run: go build ./...
+        timeout: 10
+  test:
+    steps:
+      - name: test
+  build:
+    steps: []
+  lint:
+    steps:
+      - run: ""
+  docs:
+    name: docs
+`)
+
+	diagnostics := Lint(data)
+	require.True(t, HasErrors(diagnostics))
+
+	// unknown top-level, step and job keys
+	require.NotNil(t, findDiagnostic(diagnostics, 1, SEVERITY_ERROR))
+	require.NotNil(t, findDiagnostic(diagnostics, 7, SEVERITY_ERROR))
+	require.NotNil(t, findDiagnostic(diagnostics, 17, SEVERITY_ERROR))
+	// missing run
+	require.NotNil(t, findDiagnostic(diagnostics, 10, SEVERITY_ERROR))
+	// duplicate job
+	duplicate := findDiagnostic(diagnostics, 11, SEVERITY_ERROR)
+	require.NotNil(t, duplicate)
+	require.Equal(t, 3, duplicate.Column)
+	// empty run
+	require.NotNil(t, findDiagnostic(diagnostics, 15, SEVERITY_ERROR))
+	// job without steps
+	require.NotNil(t, findDiagnostic(diagnostics, 16, SEVERITY_WARNING))
+}
+
+func TestLint_Needs(t *testing.T) {
+	data := []byte(`jobs:
+  build:
+    needs: [test]
+    steps:
+      - run: make build
+  test:
+    needs: [build]
+    steps:
+      - run: make test
+  deploy:
+    needs: [publish, deploy]
+    steps:
+      - run: make deploy
+`)
+
+	diagnostics := Lint(data)
+	require.NotNil(t, findDiagnostic(diagnostics, 11, SEVERITY_ERROR))
+
+	cycles := 0
+	for _, diagnostic := range diagnostics {
+		if diagnostic.Message == "dependency cycle: build -> test -> build" {
+			cycles++
+		}
+	}
+	require.Equal(t, 1, cycles)
+	require.Len(t, diagnostics, 3)
+}
+
+func TestParsePipeline_OrdersJobsByNeeds(t *testing.T) {
+	data := []byte(`jobs:
+  deploy:
+    needs: [build, test]
+    steps:
+      - run: make deploy
+  test:
+    needs: build
+    steps:
+      - run: make test
+  build:
+    steps:
+      - run: make build
+  docs:
+    steps:
+      - run: make docs
+`)
+
+	pipeline, err := ParsePipeline(data)
+	require.NoError(t, err)
+
+	names := make([]string, len(pipeline.Jobs))
+	for i, job := range pipeline.Jobs {
+		names[i] = job.Name
+	}
+	require.Equal(t, []string{"build", "test", "deploy", "docs"}, names)
+
+	_, err = OrderJobs([]Job{{Name: "a", Needs: []string{"b"}}, {Name: "b", Needs: []string{"a"}}})
+	require.ErrorIs(t, err, ErrDependencyCycle)
+}
+
+func TestParsePipeline_Strict(t *testing.T) {
+	cases := []struct {
+		data string
+		path string
+		line int
+	}{
+		{data: "", line: 1},
+		{data: "# only comment\n", line: 1},
+		{data: "- build\n", line: 1},
+		{data: "jobs:\n  build: make\n", path: "jobs.build", line: 2},
+		{data: "jobs:\n  build:\n    steps: make\n", path: "jobs.build.steps", line: 3},
+		{data: "jobs:\n  build:\n    steps:\n      - name: build\n        run: make\n        timeout: 10\n", path: "jobs.build.steps[0].timeout", line: 6},
+		{data: "jobs:\n  build:\n    steps:\n      - name: build\n", path: "jobs.build.steps[0]", line: 4},
+		{data: "checkout:\n  depth: deep\njobs:\n  build:\n    steps:\n      - run: make\n", path: "checkout.depth", line: 2},
+		{data: "image: alpine\njobs:\n  build:\n    steps:\n      - run: make\n", path: "image", line: 1},
+	}
+
+	for _, c := range cases {
+		_, err := ParsePipeline([]byte(c.data))
+		require.ErrorIs(t, err, ErrInvalidConfig, c.data)
+
+		var configErr *ConfigError
+		require.ErrorAs(t, err, &configErr, c.data)
+		require.Equal(t, c.path, configErr.Path, c.data)
+		require.Equal(t, c.line, configErr.Line, c.data)
+	}
+}
+
+func TestParsePipeline_Anchors(t *testing.T) {
+	data := []byte(`jobs:
+  build: &defaults
+    steps:
+      - name: build
+        run: make build
+  test:
+    <<: *defaults
+    needs: build
+`)
+
+	pipeline, err := ParsePipeline(data)
+	require.NoError(t, err)
+	require.Len(t, pipeline.Jobs, 2)
+	require.Equal(t, "test", pipeline.Jobs[1].Name)
+	require.Equal(t, []string{"build"}, pipeline.Jobs[1].Needs)
+	require.Equal(t, "make build", pipeline.Jobs[1].Steps[0].Run)
+	require.Empty(t, Lint(data))
+}
+
+func TestParsePipeline_Manual(t *testing.T) {
+	data := []byte(`jobs:
+  build:
+    steps:
+      - run: make build
+  deploy:
+    needs: build
+    when: manual
+    steps:
+      - run: make deploy
+`)
+
+	pipeline, err := ParsePipeline(data)
+	require.NoError(t, err)
+	require.False(t, pipeline.Jobs[0].Manual)
+	require.True(t, pipeline.Jobs[1].Manual)
+
+	invalid := []byte("jobs:\n  deploy:\n    when: sometimes\n    steps:\n      - run: make deploy\n")
+	_, err = ParsePipeline(invalid)
+	require.ErrorIs(t, err, ErrInvalidConfig)
+	require.NotNil(t, findDiagnostic(Lint(invalid), 3, SEVERITY_ERROR))
+}
+
+func TestParsePipeline_RunsOn(t *testing.T) {
+	data := []byte(`jobs:
+  build:
+    runs-on: [linux, large]
+    steps:
+      - run: make build
+  test:
+    needs: build
+    runs-on: [linux, gpu]
+    steps:
+      - run: make test
+  lint:
+    steps:
+      - run: make lint
+`)
+
+	pipeline, err := ParsePipeline(data)
+	require.NoError(t, err)
+	require.Equal(t, []string{"linux", "large"}, pipeline.Jobs[0].RunsOn)
+	require.Equal(t, []string{"gpu", "large", "linux"}, pipeline.RunsOn())
+	require.Empty(t, Lint(data))
+
+	require.True(t, HasLabels([]string{"linux", "large", "gpu", "arm"}, pipeline.RunsOn()))
+	require.False(t, HasLabels([]string{"linux", "large"}, pipeline.RunsOn()))
+	require.True(t, HasLabels(nil, nil))
+
+	invalid := []byte("jobs:\n  build:\n    runs-on: [linux, '']\n    steps:\n      - run: make build\n")
+	_, err = ParsePipeline(invalid)
+	require.ErrorIs(t, err, ErrInvalidConfig)
+}
+
+func TestParsePipeline_Resources(t *testing.T) {
+	data := []byte(`jobs:
+  build:
+    resources:
+      cpus: 4
+      memory: 8g
+    steps:
+      - run: make build
+  test:
+    steps:
+      - run: make test
+`)
+
+	pipeline, err := ParsePipeline(data)
+	require.NoError(t, err)
+	require.Equal(t, &Resources{Cpus: 4, Memory: "8g"}, pipeline.Jobs[0].Resources)
+	require.Nil(t, pipeline.Jobs[1].Resources)
+	require.Empty(t, Lint(data))
+
+	defaults := Resources{Cpus: 2, Memory: "4g", Pids: 1024}
+	require.Equal(t, Resources{Cpus: 4, Memory: "8g", Pids: 1024}, defaults.Merge(pipeline.Jobs[0].Resources))
+	require.Equal(t, defaults, defaults.Merge(pipeline.Jobs[1].Resources))
+
+	memory, err := ParseMemory("512m")
+	require.NoError(t, err)
+	require.Equal(t, int64(512*1024*1024), memory)
+
+	for _, invalid := range []string{"cpus: -1", "memory: lots", "pids: -5"} {
+		data := []byte("jobs:\n  build:\n    resources:\n      " + invalid + "\n    steps:\n      - run: make build\n")
+		_, err = ParsePipeline(data)
+		require.ErrorIs(t, err, ErrInvalidConfig, invalid)
+	}
+}
+
+func TestResources_Within(t *testing.T) {
+	maximums := Resources{Cpus: 8, Memory: "16g", Pids: 4096}
+
+	require.NoError(t, Resources{Cpus: 8, Memory: "16g", Pids: 4096}.Within(maximums))
+	require.NoError(t, Resources{Cpus: 64, Memory: "1t"}.Within(Resources{}))
+
+	// override above maximum is refused instead of being applied
+	for _, override := range []Resources{{Cpus: 8.5}, {Memory: "17g"}, {Pids: 4097}} {
+		err := override.Within(maximums)
+		require.ErrorIs(t, err, ErrInvalidResources, override)
+	}
+}
+
+func TestParsePipeline_Trigger(t *testing.T) {
+	data := []byte(`jobs:
+  build:
+    steps:
+      - run: make build
+  deploy:
+    needs: build
+    trigger:
+      repository: https://github.com/ysayonnar/service.git
+      branch: main
+      inputs:
+        deploy_env: staging
+      wait: true
+`)
+	require.Empty(t, Lint(data))
+
+	pipeline, err := ParsePipeline(data)
+	require.NoError(t, err)
+	require.Nil(t, pipeline.Jobs[0].Trigger)
+
+	trigger := pipeline.Jobs[1].Trigger
+	require.NotNil(t, trigger)
+	require.Equal(t, "https://github.com/ysayonnar/service.git", trigger.Repository)
+	require.Equal(t, "main", trigger.Branch)
+	require.Equal(t, map[string]any{"deploy_env": "staging"}, trigger.Inputs)
+	require.True(t, trigger.Wait)
+
+	invalid := []string{
+		"jobs:\n  deploy:\n    trigger:\n      repository: service\n      branch: main\n    steps:\n      - run: make\n",
+		"jobs:\n  deploy:\n    trigger:\n      branch: main\n",
+		"jobs:\n  deploy:\n    trigger:\n      repository: service\n      branch: main\n      inputs:\n        env: [staging]\n",
+	}
+	for _, data := range invalid {
+		_, err := ParsePipeline([]byte(data))
+		require.ErrorIs(t, err, ErrInvalidConfig, data)
+		require.True(t, HasErrors(Lint([]byte(data))), data)
+	}
+}
+
+func TestParsePipeline_Concurrency(t *testing.T) {
+	data := []byte(`concurrency:
+  group: ci-${repository}-${ref_type}-${ref}
+jobs:
+  build:
+    steps:
+      - run: make build
+  deploy:
+    needs: build
+    concurrency:
+      group: deploy-${branch}
+      cancel-in-progress: true
+    steps:
+      - run: make deploy
+`)
+	require.Empty(t, Lint(data))
+
+	pipeline, err := ParsePipeline(data)
+	require.NoError(t, err)
+	require.False(t, pipeline.Concurrency.CancelInProgress)
+	require.Nil(t, pipeline.Jobs[0].Concurrency)
+	require.True(t, pipeline.Jobs[1].Concurrency.CancelInProgress)
+
+	variables := map[string]string{
+		GROUP_VARIABLE_REPOSITORY: "pipecraft",
+		GROUP_VARIABLE_BRANCH:     "main",
+		GROUP_VARIABLE_REF:        "main",
+		GROUP_VARIABLE_REF_TYPE:   "branch",
+	}
+	require.Equal(t, "ci-pipecraft-branch-main", pipeline.Concurrency.ExpandGroup(variables))
+	require.Equal(t, "deploy-main", pipeline.Jobs[1].Concurrency.ExpandGroup(variables))
+
+	invalid := []string{
+		"concurrency:\n  group: \"\"\njobs:\n  build:\n    steps:\n      - run: make\n",
+		"concurrency:\n  group: deploy-${environment}\njobs:\n  build:\n    steps:\n      - run: make\n",
+		"jobs:\n  build:\n    concurrency:\n      cancel-in-progress: true\n    steps:\n      - run: make\n",
+	}
+	for _, data := range invalid {
+		_, err := ParsePipeline([]byte(data))
+		require.ErrorIs(t, err, ErrInvalidConfig, data)
+		require.True(t, HasErrors(Lint([]byte(data))), data)
+	}
+}
+
+func TestParsePipeline_AutoCancel(t *testing.T) {
+	pipeline, err := ParsePipeline([]byte("jobs:\n  build:\n    steps:\n      - run: make\n"))
+	require.NoError(t, err)
+	require.Nil(t, pipeline.AutoCancel)
+
+	valid := map[string]AutoCancel{
+		"auto-cancel: true\n":              {Enabled: true},
+		"auto-cancel: false\n":             {},
+		"auto-cancel:\n  running: true\n":  {Enabled: true, Running: true},
+		"auto-cancel:\n  running: false\n": {Enabled: true},
+	}
+	for autoCancel, expected := range valid {
+		data := []byte(autoCancel + "jobs:\n  build:\n    steps:\n      - run: make\n")
+		require.Empty(t, Lint(data), autoCancel)
+
+		pipeline, err := ParsePipeline(data)
+		require.NoError(t, err, autoCancel)
+		require.Equal(t, expected, *pipeline.AutoCancel, autoCancel)
+	}
+
+	invalid := []string{
+		"auto-cancel: sometimes\n",
+		"auto-cancel:\n  waiting: true\n",
+		"auto-cancel: [running]\n",
+	}
+	for _, autoCancel := range invalid {
+		data := []byte(autoCancel + "jobs:\n  build:\n    steps:\n      - run: make\n")
+		_, err := ParsePipeline(data)
+		require.ErrorIs(t, err, ErrInvalidConfig, autoCancel)
+		require.True(t, HasErrors(Lint(data)), autoCancel)
+	}
+}
+
+func TestParsePipeline_Inputs(t *testing.T) {
+	data := []byte(`inputs:
+  deploy_env:
+    type: choice
+    options: [staging, prod]
+    default: staging
+  replicas:
+    type: number
+    default: 2
+  dry_run:
+    type: boolean
+  version:
+    type: string
+    required: true
+jobs:
+  deploy:
+    steps:
+      - run: make deploy
+`)
+	require.Empty(t, Lint(data))
+
+	pipeline, err := ParsePipeline(data)
+	require.NoError(t, err)
+	require.Len(t, pipeline.Inputs, 4)
+
+	values, err := ResolveInputs(pipeline.Inputs, map[string]any{"version": "1.2.0", "dry_run": true, "replicas": float64(3)})
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"deploy_env": "staging", "replicas": "3", "dry_run": "true", "version": "1.2.0"}, values)
+	require.Equal(t, []string{"INPUT_DEPLOY_ENV=staging", "INPUT_DRY_RUN=true", "INPUT_REPLICAS=3", "INPUT_VERSION=1.2.0"}, InputsEnv(values))
+
+	invalid := []map[string]any{
+		{},
+		{"version": "1.2.0", "deploy_env": "qa"},
+		{"version": "1.2.0", "replicas": "many"},
+		{"version": "1.2.0", "dry_run": "maybe"},
+		{"version": 1},
+		{"version": "1.2.0", "region": "eu"},
+	}
+	for _, provided := range invalid {
+		_, err := ResolveInputs(pipeline.Inputs, provided)
+		require.ErrorIs(t, err, ErrInvalidInputs, provided)
+	}
+
+	declarations := []string{
+		"inputs:\n  env:\n    type: choice\njobs:\n  build:\n    steps:\n      - run: make\n",
+		"inputs:\n  env:\n    type: list\njobs:\n  build:\n    steps:\n      - run: make\n",
+		"inputs:\n  replicas:\n    type: number\n    default: two\njobs:\n  build:\n    steps:\n      - run: make\n",
+		"inputs:\n  deploy-env:\n    type: string\njobs:\n  build:\n    steps:\n      - run: make\n",
+	}
+	for _, declaration := range declarations {
+		_, err := ParsePipeline([]byte(declaration))
+		require.ErrorIs(t, err, ErrInvalidConfig, declaration)
+		require.True(t, HasErrors(Lint([]byte(declaration))), declaration)
+	}
+}
+
+func TestParsePipeline_DockerBuild(t *testing.T) {
+	data := []byte(`jobs:
+  test:
+    steps:
+      - run: make test
+  image:
+    needs: test
+    steps:
+      - name: build
+        docker-build:
+          context: services
+          dockerfile: docker/app.dockerfile
+          args:
+            VERSION: 1.0.0
+          tags:
+            - localhost:5000/pipecraft:${commit_short}
+            - ysayonnar/pipecraft:${branch}
+            - ysayonnar/pipecraft
+          push: true
+`)
+	require.Empty(t, Lint(data))
+
+	pipeline, err := ParsePipeline(data)
+	require.NoError(t, err)
+
+	step := pipeline.Jobs[1].Steps[0]
+	require.NotNil(t, step.DockerBuild)
+	require.Equal(t, "services", step.DockerBuild.ContextDir())
+	require.Equal(t, "docker/app.dockerfile", step.DockerBuild.DockerfileName())
+	require.Equal(t, map[string]string{"VERSION": "1.0.0"}, step.DockerBuild.Args)
+	require.True(t, step.DockerBuild.Push)
+	require.Equal(t, "docker-build localhost:5000/pipecraft:${commit_short} ysayonnar/pipecraft:${branch} ysayonnar/pipecraft", step.Command())
+	require.Equal(t, "make test", pipeline.Jobs[0].Steps[0].Command())
+
+	tags, err := step.DockerBuild.ExpandTags(map[string]string{
+		TAG_VARIABLE_COMMIT_SHORT: "0123456",
+		TAG_VARIABLE_BRANCH:       "feature/docker",
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"localhost:5000/pipecraft:0123456", "ysayonnar/pipecraft:feature-docker", "ysayonnar/pipecraft:latest"}, tags)
+
+	require.Equal(t, "localhost:5000", Registry(tags[0]))
+	require.Equal(t, DEFAULT_REGISTRY, Registry(tags[1]))
+
+	build := DockerBuild{Tags: []string{"pipecraft"}}
+	require.Equal(t, DEFAULT_DOCKER_CONTEXT, build.ContextDir())
+	require.Equal(t, DEFAULT_DOCKERFILE, build.DockerfileName())
+
+	invalid := []string{
+		"      - run: make\n        docker-build:\n          tags: [pipecraft]\n",
+		"      - name: build\n",
+		"      - docker-build:\n          push: true\n",
+		"      - docker-build:\n          context: ../other\n          tags: [pipecraft]\n",
+		"      - docker-build:\n          dockerfile: /etc/Dockerfile\n          tags: [pipecraft]\n",
+		"      - docker-build:\n          tags: [pipecraft:${version}]\n",
+		"      - docker-build:\n          tags: [Pipecraft]\n",
+		"      - docker-build:\n          tags: [pipecraft@sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef]\n",
+	}
+	for _, step := range invalid {
+		data := []byte("jobs:\n  image:\n    steps:\n" + step)
+		_, err := ParsePipeline(data)
+		require.ErrorIs(t, err, ErrInvalidConfig, step)
+		require.True(t, HasErrors(Lint(data)), step)
+	}
+}
+
+func TestExpand_Includes(t *testing.T) {
+	loader := mapLoader{
+		"ci/lint.yaml": `jobs:
+  lint:
+    steps:
+      - run: make lint
+`,
+		"templates@v1:go.yaml": `include: [common.yaml]
+jobs:
+  .go:
+    steps:
+      - name: build
+        run: go build ./...
+`,
+		"templates@v1:common.yaml": `checkout:
+  depth: 1
+jobs:
+  lint:
+    steps:
+      - run: echo overridden
+`,
+	}
+
+	data := []byte(`include:
+  - repository: templates
+    ref: v1
+    file: go.yaml
+  - ci/lint.yaml
+checkout:
+  lfs: true
+jobs:
+  build:
+    extends: .go
+  test:
+    extends: [.go, build]
+    needs: build
+    steps:
+      - run: go test ./...
+`)
+	require.Empty(t, Lint(data))
+
+	expanded, err := Expand(data, loader)
+	require.NoError(t, err)
+	require.Empty(t, Lint(expanded))
+
+	pipeline, err := ParsePipeline(expanded)
+	require.NoError(t, err)
+	require.Equal(t, 1, *pipeline.Checkout.Depth)
+	require.True(t, *pipeline.Checkout.LFS)
+
+	names := make([]string, len(pipeline.Jobs))
+	for i, job := range pipeline.Jobs {
+		names[i] = job.Name
+	}
+	require.Equal(t, []string{"lint", "build", "test"}, names)
+	require.Equal(t, "make lint", pipeline.Jobs[0].Steps[0].Run)
+	require.Equal(t, "go build ./...", pipeline.Jobs[1].Steps[0].Run)
+	require.Equal(t, "go test ./...", pipeline.Jobs[2].Steps[0].Run)
+
+	// config without includes and extends is not rewritten
+	plain := []byte("jobs:\n  build:\n    steps:\n      - run: make\n")
+	expanded, err = Expand(plain, loader)
+	require.NoError(t, err)
+	require.Equal(t, plain, expanded)
+
+	_, err = ParsePipeline(data)
+	require.ErrorIs(t, err, ErrInvalidConfig)
+}
+
+func TestExpand_Errors(t *testing.T) {
+	loader := mapLoader{
+		"a.yaml": "include: [b.yaml]\njobs: {}\n",
+		"b.yaml": "include: [a.yaml]\njobs: {}\n",
+	}
+
+	tests := map[string]string{
+		"missing include": "include: [missing.yaml]\njobs:\n  build:\n    steps:\n      - run: make\n",
+		"include cycle":   "include: [a.yaml]\njobs:\n  build:\n    steps:\n      - run: make\n",
+		"invalid include": "include:\n  - repository: templates\njobs:\n  build:\n    steps:\n      - run: make\n",
+		"unknown extends": "jobs:\n  build:\n    extends: .go\n",
+		"extends cycle":   "jobs:\n  build:\n    extends: test\n  test:\n    extends: build\n",
+	}
+	for name, data := range tests {
+		_, err := Expand([]byte(data), loader)
+		require.ErrorIs(t, err, ErrInvalidConfig, name)
+	}
+
+	var configErr *ConfigError
+	_, err := Expand([]byte(tests["include cycle"]), loader)
+	require.ErrorAs(t, err, &configErr)
+	require.Equal(t, "b.yaml", configErr.File)
+
+	diagnostics := Lint([]byte(tests["extends cycle"]))
+	require.True(t, HasErrors(diagnostics))
+}
+
+func TestSchema(t *testing.T) {
+	schema := Schema()
+	require.Equal(t, SCHEMA_DRAFT, schema["$schema"])
+	require.Equal(t, []string{"jobs"}, schema["required"])
+	require.Equal(t, false, schema["additionalProperties"])
+
+	properties := schema["properties"].(map[string]any)
+	require.Contains(t, properties, "checkout")
+
+	job := properties["jobs"].(map[string]any)["additionalProperties"].(map[string]any)
+	step := job["properties"].(map[string]any)["steps"].(map[string]any)["items"].(map[string]any)
+	require.Equal(t, []any{
+		map[string]any{"required": []string{"run"}},
+		map[string]any{"required": []string{"docker-build"}},
+	}, step["oneOf"])
+	require.Contains(t, step["properties"], "docker-build")
+}
+
+func TestSchema_Published(t *testing.T) {
+	schema, err := json.MarshalIndent(Schema(), "", "  ")
+	require.NoError(t, err)
+	schema = append(schema, '\n')
+
+	if *updateSchema {
+		require.NoError(t, os.WriteFile(PUBLISHED_SCHEMA_PATH, schema, 0644))
+	}
+
+	published, err := os.ReadFile(PUBLISHED_SCHEMA_PATH)
+	require.NoError(t, err)
+	require.Equal(t, string(schema), string(published), "schema is outdated, run tests with -update-schema")
+}
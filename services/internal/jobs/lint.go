@@ -0,0 +1,315 @@
+package jobs
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	SEVERITY_ERROR   = "error"
+	SEVERITY_WARNING = "warning"
+)
+
+var yamlErrorLine = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+
+type Diagnostic struct {
+	Line     int    `json:"line"`
+	Column   int    `json:"column"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+func HasErrors(diagnostics []Diagnostic) bool {
+	for _, diagnostic := range diagnostics {
+		if diagnostic.Severity == SEVERITY_ERROR {
+			return true
+		}
+	}
+	return false
+}
+
+type linter struct {
+	diagnostics []Diagnostic
+}
+
+func (l *linter) report(node *yaml.Node, severity, format string, args ...any) {
+	diagnostic := Diagnostic{Severity: severity, Message: fmt.Sprintf(format, args...)}
+	if node != nil {
+		diagnostic.Line = node.Line
+		diagnostic.Column = node.Column
+	}
+	l.diagnostics = append(l.diagnostics, diagnostic)
+}
+
+func (l *linter) reportConfigError(configErr *ConfigError) {
+	message := configErr.Message
+	if configErr.Path != "" {
+		message = configErr.Path + ": " + message
+	}
+	if configErr.File != "" {
+		message = configErr.File + ": " + message
+	}
+	l.diagnostics = append(l.diagnostics, Diagnostic{
+		Line:     configErr.Line,
+		Column:   configErr.Column,
+		Severity: SEVERITY_ERROR,
+		Message:  message,
+	})
+}
+
+// Lint checks ci config and returns every problem found, so all of them can be fixed at once.
+func Lint(data []byte) []Diagnostic {
+	l := &linter{diagnostics: []Diagnostic{}}
+
+	document, err := parseDocument(data)
+	if err != nil {
+		var configErr *ConfigError
+		if errors.As(err, &configErr) {
+			l.reportConfigError(configErr)
+		}
+		return l.diagnostics
+	}
+
+	// format of config is checked against the same types it is decoded into
+	checkNode(document, reflect.TypeOf(Config{}), "", l.reportConfigError)
+
+	if checkoutKey, checkoutNode := findKeyNode(document, "checkout"); checkoutNode != nil {
+		var config Config
+		if err := checkoutNode.Decode(&config.Checkout); err == nil {
+			if err := config.Checkout.Validate(); err != nil {
+				l.report(checkoutKey, SEVERITY_ERROR, "%s", err.Error())
+			}
+		}
+	}
+
+	if concurrencyKey, concurrencyNode := findKeyNode(document, "concurrency"); concurrencyNode != nil {
+		l.concurrency(concurrencyKey, concurrencyNode)
+	}
+
+	if _, inputsNode := findKeyNode(document, "inputs"); inputsNode != nil {
+		for _, pair := range mappingPairs(inputsNode) {
+			var input Input
+			if err := pair[1].Decode(&input); err == nil {
+				if err := input.Validate(pair[0].Value); err != nil {
+					l.report(pair[0], SEVERITY_ERROR, "%s", err.Error())
+				}
+			}
+		}
+	}
+
+	// NOTE: jobs of included files are unknown here, so references are checked only when config has no includes
+	checkRefs := !hasKey(document, "include")
+	if checkRefs && needsExpansion(document) {
+		expanded, err := newExpander(nil).expandDocument(document)
+		if err != nil {
+			var configErr *ConfigError
+			if errors.As(err, &configErr) {
+				l.reportConfigError(configErr)
+			}
+			return l.diagnostics
+		}
+		document = expanded
+	}
+
+	jobsKey, jobsNode := findKeyNode(document, "jobs")
+	if jobsNode == nil || jobsNode.Kind != yaml.MappingNode {
+		return l.diagnostics
+	}
+	if len(jobsNode.Content) == 0 {
+		l.report(jobsKey, SEVERITY_ERROR, "no jobs found")
+		return l.diagnostics
+	}
+
+	jobNames := make(map[string]*yaml.Node)
+	needs := make(map[string][]*yaml.Node)
+	var order []string
+	for _, pair := range mappingPairs(jobsNode) {
+		nameNode, bodyNode := pair[0], resolveAlias(pair[1])
+		if isHiddenJob(nameNode.Value) {
+			continue
+		}
+
+		jobNames[nameNode.Value] = nameNode
+		order = append(order, nameNode.Value)
+
+		if bodyNode.Kind == yaml.MappingNode {
+			needs[nameNode.Value] = l.job(nameNode, bodyNode)
+		}
+	}
+
+	for _, name := range order {
+		for _, needNode := range needs[name] {
+			if needNode.Value == name {
+				l.report(needNode, SEVERITY_ERROR, "job %q can't need itself", name)
+			} else if _, ok := jobNames[needNode.Value]; !ok && checkRefs {
+				l.report(needNode, SEVERITY_ERROR, "job %q needs unknown job %q", name, needNode.Value)
+			}
+		}
+	}
+
+	l.cycles(order, jobNames, needs)
+
+	return l.diagnostics
+}
+
+func (l *linter) job(nameNode, bodyNode *yaml.Node) []*yaml.Node {
+	var needs []*yaml.Node
+	if _, needsNode := findKeyNode(bodyNode, "needs"); needsNode != nil {
+		switch needsNode.Kind {
+		case yaml.ScalarNode:
+			needs = append(needs, needsNode)
+		case yaml.SequenceNode:
+			for _, needNode := range needsNode.Content {
+				if needNode.Kind == yaml.ScalarNode {
+					needs = append(needs, needNode)
+				}
+			}
+		}
+	}
+
+	if concurrencyKey, concurrencyNode := findKeyNode(bodyNode, "concurrency"); concurrencyNode != nil {
+		l.concurrency(concurrencyKey, concurrencyNode)
+	}
+
+	stepsKey, stepsNode := findKeyNode(bodyNode, "steps")
+	if triggerKey, _ := findKeyNode(bodyNode, "trigger"); triggerKey != nil {
+		if stepsKey != nil {
+			l.report(triggerKey, SEVERITY_ERROR, "job %q can't have both trigger and steps", nameNode.Value)
+		}
+		return needs
+	}
+	if stepsNode == nil {
+		// steps of extended job come from included files
+		if extendsKey, _ := findKeyNode(bodyNode, "extends"); extendsKey == nil {
+			l.report(nameNode, SEVERITY_WARNING, "job %q has no steps", nameNode.Value)
+		}
+		return needs
+	}
+	if stepsNode.Kind != yaml.SequenceNode {
+		return needs
+	}
+	if len(stepsNode.Content) == 0 {
+		l.report(stepsKey, SEVERITY_WARNING, "job %q has no steps", nameNode.Value)
+		return needs
+	}
+
+	for i, stepNode := range stepsNode.Content {
+		stepNode = resolveAlias(stepNode)
+		if stepNode.Kind != yaml.MappingNode {
+			continue
+		}
+
+		runKey, runNode := findKeyNode(stepNode, "run")
+		if runNode != nil && runNode.Kind == yaml.ScalarNode && strings.TrimSpace(runNode.Value) == "" {
+			l.report(runKey, SEVERITY_ERROR, "run of step %d of job %q is empty", i+1, nameNode.Value)
+		}
+
+		buildKey, buildNode := findKeyNode(stepNode, "docker-build")
+		switch {
+		case runKey == nil && buildKey == nil:
+			l.report(stepNode, SEVERITY_ERROR, "step %d of job %q has neither run nor docker-build", i+1, nameNode.Value)
+		case runKey != nil && buildKey != nil:
+			l.report(buildKey, SEVERITY_ERROR, "step %d of job %q can't have both run and docker-build", i+1, nameNode.Value)
+		case buildNode != nil:
+			var build DockerBuild
+			if err := buildNode.Decode(&build); err == nil {
+				if err := build.Validate(); err != nil {
+					l.report(buildKey, SEVERITY_ERROR, "%s", err.Error())
+				}
+			}
+		}
+	}
+
+	return needs
+}
+
+func (l *linter) concurrency(keyNode, node *yaml.Node) {
+	var concurrency Concurrency
+	if err := node.Decode(&concurrency); err == nil {
+		if err := concurrency.Validate(); err != nil {
+			l.report(keyNode, SEVERITY_ERROR, "%s", err.Error())
+		}
+	}
+}
+
+// cycles reports every dependency cycle once, at the job where it is entered first.
+func (l *linter) cycles(order []string, jobNames map[string]*yaml.Node, needs map[string][]*yaml.Node) {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+
+	state := make(map[string]int)
+	var stack []string
+
+	var visit func(name string)
+	visit = func(name string) {
+		state[name] = visiting
+		stack = append(stack, name)
+
+		for _, needNode := range needs[name] {
+			need := needNode.Value
+			if _, ok := jobNames[need]; !ok || need == name {
+				continue
+			}
+
+			switch state[need] {
+			case unvisited:
+				visit(need)
+			case visiting:
+				start := 0
+				for i, job := range stack {
+					if job == need {
+						start = i
+						break
+					}
+				}
+				cycle := append(append([]string{}, stack[start:]...), need)
+				l.report(jobNames[need], SEVERITY_ERROR, "dependency cycle: %s", strings.Join(cycle, " -> "))
+			}
+		}
+
+		stack = stack[:len(stack)-1]
+		state[name] = visited
+	}
+
+	for _, name := range order {
+		if state[name] == unvisited {
+			visit(name)
+		}
+	}
+}
+
+func syntaxError(err error) *ConfigError {
+	message := err.Error()
+	if typeErr, ok := err.(*yaml.TypeError); ok && len(typeErr.Errors) > 0 {
+		message = typeErr.Errors[0]
+	}
+
+	configErr := &ConfigError{Message: strings.TrimPrefix(message, "yaml: ")}
+	if match := yamlErrorLine.FindStringSubmatch(message); match != nil {
+		configErr.Line, _ = strconv.Atoi(match[1])
+		configErr.Message = match[2]
+	}
+	return configErr
+}
+
+func yamlErrorMessage(err error) string {
+	return syntaxError(err).Message
+}
+
+func findKeyNode(mapping *yaml.Node, key string) (*yaml.Node, *yaml.Node) {
+	for _, pair := range mappingPairs(mapping) {
+		if pair[0].Value == key {
+			return pair[0], resolveAlias(pair[1])
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,27 @@
+package jobs
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+)
+
+var ErrInvalidConfigPath = errors.New("invalid ci config path")
+
+// ValidateConfigPath checks that path points to a file inside repository.
+func ValidateConfigPath(configPath string) error {
+	if configPath == "" {
+		return fmt.Errorf("%w: empty path", ErrInvalidConfigPath)
+	}
+	if path.IsAbs(configPath) {
+		return fmt.Errorf("%w: path has to be relative to repository root", ErrInvalidConfigPath)
+	}
+
+	cleaned := path.Clean(configPath)
+	if cleaned == "." || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return fmt.Errorf("%w: path has to be inside repository", ErrInvalidConfigPath)
+	}
+
+	return nil
+}
@@ -0,0 +1,86 @@
+package jobs
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/docker/go-units"
+)
+
+var ErrInvalidResources = errors.New("invalid resources")
+
+// Resources limit container of job while it runs, memory is written with unit like 512m or 4g.
+// Limits which are not set are taken from config of worker.
+type Resources struct {
+	Cpus   float64 `yaml:"cpus,omitempty"`
+	Memory string  `yaml:"memory,omitempty"`
+	Pids   int64   `yaml:"pids,omitempty"`
+}
+
+func (r Resources) Validate() error {
+	if r.Cpus < 0 {
+		return fmt.Errorf("%w: cpus can't be negative", ErrInvalidResources)
+	}
+	if r.Pids < 0 {
+		return fmt.Errorf("%w: pids can't be negative", ErrInvalidResources)
+	}
+	if _, err := ParseMemory(r.Memory); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Merge returns resources with limits of override set over these ones.
+func (r Resources) Merge(override *Resources) Resources {
+	if override == nil {
+		return r
+	}
+
+	merged := r
+	if override.Cpus > 0 {
+		merged.Cpus = override.Cpus
+	}
+	if override.Memory != "" {
+		merged.Memory = override.Memory
+	}
+	if override.Pids > 0 {
+		merged.Pids = override.Pids
+	}
+	return merged
+}
+
+// Within checks that resources don't exceed maximums, maximum which is not set doesn't limit them.
+func (r Resources) Within(maximums Resources) error {
+	if maximums.Cpus > 0 && r.Cpus > maximums.Cpus {
+		return fmt.Errorf("%w: cpus %g exceed maximum %g", ErrInvalidResources, r.Cpus, maximums.Cpus)
+	}
+	if maximums.Pids > 0 && r.Pids > maximums.Pids {
+		return fmt.Errorf("%w: pids %d exceed maximum %d", ErrInvalidResources, r.Pids, maximums.Pids)
+	}
+
+	maxMemory, err := ParseMemory(maximums.Memory)
+	if err != nil {
+		return err
+	}
+	memory, err := ParseMemory(r.Memory)
+	if err != nil {
+		return err
+	}
+	if maxMemory > 0 && memory > maxMemory {
+		return fmt.Errorf("%w: memory %s exceeds maximum %s", ErrInvalidResources, r.Memory, maximums.Memory)
+	}
+	return nil
+}
+
+// ParseMemory returns memory in bytes, empty memory means no limit and is 0.
+func ParseMemory(memory string) (int64, error) {
+	if memory == "" {
+		return 0, nil
+	}
+
+	bytes, err := units.RAMInBytes(memory)
+	if err != nil || bytes <= 0 {
+		return 0, fmt.Errorf("%w: memory %q, expected positive size like 512m or 4g", ErrInvalidResources, memory)
+	}
+	return bytes, nil
+}
@@ -0,0 +1,91 @@
+package jobs
+
+import (
+	"reflect"
+)
+
+const (
+	SCHEMA_DRAFT = "https://json-schema.org/draft/2020-12/schema"
+	SCHEMA_TITLE = "pipecraft pipeline"
+)
+
+// SchemaProvider is implemented by types which accept several yaml shapes, so their schema can't be derived.
+type SchemaProvider interface {
+	JSONSchema() map[string]any
+}
+
+// Schema returns JSON Schema of ci config generated from types it is decoded into.
+func Schema() map[string]any {
+	schema := typeSchema(reflect.TypeOf(Config{}))
+	schema["$schema"] = SCHEMA_DRAFT
+	schema["title"] = SCHEMA_TITLE
+	return schema
+}
+
+func typeSchema(t reflect.Type) map[string]any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	if provider, ok := reflect.New(t).Elem().Interface().(SchemaProvider); ok {
+		return provider.JSONSchema()
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		return structSchema(t)
+	case reflect.Map:
+		return map[string]any{
+			"type":                 "object",
+			"additionalProperties": typeSchema(t.Elem()),
+		}
+	case reflect.Slice:
+		return map[string]any{
+			"type":  "array",
+			"items": typeSchema(t.Elem()),
+		}
+	case reflect.Interface:
+		return map[string]any{"type": []string{"string", "number", "boolean"}}
+	default:
+		return map[string]any{"type": schemaType(t)}
+	}
+}
+
+func structSchema(t reflect.Type) map[string]any {
+	properties := make(map[string]any)
+	required := []string{}
+	for _, field := range yamlFields(t) {
+		properties[field.name] = typeSchema(field.typ)
+		if field.required {
+			required = append(required, field.name)
+		}
+	}
+
+	schema := map[string]any{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+func schemaType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Struct, reflect.Map:
+		return "object"
+	case reflect.Slice:
+		return "array"
+	default:
+		return "string"
+	}
+}
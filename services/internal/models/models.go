@@ -1,23 +1,153 @@
 package models
 
+import (
+	"encoding/json"
+	"pipecraft/internal/jobs"
+	"pipecraft/internal/vcs"
+	"time"
+)
+
 type ErrorResponse struct {
 	Error string `json:"error"`
 }
 
 type RunPipelineRequest struct {
-	RepositoryUrl string `json:"repository_url"`
-	Branch        string `json:"branch"`
-	Commit        string `json:"commit,omitempty"`
+	RepositoryUrl string               `json:"repository_url"`
+	Branch        string               `json:"branch,omitempty"`
+	Ref           string               `json:"ref,omitempty"`
+	RefType       string               `json:"ref_type,omitempty"`
+	Commit        string               `json:"commit,omitempty"`
+	Force         bool                 `json:"force,omitempty"`
+	Checkout      *vcs.CheckoutOptions `json:"checkout,omitempty"`
+	TriggeredBy   string               `json:"triggered_by,omitempty"`
+	Inputs        map[string]any       `json:"inputs,omitempty"`
+	Priority      *int                 `json:"priority,omitempty"`
+	Trigger       string               `json:"-"`
 }
 
 type RunPipelineResponse struct {
-	PipelineId int64 `json:"pipeline_id,omitempty"`
+	PipelineId int64   `json:"pipeline_id,omitempty"`
+	Commit     string  `json:"commit,omitempty"`
+	Superseded []int64 `json:"superseded,omitempty"`
 }
 
 type PipelineStatusResponse struct {
 	Status string `json:"status"`
 }
 
+type ListPipelinesRequest struct {
+	RepositoryUrl string
+	RefType       string
+	Status        string
+	Limit         int
+}
+
+type PipelineResponse struct {
+	PipelineId       int64          `json:"pipeline_id"`
+	Status           string         `json:"status"`
+	RepositoryUrl    string         `json:"repository_url"`
+	Branch           string         `json:"branch,omitempty"`
+	Ref              string         `json:"ref"`
+	RefType          string         `json:"ref_type"`
+	Commit           string         `json:"commit"`
+	Attempt          int            `json:"attempt"`
+	RerunOf          int64          `json:"rerun_of,omitempty"`
+	ConfigFile       string         `json:"config_file,omitempty"`
+	Trigger          string         `json:"trigger"`
+	TriggeredBy      string         `json:"triggered_by,omitempty"`
+	Inputs           map[string]any `json:"inputs,omitempty"`
+	ParentPipelineId int64          `json:"parent_pipeline_id,omitempty"`
+	Priority         int            `json:"priority"`
+	CreatedAt        time.Time      `json:"created_at"`
+}
+
+type PipelinesListResponse struct {
+	Pipelines []PipelineResponse `json:"pipelines"`
+}
+
+type QueuedPipelineResponse struct {
+	PipelineId       int64      `json:"pipeline_id"`
+	RepositoryUrl    string     `json:"repository_url"`
+	Ref              string     `json:"ref"`
+	Trigger          string     `json:"trigger"`
+	Priority         int        `json:"priority"`
+	Position         int        `json:"position,omitempty"`
+	StartedAt        *time.Time `json:"started_at,omitempty"`
+	EstimatedStartAt *time.Time `json:"estimated_start_at,omitempty"`
+	CreatedAt        time.Time  `json:"created_at"`
+}
+
+type QueueResponse struct {
+	Running []QueuedPipelineResponse `json:"running"`
+	Waiting []QueuedPipelineResponse `json:"waiting"`
+}
+
+type DownstreamPipelineResponse struct {
+	PipelineId    int64  `json:"pipeline_id"`
+	Job           string `json:"job"`
+	Status        string `json:"status"`
+	RepositoryUrl string `json:"repository_url"`
+	Branch        string `json:"branch"`
+	Commit        string `json:"commit"`
+}
+
+type PipelineDetailsResponse struct {
+	PipelineResponse
+	ParentJob  string                       `json:"parent_job,omitempty"`
+	Downstream []DownstreamPipelineResponse `json:"downstream"`
+}
+
+type LintResponse struct {
+	Valid       bool              `json:"valid"`
+	Diagnostics []jobs.Diagnostic `json:"diagnostics"`
+}
+
+type PipelineConfigResponse struct {
+	ConfigFile string `json:"config_file"`
+	Config     string `json:"config"`
+}
+
+type ApprovalRequest struct {
+	User string `json:"user"`
+}
+
+type ApprovalResponse struct {
+	JobName   string     `json:"job_name"`
+	Status    string     `json:"status"`
+	DecidedBy string     `json:"decided_by,omitempty"`
+	DecidedAt *time.Time `json:"decided_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+type ApprovalsListResponse struct {
+	Approvals []ApprovalResponse `json:"approvals"`
+}
+
+type ScheduleRequest struct {
+	RepositoryUrl  string `json:"repository_url"`
+	Branch         string `json:"branch"`
+	CronExpression string `json:"cron_expression"`
+	Timezone       string `json:"timezone,omitempty"`
+	Enabled        *bool  `json:"enabled,omitempty"`
+}
+
+type ScheduleResponse struct {
+	ScheduleId     int64      `json:"schedule_id"`
+	RepositoryUrl  string     `json:"repository_url"`
+	Branch         string     `json:"branch"`
+	CronExpression string     `json:"cron_expression"`
+	Timezone       string     `json:"timezone"`
+	Enabled        bool       `json:"enabled"`
+	NextRunAt      *time.Time `json:"next_run_at,omitempty"`
+	LastRunAt      *time.Time `json:"last_run_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+type SchedulesListResponse struct {
+	Schedules []ScheduleResponse `json:"schedules"`
+}
+
 type Logs struct {
 	LogsId        int64  `json:"logs_id"`
 	CommandNumber int    `json:"command_number"`
@@ -29,3 +159,112 @@ type Logs struct {
 type PipelineLogsResponse struct {
 	Logs []Logs `json:"logs"`
 }
+
+type RepositoryCredentialsRequest struct {
+	RepositoryUrl string `json:"repository_url"`
+	Kind          string `json:"kind"`
+	SSHPrivateKey string `json:"ssh_private_key,omitempty"`
+	KnownHosts    string `json:"known_hosts,omitempty"`
+	Username      string `json:"username,omitempty"`
+	Token         string `json:"token,omitempty"`
+}
+
+type RepositoryCredentialsResponse struct {
+	RepositoryUrl string    `json:"repository_url"`
+	Kind          string    `json:"kind"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// NOTE: registry is host of registry like ghcr.io, docker hub is docker.io
+type RegistryCredentialsRequest struct {
+	RepositoryUrl string `json:"repository_url"`
+	Registry      string `json:"registry"`
+	Username      string `json:"username"`
+	Password      string `json:"password"`
+}
+
+type RegistryCredentialsResponse struct {
+	RepositoryUrl string    `json:"repository_url"`
+	Registry      string    `json:"registry"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// NOTE: settings which are left out of request keep their saved values
+type RepositorySettingsRequest struct {
+	RepositoryUrl          string  `json:"repository_url"`
+	CiConfigPath           *string `json:"ci_config_path,omitempty"`
+	MaxConcurrentPipelines *int    `json:"max_concurrent_pipelines,omitempty"`
+	AutoCancel             *bool   `json:"auto_cancel,omitempty"`
+	AutoCancelRunning      *bool   `json:"auto_cancel_running,omitempty"`
+}
+
+type RepositorySettingsResponse struct {
+	RepositoryUrl          string    `json:"repository_url"`
+	CiConfigPath           string    `json:"ci_config_path"`
+	MaxConcurrentPipelines int       `json:"max_concurrent_pipelines"`
+	AutoCancel             bool      `json:"auto_cancel"`
+	AutoCancelRunning      bool      `json:"auto_cancel_running"`
+	Privileged             bool      `json:"privileged"`
+	UpdatedAt              time.Time `json:"updated_at"`
+}
+
+type PoolRequest struct {
+	Size   *int  `json:"size,omitempty"`
+	Paused *bool `json:"paused,omitempty"`
+}
+
+type PoolResponse struct {
+	Size   int  `json:"size"`
+	Busy   int  `json:"busy"`
+	Paused bool `json:"paused"`
+}
+
+type OrphanResponse struct {
+	Kind       string `json:"kind"`
+	Name       string `json:"name"`
+	PipelineId int64  `json:"pipeline_id"`
+	Reason     string `json:"reason"`
+}
+
+type OrphansResponse struct {
+	Orphans []OrphanResponse `json:"orphans"`
+}
+
+type RegisterRunnerRequest struct {
+	Name              string   `json:"name"`
+	RegistrationToken string   `json:"registration_token"`
+	Labels            []string `json:"labels"`
+}
+
+// NOTE: intervals are in seconds, runner has to send heartbeats at least once per heartbeat interval
+type RegisterRunnerResponse struct {
+	RunnerId          int64            `json:"runner_id"`
+	Token             string           `json:"token"`
+	HeartbeatInterval int              `json:"heartbeat_interval"`
+	PollTimeout       int              `json:"poll_timeout"`
+	CI                RunnerCIResponse `json:"ci"`
+}
+
+type RunnerCIResponse struct {
+	ConfigPath             string   `json:"config_path"`
+	PipelinesDir           string   `json:"pipelines_dir"`
+	ProtectedBranches      []string `json:"protected_branches,omitempty"`
+	PrivilegedRepositories []string `json:"privileged_repositories,omitempty"`
+	TrustedRepositories    []string `json:"trusted_repositories,omitempty"`
+}
+
+type RunnerPipelineResponse struct {
+	PipelineId int64 `json:"pipeline_id"`
+}
+
+type RunnerCallRequest struct {
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params,omitempty"`
+}
+
+// NOTE: error of call is returned in body, so runner gets the same errors as worker of server
+type RunnerCallResponse struct {
+	Result    json.RawMessage `json:"result,omitempty"`
+	Error     string          `json:"error,omitempty"`
+	ErrorCode string          `json:"error_code,omitempty"`
+}
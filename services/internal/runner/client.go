@@ -0,0 +1,350 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"pipecraft/internal/models"
+	"pipecraft/internal/storage"
+	"pipecraft/internal/vcs"
+	"pipecraft/internal/worker"
+	"strings"
+	"time"
+)
+
+const (
+	CALL_TIMEOUT       = 30 * time.Second
+	POLL_EXTRA_TIMEOUT = 10 * time.Second
+)
+
+var (
+	ErrRegistrationFailed  = errors.New("runner registration failed")
+	ErrNotRegistered       = errors.New("runner is not registered")
+	ErrPipelineNotAssigned = worker.ErrPipelineNotAssigned
+)
+
+// Client talks to runner api of server, it gives pipelines to listener of runner and storage to their workers.
+type Client struct {
+	serverUrl   string
+	httpClient  *http.Client
+	token       string
+	labels      []string
+	pollTimeout time.Duration
+}
+
+func NewClient(serverUrl string) *Client {
+	return &Client{
+		serverUrl:  strings.TrimSuffix(serverUrl, "/"),
+		httpClient: &http.Client{},
+	}
+}
+
+// Register registers runner with its labels on server, token of runner is kept by client and sent with every
+// following request.
+func (c *Client) Register(name, registrationToken string, labels []string) (*models.RegisterRunnerResponse, error) {
+	const op = "runner.Client.Register"
+
+	dto := models.RegisterRunnerRequest{Name: name, RegistrationToken: registrationToken, Labels: labels}
+
+	var response models.RegisterRunnerResponse
+	status, err := c.do(context.Background(), http.MethodPost, "/runners/register", dto, &response, CALL_TIMEOUT)
+	if err != nil {
+		return nil, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+	if status != http.StatusCreated {
+		return nil, fmt.Errorf("op: %s, err: %w: server responded with %d", op, ErrRegistrationFailed, status)
+	}
+
+	c.token = response.Token
+	c.labels = labels
+	c.pollTimeout = time.Duration(response.PollTimeout) * time.Second
+	return &response, nil
+}
+
+func (c *Client) Heartbeat(ctx context.Context) error {
+	const op = "runner.Client.Heartbeat"
+
+	status, err := c.do(ctx, http.MethodPost, "/runner/heartbeat", nil, nil, CALL_TIMEOUT)
+	if err != nil {
+		return fmt.Errorf("op: %s, err: %w", op, err)
+	}
+	if status != http.StatusNoContent {
+		return fmt.Errorf("op: %s, err: server responded with %d", op, status)
+	}
+
+	return nil
+}
+
+// ClaimNextPipeline waits until server gives a pipeline to runner, storage.ErrNotFound is returned when server has
+// nothing to run for poll timeout.
+func (c *Client) ClaimNextPipeline(ctx context.Context) (int64, error) {
+	const op = "runner.Client.ClaimNextPipeline"
+
+	var response models.RunnerPipelineResponse
+	status, err := c.do(ctx, http.MethodPost, "/runner/pipelines/request", nil, &response, c.pollTimeout+POLL_EXTRA_TIMEOUT)
+	if err != nil {
+		return 0, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	switch status {
+	case http.StatusOK:
+		return response.PipelineId, nil
+	case http.StatusNoContent:
+		return 0, storage.ErrNotFound
+	default:
+		return 0, fmt.Errorf("op: %s, err: server responded with %d", op, status)
+	}
+}
+
+func (c *Client) Labels() []string {
+	return c.labels
+}
+
+func (c *Client) Pipeline(pipelineId int64) (worker.Storage, worker.Credentials) {
+	pipeline := &PipelineClient{client: c, pipelineId: pipelineId}
+	return pipeline, pipeline
+}
+
+// call runs method of server storage on behalf of pipeline, storage.ErrNotFound of server is returned as is.
+func (c *Client) call(pipelineId int64, method string, params, result any) error {
+	const op = "runner.Client.call"
+
+	data, err := json.Marshal(params)
+	if err != nil {
+		return fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	var response models.RunnerCallResponse
+	url := fmt.Sprintf("/runner/pipelines/%d/call", pipelineId)
+	dto := models.RunnerCallRequest{Method: method, Params: data}
+
+	status, err := c.do(context.Background(), http.MethodPost, url, dto, &response, CALL_TIMEOUT)
+	if err != nil {
+		return fmt.Errorf("op: %s, method: %s, err: %w", op, method, err)
+	}
+
+	switch status {
+	case http.StatusOK:
+	case http.StatusForbidden:
+		return fmt.Errorf("op: %s, method: %s, err: %w", op, method, ErrPipelineNotAssigned)
+	case http.StatusNotFound:
+		// NOTE: pipeline of call doesn't exist on server, reaper of runner removes what is left of it
+		return fmt.Errorf("op: %s, method: %s, err: %w", op, method, storage.ErrNotFound)
+	default:
+		return fmt.Errorf("op: %s, method: %s, err: server responded with %d", op, method, status)
+	}
+
+	if response.ErrorCode == ERROR_CODE_NOT_FOUND {
+		return fmt.Errorf("op: %s, method: %s, err: %w: %s", op, method, storage.ErrNotFound, response.Error)
+	}
+	if response.Error != "" {
+		return fmt.Errorf("op: %s, method: %s, err: %s", op, method, response.Error)
+	}
+
+	if result != nil && len(response.Result) > 0 {
+		if err := json.Unmarshal(response.Result, result); err != nil {
+			return fmt.Errorf("op: %s, method: %s, err: %w", op, method, err)
+		}
+	}
+
+	return nil
+}
+
+func (c *Client) do(ctx context.Context, method, url string, body, result any, timeout time.Duration) (int, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return 0, err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, method, c.serverUrl+url, reader)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		return resp.StatusCode, ErrNotRegistered
+	}
+
+	if result != nil && (resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusCreated) {
+		if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+			return resp.StatusCode, err
+		}
+	}
+
+	return resp.StatusCode, nil
+}
+
+// PipelineClient is storage of pipeline which runner runs, every call goes to server.
+type PipelineClient struct {
+	client     *Client
+	pipelineId int64
+}
+
+func (p *PipelineClient) GetPipelineInfo(id int64) (*storage.PipelinesTable, error) {
+	var pipeline *storage.PipelinesTable
+	err := p.client.call(p.pipelineId, METHOD_GET_PIPELINE_INFO, idParams{Id: id}, &pipeline)
+	return pipeline, err
+}
+
+func (p *PipelineClient) UpdatePipelineStatus(id int64, status string) error {
+	return p.client.call(p.pipelineId, METHOD_UPDATE_PIPELINE_STATUS, statusParams{Id: id, Status: status}, nil)
+}
+
+func (p *PipelineClient) UpdatePipelineConfigFile(id int64, configFile string) error {
+	return p.client.call(p.pipelineId, METHOD_UPDATE_PIPELINE_CONFIG_FILE, configFileParams{Id: id, ConfigFile: configFile}, nil)
+}
+
+func (p *PipelineClient) UpdatePipelineConfig(id int64, config string) error {
+	return p.client.call(p.pipelineId, METHOD_UPDATE_PIPELINE_CONFIG, configParams{Id: id, Config: config}, nil)
+}
+
+func (p *PipelineClient) GetPipelineConfig(id int64) (string, string, error) {
+	var config configResult
+	err := p.client.call(p.pipelineId, METHOD_GET_PIPELINE_CONFIG, idParams{Id: id}, &config)
+	return config.ConfigFile, config.Config, err
+}
+
+func (p *PipelineClient) UpdatePipelineDiagnostics(id int64, diagnostics string) error {
+	return p.client.call(p.pipelineId, METHOD_UPDATE_PIPELINE_DIAGNOSTICS, diagnosticsParams{Id: id, Diagnostics: diagnostics}, nil)
+}
+
+func (p *PipelineClient) GetPipelineDiagnostics(id int64) (string, error) {
+	var diagnostics string
+	err := p.client.call(p.pipelineId, METHOD_GET_PIPELINE_DIAGNOSTICS, idParams{Id: id}, &diagnostics)
+	return diagnostics, err
+}
+
+func (p *PipelineClient) GetPipelineLogs(id int64) ([]*storage.LogsTable, error) {
+	var logs []*storage.LogsTable
+	err := p.client.call(p.pipelineId, METHOD_GET_PIPELINE_LOGS, idParams{Id: id}, &logs)
+	return logs, err
+}
+
+func (p *PipelineClient) CreateLog(logTable storage.LogsTable) error {
+	return p.client.call(p.pipelineId, METHOD_CREATE_LOG, logTable, nil)
+}
+
+func (p *PipelineClient) StartLog(logTable storage.LogsTable) (int64, error) {
+	var logId int64
+	err := p.client.call(p.pipelineId, METHOD_START_LOG, logTable, &logId)
+	return logId, err
+}
+
+func (p *PipelineClient) AppendLog(pipelineId, logId int64, results, finalStatus string) error {
+	params := appendLogParams{PipelineId: pipelineId, LogId: logId, Results: results, FinalStatus: finalStatus}
+	return p.client.call(p.pipelineId, METHOD_APPEND_LOG, params, nil)
+}
+
+func (p *PipelineClient) CreateSiblingPipelines(id int64, configFiles []string) error {
+	return p.client.call(p.pipelineId, METHOD_CREATE_SIBLING_PIPELINES, siblingsParams{Id: id, ConfigFiles: configFiles}, nil)
+}
+
+func (p *PipelineClient) CreateDownstreamPipeline(pipeline storage.PipelinesTable) (int64, error) {
+	var id int64
+	err := p.client.call(p.pipelineId, METHOD_CREATE_DOWNSTREAM_PIPELINE, pipeline, &id)
+	return id, err
+}
+
+func (p *PipelineClient) GetDownstreamPipeline(parentPipelineId int64, parentJob string) (*storage.PipelinesTable, error) {
+	var pipeline *storage.PipelinesTable
+	params := downstreamParams{ParentPipelineId: parentPipelineId, ParentJob: parentJob}
+	err := p.client.call(p.pipelineId, METHOD_GET_DOWNSTREAM_PIPELINE, params, &pipeline)
+	return pipeline, err
+}
+
+func (p *PipelineClient) WaitForDownstream(pipelineId, downstreamPipelineId int64, workspaceVolume string) (string, error) {
+	var status string
+	params := waitForDownstreamParams{PipelineId: pipelineId, DownstreamPipelineId: downstreamPipelineId, WorkspaceVolume: workspaceVolume}
+	err := p.client.call(p.pipelineId, METHOD_WAIT_FOR_DOWNSTREAM, params, &status)
+	return status, err
+}
+
+func (p *PipelineClient) RequestApproval(pipelineId int64, jobName, workspaceVolume string) (string, error) {
+	var status string
+	params := approvalParams{PipelineId: pipelineId, JobName: jobName, WorkspaceVolume: workspaceVolume}
+	err := p.client.call(p.pipelineId, METHOD_REQUEST_APPROVAL, params, &status)
+	return status, err
+}
+
+func (p *PipelineClient) AcquireConcurrencyLock(group string, pipelineId int64, jobName string, cancelInProgress bool, workspaceVolume string) (bool, error) {
+	var acquired bool
+	params := acquireLockParams{
+		Group:            group,
+		PipelineId:       pipelineId,
+		JobName:          jobName,
+		CancelInProgress: cancelInProgress,
+		WorkspaceVolume:  workspaceVolume,
+	}
+	err := p.client.call(p.pipelineId, METHOD_ACQUIRE_CONCURRENCY_LOCK, params, &acquired)
+	return acquired, err
+}
+
+func (p *PipelineClient) ReleaseConcurrencyLock(group string, pipelineId int64) error {
+	return p.client.call(p.pipelineId, METHOD_RELEASE_CONCURRENCY_LOCK, releaseLockParams{Group: group, PipelineId: pipelineId}, nil)
+}
+
+func (p *PipelineClient) IsCancelRequested(pipelineId int64) (bool, error) {
+	var cancelRequested bool
+	err := p.client.call(p.pipelineId, METHOD_IS_CANCEL_REQUESTED, idParams{Id: pipelineId}, &cancelRequested)
+	return cancelRequested, err
+}
+
+func (p *PipelineClient) SupersedePipelines(pipelineId int64, cancelRunning bool) ([]int64, error) {
+	var superseded []int64
+	params := supersedeParams{PipelineId: pipelineId, CancelRunning: cancelRunning}
+	err := p.client.call(p.pipelineId, METHOD_SUPERSEDE_PIPELINES, params, &superseded)
+	return superseded, err
+}
+
+func (p *PipelineClient) RequeuePipeline(pipelineId int64, workspaceVolume, interruptedJob string) (bool, error) {
+	var requeued bool
+	params := requeueParams{PipelineId: pipelineId, WorkspaceVolume: workspaceVolume, InterruptedJob: interruptedJob}
+	err := p.client.call(p.pipelineId, METHOD_REQUEUE_PIPELINE, params, &requeued)
+	return requeued, err
+}
+
+func (p *PipelineClient) HandOffPipeline(pipelineId int64, runsOn []string) (bool, error) {
+	var handedOff bool
+	err := p.client.call(p.pipelineId, METHOD_HAND_OFF_PIPELINE, handOffParams{PipelineId: pipelineId, RunsOn: runsOn}, &handedOff)
+	return handedOff, err
+}
+
+func (p *PipelineClient) GetRepositorySettings(repository string) (*storage.RepositorySettingsTable, error) {
+	var settings *storage.RepositorySettingsTable
+	err := p.client.call(p.pipelineId, METHOD_GET_REPOSITORY_SETTINGS, repositoryParams{Repository: repository}, &settings)
+	return settings, err
+}
+
+// Get returns credentials of repository, so runner clones private repositories the same way server does.
+func (p *PipelineClient) Get(repository string) (*vcs.Credentials, error) {
+	var credentials *vcs.Credentials
+	err := p.client.call(p.pipelineId, METHOD_GET_REPOSITORY_CREDENTIALS, repositoryParams{Repository: repository}, &credentials)
+	return credentials, err
+}
+
+func (p *PipelineClient) GetRegistry(repository, registry string) (*worker.RegistryCredentials, error) {
+	var credentials *worker.RegistryCredentials
+	err := p.client.call(p.pipelineId, METHOD_GET_REGISTRY_CREDENTIALS, registryParams{Repository: repository, Registry: registry}, &credentials)
+	return credentials, err
+}
@@ -0,0 +1,477 @@
+package runner
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"pipecraft/internal/config"
+	"pipecraft/internal/logger"
+	"pipecraft/internal/models"
+	"pipecraft/internal/storage"
+	"pipecraft/internal/worker"
+)
+
+const REGISTRATION_TOKEN_ENV = "RUNNER_REGISTRATION_TOKEN"
+
+// methods of storage which runner calls on server, they match methods of worker.Storage
+const (
+	METHOD_GET_PIPELINE_INFO           = "GetPipelineInfo"
+	METHOD_UPDATE_PIPELINE_STATUS      = "UpdatePipelineStatus"
+	METHOD_UPDATE_PIPELINE_CONFIG_FILE = "UpdatePipelineConfigFile"
+	METHOD_UPDATE_PIPELINE_CONFIG      = "UpdatePipelineConfig"
+	METHOD_GET_PIPELINE_CONFIG         = "GetPipelineConfig"
+	METHOD_UPDATE_PIPELINE_DIAGNOSTICS = "UpdatePipelineDiagnostics"
+	METHOD_GET_PIPELINE_DIAGNOSTICS    = "GetPipelineDiagnostics"
+	METHOD_GET_PIPELINE_LOGS           = "GetPipelineLogs"
+	METHOD_CREATE_LOG                  = "CreateLog"
+	METHOD_START_LOG                   = "StartLog"
+	METHOD_APPEND_LOG                  = "AppendLog"
+	METHOD_CREATE_SIBLING_PIPELINES    = "CreateSiblingPipelines"
+	METHOD_CREATE_DOWNSTREAM_PIPELINE  = "CreateDownstreamPipeline"
+	METHOD_GET_DOWNSTREAM_PIPELINE     = "GetDownstreamPipeline"
+	METHOD_WAIT_FOR_DOWNSTREAM         = "WaitForDownstream"
+	METHOD_REQUEST_APPROVAL            = "RequestApproval"
+	METHOD_ACQUIRE_CONCURRENCY_LOCK    = "AcquireConcurrencyLock"
+	METHOD_RELEASE_CONCURRENCY_LOCK    = "ReleaseConcurrencyLock"
+	METHOD_IS_CANCEL_REQUESTED         = "IsCancelRequested"
+	METHOD_SUPERSEDE_PIPELINES         = "SupersedePipelines"
+	METHOD_REQUEUE_PIPELINE            = "RequeuePipeline"
+	METHOD_HAND_OFF_PIPELINE           = "HandOffPipeline"
+	METHOD_GET_REPOSITORY_SETTINGS     = "GetRepositorySettings"
+	METHOD_GET_REPOSITORY_CREDENTIALS  = "GetRepositoryCredentials"
+	METHOD_GET_REGISTRY_CREDENTIALS    = "GetRegistryCredentials"
+)
+
+const (
+	ERROR_CODE_NOT_FOUND = "not_found"
+	ERROR_CODE_INTERNAL  = "internal"
+)
+
+var (
+	ErrInvalidCall    = errors.New("invalid runner call")
+	ErrCallNotAllowed = errors.New("runner call is not allowed for pipeline")
+)
+
+type idParams struct {
+	Id int64 `json:"id"`
+}
+
+type statusParams struct {
+	Id     int64  `json:"id"`
+	Status string `json:"status"`
+}
+
+type configFileParams struct {
+	Id         int64  `json:"id"`
+	ConfigFile string `json:"config_file"`
+}
+
+type configParams struct {
+	Id     int64  `json:"id"`
+	Config string `json:"config"`
+}
+
+type configResult struct {
+	ConfigFile string `json:"config_file"`
+	Config     string `json:"config"`
+}
+
+type diagnosticsParams struct {
+	Id          int64  `json:"id"`
+	Diagnostics string `json:"diagnostics"`
+}
+
+type appendLogParams struct {
+	PipelineId  int64  `json:"pipeline_id"`
+	LogId       int64  `json:"log_id"`
+	Results     string `json:"results"`
+	FinalStatus string `json:"final_status"`
+}
+
+type siblingsParams struct {
+	Id          int64    `json:"id"`
+	ConfigFiles []string `json:"config_files"`
+}
+
+type downstreamParams struct {
+	ParentPipelineId int64  `json:"parent_pipeline_id"`
+	ParentJob        string `json:"parent_job"`
+}
+
+type waitForDownstreamParams struct {
+	PipelineId           int64  `json:"pipeline_id"`
+	DownstreamPipelineId int64  `json:"downstream_pipeline_id"`
+	WorkspaceVolume      string `json:"workspace_volume"`
+}
+
+type approvalParams struct {
+	PipelineId      int64  `json:"pipeline_id"`
+	JobName         string `json:"job_name"`
+	WorkspaceVolume string `json:"workspace_volume"`
+}
+
+type acquireLockParams struct {
+	Group            string `json:"group"`
+	PipelineId       int64  `json:"pipeline_id"`
+	JobName          string `json:"job_name"`
+	CancelInProgress bool   `json:"cancel_in_progress"`
+	WorkspaceVolume  string `json:"workspace_volume"`
+}
+
+type releaseLockParams struct {
+	Group      string `json:"group"`
+	PipelineId int64  `json:"pipeline_id"`
+}
+
+type supersedeParams struct {
+	PipelineId    int64 `json:"pipeline_id"`
+	CancelRunning bool  `json:"cancel_running"`
+}
+
+type requeueParams struct {
+	PipelineId      int64  `json:"pipeline_id"`
+	WorkspaceVolume string `json:"workspace_volume"`
+	InterruptedJob  string `json:"interrupted_job"`
+}
+
+type handOffParams struct {
+	PipelineId int64    `json:"pipeline_id"`
+	RunsOn     []string `json:"runs_on"`
+}
+
+type repositoryParams struct {
+	Repository string `json:"repository"`
+}
+
+type registryParams struct {
+	Repository string `json:"repository"`
+	Registry   string `json:"registry"`
+}
+
+// Dispatch runs call of runner on behalf of pipeline it was given against storage of server. Call can change only
+// that pipeline and read only it, its upstream pipelines and pipeline it reruns, secrets are given only for its
+// repository and credentials of repositories also for trusted ones, the same credentials worker of server reads them
+// with. Error of storage is returned in response, error is returned only for call which can't be run.
+func Dispatch(s worker.Storage, credentials worker.Credentials, ci config.CI, pipelineId int64, dto *models.RunnerCallRequest) (*models.RunnerCallResponse, error) {
+	const op = "runner.Dispatch"
+
+	pipeline, err := s.GetPipelineInfo(pipelineId)
+	if err != nil {
+		return nil, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	// own checks that call targets pipeline runner was given
+	own := func(id int64) error {
+		if id != pipelineId {
+			return fmt.Errorf("%w: %s of pipeline %d", ErrCallNotAllowed, dto.Method, id)
+		}
+		return nil
+	}
+	// repository checks that call targets repository of pipeline, repository of pipeline is used then
+	repository := func(name string) error {
+		if name != pipeline.Repository {
+			return fmt.Errorf("%w: %s of repository %q", ErrCallNotAllowed, dto.Method, name)
+		}
+		return nil
+	}
+
+	var result any
+
+	switch dto.Method {
+	case METHOD_GET_PIPELINE_INFO:
+		var params idParams
+		if err := decodeParams(dto.Params, &params); err != nil {
+			return nil, err
+		}
+		if err := readable(s, pipeline, params.Id); err != nil {
+			return nil, err
+		}
+		result, err = s.GetPipelineInfo(params.Id)
+	case METHOD_UPDATE_PIPELINE_STATUS:
+		var params statusParams
+		if err := decodeParams(dto.Params, &params); err != nil {
+			return nil, err
+		}
+		if err := own(params.Id); err != nil {
+			return nil, err
+		}
+		err = s.UpdatePipelineStatus(params.Id, params.Status)
+	case METHOD_UPDATE_PIPELINE_CONFIG_FILE:
+		var params configFileParams
+		if err := decodeParams(dto.Params, &params); err != nil {
+			return nil, err
+		}
+		if err := own(params.Id); err != nil {
+			return nil, err
+		}
+		err = s.UpdatePipelineConfigFile(params.Id, params.ConfigFile)
+	case METHOD_UPDATE_PIPELINE_CONFIG:
+		var params configParams
+		if err := decodeParams(dto.Params, &params); err != nil {
+			return nil, err
+		}
+		if err := own(params.Id); err != nil {
+			return nil, err
+		}
+		err = s.UpdatePipelineConfig(params.Id, params.Config)
+	case METHOD_GET_PIPELINE_CONFIG:
+		var params idParams
+		if err := decodeParams(dto.Params, &params); err != nil {
+			return nil, err
+		}
+		if err := own(params.Id); err != nil {
+			return nil, err
+		}
+		var config configResult
+		config.ConfigFile, config.Config, err = s.GetPipelineConfig(params.Id)
+		result = config
+	case METHOD_UPDATE_PIPELINE_DIAGNOSTICS:
+		var params diagnosticsParams
+		if err := decodeParams(dto.Params, &params); err != nil {
+			return nil, err
+		}
+		if err := own(params.Id); err != nil {
+			return nil, err
+		}
+		err = s.UpdatePipelineDiagnostics(params.Id, params.Diagnostics)
+	case METHOD_GET_PIPELINE_DIAGNOSTICS:
+		var params idParams
+		if err := decodeParams(dto.Params, &params); err != nil {
+			return nil, err
+		}
+		if err := own(params.Id); err != nil {
+			return nil, err
+		}
+		result, err = s.GetPipelineDiagnostics(params.Id)
+	case METHOD_GET_PIPELINE_LOGS:
+		var params idParams
+		if err := decodeParams(dto.Params, &params); err != nil {
+			return nil, err
+		}
+		if err := readable(s, pipeline, params.Id); err != nil {
+			return nil, err
+		}
+		result, err = s.GetPipelineLogs(params.Id)
+	case METHOD_CREATE_LOG:
+		var params storage.LogsTable
+		if err := decodeParams(dto.Params, &params); err != nil {
+			return nil, err
+		}
+		if err := own(params.PipelineId); err != nil {
+			return nil, err
+		}
+		err = s.CreateLog(params)
+	case METHOD_START_LOG:
+		var params storage.LogsTable
+		if err := decodeParams(dto.Params, &params); err != nil {
+			return nil, err
+		}
+		if err := own(params.PipelineId); err != nil {
+			return nil, err
+		}
+		result, err = s.StartLog(params)
+	case METHOD_APPEND_LOG:
+		var params appendLogParams
+		if err := decodeParams(dto.Params, &params); err != nil {
+			return nil, err
+		}
+		if err := own(params.PipelineId); err != nil {
+			return nil, err
+		}
+		err = s.AppendLog(params.PipelineId, params.LogId, params.Results, params.FinalStatus)
+	case METHOD_CREATE_SIBLING_PIPELINES:
+		var params siblingsParams
+		if err := decodeParams(dto.Params, &params); err != nil {
+			return nil, err
+		}
+		if err := own(params.Id); err != nil {
+			return nil, err
+		}
+		err = s.CreateSiblingPipelines(params.Id, params.ConfigFiles)
+	case METHOD_CREATE_DOWNSTREAM_PIPELINE:
+		var params storage.PipelinesTable
+		if err := decodeParams(dto.Params, &params); err != nil {
+			return nil, err
+		}
+		if err := own(params.ParentPipelineId); err != nil {
+			return nil, err
+		}
+		result, err = s.CreateDownstreamPipeline(params)
+	case METHOD_GET_DOWNSTREAM_PIPELINE:
+		var params downstreamParams
+		if err := decodeParams(dto.Params, &params); err != nil {
+			return nil, err
+		}
+		if err := own(params.ParentPipelineId); err != nil {
+			return nil, err
+		}
+		result, err = s.GetDownstreamPipeline(params.ParentPipelineId, params.ParentJob)
+	case METHOD_WAIT_FOR_DOWNSTREAM:
+		var params waitForDownstreamParams
+		if err := decodeParams(dto.Params, &params); err != nil {
+			return nil, err
+		}
+		if err := downstream(s, pipelineId, params.PipelineId, params.DownstreamPipelineId); err != nil {
+			return nil, err
+		}
+		result, err = s.WaitForDownstream(params.PipelineId, params.DownstreamPipelineId, params.WorkspaceVolume)
+	case METHOD_REQUEST_APPROVAL:
+		var params approvalParams
+		if err := decodeParams(dto.Params, &params); err != nil {
+			return nil, err
+		}
+		if err := own(params.PipelineId); err != nil {
+			return nil, err
+		}
+		result, err = s.RequestApproval(params.PipelineId, params.JobName, params.WorkspaceVolume)
+	case METHOD_ACQUIRE_CONCURRENCY_LOCK:
+		var params acquireLockParams
+		if err := decodeParams(dto.Params, &params); err != nil {
+			return nil, err
+		}
+		if err := own(params.PipelineId); err != nil {
+			return nil, err
+		}
+		result, err = s.AcquireConcurrencyLock(params.Group, params.PipelineId, params.JobName, params.CancelInProgress, params.WorkspaceVolume)
+	case METHOD_RELEASE_CONCURRENCY_LOCK:
+		var params releaseLockParams
+		if err := decodeParams(dto.Params, &params); err != nil {
+			return nil, err
+		}
+		if err := own(params.PipelineId); err != nil {
+			return nil, err
+		}
+		err = s.ReleaseConcurrencyLock(params.Group, params.PipelineId)
+	case METHOD_IS_CANCEL_REQUESTED:
+		var params idParams
+		if err := decodeParams(dto.Params, &params); err != nil {
+			return nil, err
+		}
+		if err := own(params.Id); err != nil {
+			return nil, err
+		}
+		result, err = s.IsCancelRequested(params.Id)
+	case METHOD_SUPERSEDE_PIPELINES:
+		var params supersedeParams
+		if err := decodeParams(dto.Params, &params); err != nil {
+			return nil, err
+		}
+		if err := own(params.PipelineId); err != nil {
+			return nil, err
+		}
+		result, err = s.SupersedePipelines(params.PipelineId, params.CancelRunning)
+	case METHOD_REQUEUE_PIPELINE:
+		var params requeueParams
+		if err := decodeParams(dto.Params, &params); err != nil {
+			return nil, err
+		}
+		if err := own(params.PipelineId); err != nil {
+			return nil, err
+		}
+		result, err = s.RequeuePipeline(params.PipelineId, params.WorkspaceVolume, params.InterruptedJob)
+	case METHOD_HAND_OFF_PIPELINE:
+		var params handOffParams
+		if err := decodeParams(dto.Params, &params); err != nil {
+			return nil, err
+		}
+		if err := own(params.PipelineId); err != nil {
+			return nil, err
+		}
+		result, err = s.HandOffPipeline(params.PipelineId, params.RunsOn)
+	case METHOD_GET_REPOSITORY_SETTINGS:
+		var params repositoryParams
+		if err := decodeParams(dto.Params, &params); err != nil {
+			return nil, err
+		}
+		if err := repository(params.Repository); err != nil {
+			return nil, err
+		}
+		result, err = s.GetRepositorySettings(pipeline.Repository)
+	case METHOD_GET_REPOSITORY_CREDENTIALS:
+		var params repositoryParams
+		if err := decodeParams(dto.Params, &params); err != nil {
+			return nil, err
+		}
+		if !ci.IsTrustedRepository(params.Repository) {
+			if err := repository(params.Repository); err != nil {
+				return nil, err
+			}
+		}
+		if credentials != nil {
+			result, err = credentials.Get(params.Repository)
+		}
+	case METHOD_GET_REGISTRY_CREDENTIALS:
+		var params registryParams
+		if err := decodeParams(dto.Params, &params); err != nil {
+			return nil, err
+		}
+		if err := repository(params.Repository); err != nil {
+			return nil, err
+		}
+		if credentials != nil {
+			result, err = credentials.GetRegistry(pipeline.Repository, params.Registry)
+		}
+	default:
+		return nil, fmt.Errorf("%w: unknown method %q", ErrInvalidCall, dto.Method)
+	}
+
+	if err != nil {
+		response := &models.RunnerCallResponse{Error: err.Error(), ErrorCode: ERROR_CODE_INTERNAL}
+		if errors.Is(err, storage.ErrNotFound) {
+			response.ErrorCode = ERROR_CODE_NOT_FOUND
+		} else {
+			slog.Warn("runner call failed", slog.String("method", dto.Method), logger.Err(err))
+		}
+		return response, nil
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		return nil, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	return &models.RunnerCallResponse{Result: data}, nil
+}
+
+// readable checks that pipeline can be read by runner of another one, that is the pipeline itself, pipeline it reruns
+// and pipelines which triggered it one by one.
+func readable(s worker.Storage, pipeline *storage.PipelinesTable, id int64) error {
+	if id == pipeline.PipelineId || (pipeline.RerunOf != 0 && id == pipeline.RerunOf) {
+		return nil
+	}
+
+	parentId := pipeline.ParentPipelineId
+	for depth := 0; parentId != 0 && depth < worker.MAX_DOWNSTREAM_DEPTH; depth++ {
+		if parentId == id {
+			return nil
+		}
+		parent, err := s.GetPipelineInfo(parentId)
+		if err != nil {
+			break
+		}
+		parentId = parent.ParentPipelineId
+	}
+
+	return fmt.Errorf("%w: pipeline %d", ErrCallNotAllowed, id)
+}
+
+// downstream checks that pipeline waits for its own downstream pipeline.
+func downstream(s worker.Storage, pipelineId, waitingId, downstreamId int64) error {
+	if waitingId != pipelineId {
+		return fmt.Errorf("%w: pipeline %d", ErrCallNotAllowed, waitingId)
+	}
+
+	pipeline, err := s.GetPipelineInfo(downstreamId)
+	if err != nil || pipeline.ParentPipelineId != pipelineId {
+		return fmt.Errorf("%w: downstream pipeline %d", ErrCallNotAllowed, downstreamId)
+	}
+	return nil
+}
+
+func decodeParams(data json.RawMessage, params any) error {
+	if err := json.Unmarshal(data, params); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidCall, err)
+	}
+	return nil
+}
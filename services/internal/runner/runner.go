@@ -0,0 +1,108 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"pipecraft/internal/config"
+	"pipecraft/internal/logger"
+	"pipecraft/internal/worker"
+	"time"
+)
+
+// Runner runs pipelines which it gets from server with the same worker as server does, logs and statuses are sent
+// back to server as they are written.
+// NOTE: runner is registered anew on every start, pipelines of previous registration are requeued by server once
+// its heartbeats are missed
+type Runner struct {
+	cfg      config.Runner
+	client   *Client
+	pool     *worker.Pool
+	listener *worker.Listener
+	reaper   *worker.Reaper
+
+	heartbeatInterval time.Duration
+	stopHeartbeats    context.CancelFunc
+	heartbeatsStopped chan struct{}
+}
+
+func New(cfg config.Runner) *Runner {
+	return &Runner{
+		cfg:    cfg,
+		client: NewClient(cfg.ServerUrl),
+		pool:   worker.NewPool(cfg.PoolSize),
+	}
+}
+
+// Register registers runner on server with registration token, it has to be done before runner is started.
+func (r *Runner) Register(registrationToken string) error {
+	const op = "runner.Runner.Register"
+
+	response, err := r.client.Register(r.cfg.Name, registrationToken, r.cfg.Labels)
+	if err != nil {
+		return fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	ci := config.CI{
+		ConfigPath:             response.CI.ConfigPath,
+		PipelinesDir:           response.CI.PipelinesDir,
+		ProtectedBranches:      response.CI.ProtectedBranches,
+		PrivilegedRepositories: response.CI.PrivilegedRepositories,
+		TrustedRepositories:    response.CI.TrustedRepositories,
+	}
+	listenInterval := time.Duration(r.cfg.ListenInterval) * time.Second
+
+	r.listener = worker.NewListener(r.client, nil, ci, r.cfg.Resources, r.cfg.Docker, r.cfg.InstanceId, r.pool, listenInterval)
+	r.reaper = worker.NewReaper(r.listener)
+	r.heartbeatInterval = time.Duration(response.HeartbeatInterval) * time.Second
+
+	slog.Info("runner is registered", slog.Int64("runner_id", response.RunnerId), slog.String("name", r.cfg.Name), slog.Any("labels", r.cfg.Labels))
+	return nil
+}
+
+// Start runs pipelines until ctx is done, heartbeats are sent until runner is shut down.
+func (r *Runner) Start(ctx context.Context) {
+	heartbeatCtx, stopHeartbeats := context.WithCancel(context.Background())
+	r.stopHeartbeats = stopHeartbeats
+	r.heartbeatsStopped = make(chan struct{})
+
+	go r.heartbeats(heartbeatCtx)
+
+	// NOTE: leftovers of previous run are removed before pipelines are claimed, so they don't clash with new ones
+	r.reaper.Reap(ctx)
+	if r.cfg.ReaperInterval > 0 {
+		go r.reaper.Start(ctx, time.Duration(r.cfg.ReaperInterval)*time.Second)
+	}
+
+	r.listener.Start(ctx)
+}
+
+// Shutdown waits for running pipelines like worker of server does, interrupted pipelines are requeued on server.
+func (r *Runner) Shutdown(ctx context.Context) error {
+	err := r.listener.Shutdown(ctx)
+
+	if r.stopHeartbeats != nil {
+		r.stopHeartbeats()
+		<-r.heartbeatsStopped
+	}
+
+	return err
+}
+
+func (r *Runner) heartbeats(ctx context.Context) {
+	defer close(r.heartbeatsStopped)
+
+	ticker := time.NewTicker(r.heartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.client.Heartbeat(ctx); err != nil && ctx.Err() == nil {
+				slog.Warn("failed to send heartbeat", logger.Err(err))
+			}
+		}
+	}
+}
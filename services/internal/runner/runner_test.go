@@ -0,0 +1,201 @@
+package runner_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"pipecraft/internal/config"
+	"pipecraft/internal/handlers"
+	"pipecraft/internal/runner"
+	"pipecraft/internal/server"
+	"pipecraft/internal/services"
+	"pipecraft/internal/storage"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const REGISTRATION_TOKEN = "registration-token"
+
+// newServer serves runner api over loopback with storage mock in place of the database.
+func newServer(t *testing.T, runners config.Runners) (*httptest.Server, *services.StorageMock, *services.RunnerService) {
+	storageMock := services.NewStorageMock()
+	runnerService := services.NewRunnerService(storageMock, storageMock, nil, REGISTRATION_TOKEN, config.CI{ConfigPath: "ci.yaml"}, runners, nil)
+	runnerService.PollInterval = 10 * time.Millisecond
+
+	h := handlers.New(
+		handlers.NewMockRedisServie(),
+		handlers.NewMockPipelineService(),
+		handlers.NewMockCredentialsService(),
+		handlers.NewMockSettingsService(),
+		handlers.NewMockScheduleService(),
+		handlers.NewMockPoolService(),
+		runnerService,
+		handlers.NewMockReaperService(),
+	)
+	srv := httptest.NewServer(server.New(h, config.Http{}).Handler())
+	t.Cleanup(srv.Close)
+
+	return srv, storageMock, runnerService
+}
+
+func TestRunner_Loopback(t *testing.T) {
+	srv, storageMock, _ := newServer(t, config.Runners{HeartbeatTimeout: 60, PollTimeout: 1, AckTimeout: 60})
+
+	client := runner.NewClient(srv.URL)
+	_, err := client.Register("runner-1", "wrong", nil)
+	require.ErrorIs(t, err, runner.ErrRegistrationFailed)
+
+	registered, err := client.Register("runner-1", REGISTRATION_TOKEN, nil)
+	require.NoError(t, err)
+	require.Equal(t, "ci.yaml", registered.CI.ConfigPath)
+	require.NoError(t, client.Heartbeat(context.Background()))
+
+	pipelineId, err := storageMock.CreatePipeline(storage.PipelinesTable{Repository: "ysayonnar/pipecraft", Ref: "main"}, false)
+	require.NoError(t, err)
+
+	claimed, err := client.ClaimNextPipeline(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, pipelineId, claimed)
+
+	// nothing is left in the queue, long poll ends after poll timeout
+	_, err = client.ClaimNextPipeline(context.Background())
+	require.ErrorIs(t, err, storage.ErrNotFound)
+
+	// worker of runner reads and writes pipeline through server
+	s, credentials := client.Pipeline(pipelineId)
+
+	info, err := s.GetPipelineInfo(pipelineId)
+	require.NoError(t, err)
+	require.Equal(t, "ysayonnar/pipecraft", info.Repository)
+	require.Equal(t, storage.PIPELINE_STATUS_RUNNING, info.Status)
+
+	err = s.CreateLog(storage.LogsTable{CommandName: "build:test", Command: "go test ./...", Results: "ok", FinalStatus: storage.LOG_STATUS_SUCCEEDED, PipelineId: pipelineId})
+	require.NoError(t, err)
+
+	err = s.UpdatePipelineStatus(pipelineId, storage.PIPELINE_STATUS_COMPLETED)
+	require.NoError(t, err)
+
+	status, err := storageMock.GetPipelineStatus(pipelineId)
+	require.NoError(t, err)
+	require.Equal(t, storage.PIPELINE_STATUS_COMPLETED, status)
+
+	_, err = s.GetDownstreamPipeline(pipelineId, "deploy")
+	require.ErrorIs(t, err, storage.ErrNotFound)
+
+	repositoryCredentials, err := credentials.Get("ysayonnar/pipecraft")
+	require.NoError(t, err)
+	require.Nil(t, repositoryCredentials)
+
+	registryCredentials, err := credentials.GetRegistry("ysayonnar/pipecraft", "ghcr.io")
+	require.NoError(t, err)
+	require.Nil(t, registryCredentials)
+
+	// other runner can't change pipeline it wasn't given
+	other := runner.NewClient(srv.URL)
+	_, err = other.Register("runner-2", REGISTRATION_TOKEN, nil)
+	require.NoError(t, err)
+
+	// pipeline which server doesn't know is not found for reaper of runner
+	unknownStorage, _ := client.Pipeline(42)
+	_, err = unknownStorage.GetPipelineInfo(42)
+	require.ErrorIs(t, err, storage.ErrNotFound)
+
+	otherStorage, _ := other.Pipeline(pipelineId)
+	err = otherStorage.UpdatePipelineStatus(pipelineId, storage.PIPELINE_STATUS_FAILED)
+	require.ErrorIs(t, err, runner.ErrPipelineNotAssigned)
+
+	unregistered := runner.NewClient(srv.URL)
+	_, err = unregistered.ClaimNextPipeline(context.Background())
+	require.ErrorIs(t, err, runner.ErrNotRegistered)
+}
+
+func TestRunner_LostRunnerIsRequeued(t *testing.T) {
+	srv, storageMock, runnerService := newServer(t, config.Runners{HeartbeatTimeout: 1, PollTimeout: 1, AckTimeout: 60})
+
+	lost := runner.NewClient(srv.URL)
+	_, err := lost.Register("runner-1", REGISTRATION_TOKEN, nil)
+	require.NoError(t, err)
+
+	pipelineId, err := storageMock.CreatePipeline(storage.PipelinesTable{Repository: "ysayonnar/pipecraft", Ref: "main"}, false)
+	require.NoError(t, err)
+
+	claimed, err := lost.ClaimNextPipeline(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, pipelineId, claimed)
+
+	// runner sends no heartbeats for heartbeat timeout
+	time.Sleep(1100 * time.Millisecond)
+
+	requeued, err := runnerService.RequeueLost()
+	require.NoError(t, err)
+	require.Equal(t, []int64{pipelineId}, requeued)
+
+	s, _ := lost.Pipeline(pipelineId)
+	err = s.UpdatePipelineStatus(pipelineId, storage.PIPELINE_STATUS_COMPLETED)
+	require.ErrorIs(t, err, runner.ErrPipelineNotAssigned)
+
+	// requeued pipeline is given to another runner
+	other := runner.NewClient(srv.URL)
+	_, err = other.Register("runner-2", REGISTRATION_TOKEN, nil)
+	require.NoError(t, err)
+
+	claimed, err = other.ClaimNextPipeline(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, pipelineId, claimed)
+}
+
+func TestRunner_HandOffByLabels(t *testing.T) {
+	srv, storageMock, _ := newServer(t, config.Runners{HeartbeatTimeout: 60, PollTimeout: 1, AckTimeout: 60})
+
+	small := runner.NewClient(srv.URL)
+	_, err := small.Register("runner-1", REGISTRATION_TOKEN, []string{"linux"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"linux"}, small.Labels())
+
+	pipelineId, err := storageMock.CreatePipeline(storage.PipelinesTable{Repository: "ysayonnar/pipecraft", Ref: "main"}, false)
+	require.NoError(t, err)
+
+	claimed, err := small.ClaimNextPipeline(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, pipelineId, claimed)
+
+	// ci config asks for labels runner doesn't have, so pipeline goes back to the queue
+	s, _ := small.Pipeline(pipelineId)
+	handedOff, err := s.HandOffPipeline(pipelineId, []string{"large", "linux"})
+	require.NoError(t, err)
+	require.True(t, handedOff)
+
+	_, err = small.ClaimNextPipeline(context.Background())
+	require.ErrorIs(t, err, storage.ErrNotFound)
+
+	large := runner.NewClient(srv.URL)
+	_, err = large.Register("runner-2", REGISTRATION_TOKEN, []string{"linux", "large"})
+	require.NoError(t, err)
+
+	claimed, err = large.ClaimNextPipeline(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, pipelineId, claimed)
+}
+
+func TestRunner_StartAndShutdown(t *testing.T) {
+	srv, _, _ := newServer(t, config.Runners{HeartbeatTimeout: 3, PollTimeout: 1, AckTimeout: 60})
+
+	r := runner.New(config.Runner{ServerUrl: srv.URL, Name: "runner-1", PoolSize: 1, ListenInterval: 1})
+	require.NoError(t, r.Register(REGISTRATION_TOKEN))
+
+	ctx, stop := context.WithCancel(context.Background())
+	started := make(chan struct{})
+	go func() {
+		defer close(started)
+		r.Start(ctx)
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+	stop()
+	<-started
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.NoError(t, r.Shutdown(shutdownCtx))
+}
@@ -1,6 +1,8 @@
 package server
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"github.com/gorilla/mux"
 	"log/slog"
@@ -12,29 +14,66 @@ import (
 )
 
 type Server struct {
-	Handlers *handlers.Handlers
+	Handlers   *handlers.Handlers
+	httpServer *http.Server
 }
 
-func New(h *handlers.Handlers) *Server {
-	return &Server{Handlers: h}
+func New(h *handlers.Handlers, httpCfg config.Http) *Server {
+	s := &Server{Handlers: h}
+	s.httpServer = &http.Server{
+		Addr:         fmt.Sprintf(":%d", httpCfg.Port),
+		Handler:      s.router(),
+		ReadTimeout:  time.Duration(httpCfg.ReadTimeout) * time.Second,
+		WriteTimeout: time.Duration(httpCfg.WriteTimeout) * time.Second,
+	}
+	return s
+}
+
+func (s *Server) Listen() {
+	err := s.httpServer.ListenAndServe()
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		slog.Error("error while listening http-server", logger.Err(err))
+	}
+}
+
+// Shutdown stops accepting requests and waits for active ones until ctx is done.
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.httpServer.Shutdown(ctx)
 }
 
-func (s *Server) Listen(httpCfg config.Http) {
+// Handler returns router of server, so it can be served by other http-server as well.
+func (s *Server) Handler() http.Handler {
+	return s.httpServer.Handler
+}
+
+func (s *Server) router() *mux.Router {
 	r := mux.NewRouter()
 
 	r.HandleFunc("/run-pipeline", s.Handlers.RunPipeline)
+	r.HandleFunc("/pipelines", s.Handlers.ListPipelines)
+	r.HandleFunc("/queue", s.Handlers.Queue)
+	r.HandleFunc("/pipeline/{id}", s.Handlers.Pipeline)
 	r.HandleFunc("/pipeline/{id}/status", s.Handlers.PipelineStatus)
 	r.HandleFunc("/pipeline/{id}/logs", s.Handlers.PipelineLogs)
+	r.HandleFunc("/pipeline/{id}/rerun", s.Handlers.RerunPipeline)
+	r.HandleFunc("/pipeline/{id}/diagnostics", s.Handlers.PipelineDiagnostics)
+	r.HandleFunc("/pipeline/{id}/config", s.Handlers.PipelineConfig)
+	r.HandleFunc("/pipeline/{id}/approvals", s.Handlers.PipelineApprovals)
+	r.HandleFunc("/pipeline/{id}/jobs/{job}/approve", s.Handlers.ApproveJob)
+	r.HandleFunc("/pipeline/{id}/jobs/{job}/reject", s.Handlers.RejectJob)
+	r.HandleFunc("/lint", s.Handlers.Lint)
+	r.HandleFunc("/schema", s.Handlers.Schema)
+	r.HandleFunc("/repository/credentials", s.Handlers.RepositoryCredentials)
+	r.HandleFunc("/repository/registry-credentials", s.Handlers.RegistryCredentials)
+	r.HandleFunc("/repository/settings", s.Handlers.RepositorySettings)
+	r.HandleFunc("/schedules", s.Handlers.Schedules)
+	r.HandleFunc("/schedules/{id}", s.Handlers.Schedule)
+	r.HandleFunc("/admin/pool", s.Handlers.Pool)
+	r.HandleFunc("/admin/orphans", s.Handlers.Orphans)
+	r.HandleFunc("/runners/register", s.Handlers.RegisterRunner)
+	r.HandleFunc("/runner/heartbeat", s.Handlers.RunnerHeartbeat)
+	r.HandleFunc("/runner/pipelines/request", s.Handlers.RequestRunnerPipeline)
+	r.HandleFunc("/runner/pipelines/{id}/call", s.Handlers.RunnerCall)
 
-	server := &http.Server{
-		Addr:         fmt.Sprintf(":%d", httpCfg.Port),
-		Handler:      r,
-		ReadTimeout:  time.Duration(httpCfg.ReadTimeout) * time.Second,
-		WriteTimeout: time.Duration(httpCfg.WriteTimeout) * time.Second,
-	}
-
-	err := server.ListenAndServe()
-	if err != nil {
-		slog.Error("error while listening http-server", logger.Err(err))
-	}
+	return r
 }
@@ -0,0 +1,245 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"pipecraft/internal/models"
+	"pipecraft/internal/secrets"
+	"pipecraft/internal/storage"
+	"pipecraft/internal/vcs"
+	"pipecraft/internal/worker"
+	"strings"
+)
+
+var (
+	ErrCredentialsNotFound = errors.New("credentials not found")
+	ErrInvalidCredentials  = vcs.ErrInvalidCredentials
+	ErrEncryptionDisabled  = errors.New("credentials encryption key is not configured")
+)
+
+type CredentialsService struct {
+	Storage CredentialsStorage
+	Cipher  *secrets.Cipher
+}
+
+type CredentialsStorage interface {
+	SaveRepositoryCredentials(credentials storage.CredentialsTable) error
+	GetRepositoryCredentials(repository string) (*storage.CredentialsTable, error)
+	DeleteRepositoryCredentials(repository string) error
+	SaveRegistryCredentials(credentials storage.RegistryCredentialsTable) error
+	GetRegistryCredentials(repository, registry string) (*storage.RegistryCredentialsTable, error)
+	DeleteRegistryCredentials(repository, registry string) error
+}
+
+func NewCredentialsService(s CredentialsStorage, c *secrets.Cipher) *CredentialsService {
+	return &CredentialsService{Storage: s, Cipher: c}
+}
+
+func (s *CredentialsService) Save(dto *models.RepositoryCredentialsRequest) error {
+	const op = `services.CredentialsService.Save`
+
+	if s.Cipher == nil {
+		return ErrEncryptionDisabled
+	}
+
+	credentials := vcs.Credentials{
+		Kind:          dto.Kind,
+		SSHPrivateKey: dto.SSHPrivateKey,
+		KnownHosts:    dto.KnownHosts,
+		Username:      dto.Username,
+		Token:         dto.Token,
+	}
+	if dto.RepositoryUrl == "" {
+		return fmt.Errorf("%w: empty repository_url", ErrInvalidCredentials)
+	}
+	if err := credentials.Validate(); err != nil {
+		return err
+	}
+	if _, err := credentials.Files(dto.RepositoryUrl); err != nil {
+		return err
+	}
+
+	plaintext, err := json.Marshal(credentials)
+	if err != nil {
+		return fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	secret, err := s.Cipher.Encrypt(plaintext)
+	if err != nil {
+		return fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	err = s.Storage.SaveRepositoryCredentials(storage.CredentialsTable{
+		Repository: dto.RepositoryUrl,
+		Kind:       dto.Kind,
+		Secret:     secret,
+	})
+	if err != nil {
+		return fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *CredentialsService) Info(repository string) (*models.RepositoryCredentialsResponse, error) {
+	const op = `services.CredentialsService.Info`
+
+	credentials, err := s.Storage.GetRepositoryCredentials(repository)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, ErrCredentialsNotFound
+		}
+		return nil, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	return &models.RepositoryCredentialsResponse{
+		RepositoryUrl: credentials.Repository,
+		Kind:          credentials.Kind,
+		UpdatedAt:     credentials.UpdatedAt,
+	}, nil
+}
+
+func (s *CredentialsService) Delete(repository string) error {
+	const op = `services.CredentialsService.Delete`
+
+	err := s.Storage.DeleteRepositoryCredentials(repository)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return ErrCredentialsNotFound
+		}
+		return fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	return nil
+}
+
+// Get returns decrypted credentials of repository or nil when repository has none.
+func (s *CredentialsService) Get(repository string) (*vcs.Credentials, error) {
+	const op = `services.CredentialsService.Get`
+
+	credentialsTable, err := s.Storage.GetRepositoryCredentials(repository)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	if s.Cipher == nil {
+		return nil, fmt.Errorf("op: %s, err: %w", op, ErrEncryptionDisabled)
+	}
+
+	plaintext, err := s.Cipher.Decrypt(credentialsTable.Secret)
+	if err != nil {
+		return nil, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	var credentials vcs.Credentials
+	if err := json.Unmarshal(plaintext, &credentials); err != nil {
+		return nil, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	return &credentials, nil
+}
+
+// SaveRegistry stores credentials which docker-build steps of repository push to registry with.
+func (s *CredentialsService) SaveRegistry(dto *models.RegistryCredentialsRequest) error {
+	const op = `services.CredentialsService.SaveRegistry`
+
+	if s.Cipher == nil {
+		return ErrEncryptionDisabled
+	}
+
+	if dto.RepositoryUrl == "" {
+		return fmt.Errorf("%w: empty repository_url", ErrInvalidCredentials)
+	}
+	if dto.Registry == "" || strings.ContainsAny(dto.Registry, "/ ") {
+		return fmt.Errorf("%w: registry has to be a host like ghcr.io", ErrInvalidCredentials)
+	}
+	if dto.Username == "" || dto.Password == "" {
+		return fmt.Errorf("%w: registry credentials require username and password", ErrInvalidCredentials)
+	}
+
+	plaintext, err := json.Marshal(worker.RegistryCredentials{Username: dto.Username, Password: dto.Password})
+	if err != nil {
+		return fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	secret, err := s.Cipher.Encrypt(plaintext)
+	if err != nil {
+		return fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	err = s.Storage.SaveRegistryCredentials(storage.RegistryCredentialsTable{
+		Repository: dto.RepositoryUrl,
+		Registry:   dto.Registry,
+		Secret:     secret,
+	})
+	if err != nil {
+		return fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *CredentialsService) RegistryInfo(repository, registry string) (*models.RegistryCredentialsResponse, error) {
+	const op = `services.CredentialsService.RegistryInfo`
+
+	credentials, err := s.Storage.GetRegistryCredentials(repository, registry)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, ErrCredentialsNotFound
+		}
+		return nil, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	return &models.RegistryCredentialsResponse{
+		RepositoryUrl: credentials.Repository,
+		Registry:      credentials.Registry,
+		UpdatedAt:     credentials.UpdatedAt,
+	}, nil
+}
+
+func (s *CredentialsService) DeleteRegistry(repository, registry string) error {
+	const op = `services.CredentialsService.DeleteRegistry`
+
+	err := s.Storage.DeleteRegistryCredentials(repository, registry)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return ErrCredentialsNotFound
+		}
+		return fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	return nil
+}
+
+// GetRegistry returns decrypted credentials of registry for repository or nil when repository has none.
+func (s *CredentialsService) GetRegistry(repository, registry string) (*worker.RegistryCredentials, error) {
+	const op = `services.CredentialsService.GetRegistry`
+
+	credentialsTable, err := s.Storage.GetRegistryCredentials(repository, registry)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	if s.Cipher == nil {
+		return nil, fmt.Errorf("op: %s, err: %w", op, ErrEncryptionDisabled)
+	}
+
+	plaintext, err := s.Cipher.Decrypt(credentialsTable.Secret)
+	if err != nil {
+		return nil, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	var credentials worker.RegistryCredentials
+	if err := json.Unmarshal(plaintext, &credentials); err != nil {
+		return nil, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	return &credentials, nil
+}
@@ -1,45 +1,457 @@
 package services
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	"pipecraft/internal/config"
+	"pipecraft/internal/jobs"
 	"pipecraft/internal/models"
 	"pipecraft/internal/storage"
+	"pipecraft/internal/vcs"
+	"time"
 )
 
 var (
-	ErrNotFound      = errors.New("pipeline not found")
-	ErrAlreadyExists = errors.New("pipeline already exists")
+	ErrNotFound         = errors.New("pipeline not found")
+	ErrAlreadyExists    = errors.New("pipeline already exists")
+	ErrNotFinished      = errors.New("pipeline is not finished")
+	ErrRefNotFound      = errors.New("ref not found in repository")
+	ErrConfigNotRead    = errors.New("ci config of pipeline is not read yet")
+	ErrApprovalNotFound = errors.New("job of pipeline is not waiting for approval")
+	ErrApprovalDecided  = errors.New("approval is already decided")
+	ErrInvalidApproval  = errors.New("invalid approval")
+	ErrInvalidCheckout  = vcs.ErrInvalidCheckout
+	ErrInvalidRef       = vcs.ErrInvalidRef
+	ErrInvalidInputs    = jobs.ErrInvalidInputs
+	ErrInvalidConfig    = jobs.ErrInvalidConfig
+	ErrInvalidPriority  = errors.New("invalid pipeline priority")
 )
 
+const (
+	DEFAULT_LIST_LIMIT = 50
+	MAX_LIST_LIMIT     = 500
+
+	MIN_PRIORITY = -100
+	MAX_PRIORITY = 100
+)
+
+// NOTE: Anonymous reads repositories which are neither repository of pipeline nor trusted, so ci config can't
+// include private files of them with credentials of server
 type PipelineService struct {
-	Storage Storage
+	Storage   Storage
+	Resolver  Resolver
+	Anonymous Resolver
+	CI        config.CI
 }
 
 type Storage interface {
-	CreatePipeline(repository, branch, commit string) (int64, error)
+	CreatePipeline(pipeline storage.PipelinesTable, force bool) (int64, error)
+	CreateRerun(id int64, failedOnly bool, triggeredBy string) (int64, error)
 	GetPipelineStatus(id int64) (string, error)
 	GetPipelineLogs(id int64) ([]*storage.LogsTable, error)
+	GetPipelineDiagnostics(id int64) (string, error)
+	GetPipelineConfig(id int64) (string, string, error)
+	DecideApproval(pipelineId int64, jobName, status, decidedBy string) error
+	ListApprovals(pipelineId int64) ([]*storage.ApprovalsTable, error)
+	ListPipelines(filter storage.PipelinesFilter) ([]*storage.PipelinesTable, error)
+	GetPipelineInfo(id int64) (*storage.PipelinesTable, error)
+	ListDownstreamPipelines(parentPipelineId int64) ([]*storage.PipelinesTable, error)
+	GetRepositorySettings(repository string) (*storage.RepositorySettingsTable, error)
+	ListQueue() ([]*storage.QueueTable, error)
+	SupersedePipelines(pipelineId int64, cancelRunning bool) ([]int64, error)
 }
 
-func NewPipelineService(s Storage) *PipelineService {
-	return &PipelineService{Storage: s}
+type Resolver interface {
+	ResolveRef(repository, refType, ref string) (string, error)
+	ReadFile(repository, ref, file string) ([]byte, error)
+}
+
+func NewPipelineService(s Storage, r Resolver, ci config.CI) *PipelineService {
+	return &PipelineService{Storage: s, Resolver: r, Anonymous: vcs.NewResolver(nil), CI: ci}
 }
 
 func (s *PipelineService) Run(dto *models.RunPipelineRequest) (*models.RunPipelineResponse, error) {
 	const op = `service.PipelineService.Run`
 
-	pipelineId, err := s.Storage.CreatePipeline(dto.RepositoryUrl, dto.Branch, dto.Commit)
+	// NOTE: priority which is not given comes from trigger, so scheduled pipelines don't hold up pushed ones
+	priority := storage.TriggerPriority(dto.Trigger)
+	if dto.Priority != nil {
+		if *dto.Priority < MIN_PRIORITY || *dto.Priority > MAX_PRIORITY {
+			return nil, fmt.Errorf("%w: priority has to be between %d and %d", ErrInvalidPriority, MIN_PRIORITY, MAX_PRIORITY)
+		}
+		priority = *dto.Priority
+	}
+
+	checkout := "{}"
+	if dto.Checkout != nil {
+		if err := dto.Checkout.Validate(); err != nil {
+			return nil, err
+		}
+
+		data, err := json.Marshal(dto.Checkout)
+		if err != nil {
+			return nil, fmt.Errorf(`%s: %w`, op, err)
+		}
+		checkout = string(data)
+	}
+
+	// NOTE: branch field is kept for clients which don't know about refs
+	ref := dto.Ref
+	if ref == "" {
+		ref = dto.Branch
+	}
+	refType, ref, err := vcs.NormalizeRef(dto.RefType, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	branch := ""
+	commit := dto.Commit
+	switch refType {
+	case vcs.REF_TYPE_BRANCH:
+		branch = ref
+	case vcs.REF_TYPE_COMMIT:
+		commit = ref
+	}
+
+	// NOTE: dedupe key has to contain concrete commit, otherwise branch tip is built only once
+	if commit == "" {
+		sha, err := s.Resolver.ResolveRef(dto.RepositoryUrl, refType, ref)
+		if err != nil {
+			if errors.Is(err, vcs.ErrRefNotFound) {
+				return nil, ErrRefNotFound
+			}
+			return nil, fmt.Errorf(`%s: %w`, op, err)
+		}
+		commit = sha
+	}
+
+	// NOTE: inputs are checked also when none are given, config may require some
+	if err := s.validateInputs(dto.RepositoryUrl, commit, dto.Inputs); err != nil {
+		return nil, err
+	}
+
+	inputs := "{}"
+	if len(dto.Inputs) > 0 {
+		data, err := json.Marshal(dto.Inputs)
+		if err != nil {
+			return nil, fmt.Errorf(`%s: %w`, op, err)
+		}
+		inputs = string(data)
+	}
+
+	pipelineId, err := s.Storage.CreatePipeline(storage.PipelinesTable{
+		Repository:  dto.RepositoryUrl,
+		Branch:      branch,
+		Ref:         ref,
+		RefType:     refType,
+		Commit:      commit,
+		Checkout:    checkout,
+		Trigger:     dto.Trigger,
+		TriggeredBy: dto.TriggeredBy,
+		Inputs:      inputs,
+		Priority:    priority,
+	}, dto.Force)
 	if err != nil {
 		if errors.Is(err, storage.ErrPipelineAlreadyExists) {
-			return &models.RunPipelineResponse{PipelineId: pipelineId}, ErrAlreadyExists
+			return &models.RunPipelineResponse{PipelineId: pipelineId, Commit: commit}, ErrAlreadyExists
 		}
 		return nil, fmt.Errorf(`%s: %w`, op, err)
 	}
 
+	superseded, err := s.supersede(pipelineId, dto.RepositoryUrl, branch)
+	if err != nil {
+		return nil, fmt.Errorf(`%s: %w`, op, err)
+	}
+
+	return &models.RunPipelineResponse{PipelineId: pipelineId, Commit: commit, Superseded: superseded}, nil
+}
+
+// supersede applies auto cancel policy of repository to older pipelines of branch, protected branches are never touched.
+// NOTE: policy of ci config is applied by worker once config is read
+func (s *PipelineService) supersede(pipelineId int64, repository, branch string) ([]int64, error) {
+	const op = `services.PipelineService.supersede`
+
+	if branch == "" || s.CI.IsProtectedBranch(branch) {
+		return nil, nil
+	}
+
+	settings, err := s.Storage.GetRepositorySettings(repository)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+	if !settings.AutoCancel {
+		return nil, nil
+	}
+
+	superseded, err := s.Storage.SupersedePipelines(pipelineId, settings.AutoCancelRunning)
+	if err != nil {
+		return nil, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	return superseded, nil
+}
+
+// validateInputs checks inputs against ci config of repository at commit, invalid config is ErrInvalidConfig.
+// NOTE: config which isn't found at config path may be found by worker in pipelines dir, so inputs are checked
+// there once more
+func (s *PipelineService) validateInputs(repository, commit string, inputs map[string]any) error {
+	const op = `services.PipelineService.validateInputs`
+
+	configPath := s.CI.ConfigPath
+	settings, err := s.Storage.GetRepositorySettings(repository)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return fmt.Errorf("op: %s, err: %w", op, err)
+	}
+	if settings != nil && settings.CiConfigPath != "" {
+		configPath = settings.CiConfigPath
+	}
+
+	loader := resolverLoader{resolver: s.Resolver, anonymous: s.Anonymous, trusted: s.CI.IsTrustedRepository, repository: repository, commit: commit}
+	data, err := loader.Load("", "", configPath)
+	if err != nil {
+		if errors.Is(err, vcs.ErrFileNotFound) || errors.Is(err, vcs.ErrRefNotFound) {
+			return nil
+		}
+		return fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	expanded, err := jobs.Expand(data, loader)
+	if err != nil {
+		if errors.Is(err, jobs.ErrInvalidConfig) || errors.Is(err, jobs.ErrInvalidInclude) ||
+			errors.Is(err, vcs.ErrFileNotFound) || errors.Is(err, vcs.ErrRefNotFound) {
+			return fmt.Errorf("%w: %w", ErrInvalidConfig, err)
+		}
+		return fmt.Errorf("op: %s, err: %w", op, err)
+	}
+	pipeline, err := jobs.ParsePipeline(expanded)
+	if err != nil {
+		return err
+	}
+
+	_, err = jobs.ResolveInputs(pipeline.Inputs, inputs)
+	return err
+}
+
+// resolverLoader reads included files from remote repositories, local includes are read at pipeline commit.
+// Repositories which are neither repository of pipeline nor trusted are read anonymously, as worker reads them.
+type resolverLoader struct {
+	resolver   Resolver
+	anonymous  Resolver
+	trusted    func(repository string) bool
+	repository string
+	commit     string
+}
+
+func (l resolverLoader) Load(repository, ref, file string) ([]byte, error) {
+	if repository == "" {
+		return l.resolver.ReadFile(l.repository, l.commit, file)
+	}
+	if repository != l.repository && !l.trusted(repository) {
+		return l.anonymous.ReadFile(repository, ref, file)
+	}
+	return l.resolver.ReadFile(repository, ref, file)
+}
+
+func (s *PipelineService) Rerun(id int64, failedOnly bool, triggeredBy string) (*models.RunPipelineResponse, error) {
+	const op = `services.PipelineService.Rerun`
+
+	pipelineId, err := s.Storage.CreateRerun(id, failedOnly, triggeredBy)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, ErrNotFound
+		}
+		if errors.Is(err, storage.ErrPipelineNotFinished) {
+			return nil, ErrNotFinished
+		}
+		return nil, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
 	return &models.RunPipelineResponse{PipelineId: pipelineId}, nil
 }
 
+func (s *PipelineService) List(dto *models.ListPipelinesRequest) (*models.PipelinesListResponse, error) {
+	const op = `services.PipelineService.List`
+
+	limit := dto.Limit
+	if limit <= 0 {
+		limit = DEFAULT_LIST_LIMIT
+	}
+	limit = min(limit, MAX_LIST_LIMIT)
+
+	pipelines, err := s.Storage.ListPipelines(storage.PipelinesFilter{
+		Repository: dto.RepositoryUrl,
+		RefType:    dto.RefType,
+		Status:     dto.Status,
+		Limit:      limit,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	response := &models.PipelinesListResponse{Pipelines: make([]models.PipelineResponse, len(pipelines))}
+	for i, pipeline := range pipelines {
+		response.Pipelines[i], err = pipelineResponse(pipeline)
+		if err != nil {
+			return nil, fmt.Errorf("op: %s, err: %w", op, err)
+		}
+	}
+
+	return response, nil
+}
+
+// Get returns pipeline with links to pipeline which triggered it and pipelines triggered by it.
+func (s *PipelineService) Get(id int64) (*models.PipelineDetailsResponse, error) {
+	const op = `services.PipelineService.Get`
+
+	pipeline, err := s.Storage.GetPipelineInfo(id)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	downstream, err := s.Storage.ListDownstreamPipelines(id)
+	if err != nil {
+		return nil, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	response := &models.PipelineDetailsResponse{
+		ParentJob:  pipeline.ParentJob,
+		Downstream: make([]models.DownstreamPipelineResponse, len(downstream)),
+	}
+	response.PipelineResponse, err = pipelineResponse(pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	for i, child := range downstream {
+		response.Downstream[i] = models.DownstreamPipelineResponse{
+			PipelineId:    child.PipelineId,
+			Job:           child.ParentJob,
+			Status:        child.Status,
+			RepositoryUrl: child.Repository,
+			Branch:        child.Branch,
+			Commit:        child.Commit,
+		}
+	}
+
+	return response, nil
+}
+
+func pipelineResponse(pipeline *storage.PipelinesTable) (models.PipelineResponse, error) {
+	response := models.PipelineResponse{
+		PipelineId:       pipeline.PipelineId,
+		Status:           pipeline.Status,
+		RepositoryUrl:    pipeline.Repository,
+		Branch:           pipeline.Branch,
+		Ref:              pipeline.Ref,
+		RefType:          pipeline.RefType,
+		Commit:           pipeline.Commit,
+		Attempt:          pipeline.Attempt,
+		RerunOf:          pipeline.RerunOf,
+		ConfigFile:       pipeline.ConfigFile,
+		Trigger:          pipeline.Trigger,
+		TriggeredBy:      pipeline.TriggeredBy,
+		ParentPipelineId: pipeline.ParentPipelineId,
+		Priority:         pipeline.Priority,
+		CreatedAt:        pipeline.CreatedAt,
+	}
+	if pipeline.Inputs != "" {
+		if err := json.Unmarshal([]byte(pipeline.Inputs), &response.Inputs); err != nil {
+			return models.PipelineResponse{}, err
+		}
+	}
+
+	return response, nil
+}
+
+// Queue returns running pipelines and waiting ones in the order they are claimed, start of waiting pipeline is estimated
+// from average durations of the last pipelines of its repository.
+// NOTE: as many pipelines are assumed to run at a time as are running now, which is the pool size while queue is not empty
+func (s *PipelineService) Queue() (*models.QueueResponse, error) {
+	const op = `services.PipelineService.Queue`
+
+	queue, err := s.Storage.ListQueue()
+	if err != nil {
+		return nil, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	now := time.Now()
+	response := &models.QueueResponse{
+		Running: make([]models.QueuedPipelineResponse, 0),
+		Waiting: make([]models.QueuedPipelineResponse, 0),
+	}
+
+	// slots hold times at which running pipelines are expected to finish
+	var slots []time.Time
+	for _, entry := range queue {
+		if entry.Status != storage.PIPELINE_STATUS_RUNNING {
+			continue
+		}
+
+		finishAt := now
+		if entry.StartedAt != nil {
+			finishAt = entry.StartedAt.Add(entry.AverageDuration)
+		}
+		if finishAt.Before(now) {
+			finishAt = now
+		}
+		slots = append(slots, finishAt)
+
+		response.Running = append(response.Running, queuedPipelineResponse(entry))
+	}
+	if len(slots) == 0 {
+		slots = append(slots, now)
+	}
+
+	estimated := true
+	for _, entry := range queue {
+		if entry.Status == storage.PIPELINE_STATUS_RUNNING {
+			continue
+		}
+
+		pipeline := queuedPipelineResponse(entry)
+		pipeline.Position = len(response.Waiting) + 1
+
+		// NOTE: pipelines after one without known duration can't be estimated
+		if estimated {
+			slot := 0
+			for i := range slots {
+				if slots[i].Before(slots[slot]) {
+					slot = i
+				}
+			}
+
+			startAt := slots[slot]
+			pipeline.EstimatedStartAt = &startAt
+			slots[slot] = startAt.Add(entry.AverageDuration)
+			estimated = entry.AverageDuration > 0
+		}
+
+		response.Waiting = append(response.Waiting, pipeline)
+	}
+
+	return response, nil
+}
+
+func queuedPipelineResponse(entry *storage.QueueTable) models.QueuedPipelineResponse {
+	return models.QueuedPipelineResponse{
+		PipelineId:    entry.PipelineId,
+		RepositoryUrl: entry.Repository,
+		Ref:           entry.Ref,
+		Trigger:       entry.Trigger,
+		Priority:      entry.Priority,
+		StartedAt:     entry.StartedAt,
+		CreatedAt:     entry.CreatedAt,
+	}
+}
+
 func (s *PipelineService) GetStatus(id int64) (*models.PipelineStatusResponse, error) {
 	const op = `services.PipelineService.GetStatus`
 
@@ -79,3 +491,102 @@ func (s *PipelineService) GetLogs(id int64) (*models.PipelineLogsResponse, error
 
 	return &models.PipelineLogsResponse{Logs: logsRequest}, nil
 }
+
+func (s *PipelineService) Lint(data []byte) *models.LintResponse {
+	diagnostics := jobs.Lint(data)
+	return &models.LintResponse{Valid: !jobs.HasErrors(diagnostics), Diagnostics: diagnostics}
+}
+
+func (s *PipelineService) GetDiagnostics(id int64) (*models.LintResponse, error) {
+	const op = `services.PipelineService.GetDiagnostics`
+
+	data, err := s.Storage.GetPipelineDiagnostics(id)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	diagnostics := []jobs.Diagnostic{}
+	if err := json.Unmarshal([]byte(data), &diagnostics); err != nil {
+		return nil, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	return &models.LintResponse{Valid: !jobs.HasErrors(diagnostics), Diagnostics: diagnostics}, nil
+}
+
+func (s *PipelineService) GetConfig(id int64) (*models.PipelineConfigResponse, error) {
+	const op = `services.PipelineService.GetConfig`
+
+	configFile, config, err := s.Storage.GetPipelineConfig(id)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+	if config == "" {
+		return nil, ErrConfigNotRead
+	}
+
+	return &models.PipelineConfigResponse{ConfigFile: configFile, Config: config}, nil
+}
+
+func (s *PipelineService) Approve(id int64, jobName string, dto *models.ApprovalRequest) error {
+	return s.decide(id, jobName, storage.APPROVAL_STATUS_APPROVED, dto)
+}
+
+func (s *PipelineService) Reject(id int64, jobName string, dto *models.ApprovalRequest) error {
+	return s.decide(id, jobName, storage.APPROVAL_STATUS_REJECTED, dto)
+}
+
+func (s *PipelineService) decide(id int64, jobName, status string, dto *models.ApprovalRequest) error {
+	const op = `services.PipelineService.decide`
+
+	if dto.User == "" {
+		return fmt.Errorf("%w: empty user", ErrInvalidApproval)
+	}
+
+	err := s.Storage.DecideApproval(id, jobName, status, dto.User)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return ErrApprovalNotFound
+		}
+		if errors.Is(err, storage.ErrApprovalDecided) {
+			return ErrApprovalDecided
+		}
+		return fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *PipelineService) ListApprovals(id int64) (*models.ApprovalsListResponse, error) {
+	const op = `services.PipelineService.ListApprovals`
+
+	if _, err := s.Storage.GetPipelineStatus(id); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	approvals, err := s.Storage.ListApprovals(id)
+	if err != nil {
+		return nil, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	response := &models.ApprovalsListResponse{Approvals: make([]models.ApprovalResponse, len(approvals))}
+	for i, approval := range approvals {
+		response.Approvals[i] = models.ApprovalResponse{
+			JobName:   approval.JobName,
+			Status:    approval.Status,
+			DecidedBy: approval.DecidedBy,
+			DecidedAt: approval.DecidedAt,
+			CreatedAt: approval.CreatedAt,
+		}
+	}
+
+	return response, nil
+}
@@ -0,0 +1,50 @@
+package services
+
+import "errors"
+
+type PoolMock struct {
+	size   int
+	busy   int
+	paused bool
+}
+
+func NewPoolMock(size int) *PoolMock {
+	return &PoolMock{size: size}
+}
+
+func (p *PoolMock) Size() int {
+	return p.size
+}
+
+func (p *PoolMock) Busy() int {
+	return p.busy
+}
+
+func (p *PoolMock) Paused() bool {
+	return p.paused
+}
+
+func (p *PoolMock) Resize(size int) error {
+	p.size = size
+	return nil
+}
+
+func (p *PoolMock) Pause() {
+	p.paused = true
+}
+
+func (p *PoolMock) Resume() {
+	p.paused = false
+}
+
+type ErrorPoolMock struct {
+	PoolMock
+}
+
+func NewErrorPoolMock() *ErrorPoolMock {
+	return &ErrorPoolMock{}
+}
+
+func (p *ErrorPoolMock) Resize(size int) error {
+	return errors.New("mocked error")
+}
@@ -0,0 +1,60 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"pipecraft/internal/models"
+)
+
+var ErrInvalidPoolSize = errors.New("invalid pool size")
+
+const MAX_POOL_SIZE = 100
+
+type PoolService struct {
+	Pool Pool
+}
+
+type Pool interface {
+	Size() int
+	Busy() int
+	Paused() bool
+	Resize(size int) error
+	Pause()
+	Resume()
+}
+
+func NewPoolService(p Pool) *PoolService {
+	return &PoolService{Pool: p}
+}
+
+func (s *PoolService) Get() *models.PoolResponse {
+	return &models.PoolResponse{
+		Size:   s.Pool.Size(),
+		Busy:   s.Pool.Busy(),
+		Paused: s.Pool.Paused(),
+	}
+}
+
+// Update changes size of pool and pauses or resumes claiming of pipelines, running pipelines keep running.
+func (s *PoolService) Update(dto *models.PoolRequest) (*models.PoolResponse, error) {
+	const op = `services.PoolService.Update`
+
+	if dto.Size != nil {
+		if *dto.Size <= 0 || *dto.Size > MAX_POOL_SIZE {
+			return nil, fmt.Errorf("%w: size has to be between 1 and %d", ErrInvalidPoolSize, MAX_POOL_SIZE)
+		}
+		if err := s.Pool.Resize(*dto.Size); err != nil {
+			return nil, fmt.Errorf("op: %s, err: %w", op, err)
+		}
+	}
+
+	if dto.Paused != nil {
+		if *dto.Paused {
+			s.Pool.Pause()
+		} else {
+			s.Pool.Resume()
+		}
+	}
+
+	return s.Get(), nil
+}
@@ -0,0 +1,31 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"pipecraft/internal/worker"
+)
+
+type ReaperMock struct {
+	orphans []worker.Orphan
+}
+
+func NewReaperMock(orphans ...worker.Orphan) *ReaperMock {
+	return &ReaperMock{orphans: orphans}
+}
+
+func (r *ReaperMock) Orphans(ctx context.Context) ([]worker.Orphan, error) {
+	return r.orphans, nil
+}
+
+type ErrorReaperMock struct {
+	ReaperMock
+}
+
+func NewErrorReaperMock() *ErrorReaperMock {
+	return &ErrorReaperMock{}
+}
+
+func (r *ErrorReaperMock) Orphans(ctx context.Context) ([]worker.Orphan, error) {
+	return nil, errors.New("mocked error")
+}
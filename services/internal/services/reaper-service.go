@@ -0,0 +1,51 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"pipecraft/internal/models"
+	"pipecraft/internal/worker"
+)
+
+var ErrReaperDisabled = errors.New("reaper is disabled")
+
+// ReaperService shows what is left on docker host by pipelines which are not run anymore, reaper is nil while
+// workers of server are disabled.
+type ReaperService struct {
+	Reaper Reaper
+}
+
+type Reaper interface {
+	Orphans(ctx context.Context) ([]worker.Orphan, error)
+}
+
+func NewReaperService(r Reaper) *ReaperService {
+	return &ReaperService{Reaper: r}
+}
+
+// Orphans returns containers, networks and volumes which reaper would remove on its next run, nothing is removed.
+func (s *ReaperService) Orphans(ctx context.Context) (*models.OrphansResponse, error) {
+	const op = `services.ReaperService.Orphans`
+
+	if s.Reaper == nil {
+		return nil, ErrReaperDisabled
+	}
+
+	orphans, err := s.Reaper.Orphans(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	response := &models.OrphansResponse{Orphans: []models.OrphanResponse{}}
+	for _, orphan := range orphans {
+		response.Orphans = append(response.Orphans, models.OrphanResponse{
+			Kind:       orphan.Kind,
+			Name:       orphan.Name,
+			PipelineId: orphan.PipelineId,
+			Reason:     orphan.Reason,
+		})
+	}
+
+	return response, nil
+}
@@ -0,0 +1,62 @@
+package services
+
+import (
+	"errors"
+	"pipecraft/internal/vcs"
+)
+
+type ResolverMock struct {
+	refs  map[string]string
+	files map[string]string
+}
+
+func NewResolverMock() *ResolverMock {
+	return &ResolverMock{
+		refs: map[string]string{
+			"refs/heads/branch": "3f1c2a9d8e7b6a5c4d3e2f1a0b9c8d7e6f5a4b3c",
+			"refs/tags/v1.0.0":  "9a8b7c6d5e4f3a2b1c0d9e8f7a6b5c4d3e2f1a0b",
+			"refs/pull/42/head": "0a1b2c3d4e5f6a7b8c9d0e1f2a3b4c5d6e7f8a9b",
+		},
+		files: make(map[string]string),
+	}
+}
+
+func (r *ResolverMock) AddFile(repository, ref, file, content string) {
+	r.files[repository+"@"+ref+":"+file] = content
+}
+
+func (r *ResolverMock) ResolveRef(repository, refType, ref string) (string, error) {
+	if refType == vcs.REF_TYPE_COMMIT {
+		return ref, nil
+	}
+
+	sha, ok := r.refs[vcs.FullRef(refType, ref)]
+	if !ok {
+		return "", vcs.ErrRefNotFound
+	}
+
+	return sha, nil
+}
+
+func (r *ResolverMock) ReadFile(repository, ref, file string) ([]byte, error) {
+	content, ok := r.files[repository+"@"+ref+":"+file]
+	if !ok {
+		return nil, vcs.ErrFileNotFound
+	}
+
+	return []byte(content), nil
+}
+
+type ErrorResolverMock struct{}
+
+func NewErrorResolverMock() *ErrorResolverMock {
+	return &ErrorResolverMock{}
+}
+
+func (e ErrorResolverMock) ResolveRef(repository, refType, ref string) (string, error) {
+	return "", errors.New("mocked error")
+}
+
+func (e ErrorResolverMock) ReadFile(repository, ref, file string) ([]byte, error) {
+	return nil, errors.New("mocked error")
+}
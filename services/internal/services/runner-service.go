@@ -0,0 +1,302 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"pipecraft/internal/config"
+	"pipecraft/internal/logger"
+	"pipecraft/internal/models"
+	"pipecraft/internal/runner"
+	"pipecraft/internal/storage"
+	"pipecraft/internal/worker"
+	"strings"
+	"time"
+)
+
+var (
+	ErrRunnersDisabled     = errors.New("runners are disabled")
+	ErrInvalidRunner       = errors.New("invalid runner")
+	ErrInvalidRunnerToken  = errors.New("invalid runner token")
+	ErrNoPipeline          = errors.New("no pipeline to run")
+	ErrPipelineNotAssigned = errors.New("pipeline is not assigned to runner")
+	ErrInvalidRunnerCall   = runner.ErrInvalidCall
+)
+
+const (
+	RUNNER_TOKEN_BYTES   = 32
+	RUNNER_POLL_INTERVAL = time.Second
+
+	// NOTE: runner is asked to send a few heartbeats per heartbeat timeout, so one lost request doesn't requeue its pipelines
+	HEARTBEATS_PER_TIMEOUT = 3
+)
+
+// RunnerService serves runners which run pipelines outside of server. Runner registers with registration token and
+// labels and then takes pipelines from the same queue as workers of server do. Local labels are labels of workers
+// of server, they are nil while workers are disabled.
+type RunnerService struct {
+	Storage           RunnerStorage
+	Backend           worker.Storage
+	Credentials       worker.Credentials
+	RegistrationToken string
+	CI                config.CI
+	Runners           config.Runners
+	LocalLabels       []string
+	PollInterval      time.Duration
+}
+
+type RunnerStorage interface {
+	CreateRunner(name, tokenHash string, labels []string) (int64, error)
+	GetRunner(runnerId int64) (*storage.RunnersTable, error)
+	GetRunnerByTokenHash(tokenHash string) (*storage.RunnersTable, error)
+	UpdateRunnerHeartbeat(runnerId int64) error
+	ClaimNextPipeline(runnerId int64, labels []string) (int64, error)
+	IsPipelineAssigned(pipelineId, runnerId int64) (bool, error)
+	AcknowledgePipeline(pipelineId, runnerId int64) error
+	RequeueLostPipelines(heartbeatTimeout, ackTimeout time.Duration) ([]int64, error)
+	UpdateWaitingForRunner(heartbeatTimeout time.Duration, localLabels []string) error
+}
+
+// NewRunnerService returns service of runners, runners can't register while registration token is empty.
+func NewRunnerService(s RunnerStorage, backend worker.Storage, credentials worker.Credentials, registrationToken string, ci config.CI, runners config.Runners, localLabels []string) *RunnerService {
+	return &RunnerService{
+		Storage:           s,
+		Backend:           backend,
+		Credentials:       credentials,
+		RegistrationToken: registrationToken,
+		CI:                ci,
+		Runners:           runners,
+		LocalLabels:       localLabels,
+		PollInterval:      RUNNER_POLL_INTERVAL,
+	}
+}
+
+func (s *RunnerService) Register(dto *models.RegisterRunnerRequest) (*models.RegisterRunnerResponse, error) {
+	const op = `services.RunnerService.Register`
+
+	if s.RegistrationToken == "" {
+		return nil, ErrRunnersDisabled
+	}
+	if subtle.ConstantTimeCompare([]byte(dto.RegistrationToken), []byte(s.RegistrationToken)) != 1 {
+		return nil, ErrInvalidRunnerToken
+	}
+	if strings.TrimSpace(dto.Name) == "" {
+		return nil, fmt.Errorf("%w: empty name", ErrInvalidRunner)
+	}
+	for _, label := range dto.Labels {
+		if strings.TrimSpace(label) == "" {
+			return nil, fmt.Errorf("%w: empty label", ErrInvalidRunner)
+		}
+	}
+
+	tokenData := make([]byte, RUNNER_TOKEN_BYTES)
+	if _, err := rand.Read(tokenData); err != nil {
+		return nil, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+	token := hex.EncodeToString(tokenData)
+
+	runnerId, err := s.Storage.CreateRunner(dto.Name, hashRunnerToken(token), dto.Labels)
+	if err != nil {
+		return nil, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	return &models.RegisterRunnerResponse{
+		RunnerId:          runnerId,
+		Token:             token,
+		HeartbeatInterval: max(s.Runners.HeartbeatTimeout/HEARTBEATS_PER_TIMEOUT, 1),
+		PollTimeout:       s.Runners.PollTimeout,
+		CI: models.RunnerCIResponse{
+			ConfigPath:             s.CI.ConfigPath,
+			PipelinesDir:           s.CI.PipelinesDir,
+			ProtectedBranches:      s.CI.ProtectedBranches,
+			PrivilegedRepositories: s.CI.PrivilegedRepositories,
+			TrustedRepositories:    s.CI.TrustedRepositories,
+		},
+	}, nil
+}
+
+// Authenticate returns id of runner which token belongs to.
+func (s *RunnerService) Authenticate(token string) (int64, error) {
+	const op = `services.RunnerService.Authenticate`
+
+	if s.RegistrationToken == "" {
+		return 0, ErrRunnersDisabled
+	}
+	if token == "" {
+		return 0, ErrInvalidRunnerToken
+	}
+
+	runner, err := s.Storage.GetRunnerByTokenHash(hashRunnerToken(token))
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return 0, ErrInvalidRunnerToken
+		}
+		return 0, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	return runner.RunnerId, nil
+}
+
+func (s *RunnerService) Heartbeat(runnerId int64) error {
+	const op = `services.RunnerService.Heartbeat`
+
+	if err := s.Storage.UpdateRunnerHeartbeat(runnerId); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return ErrInvalidRunnerToken
+		}
+		return fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	return nil
+}
+
+// RequestPipeline waits for poll timeout until there is a pipeline for labels of runner, ErrNoPipeline is returned
+// otherwise. Request of pipeline counts as heartbeat of runner.
+// NOTE: response may be lost after pipeline is claimed, so pipeline which runner doesn't acknowledge with its first
+// call is requeued after ack timeout
+func (s *RunnerService) RequestPipeline(ctx context.Context, runnerId int64) (*models.RunnerPipelineResponse, error) {
+	const op = `services.RunnerService.RequestPipeline`
+
+	if err := s.Heartbeat(runnerId); err != nil {
+		return nil, err
+	}
+
+	runner, err := s.Storage.GetRunner(runnerId)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, ErrInvalidRunnerToken
+		}
+		return nil, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	deadline := time.After(time.Duration(s.Runners.PollTimeout) * time.Second)
+	for {
+		pipelineId, err := s.Storage.ClaimNextPipeline(runnerId, runner.Labels)
+		if err == nil {
+			// NOTE: runner which gave up waiting doesn't get claimed pipeline, so it is put back to the queue
+			if ctx.Err() != nil {
+				s.requeue(pipelineId)
+				return nil, ctx.Err()
+			}
+			return &models.RunnerPipelineResponse{PipelineId: pipelineId}, nil
+		}
+		if !errors.Is(err, storage.ErrNotFound) {
+			return nil, fmt.Errorf("op: %s, err: %w", op, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-deadline:
+			return nil, ErrNoPipeline
+		case <-time.After(s.PollInterval):
+		}
+	}
+}
+
+func (s *RunnerService) requeue(pipelineId int64) {
+	pipeline, err := s.Backend.GetPipelineInfo(pipelineId)
+	if err != nil {
+		slog.Error("error while getting pipeline to requeue", logger.Err(err))
+		return
+	}
+	if _, err := s.Backend.RequeuePipeline(pipelineId, pipeline.WorkspaceVolume, ""); err != nil {
+		slog.Error("error while requeueing pipeline", logger.Err(err))
+	}
+}
+
+// Call runs call of runner against storage, runner can call only on behalf of pipeline it was given. First call
+// acknowledges that runner got pipeline.
+func (s *RunnerService) Call(runnerId, pipelineId int64, dto *models.RunnerCallRequest) (*models.RunnerCallResponse, error) {
+	const op = `services.RunnerService.Call`
+
+	assigned, err := s.Storage.IsPipelineAssigned(pipelineId, runnerId)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+	if !assigned {
+		return nil, ErrPipelineNotAssigned
+	}
+	if err := s.Storage.AcknowledgePipeline(pipelineId, runnerId); err != nil {
+		return nil, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	response, err := runner.Dispatch(s.Backend, s.Credentials, s.CI, pipelineId, dto)
+	if err != nil {
+		if errors.Is(err, runner.ErrInvalidCall) {
+			return nil, err
+		}
+		if errors.Is(err, runner.ErrCallNotAllowed) {
+			return nil, fmt.Errorf("%w: %w", ErrPipelineNotAssigned, err)
+		}
+		return nil, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	return response, nil
+}
+
+// RequeueLost puts pipelines of runners which missed their heartbeats and pipelines runners didn't acknowledge back
+// to the queue.
+func (s *RunnerService) RequeueLost() ([]int64, error) {
+	const op = `services.RunnerService.RequeueLost`
+
+	requeued, err := s.Storage.RequeueLostPipelines(
+		time.Duration(s.Runners.HeartbeatTimeout)*time.Second,
+		time.Duration(s.Runners.AckTimeout)*time.Second,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	return requeued, nil
+}
+
+// UpdateWaitingForRunner marks waiting pipelines which neither online runner nor worker of server can run as waiting
+// for runner.
+func (s *RunnerService) UpdateWaitingForRunner() error {
+	const op = `services.RunnerService.UpdateWaitingForRunner`
+
+	if err := s.Storage.UpdateWaitingForRunner(time.Duration(s.Runners.HeartbeatTimeout)*time.Second, s.LocalLabels); err != nil {
+		return fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	return nil
+}
+
+// StartReaper requeues pipelines of lost runners and updates pipelines waiting for runner every half of heartbeat
+// timeout until ctx is done.
+func (s *RunnerService) StartReaper(ctx context.Context) {
+	interval := time.Duration(s.Runners.HeartbeatTimeout) * time.Second / 2
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+
+		requeued, err := s.RequeueLost()
+		if err != nil {
+			slog.Error("error while requeueing pipelines of lost runners", logger.Err(err))
+		} else if len(requeued) > 0 {
+			slog.Warn("pipelines of lost runners are requeued", slog.Any("pipelines", requeued))
+		}
+
+		if err := s.UpdateWaitingForRunner(); err != nil {
+			slog.Error("error while updating pipelines waiting for runner", logger.Err(err))
+		}
+	}
+}
+
+func hashRunnerToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
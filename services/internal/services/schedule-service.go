@@ -0,0 +1,190 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"pipecraft/internal/models"
+	"pipecraft/internal/storage"
+	"pipecraft/internal/vcs"
+	"time"
+	_ "time/tzdata" // NOTE: timezones of schedules have to be known even in images without tzdata
+
+	"github.com/robfig/cron/v3"
+)
+
+var (
+	ErrScheduleNotFound = errors.New("schedule not found")
+	ErrInvalidSchedule  = errors.New("invalid schedule")
+)
+
+const DEFAULT_SCHEDULE_TIMEZONE = "UTC"
+
+var cronParser = cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+type ScheduleService struct {
+	Storage ScheduleStorage
+}
+
+type ScheduleStorage interface {
+	CreateSchedule(schedule storage.SchedulesTable) (*storage.SchedulesTable, error)
+	UpdateSchedule(schedule storage.SchedulesTable) (*storage.SchedulesTable, error)
+	GetSchedule(id int64) (*storage.SchedulesTable, error)
+	ListSchedules(repository string) ([]*storage.SchedulesTable, error)
+	DeleteSchedule(id int64) error
+}
+
+func NewScheduleService(s ScheduleStorage) *ScheduleService {
+	return &ScheduleService{Storage: s}
+}
+
+// NextRun returns the first time after given one which matches cron expression in timezone of schedule.
+func NextRun(cronExpression, timezone string, after time.Time) (time.Time, error) {
+	location, err := time.LoadLocation(timezone)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: unknown timezone %q", ErrInvalidSchedule, timezone)
+	}
+
+	schedule, err := cronParser.Parse(cronExpression)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: %s", ErrInvalidSchedule, err.Error())
+	}
+
+	next := schedule.Next(after.In(location))
+	if next.IsZero() {
+		return time.Time{}, fmt.Errorf("%w: cron expression never matches", ErrInvalidSchedule)
+	}
+
+	return next.UTC(), nil
+}
+
+func (s *ScheduleService) Create(dto *models.ScheduleRequest) (*models.ScheduleResponse, error) {
+	const op = `services.ScheduleService.Create`
+
+	schedule, err := scheduleFromRequest(dto)
+	if err != nil {
+		return nil, err
+	}
+
+	created, err := s.Storage.CreateSchedule(*schedule)
+	if err != nil {
+		return nil, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	return scheduleResponse(created), nil
+}
+
+func (s *ScheduleService) Update(id int64, dto *models.ScheduleRequest) (*models.ScheduleResponse, error) {
+	const op = `services.ScheduleService.Update`
+
+	schedule, err := scheduleFromRequest(dto)
+	if err != nil {
+		return nil, err
+	}
+	schedule.ScheduleId = id
+
+	updated, err := s.Storage.UpdateSchedule(*schedule)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, ErrScheduleNotFound
+		}
+		return nil, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	return scheduleResponse(updated), nil
+}
+
+func (s *ScheduleService) Get(id int64) (*models.ScheduleResponse, error) {
+	const op = `services.ScheduleService.Get`
+
+	schedule, err := s.Storage.GetSchedule(id)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, ErrScheduleNotFound
+		}
+		return nil, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	return scheduleResponse(schedule), nil
+}
+
+func (s *ScheduleService) List(repository string) (*models.SchedulesListResponse, error) {
+	const op = `services.ScheduleService.List`
+
+	schedules, err := s.Storage.ListSchedules(repository)
+	if err != nil {
+		return nil, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	response := &models.SchedulesListResponse{Schedules: make([]models.ScheduleResponse, len(schedules))}
+	for i, schedule := range schedules {
+		response.Schedules[i] = *scheduleResponse(schedule)
+	}
+
+	return response, nil
+}
+
+func (s *ScheduleService) Delete(id int64) error {
+	const op = `services.ScheduleService.Delete`
+
+	err := s.Storage.DeleteSchedule(id)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return ErrScheduleNotFound
+		}
+		return fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	return nil
+}
+
+// scheduleFromRequest validates request and computes next run, disabled schedules have no next run.
+func scheduleFromRequest(dto *models.ScheduleRequest) (*storage.SchedulesTable, error) {
+	if dto.RepositoryUrl == "" {
+		return nil, fmt.Errorf("%w: empty repository_url", ErrInvalidSchedule)
+	}
+	if _, _, err := vcs.NormalizeRef(vcs.REF_TYPE_BRANCH, dto.Branch); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidSchedule, err.Error())
+	}
+
+	timezone := dto.Timezone
+	if timezone == "" {
+		timezone = DEFAULT_SCHEDULE_TIMEZONE
+	}
+	enabled := true
+	if dto.Enabled != nil {
+		enabled = *dto.Enabled
+	}
+
+	nextRunAt, err := NextRun(dto.CronExpression, timezone, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	schedule := &storage.SchedulesTable{
+		Repository:     dto.RepositoryUrl,
+		Branch:         dto.Branch,
+		CronExpression: dto.CronExpression,
+		Timezone:       timezone,
+		Enabled:        enabled,
+	}
+	if enabled {
+		schedule.NextRunAt = &nextRunAt
+	}
+
+	return schedule, nil
+}
+
+func scheduleResponse(schedule *storage.SchedulesTable) *models.ScheduleResponse {
+	return &models.ScheduleResponse{
+		ScheduleId:     schedule.ScheduleId,
+		RepositoryUrl:  schedule.Repository,
+		Branch:         schedule.Branch,
+		CronExpression: schedule.CronExpression,
+		Timezone:       schedule.Timezone,
+		Enabled:        schedule.Enabled,
+		NextRunAt:      schedule.NextRunAt,
+		LastRunAt:      schedule.LastRunAt,
+		CreatedAt:      schedule.CreatedAt,
+		UpdatedAt:      schedule.UpdatedAt,
+	}
+}
@@ -0,0 +1,80 @@
+package services
+
+import (
+	"context"
+	"log/slog"
+	"pipecraft/internal/logger"
+	"pipecraft/internal/models"
+	"pipecraft/internal/storage"
+	"time"
+)
+
+type SchedulerStorage interface {
+	ListDueSchedules(now time.Time) ([]*storage.SchedulesTable, error)
+	ClaimScheduleRun(id int64, nextRunAt, newNextRunAt time.Time) (bool, error)
+}
+
+type PipelineRunner interface {
+	Run(dto *models.RunPipelineRequest) (*models.RunPipelineResponse, error)
+}
+
+// Scheduler runs pipelines of due schedules, every run is claimed in storage first,
+// so several replicas of scheduler fire it only once.
+type Scheduler struct {
+	Storage   SchedulerStorage
+	Pipelines PipelineRunner
+}
+
+func NewScheduler(s SchedulerStorage, pipelines PipelineRunner) *Scheduler {
+	return &Scheduler{Storage: s, Pipelines: pipelines}
+}
+
+// Start fires due schedules every interval until ctx is done.
+func (s *Scheduler) Start(ctx context.Context, interval time.Duration) {
+	for {
+		s.Tick(time.Now())
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// Tick runs every schedule due at now, runs missed while scheduler was down are fired once.
+func (s *Scheduler) Tick(now time.Time) {
+	schedules, err := s.Storage.ListDueSchedules(now)
+	if err != nil {
+		slog.Error("error while listing due schedules", logger.Err(err))
+		return
+	}
+
+	for _, schedule := range schedules {
+		nextRunAt, err := NextRun(schedule.CronExpression, schedule.Timezone, now)
+		if err != nil {
+			slog.Error("error while computing next run of schedule", slog.Int64("schedule_id", schedule.ScheduleId), logger.Err(err))
+			continue
+		}
+
+		claimed, err := s.Storage.ClaimScheduleRun(schedule.ScheduleId, *schedule.NextRunAt, nextRunAt)
+		if err != nil {
+			slog.Error("error while claiming schedule run", slog.Int64("schedule_id", schedule.ScheduleId), logger.Err(err))
+			continue
+		}
+		if !claimed {
+			continue
+		}
+
+		// NOTE: scheduled pipelines run even when branch has no new commits
+		_, err = s.Pipelines.Run(&models.RunPipelineRequest{
+			RepositoryUrl: schedule.Repository,
+			Branch:        schedule.Branch,
+			Force:         true,
+			Trigger:       storage.TRIGGER_SCHEDULE,
+		})
+		if err != nil {
+			slog.Error("error while running scheduled pipeline", slog.Int64("schedule_id", schedule.ScheduleId), logger.Err(err))
+		}
+	}
+}
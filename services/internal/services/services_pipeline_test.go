@@ -1,8 +1,10 @@
 package services
 
 import (
+	"pipecraft/internal/config"
 	"pipecraft/internal/models"
 	"pipecraft/internal/storage"
+	"pipecraft/internal/vcs"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -14,7 +16,7 @@ type Suite struct {
 
 func NewSuite() *Suite {
 	s := NewStorageMock()
-	p := NewPipelineService(s)
+	p := NewPipelineService(s, NewResolverMock(), config.CI{ConfigPath: "ci.yaml"})
 	return &Suite{pipelineService: p}
 }
 
@@ -86,7 +88,7 @@ func Test_PipelineService_Logs_HappyPath(t *testing.T) {
 
 func Test_PipelineService_Error(t *testing.T) {
 	s := NewErrorStorageMock()
-	p := NewPipelineService(s)
+	p := NewPipelineService(s, NewResolverMock(), config.CI{ConfigPath: "ci.yaml"})
 
 	requestDto := models.RunPipelineRequest{
 		RepositoryUrl: "repo",
@@ -98,11 +100,545 @@ func Test_PipelineService_Error(t *testing.T) {
 	require.Error(t, err)
 	require.Nil(t, runResponse)
 
+	rerunResponse, err := p.Rerun(int64(1), false, "")
+	require.Error(t, err)
+	require.Nil(t, rerunResponse)
+
 	logsResponse, err := p.GetLogs(int64(1))
 	require.Error(t, err)
 	require.Nil(t, logsResponse)
 
+	listResponse, err := p.List(&models.ListPipelinesRequest{})
+	require.Error(t, err)
+	require.Nil(t, listResponse)
+
 	statusResponse, err := p.GetStatus(int64(1))
 	require.Error(t, err)
 	require.Nil(t, statusResponse)
 }
+
+func Test_PipelineService_Run_Force(t *testing.T) {
+	s := NewSuite()
+
+	requestDto := models.RunPipelineRequest{
+		RepositoryUrl: "repo",
+		Branch:        "branch",
+		Commit:        "commit",
+	}
+
+	resp, err := s.pipelineService.Run(&requestDto)
+	require.NoError(t, err)
+	require.Equal(t, resp.PipelineId, int64(1))
+
+	// forcing new attempt of the same commit
+	requestDto.Force = true
+	resp, err = s.pipelineService.Run(&requestDto)
+	require.NoError(t, err)
+	require.Equal(t, resp.PipelineId, int64(2))
+}
+
+func Test_PipelineService_Rerun(t *testing.T) {
+	storageMock := NewStorageMock()
+	p := NewPipelineService(storageMock, NewResolverMock(), config.CI{ConfigPath: "ci.yaml"})
+
+	requestDto := models.RunPipelineRequest{
+		RepositoryUrl: "repo",
+		Branch:        "branch",
+		Commit:        "commit",
+	}
+
+	runResponse, err := p.Run(&requestDto)
+	require.NoError(t, err)
+
+	// pipeline is still waiting
+	rerunResponse, err := p.Rerun(runResponse.PipelineId, false, "")
+	require.ErrorIs(t, err, ErrNotFinished)
+	require.Nil(t, rerunResponse)
+
+	storageMock.pipelines[runResponse.PipelineId].Status = storage.PIPELINE_STATUS_FAILED
+
+	rerunResponse, err = p.Rerun(runResponse.PipelineId, true, "alice")
+	require.NoError(t, err)
+	require.Equal(t, rerunResponse.PipelineId, int64(2))
+
+	rerun := storageMock.pipelines[rerunResponse.PipelineId]
+	require.Equal(t, rerun.RerunOf, runResponse.PipelineId)
+	require.Equal(t, rerun.Attempt, 2)
+	require.True(t, rerun.FailedOnly)
+	require.Equal(t, storage.TRIGGER_RERUN, rerun.Trigger)
+	require.Equal(t, "alice", rerun.TriggeredBy)
+
+	rerunResponse, err = p.Rerun(int64(-1), false, "")
+	require.ErrorIs(t, err, ErrNotFound)
+	require.Nil(t, rerunResponse)
+}
+
+func Test_PipelineService_Run_Inputs(t *testing.T) {
+	storageMock := NewStorageMock()
+	resolverMock := NewResolverMock()
+	p := NewPipelineService(storageMock, resolverMock, config.CI{ConfigPath: "ci.yaml"})
+
+	resolverMock.AddFile("repo", "commit", "ci.yaml", `include: [ci/inputs.yaml]
+jobs:
+  deploy:
+    steps:
+      - run: make deploy
+`)
+	resolverMock.AddFile("repo", "commit", "ci/inputs.yaml", `inputs:
+  deploy_env:
+    type: choice
+    options: [staging, prod]
+jobs: {}
+`)
+
+	requestDto := models.RunPipelineRequest{
+		RepositoryUrl: "repo",
+		Branch:        "branch",
+		Commit:        "commit",
+		TriggeredBy:   "alice",
+		Inputs:        map[string]any{"deploy_env": "qa"},
+	}
+
+	resp, err := p.Run(&requestDto)
+	require.ErrorIs(t, err, ErrInvalidInputs)
+	require.Nil(t, resp)
+
+	requestDto.Inputs["deploy_env"] = "prod"
+	resp, err = p.Run(&requestDto)
+	require.NoError(t, err)
+
+	pipeline := storageMock.pipelines[resp.PipelineId]
+	require.Equal(t, storage.TRIGGER_API, pipeline.Trigger)
+	require.Equal(t, "alice", pipeline.TriggeredBy)
+	require.JSONEq(t, `{"deploy_env": "prod"}`, pipeline.Inputs)
+
+	// same commit with other inputs is a new pipeline
+	requestDto.Inputs["deploy_env"] = "staging"
+	resp, err = p.Run(&requestDto)
+	require.NoError(t, err)
+	require.Equal(t, int64(2), resp.PipelineId)
+
+	// config of repository settings is read instead of global one
+	require.NoError(t, storageMock.SaveRepositorySettings(storage.RepositorySettingsTable{Repository: "repo", CiConfigPath: "deploy.yaml"}))
+	requestDto.Inputs = map[string]any{"unknown": true}
+	resp, err = p.Run(&requestDto)
+	require.NoError(t, err)
+
+	list, err := p.List(&models.ListPipelinesRequest{})
+	require.NoError(t, err)
+	require.Equal(t, map[string]any{"deploy_env": "staging"}, list.Pipelines[1].Inputs)
+	require.Equal(t, "alice", list.Pipelines[1].TriggeredBy)
+}
+
+func Test_PipelineService_Run_IncludeOfOtherRepository(t *testing.T) {
+	resolverMock := NewResolverMock()
+	anonymousMock := NewResolverMock()
+	p := NewPipelineService(NewStorageMock(), resolverMock, config.CI{ConfigPath: "ci.yaml", TrustedRepositories: []string{"templates"}})
+	p.Anonymous = anonymousMock
+
+	include := `inputs:
+  version:
+    type: string
+    required: true
+jobs: {}
+`
+	resolverMock.AddFile("repo", "commit", "ci.yaml", "include:\n  - repository: templates\n    ref: main\n    file: inputs.yaml\njobs:\n  deploy:\n    steps:\n      - run: make deploy\n")
+	resolverMock.AddFile("templates", "main", "inputs.yaml", include)
+	resolverMock.AddFile("repo", "private", "ci.yaml", "include:\n  - repository: private\n    ref: main\n    file: inputs.yaml\njobs:\n  deploy:\n    steps:\n      - run: make deploy\n")
+	resolverMock.AddFile("private", "main", "inputs.yaml", include)
+
+	// trusted repository is read with credentials
+	_, err := p.Run(&models.RunPipelineRequest{RepositoryUrl: "repo", Branch: "branch", Commit: "commit"})
+	require.ErrorIs(t, err, ErrInvalidInputs)
+
+	// other repository is read anonymously, so its private files aren't found
+	_, err = p.Run(&models.RunPipelineRequest{RepositoryUrl: "repo", Branch: "branch", Commit: "private"})
+	require.ErrorIs(t, err, ErrInvalidConfig)
+
+	anonymousMock.AddFile("private", "main", "inputs.yaml", include)
+	_, err = p.Run(&models.RunPipelineRequest{RepositoryUrl: "repo", Branch: "branch", Commit: "private"})
+	require.ErrorIs(t, err, ErrInvalidInputs)
+}
+
+func Test_PipelineService_Run_RequiredInputs(t *testing.T) {
+	storageMock := NewStorageMock()
+	resolverMock := NewResolverMock()
+	p := NewPipelineService(storageMock, resolverMock, config.CI{ConfigPath: "ci.yaml"})
+
+	resolverMock.AddFile("repo", "commit", "ci.yaml", `inputs:
+  version:
+    type: string
+    required: true
+  deploy_env:
+    type: string
+    default: staging
+jobs:
+  deploy:
+    steps:
+      - run: make deploy
+`)
+
+	requestDto := models.RunPipelineRequest{RepositoryUrl: "repo", Branch: "branch", Commit: "commit"}
+
+	// required input is checked also when no inputs are given
+	resp, err := p.Run(&requestDto)
+	require.ErrorIs(t, err, ErrInvalidInputs)
+	require.Nil(t, resp)
+	require.Empty(t, storageMock.pipelines)
+
+	requestDto.Inputs = map[string]any{"version": "1.2.0"}
+	resp, err = p.Run(&requestDto)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"version": "1.2.0"}`, storageMock.pipelines[resp.PipelineId].Inputs)
+
+	// config which can't be expanded or parsed is reported instead of being skipped
+	resolverMock.AddFile("repo", "broken", "ci.yaml", "include: [ci/missing.yaml]\njobs: {}\n")
+	resolverMock.AddFile("repo", "invalid", "ci.yaml", "jobs:\n  deploy:\n    steps: []\n    unknown: true\n")
+	for _, commit := range []string{"broken", "invalid"} {
+		_, err = p.Run(&models.RunPipelineRequest{RepositoryUrl: "repo", Branch: "branch", Commit: commit, Inputs: map[string]any{"version": "1.2.0"}})
+		require.ErrorIs(t, err, ErrInvalidConfig, commit)
+	}
+}
+
+func Test_PipelineService_Run_ResolvesBranchHead(t *testing.T) {
+	s := NewSuite()
+
+	requestDto := models.RunPipelineRequest{
+		RepositoryUrl: "repo",
+		Branch:        "branch",
+	}
+
+	resp, err := s.pipelineService.Run(&requestDto)
+	require.NoError(t, err)
+	require.Equal(t, resp.PipelineId, int64(1))
+	require.Equal(t, resp.Commit, "3f1c2a9d8e7b6a5c4d3e2f1a0b9c8d7e6f5a4b3c")
+
+	// same branch tip is deduplicated by resolved commit
+	resp, err = s.pipelineService.Run(&requestDto)
+	require.ErrorIs(t, err, ErrAlreadyExists)
+	require.Equal(t, resp.PipelineId, int64(1))
+
+	requestDto.Branch = "unknown"
+	resp, err = s.pipelineService.Run(&requestDto)
+	require.ErrorIs(t, err, ErrRefNotFound)
+	require.Nil(t, resp)
+
+	p := NewPipelineService(NewStorageMock(), NewErrorResolverMock(), config.CI{ConfigPath: "ci.yaml"})
+	resp, err = p.Run(&requestDto)
+	require.Error(t, err)
+	require.Nil(t, resp)
+}
+
+func Test_PipelineService_Run_Checkout(t *testing.T) {
+	storageMock := NewStorageMock()
+	p := NewPipelineService(storageMock, NewResolverMock(), config.CI{ConfigPath: "ci.yaml"})
+
+	depth := 1
+	requestDto := models.RunPipelineRequest{
+		RepositoryUrl: "repo",
+		Branch:        "branch",
+		Commit:        "commit",
+		Checkout:      &vcs.CheckoutOptions{Depth: &depth, Submodules: vcs.SUBMODULES_RECURSIVE},
+	}
+
+	resp, err := p.Run(&requestDto)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"depth": 1, "submodules": "recursive"}`, storageMock.pipelines[resp.PipelineId].Checkout)
+
+	depth = -1
+	resp, err = p.Run(&requestDto)
+	require.ErrorIs(t, err, ErrInvalidCheckout)
+	require.Nil(t, resp)
+}
+
+func Test_PipelineService_Run_Refs(t *testing.T) {
+	s := NewSuite()
+
+	resp, err := s.pipelineService.Run(&models.RunPipelineRequest{RepositoryUrl: "repo", Branch: "branch"})
+	require.NoError(t, err)
+	require.Equal(t, resp.Commit, "3f1c2a9d8e7b6a5c4d3e2f1a0b9c8d7e6f5a4b3c")
+
+	resp, err = s.pipelineService.Run(&models.RunPipelineRequest{RepositoryUrl: "repo", Ref: "v1.0.0", RefType: vcs.REF_TYPE_TAG})
+	require.NoError(t, err)
+	require.Equal(t, resp.Commit, "9a8b7c6d5e4f3a2b1c0d9e8f7a6b5c4d3e2f1a0b")
+
+	resp, err = s.pipelineService.Run(&models.RunPipelineRequest{RepositoryUrl: "repo", Ref: "refs/pull/42/head"})
+	require.NoError(t, err)
+	require.Equal(t, resp.Commit, "0a1b2c3d4e5f6a7b8c9d0e1f2a3b4c5d6e7f8a9b")
+
+	resp, err = s.pipelineService.Run(&models.RunPipelineRequest{RepositoryUrl: "repo", Ref: "9a8b7c6d5e4f3a2b1c0d9e8f7a6b5c4d3e2f1a0b", RefType: vcs.REF_TYPE_COMMIT})
+	require.NoError(t, err)
+	require.Equal(t, resp.Commit, "9a8b7c6d5e4f3a2b1c0d9e8f7a6b5c4d3e2f1a0b")
+
+	resp, err = s.pipelineService.Run(&models.RunPipelineRequest{RepositoryUrl: "repo", Ref: "v1.0.0", RefType: "release"})
+	require.ErrorIs(t, err, ErrInvalidRef)
+	require.Nil(t, resp)
+
+	list, err := s.pipelineService.List(&models.ListPipelinesRequest{RefType: vcs.REF_TYPE_TAG})
+	require.NoError(t, err)
+	require.Len(t, list.Pipelines, 1)
+	require.Equal(t, list.Pipelines[0].Ref, "v1.0.0")
+
+	list, err = s.pipelineService.List(&models.ListPipelinesRequest{Limit: 2})
+	require.NoError(t, err)
+	require.Len(t, list.Pipelines, 2)
+	require.Equal(t, list.Pipelines[0].RefType, vcs.REF_TYPE_COMMIT)
+}
+
+func Test_PipelineService_Diagnostics(t *testing.T) {
+	storageMock := NewStorageMock()
+	p := NewPipelineService(storageMock, NewResolverMock(), config.CI{ConfigPath: "ci.yaml"})
+
+	lintResponse := p.Lint([]byte("jobs:\n  build:\n    steps:\n      - name: build\n"))
+	require.False(t, lintResponse.Valid)
+	require.Len(t, lintResponse.Diagnostics, 1)
+
+	runResponse, err := p.Run(&models.RunPipelineRequest{RepositoryUrl: "repo", Branch: "branch", Commit: "commit"})
+	require.NoError(t, err)
+
+	diagnostics, err := p.GetDiagnostics(runResponse.PipelineId)
+	require.NoError(t, err)
+	require.True(t, diagnostics.Valid)
+	require.Empty(t, diagnostics.Diagnostics)
+
+	storageMock.pipelines[runResponse.PipelineId].Diagnostics = `[{"line":4,"column":9,"severity":"error","message":"step 1 of job \"build\" has no run"}]`
+	diagnostics, err = p.GetDiagnostics(runResponse.PipelineId)
+	require.NoError(t, err)
+	require.False(t, diagnostics.Valid)
+	require.Equal(t, 4, diagnostics.Diagnostics[0].Line)
+
+	_, err = p.GetDiagnostics(-1)
+	require.ErrorIs(t, err, ErrNotFound)
+
+	_, err = NewPipelineService(NewErrorStorageMock(), NewResolverMock(), config.CI{ConfigPath: "ci.yaml"}).GetDiagnostics(1)
+	require.Error(t, err)
+}
+
+func Test_PipelineService_Config(t *testing.T) {
+	storageMock := NewStorageMock()
+	p := NewPipelineService(storageMock, NewResolverMock(), config.CI{ConfigPath: "ci.yaml"})
+
+	runResponse, err := p.Run(&models.RunPipelineRequest{RepositoryUrl: "repo", Branch: "branch", Commit: "commit"})
+	require.NoError(t, err)
+
+	_, err = p.GetConfig(runResponse.PipelineId)
+	require.ErrorIs(t, err, ErrConfigNotRead)
+
+	storageMock.pipelines[runResponse.PipelineId].ConfigFile = "ci.yaml"
+	err = storageMock.UpdatePipelineConfig(runResponse.PipelineId, "jobs:\n  build:\n    steps:\n      - run: make\n")
+	require.NoError(t, err)
+
+	pipelineConfig, err := p.GetConfig(runResponse.PipelineId)
+	require.NoError(t, err)
+	require.Equal(t, "ci.yaml", pipelineConfig.ConfigFile)
+	require.Contains(t, pipelineConfig.Config, "run: make")
+
+	_, err = p.GetConfig(-1)
+	require.ErrorIs(t, err, ErrNotFound)
+
+	_, err = NewPipelineService(NewErrorStorageMock(), NewResolverMock(), config.CI{ConfigPath: "ci.yaml"}).GetConfig(1)
+	require.Error(t, err)
+}
+
+func Test_PipelineService_Downstream(t *testing.T) {
+	storageMock := NewStorageMock()
+	p := NewPipelineService(storageMock, NewResolverMock(), config.CI{ConfigPath: "ci.yaml"})
+
+	runResponse, err := p.Run(&models.RunPipelineRequest{RepositoryUrl: "library", Branch: "branch", Commit: "commit", TriggeredBy: "alice"})
+	require.NoError(t, err)
+	parentId := runResponse.PipelineId
+
+	downstream := storage.PipelinesTable{
+		Repository:       "service",
+		Branch:           "main",
+		Ref:              "main",
+		RefType:          "branch",
+		Commit:           "abc",
+		TriggeredBy:      "alice",
+		ParentPipelineId: parentId,
+		ParentJob:        "deploy",
+	}
+	childId, err := storageMock.CreateDownstreamPipeline(downstream)
+	require.NoError(t, err)
+
+	// downstream pipeline of job is created once
+	again, err := storageMock.CreateDownstreamPipeline(downstream)
+	require.NoError(t, err)
+	require.Equal(t, childId, again)
+
+	parent, err := p.Get(parentId)
+	require.NoError(t, err)
+	require.Equal(t, parentId, parent.PipelineId)
+	require.Len(t, parent.Downstream, 1)
+	require.Equal(t, childId, parent.Downstream[0].PipelineId)
+	require.Equal(t, "deploy", parent.Downstream[0].Job)
+	require.Equal(t, "service", parent.Downstream[0].RepositoryUrl)
+
+	child, err := p.Get(childId)
+	require.NoError(t, err)
+	require.Equal(t, parentId, child.ParentPipelineId)
+	require.Equal(t, "deploy", child.ParentJob)
+	require.Equal(t, storage.TRIGGER_UPSTREAM, child.Trigger)
+	require.Empty(t, child.Downstream)
+
+	_, err = p.Get(-1)
+	require.ErrorIs(t, err, ErrNotFound)
+
+	_, err = NewPipelineService(NewErrorStorageMock(), NewResolverMock(), config.CI{ConfigPath: "ci.yaml"}).Get(1)
+	require.Error(t, err)
+}
+
+func Test_PipelineService_Priority(t *testing.T) {
+	storageMock := NewStorageMock()
+	p := NewPipelineService(storageMock, NewResolverMock(), config.CI{ConfigPath: "ci.yaml"})
+
+	scheduled, err := p.Run(&models.RunPipelineRequest{RepositoryUrl: "repo", Branch: "main", Commit: "a", Trigger: storage.TRIGGER_SCHEDULE})
+	require.NoError(t, err)
+	require.Equal(t, storage.PRIORITY_LOW, storageMock.pipelines[scheduled.PipelineId].Priority)
+
+	pushed, err := p.Run(&models.RunPipelineRequest{RepositoryUrl: "repo", Branch: "main", Commit: "b", Trigger: storage.TRIGGER_WEBHOOK})
+	require.NoError(t, err)
+	require.Equal(t, storage.PRIORITY_NORMAL, storageMock.pipelines[pushed.PipelineId].Priority)
+
+	urgent := 50
+	hotfix, err := p.Run(&models.RunPipelineRequest{RepositoryUrl: "repo", Branch: "hotfix", Commit: "c", Priority: &urgent})
+	require.NoError(t, err)
+	require.Equal(t, urgent, storageMock.pipelines[hotfix.PipelineId].Priority)
+
+	for _, priority := range []int{MIN_PRIORITY - 1, MAX_PRIORITY + 1} {
+		_, err = p.Run(&models.RunPipelineRequest{RepositoryUrl: "repo", Branch: "main", Commit: "d", Priority: &priority})
+		require.ErrorIs(t, err, ErrInvalidPriority)
+	}
+
+	// rerun keeps priority of original pipeline
+	storageMock.pipelines[hotfix.PipelineId].Status = storage.PIPELINE_STATUS_FAILED
+	rerun, err := p.Rerun(hotfix.PipelineId, false, "")
+	require.NoError(t, err)
+	require.Equal(t, urgent, storageMock.pipelines[rerun.PipelineId].Priority)
+}
+
+func Test_PipelineService_Supersede(t *testing.T) {
+	storageMock := NewStorageMock()
+	p := NewPipelineService(storageMock, NewResolverMock(), config.CI{ConfigPath: "ci.yaml", ProtectedBranches: []string{"main", "release/*"}})
+
+	run := func(branch, commit string) *models.RunPipelineResponse {
+		response, err := p.Run(&models.RunPipelineRequest{RepositoryUrl: "repo", Branch: branch, Commit: commit})
+		require.NoError(t, err)
+		return response
+	}
+
+	// without policy every commit is built
+	first := run("feature", "a")
+	second := run("feature", "b")
+	require.Empty(t, second.Superseded)
+	require.Equal(t, storage.PIPELINE_STATUS_WAITING, storageMock.pipelines[first.PipelineId].Status)
+
+	require.NoError(t, storageMock.SaveRepositorySettings(storage.RepositorySettingsTable{Repository: "repo", AutoCancel: true}))
+
+	storageMock.pipelines[first.PipelineId].Status = storage.PIPELINE_STATUS_RUNNING
+	other := run("other", "c")
+	third := run("feature", "d")
+	require.Equal(t, []int64{second.PipelineId}, third.Superseded)
+	require.Equal(t, storage.PIPELINE_STATUS_SUPERSEDED, storageMock.pipelines[second.PipelineId].Status)
+	require.Equal(t, storage.PIPELINE_STATUS_WAITING, storageMock.pipelines[other.PipelineId].Status)
+
+	// running pipeline is canceled only when repository asks for it
+	require.False(t, storageMock.canceled[first.PipelineId])
+	require.NoError(t, storageMock.SaveRepositorySettings(storage.RepositorySettingsTable{Repository: "repo", AutoCancel: true, AutoCancelRunning: true}))
+	fourth := run("feature", "e")
+	require.Equal(t, []int64{third.PipelineId}, fourth.Superseded)
+	require.True(t, storageMock.canceled[first.PipelineId])
+
+	// pipelines of protected branches are never superseded
+	for _, branch := range []string{"main", "release/1.0"} {
+		older := run(branch, "f")
+		newer := run(branch, "g")
+		require.Empty(t, newer.Superseded, branch)
+		require.Equal(t, storage.PIPELINE_STATUS_WAITING, storageMock.pipelines[older.PipelineId].Status, branch)
+	}
+}
+
+func Test_PipelineService_Queue(t *testing.T) {
+	storageMock := NewStorageMock()
+	p := NewPipelineService(storageMock, NewResolverMock(), config.CI{ConfigPath: "ci.yaml"})
+
+	queue, err := p.Queue()
+	require.NoError(t, err)
+	require.Empty(t, queue.Running)
+	require.Empty(t, queue.Waiting)
+
+	running, err := p.Run(&models.RunPipelineRequest{RepositoryUrl: "repo", Branch: "main", Commit: "a"})
+	require.NoError(t, err)
+	storageMock.pipelines[running.PipelineId].Status = storage.PIPELINE_STATUS_RUNNING
+
+	scheduled, err := p.Run(&models.RunPipelineRequest{RepositoryUrl: "repo", Branch: "main", Commit: "b", Trigger: storage.TRIGGER_SCHEDULE})
+	require.NoError(t, err)
+	pushed, err := p.Run(&models.RunPipelineRequest{RepositoryUrl: "other", Branch: "main", Commit: "c"})
+	require.NoError(t, err)
+
+	queue, err = p.Queue()
+	require.NoError(t, err)
+	require.Len(t, queue.Running, 1)
+	require.Equal(t, running.PipelineId, queue.Running[0].PipelineId)
+	require.NotNil(t, queue.Running[0].StartedAt)
+
+	// scheduled pipeline of lower priority waits for the pushed one
+	require.Len(t, queue.Waiting, 2)
+	require.Equal(t, pushed.PipelineId, queue.Waiting[0].PipelineId)
+	require.Equal(t, 1, queue.Waiting[0].Position)
+	require.Equal(t, scheduled.PipelineId, queue.Waiting[1].PipelineId)
+	require.Equal(t, 2, queue.Waiting[1].Position)
+
+	require.NotNil(t, queue.Waiting[0].EstimatedStartAt)
+	require.NotNil(t, queue.Waiting[1].EstimatedStartAt)
+	require.True(t, queue.Waiting[1].EstimatedStartAt.After(*queue.Waiting[0].EstimatedStartAt))
+
+	_, err = NewPipelineService(NewErrorStorageMock(), NewResolverMock(), config.CI{ConfigPath: "ci.yaml"}).Queue()
+	require.Error(t, err)
+}
+
+func Test_PipelineService_Approvals(t *testing.T) {
+	storageMock := NewStorageMock()
+	p := NewPipelineService(storageMock, NewResolverMock(), config.CI{ConfigPath: "ci.yaml"})
+
+	runResponse, err := p.Run(&models.RunPipelineRequest{RepositoryUrl: "repo", Branch: "branch", Commit: "commit"})
+	require.NoError(t, err)
+	pipelineId := runResponse.PipelineId
+
+	err = p.Approve(pipelineId, "deploy", &models.ApprovalRequest{User: "alice"})
+	require.ErrorIs(t, err, ErrApprovalNotFound)
+
+	status, err := storageMock.RequestApproval(pipelineId, "deploy", "pipeline-1-workspace")
+	require.NoError(t, err)
+	require.Equal(t, storage.APPROVAL_STATUS_PENDING, status)
+	require.Equal(t, storage.PIPELINE_STATUS_WAITING_FOR_APPROVAL, storageMock.pipelines[pipelineId].Status)
+
+	err = p.Approve(pipelineId, "deploy", &models.ApprovalRequest{})
+	require.ErrorIs(t, err, ErrInvalidApproval)
+
+	err = p.Approve(pipelineId, "deploy", &models.ApprovalRequest{User: "alice"})
+	require.NoError(t, err)
+	require.Equal(t, storage.PIPELINE_STATUS_WAITING, storageMock.pipelines[pipelineId].Status)
+
+	err = p.Reject(pipelineId, "deploy", &models.ApprovalRequest{User: "bob"})
+	require.ErrorIs(t, err, ErrApprovalDecided)
+
+	// decided approval doesn't pause pipeline again
+	status, err = storageMock.RequestApproval(pipelineId, "deploy", "pipeline-1-workspace")
+	require.NoError(t, err)
+	require.Equal(t, storage.APPROVAL_STATUS_APPROVED, status)
+
+	approvals, err := p.ListApprovals(pipelineId)
+	require.NoError(t, err)
+	require.Len(t, approvals.Approvals, 1)
+	require.Equal(t, "alice", approvals.Approvals[0].DecidedBy)
+	require.NotNil(t, approvals.Approvals[0].DecidedAt)
+
+	_, err = p.ListApprovals(-1)
+	require.ErrorIs(t, err, ErrNotFound)
+
+	errorService := NewPipelineService(NewErrorStorageMock(), NewResolverMock(), config.CI{ConfigPath: "ci.yaml"})
+	require.Error(t, errorService.Reject(1, "deploy", &models.ApprovalRequest{User: "alice"}))
+	_, err = errorService.ListApprovals(1)
+	require.Error(t, err)
+}
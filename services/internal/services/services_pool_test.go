@@ -0,0 +1,52 @@
+package services
+
+import (
+	"pipecraft/internal/models"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_PoolService_HappyPath(t *testing.T) {
+	pool := NewPoolMock(5)
+	pool.busy = 3
+	s := NewPoolService(pool)
+
+	state := s.Get()
+	require.Equal(t, 5, state.Size)
+	require.Equal(t, 3, state.Busy)
+	require.False(t, state.Paused)
+
+	size, paused := 2, true
+	state, err := s.Update(&models.PoolRequest{Size: &size, Paused: &paused})
+	require.NoError(t, err)
+	require.Equal(t, 2, state.Size)
+	require.Equal(t, 3, state.Busy)
+	require.True(t, state.Paused)
+
+	// fields which are not given are kept
+	paused = false
+	state, err = s.Update(&models.PoolRequest{Paused: &paused})
+	require.NoError(t, err)
+	require.Equal(t, 2, state.Size)
+	require.False(t, state.Paused)
+}
+
+func Test_PoolService_InvalidSize(t *testing.T) {
+	s := NewPoolService(NewPoolMock(5))
+
+	for _, size := range []int{0, -1, MAX_POOL_SIZE + 1} {
+		_, err := s.Update(&models.PoolRequest{Size: &size})
+		require.ErrorIs(t, err, ErrInvalidPoolSize, size)
+	}
+	require.Equal(t, 5, s.Get().Size)
+}
+
+func Test_PoolService_Error(t *testing.T) {
+	s := NewPoolService(NewErrorPoolMock())
+
+	size := 3
+	_, err := s.Update(&models.PoolRequest{Size: &size})
+	require.Error(t, err)
+	require.NotErrorIs(t, err, ErrInvalidPoolSize)
+}
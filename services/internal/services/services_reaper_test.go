@@ -0,0 +1,39 @@
+package services
+
+import (
+	"context"
+	"pipecraft/internal/models"
+	"pipecraft/internal/worker"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_ReaperService_HappyPath(t *testing.T) {
+	s := NewReaperService(NewReaperMock(
+		worker.Orphan{Kind: worker.ORPHAN_KIND_CONTAINER, Name: "pipeline-1", PipelineId: 1, Reason: worker.ORPHAN_REASON_FINISHED},
+		worker.Orphan{Kind: worker.ORPHAN_KIND_VOLUME, Name: "pipeline-2-workspace", PipelineId: 2, Reason: worker.ORPHAN_REASON_UNKNOWN},
+	))
+
+	response, err := s.Orphans(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []models.OrphanResponse{
+		{Kind: "container", Name: "pipeline-1", PipelineId: 1, Reason: "finished"},
+		{Kind: "volume", Name: "pipeline-2-workspace", PipelineId: 2, Reason: "unknown"},
+	}, response.Orphans)
+
+	// no orphans are an empty list, not null
+	response, err = NewReaperService(NewReaperMock()).Orphans(context.Background())
+	require.NoError(t, err)
+	require.NotNil(t, response.Orphans)
+	require.Empty(t, response.Orphans)
+}
+
+func Test_ReaperService_Error(t *testing.T) {
+	_, err := NewReaperService(nil).Orphans(context.Background())
+	require.ErrorIs(t, err, ErrReaperDisabled)
+
+	_, err = NewReaperService(NewErrorReaperMock()).Orphans(context.Background())
+	require.Error(t, err)
+	require.NotErrorIs(t, err, ErrReaperDisabled)
+}
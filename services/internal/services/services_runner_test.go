@@ -0,0 +1,317 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"pipecraft/internal/config"
+	"pipecraft/internal/models"
+	"pipecraft/internal/storage"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newRunnerService(s *StorageMock) *RunnerService {
+	service := NewRunnerService(s, s, nil, "secret", config.CI{ConfigPath: "ci.yaml"}, config.Runners{HeartbeatTimeout: 60, PollTimeout: 1, AckTimeout: 60}, []string{})
+	service.PollInterval = 10 * time.Millisecond
+	return service
+}
+
+func Test_RunnerService_Register(t *testing.T) {
+	s := newRunnerService(NewStorageMock())
+
+	runner, err := s.Register(&models.RegisterRunnerRequest{Name: "runner-1", RegistrationToken: "secret"})
+	require.NoError(t, err)
+	require.NotEmpty(t, runner.Token)
+	require.Equal(t, 20, runner.HeartbeatInterval)
+	require.Equal(t, "ci.yaml", runner.CI.ConfigPath)
+
+	runnerId, err := s.Authenticate(runner.Token)
+	require.NoError(t, err)
+	require.Equal(t, runner.RunnerId, runnerId)
+
+	_, err = s.Authenticate("unknown")
+	require.ErrorIs(t, err, ErrInvalidRunnerToken)
+
+	_, err = s.Register(&models.RegisterRunnerRequest{Name: "runner-2", RegistrationToken: "wrong"})
+	require.ErrorIs(t, err, ErrInvalidRunnerToken)
+
+	_, err = s.Register(&models.RegisterRunnerRequest{Name: " ", RegistrationToken: "secret"})
+	require.ErrorIs(t, err, ErrInvalidRunner)
+
+	// runners can't register without registration token of server
+	s.RegistrationToken = ""
+	_, err = s.Register(&models.RegisterRunnerRequest{Name: "runner-3"})
+	require.ErrorIs(t, err, ErrRunnersDisabled)
+	_, err = s.Authenticate(runner.Token)
+	require.ErrorIs(t, err, ErrRunnersDisabled)
+}
+
+func Test_RunnerService_RequestPipeline(t *testing.T) {
+	storageMock := NewStorageMock()
+	s := newRunnerService(storageMock)
+
+	pipelineId, err := storageMock.CreatePipeline(storage.PipelinesTable{Repository: "ysayonnar/pipecraft", Ref: "main"}, false)
+	require.NoError(t, err)
+
+	first, err := storageMock.CreateRunner("runner-1", "first", nil)
+	require.NoError(t, err)
+	second, err := storageMock.CreateRunner("runner-2", "second", nil)
+	require.NoError(t, err)
+
+	response, err := s.RequestPipeline(context.Background(), first)
+	require.NoError(t, err)
+	require.Equal(t, pipelineId, response.PipelineId)
+
+	_, err = s.RequestPipeline(context.Background(), second)
+	require.ErrorIs(t, err, ErrNoPipeline)
+
+	// paused pipeline is resumed only by runner which keeps its workspace
+	_, err = storageMock.RequestApproval(pipelineId, "deploy", "pipeline-1-workspace")
+	require.NoError(t, err)
+	storageMock.pipelines[pipelineId].Status = storage.PIPELINE_STATUS_WAITING
+
+	_, err = s.RequestPipeline(context.Background(), second)
+	require.ErrorIs(t, err, ErrNoPipeline)
+
+	response, err = s.RequestPipeline(context.Background(), first)
+	require.NoError(t, err)
+	require.Equal(t, pipelineId, response.PipelineId)
+}
+
+func Test_RunnerService_RunnerLabels(t *testing.T) {
+	storageMock := NewStorageMock()
+	s := newRunnerService(storageMock)
+
+	registered, err := s.Register(&models.RegisterRunnerRequest{Name: "runner-1", RegistrationToken: "secret", Labels: []string{"linux"}})
+	require.NoError(t, err)
+
+	_, err = s.Register(&models.RegisterRunnerRequest{Name: "runner-2", RegistrationToken: "secret", Labels: []string{"linux", ""}})
+	require.ErrorIs(t, err, ErrInvalidRunner)
+
+	pipelineId, err := storageMock.CreatePipeline(storage.PipelinesTable{Repository: "ysayonnar/pipecraft", Ref: "main"}, false)
+	require.NoError(t, err)
+
+	_, err = s.RequestPipeline(context.Background(), registered.RunnerId)
+	require.NoError(t, err)
+	handedOff, err := storageMock.HandOffPipeline(pipelineId, []string{"large", "linux"})
+	require.NoError(t, err)
+	require.True(t, handedOff)
+
+	// no online runner has every label pipeline runs on
+	require.NoError(t, s.UpdateWaitingForRunner())
+	require.Equal(t, storage.PIPELINE_STATUS_WAITING_FOR_RUNNER, storageMock.pipelines[pipelineId].Status)
+
+	_, err = s.RequestPipeline(context.Background(), registered.RunnerId)
+	require.ErrorIs(t, err, ErrNoPipeline)
+
+	large, err := storageMock.CreateRunner("runner-3", "large", []string{"gpu", "large", "linux"})
+	require.NoError(t, err)
+
+	require.NoError(t, s.UpdateWaitingForRunner())
+	require.Equal(t, storage.PIPELINE_STATUS_WAITING, storageMock.pipelines[pipelineId].Status)
+
+	// runner which went offline doesn't count
+	storageMock.runners[large].LastHeartbeatAt = time.Now().Add(-2 * time.Minute)
+	require.NoError(t, s.UpdateWaitingForRunner())
+	require.Equal(t, storage.PIPELINE_STATUS_WAITING_FOR_RUNNER, storageMock.pipelines[pipelineId].Status)
+
+	response, err := s.RequestPipeline(context.Background(), large)
+	require.NoError(t, err)
+	require.Equal(t, pipelineId, response.PipelineId)
+}
+
+func Test_RunnerService_Call(t *testing.T) {
+	storageMock := NewStorageMock()
+	s := newRunnerService(storageMock)
+
+	pipelineId, err := storageMock.CreatePipeline(storage.PipelinesTable{Repository: "ysayonnar/pipecraft", Ref: "main"}, false)
+	require.NoError(t, err)
+	runnerId, err := storageMock.CreateRunner("runner-1", "token", nil)
+	require.NoError(t, err)
+
+	call := &models.RunnerCallRequest{Method: "UpdatePipelineStatus", Params: []byte(`{"id":1,"status":"completed"}`)}
+
+	_, err = s.Call(runnerId, pipelineId, call)
+	require.ErrorIs(t, err, ErrPipelineNotAssigned)
+
+	_, err = s.RequestPipeline(context.Background(), runnerId)
+	require.NoError(t, err)
+
+	response, err := s.Call(runnerId, pipelineId, call)
+	require.NoError(t, err)
+	require.Empty(t, response.Error)
+	require.Equal(t, storage.PIPELINE_STATUS_COMPLETED, storageMock.pipelines[pipelineId].Status)
+
+	// error of storage is returned in response with its code
+	response, err = s.Call(runnerId, pipelineId, &models.RunnerCallRequest{Method: "GetDownstreamPipeline", Params: []byte(`{"parent_pipeline_id":1,"parent_job":"deploy"}`)})
+	require.NoError(t, err)
+	require.Equal(t, "not_found", response.ErrorCode)
+
+	_, err = s.Call(runnerId, pipelineId, &models.RunnerCallRequest{Method: "DropDatabase"})
+	require.ErrorIs(t, err, ErrInvalidRunnerCall)
+
+	_, err = s.Call(runnerId, 42, call)
+	require.ErrorIs(t, err, ErrNotFound)
+}
+
+func Test_RunnerService_CallOfOtherPipeline(t *testing.T) {
+	storageMock := NewStorageMock()
+	credentials := NewCredentialsService(storageMock, newCipher(t))
+	s := NewRunnerService(storageMock, storageMock, credentials, "secret", config.CI{}, config.Runners{HeartbeatTimeout: 60, PollTimeout: 1, AckTimeout: 60}, []string{})
+	s.PollInterval = 10 * time.Millisecond
+
+	for _, repository := range []string{"https://github.com/ysayonnar/pipecraft.git", "https://github.com/ysayonnar/other.git"} {
+		err := credentials.Save(&models.RepositoryCredentialsRequest{RepositoryUrl: repository, Kind: "https", Username: "ysayonnar", Token: "token-of-" + repository})
+		require.NoError(t, err)
+		err = credentials.SaveRegistry(&models.RegistryCredentialsRequest{RepositoryUrl: repository, Registry: "ghcr.io", Username: "ysayonnar", Password: "password-of-" + repository})
+		require.NoError(t, err)
+	}
+
+	parentId, err := storageMock.CreatePipeline(storage.PipelinesTable{Repository: "https://github.com/ysayonnar/other.git", Ref: "main"}, false)
+	require.NoError(t, err)
+	otherId, err := storageMock.CreatePipeline(storage.PipelinesTable{Repository: "https://github.com/ysayonnar/other.git", Ref: "feature"}, false)
+	require.NoError(t, err)
+	pipelineId, err := storageMock.CreatePipeline(storage.PipelinesTable{Repository: "https://github.com/ysayonnar/pipecraft.git", Ref: "main", ParentPipelineId: parentId}, false)
+	require.NoError(t, err)
+	runnerId, err := storageMock.CreateRunner("runner-1", "token", nil)
+	require.NoError(t, err)
+	storageMock.pipelines[parentId].Status = storage.PIPELINE_STATUS_RUNNING
+	storageMock.pipelines[otherId].Status = storage.PIPELINE_STATUS_RUNNING
+
+	response, err := s.RequestPipeline(context.Background(), runnerId)
+	require.NoError(t, err)
+	require.Equal(t, pipelineId, response.PipelineId)
+
+	call := func(method, params string) (*models.RunnerCallResponse, error) {
+		return s.Call(runnerId, pipelineId, &models.RunnerCallRequest{Method: method, Params: []byte(params)})
+	}
+
+	// pipeline runner was given and pipelines which triggered it can be read
+	_, err = call("GetPipelineInfo", fmt.Sprintf(`{"id":%d}`, pipelineId))
+	require.NoError(t, err)
+	_, err = call("GetPipelineInfo", fmt.Sprintf(`{"id":%d}`, parentId))
+	require.NoError(t, err)
+
+	forbidden := [][2]string{
+		{"GetPipelineInfo", fmt.Sprintf(`{"id":%d}`, otherId)},
+		{"GetPipelineLogs", fmt.Sprintf(`{"id":%d}`, otherId)},
+		{"UpdatePipelineStatus", fmt.Sprintf(`{"id":%d,"status":"failed"}`, otherId)},
+		{"UpdatePipelineStatus", fmt.Sprintf(`{"id":%d,"status":"failed"}`, parentId)},
+		{"CreateLog", fmt.Sprintf(`{"PipelineId":%d,"Results":"forged"}`, otherId)},
+		{"StartLog", fmt.Sprintf(`{"PipelineId":%d,"Results":"forged"}`, otherId)},
+		{"AppendLog", fmt.Sprintf(`{"pipeline_id":%d,"log_id":1,"results":"forged"}`, otherId)},
+		{"RequeuePipeline", fmt.Sprintf(`{"pipeline_id":%d}`, otherId)},
+		{"WaitForDownstream", fmt.Sprintf(`{"pipeline_id":%d,"downstream_pipeline_id":%d}`, pipelineId, otherId)},
+		{"GetRepositorySettings", `{"repository":"https://github.com/ysayonnar/other.git"}`},
+		{"GetRepositoryCredentials", `{"repository":"https://github.com/ysayonnar/other.git"}`},
+		{"GetRegistryCredentials", `{"repository":"https://github.com/ysayonnar/other.git","registry":"ghcr.io"}`},
+	}
+	for _, forbiddenCall := range forbidden {
+		_, err := call(forbiddenCall[0], forbiddenCall[1])
+		require.ErrorIs(t, err, ErrPipelineNotAssigned, forbiddenCall)
+	}
+	require.Equal(t, storage.PIPELINE_STATUS_RUNNING, storageMock.pipelines[otherId].Status)
+	require.Equal(t, storage.PIPELINE_STATUS_RUNNING, storageMock.pipelines[parentId].Status)
+
+	// secrets are given only for repository of pipeline
+	callResponse, err := call("GetRegistryCredentials", `{"repository":"https://github.com/ysayonnar/pipecraft.git","registry":"ghcr.io"}`)
+	require.NoError(t, err)
+	require.Contains(t, string(callResponse.Result), "password-of-https://github.com/ysayonnar/pipecraft.git")
+
+	callResponse, err = call("GetRepositoryCredentials", `{"repository":"https://github.com/ysayonnar/pipecraft.git"}`)
+	require.NoError(t, err)
+	require.Contains(t, string(callResponse.Result), "token-of-https://github.com/ysayonnar/pipecraft.git")
+	require.NotContains(t, string(callResponse.Result), "https://github.com/ysayonnar/other.git")
+
+	// credentials of trusted repository are given for includes of config, its secrets aren't
+	s.CI.TrustedRepositories = []string{"https://github.com/ysayonnar/other.git"}
+	callResponse, err = call("GetRepositoryCredentials", `{"repository":"https://github.com/ysayonnar/other.git"}`)
+	require.NoError(t, err)
+	require.Contains(t, string(callResponse.Result), "token-of-https://github.com/ysayonnar/other.git")
+	_, err = call("GetRegistryCredentials", `{"repository":"https://github.com/ysayonnar/other.git","registry":"ghcr.io"}`)
+	require.ErrorIs(t, err, ErrPipelineNotAssigned)
+}
+
+func Test_RunnerService_RequeueLost(t *testing.T) {
+	storageMock := NewStorageMock()
+	s := newRunnerService(storageMock)
+
+	pipelineId, err := storageMock.CreatePipeline(storage.PipelinesTable{Repository: "ysayonnar/pipecraft", Ref: "main"}, false)
+	require.NoError(t, err)
+	runnerId, err := storageMock.CreateRunner("runner-1", "token", nil)
+	require.NoError(t, err)
+
+	_, err = s.RequestPipeline(context.Background(), runnerId)
+	require.NoError(t, err)
+
+	requeued, err := s.RequeueLost()
+	require.NoError(t, err)
+	require.Empty(t, requeued)
+
+	storageMock.runners[runnerId].LastHeartbeatAt = time.Now().Add(-2 * time.Minute)
+
+	requeued, err = s.RequeueLost()
+	require.NoError(t, err)
+	require.Equal(t, []int64{pipelineId}, requeued)
+	require.Equal(t, storage.PIPELINE_STATUS_WAITING, storageMock.pipelines[pipelineId].Status)
+	require.Zero(t, storageMock.pipelines[pipelineId].RunnerId)
+}
+
+// response which gave pipeline to runner may be lost, pipeline which runner doesn't acknowledge is requeued though
+// runner keeps sending heartbeats
+func Test_RunnerService_RequeueUnacknowledged(t *testing.T) {
+	storageMock := NewStorageMock()
+	s := newRunnerService(storageMock)
+	s.Runners.AckTimeout = 1
+
+	lostId, err := storageMock.CreatePipeline(storage.PipelinesTable{Repository: "ysayonnar/pipecraft", Ref: "main"}, false)
+	require.NoError(t, err)
+	acknowledgedId, err := storageMock.CreatePipeline(storage.PipelinesTable{Repository: "ysayonnar/pipecraft", Ref: "feature"}, false)
+	require.NoError(t, err)
+	runnerId, err := storageMock.CreateRunner("runner-1", "token", nil)
+	require.NoError(t, err)
+
+	for _, pipelineId := range []int64{lostId, acknowledgedId} {
+		response, err := s.RequestPipeline(context.Background(), runnerId)
+		require.NoError(t, err)
+		require.Equal(t, pipelineId, response.PipelineId)
+	}
+
+	// first call of runner acknowledges pipeline
+	_, err = s.Call(runnerId, acknowledgedId, &models.RunnerCallRequest{Method: "GetPipelineInfo", Params: []byte(fmt.Sprintf(`{"id":%d}`, acknowledgedId))})
+	require.NoError(t, err)
+
+	requeued, err := s.RequeueLost()
+	require.NoError(t, err)
+	require.Empty(t, requeued)
+
+	time.Sleep(1100 * time.Millisecond)
+	require.NoError(t, s.Heartbeat(runnerId))
+
+	requeued, err = s.RequeueLost()
+	require.NoError(t, err)
+	require.Equal(t, []int64{lostId}, requeued)
+	require.Equal(t, storage.PIPELINE_STATUS_WAITING, storageMock.pipelines[lostId].Status)
+	require.Equal(t, storage.PIPELINE_STATUS_RUNNING, storageMock.pipelines[acknowledgedId].Status)
+
+	_, err = s.Call(runnerId, lostId, &models.RunnerCallRequest{Method: "GetPipelineInfo", Params: []byte(fmt.Sprintf(`{"id":%d}`, lostId))})
+	require.ErrorIs(t, err, ErrPipelineNotAssigned)
+}
+
+func Test_RunnerService_StorageError(t *testing.T) {
+	s := NewRunnerService(NewErrorStorageMock(), NewStorageMock(), nil, "secret", config.CI{}, config.Runners{HeartbeatTimeout: 60, PollTimeout: 1, AckTimeout: 60}, []string{})
+
+	_, err := s.Register(&models.RegisterRunnerRequest{Name: "runner-1", RegistrationToken: "secret"})
+	require.Error(t, err)
+
+	_, err = s.Authenticate("token")
+	require.Error(t, err)
+	require.NotErrorIs(t, err, ErrInvalidRunnerToken)
+
+	_, err = s.RequeueLost()
+	require.Error(t, err)
+
+	require.Error(t, s.UpdateWaitingForRunner())
+}
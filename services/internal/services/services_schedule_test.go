@@ -0,0 +1,137 @@
+package services
+
+import (
+	"pipecraft/internal/config"
+	"pipecraft/internal/models"
+	"pipecraft/internal/storage"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_NextRun(t *testing.T) {
+	after := time.Date(2026, 3, 10, 23, 30, 0, 0, time.UTC)
+
+	next, err := NextRun("0 2 * * *", "UTC", after)
+	require.NoError(t, err)
+	require.Equal(t, time.Date(2026, 3, 11, 2, 0, 0, 0, time.UTC), next)
+
+	// 02:00 in Berlin is 01:00 UTC in winter
+	next, err = NextRun("0 2 * * *", "Europe/Berlin", after)
+	require.NoError(t, err)
+	require.Equal(t, time.Date(2026, 3, 11, 1, 0, 0, 0, time.UTC), next)
+
+	next, err = NextRun("@daily", "UTC", after)
+	require.NoError(t, err)
+	require.Equal(t, time.Date(2026, 3, 11, 0, 0, 0, 0, time.UTC), next)
+
+	_, err = NextRun("every night", "UTC", after)
+	require.ErrorIs(t, err, ErrInvalidSchedule)
+
+	_, err = NextRun("0 2 * * *", "Mars/Olympus", after)
+	require.ErrorIs(t, err, ErrInvalidSchedule)
+}
+
+func Test_ScheduleService_Crud(t *testing.T) {
+	s := NewScheduleService(NewStorageMock())
+
+	created, err := s.Create(&models.ScheduleRequest{RepositoryUrl: "repo", Branch: "main", CronExpression: "0 2 * * *"})
+	require.NoError(t, err)
+	require.Equal(t, DEFAULT_SCHEDULE_TIMEZONE, created.Timezone)
+	require.True(t, created.Enabled)
+	require.NotNil(t, created.NextRunAt)
+	require.True(t, created.NextRunAt.After(time.Now()))
+
+	disabled := false
+	updated, err := s.Update(created.ScheduleId, &models.ScheduleRequest{
+		RepositoryUrl:  "repo",
+		Branch:         "main",
+		CronExpression: "0 3 * * *",
+		Timezone:       "Europe/Berlin",
+		Enabled:        &disabled,
+	})
+	require.NoError(t, err)
+	require.False(t, updated.Enabled)
+	require.Nil(t, updated.NextRunAt)
+
+	schedule, err := s.Get(created.ScheduleId)
+	require.NoError(t, err)
+	require.Equal(t, "0 3 * * *", schedule.CronExpression)
+
+	list, err := s.List("repo")
+	require.NoError(t, err)
+	require.Len(t, list.Schedules, 1)
+
+	list, err = s.List("other")
+	require.NoError(t, err)
+	require.Empty(t, list.Schedules)
+
+	require.NoError(t, s.Delete(created.ScheduleId))
+	require.ErrorIs(t, s.Delete(created.ScheduleId), ErrScheduleNotFound)
+
+	_, err = s.Get(created.ScheduleId)
+	require.ErrorIs(t, err, ErrScheduleNotFound)
+
+	_, err = s.Update(created.ScheduleId, &models.ScheduleRequest{RepositoryUrl: "repo", Branch: "main", CronExpression: "@daily"})
+	require.ErrorIs(t, err, ErrScheduleNotFound)
+}
+
+func Test_ScheduleService_Invalid(t *testing.T) {
+	s := NewScheduleService(NewStorageMock())
+
+	for _, dto := range []*models.ScheduleRequest{
+		{Branch: "main", CronExpression: "@daily"},
+		{RepositoryUrl: "repo", CronExpression: "@daily"},
+		{RepositoryUrl: "repo", Branch: "refs/heads/main", CronExpression: "@daily"},
+		{RepositoryUrl: "repo", Branch: "main", CronExpression: "* * *"},
+		{RepositoryUrl: "repo", Branch: "main", CronExpression: "@daily", Timezone: "Nowhere"},
+	} {
+		_, err := s.Create(dto)
+		require.ErrorIs(t, err, ErrInvalidSchedule)
+	}
+
+	_, err := NewScheduleService(NewErrorStorageMock()).Create(&models.ScheduleRequest{RepositoryUrl: "repo", Branch: "main", CronExpression: "@daily"})
+	require.Error(t, err)
+}
+
+func Test_Scheduler_Tick(t *testing.T) {
+	storageMock := NewStorageMock()
+	pipelineService := NewPipelineService(storageMock, NewResolverMock(), config.CI{ConfigPath: "ci.yaml"})
+	scheduleService := NewScheduleService(storageMock)
+
+	created, err := scheduleService.Create(&models.ScheduleRequest{RepositoryUrl: "repo", Branch: "branch", CronExpression: "0 2 * * *"})
+	require.NoError(t, err)
+
+	// two replicas see the same due schedule, only one of them fires it
+	now := created.NextRunAt.Add(time.Minute)
+	due, err := storageMock.ListDueSchedules(now)
+	require.NoError(t, err)
+	require.Len(t, due, 1)
+
+	first := NewScheduler(storageMock, pipelineService)
+	first.Tick(now)
+	claimed, err := storageMock.ClaimScheduleRun(due[0].ScheduleId, *due[0].NextRunAt, now)
+	require.NoError(t, err)
+	require.False(t, claimed)
+	first.Tick(now)
+
+	pipelines, err := pipelineService.List(&models.ListPipelinesRequest{})
+	require.NoError(t, err)
+	require.Len(t, pipelines.Pipelines, 1)
+	require.Equal(t, storage.TRIGGER_SCHEDULE, pipelines.Pipelines[0].Trigger)
+
+	schedule, err := scheduleService.Get(created.ScheduleId)
+	require.NoError(t, err)
+	require.NotNil(t, schedule.LastRunAt)
+	require.Equal(t, created.NextRunAt.Add(24*time.Hour), *schedule.NextRunAt)
+
+	// nightly build runs again even when branch has no new commits
+	NewScheduler(storageMock, pipelineService).Tick(schedule.NextRunAt.Add(time.Minute))
+	pipelines, err = pipelineService.List(&models.ListPipelinesRequest{})
+	require.NoError(t, err)
+	require.Len(t, pipelines.Pipelines, 2)
+	require.Equal(t, 2, pipelines.Pipelines[0].Attempt)
+
+	NewScheduler(NewErrorStorageMock(), pipelineService).Tick(now)
+}
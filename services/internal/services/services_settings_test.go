@@ -0,0 +1,143 @@
+package services
+
+import (
+	"encoding/json"
+	"pipecraft/internal/config"
+	"pipecraft/internal/models"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// settingsRequest decodes request like handler does, settings left out of json are nil.
+func settingsRequest(t *testing.T, data string) *models.RepositorySettingsRequest {
+	var dto models.RepositorySettingsRequest
+	require.NoError(t, json.Unmarshal([]byte(data), &dto))
+	return &dto
+}
+
+func Test_SettingsService_HappyPath(t *testing.T) {
+	s := NewSettingsService(NewStorageMock(), config.CI{})
+
+	repository := "https://github.com/ysayonnar/pipecraft.git"
+
+	_, err := s.Get(repository)
+	require.ErrorIs(t, err, ErrSettingsNotFound)
+
+	err = s.Save(settingsRequest(t, `{"repository_url":"https://github.com/ysayonnar/pipecraft.git","ci_config_path":"build/pipeline.yaml"}`))
+	require.NoError(t, err)
+
+	settings, err := s.Get(repository)
+	require.NoError(t, err)
+	require.Equal(t, "build/pipeline.yaml", settings.CiConfigPath)
+
+	// empty path resets repository to defaults
+	err = s.Save(settingsRequest(t, `{"repository_url":"https://github.com/ysayonnar/pipecraft.git","ci_config_path":""}`))
+	require.NoError(t, err)
+
+	settings, err = s.Get(repository)
+	require.NoError(t, err)
+	require.Empty(t, settings.CiConfigPath)
+}
+
+func Test_SettingsService_InvalidPath(t *testing.T) {
+	s := NewSettingsService(NewStorageMock(), config.CI{})
+
+	for _, configPath := range []string{"/etc/passwd", "../ci.yaml", "ci/../../ci.yaml", ".", ".."} {
+		err := s.Save(&models.RepositorySettingsRequest{RepositoryUrl: "repo", CiConfigPath: &configPath})
+		require.ErrorIs(t, err, ErrInvalidConfigPath, configPath)
+	}
+
+	err := s.Save(settingsRequest(t, `{"ci_config_path":"ci.yaml"}`))
+	require.ErrorIs(t, err, ErrInvalidConfigPath)
+}
+
+func Test_SettingsService_MaxConcurrentPipelines(t *testing.T) {
+	s := NewSettingsService(NewStorageMock(), config.CI{})
+
+	err := s.Save(settingsRequest(t, `{"repository_url":"repo","max_concurrent_pipelines":2}`))
+	require.NoError(t, err)
+
+	settings, err := s.Get("repo")
+	require.NoError(t, err)
+	require.Equal(t, 2, settings.MaxConcurrentPipelines)
+
+	err = s.Save(settingsRequest(t, `{"repository_url":"repo","max_concurrent_pipelines":-1}`))
+	require.ErrorIs(t, err, ErrInvalidSettings)
+}
+
+func Test_SettingsService_AutoCancel(t *testing.T) {
+	s := NewSettingsService(NewStorageMock(), config.CI{})
+
+	err := s.Save(settingsRequest(t, `{"repository_url":"repo","auto_cancel":true,"auto_cancel_running":true}`))
+	require.NoError(t, err)
+
+	settings, err := s.Get("repo")
+	require.NoError(t, err)
+	require.True(t, settings.AutoCancel)
+	require.True(t, settings.AutoCancelRunning)
+
+	err = s.Save(settingsRequest(t, `{"repository_url":"other","auto_cancel_running":true}`))
+	require.ErrorIs(t, err, ErrInvalidSettings)
+
+	// running pipelines can't be canceled by auto cancel which is turned off
+	err = s.Save(settingsRequest(t, `{"repository_url":"repo","auto_cancel":false}`))
+	require.ErrorIs(t, err, ErrInvalidSettings)
+}
+
+// settings left out of request keep their saved values
+func Test_SettingsService_PartialUpdate(t *testing.T) {
+	s := NewSettingsService(NewStorageMock(), config.CI{})
+
+	err := s.Save(settingsRequest(t, `{"repository_url":"repo","ci_config_path":"deploy.yaml","auto_cancel":true,"auto_cancel_running":true}`))
+	require.NoError(t, err)
+
+	err = s.Save(settingsRequest(t, `{"repository_url":"repo","max_concurrent_pipelines":3}`))
+	require.NoError(t, err)
+
+	settings, err := s.Get("repo")
+	require.NoError(t, err)
+	require.Equal(t, "deploy.yaml", settings.CiConfigPath)
+	require.Equal(t, 3, settings.MaxConcurrentPipelines)
+	require.True(t, settings.AutoCancel)
+	require.True(t, settings.AutoCancelRunning)
+
+	err = s.Save(settingsRequest(t, `{"repository_url":"repo","auto_cancel_running":false}`))
+	require.NoError(t, err)
+
+	settings, err = s.Get("repo")
+	require.NoError(t, err)
+	require.Equal(t, "deploy.yaml", settings.CiConfigPath)
+	require.Equal(t, 3, settings.MaxConcurrentPipelines)
+	require.True(t, settings.AutoCancel)
+	require.False(t, settings.AutoCancelRunning)
+}
+
+// repository is privileged only by config of server, privileged in request is ignored
+func Test_SettingsService_Privileged(t *testing.T) {
+	s := NewSettingsService(NewStorageMock(), config.CI{PrivilegedRepositories: []string{"privileged"}})
+
+	for _, repository := range []string{"repo", "privileged"} {
+		err := s.Save(settingsRequest(t, `{"repository_url":"`+repository+`","privileged":true}`))
+		require.NoError(t, err)
+	}
+
+	settings, err := s.Get("repo")
+	require.NoError(t, err)
+	require.False(t, settings.Privileged)
+
+	settings, err = s.Get("privileged")
+	require.NoError(t, err)
+	require.True(t, settings.Privileged)
+}
+
+func Test_SettingsService_Error(t *testing.T) {
+	s := NewSettingsService(NewErrorStorageMock(), config.CI{})
+
+	err := s.Save(settingsRequest(t, `{"repository_url":"repo","ci_config_path":"ci.yaml"}`))
+	require.Error(t, err)
+
+	_, err = s.Get("repo")
+	require.Error(t, err)
+	require.NotErrorIs(t, err, ErrSettingsNotFound)
+}
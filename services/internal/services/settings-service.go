@@ -0,0 +1,104 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"pipecraft/internal/config"
+	"pipecraft/internal/jobs"
+	"pipecraft/internal/models"
+	"pipecraft/internal/storage"
+)
+
+var (
+	ErrSettingsNotFound  = errors.New("repository settings not found")
+	ErrInvalidConfigPath = jobs.ErrInvalidConfigPath
+	ErrInvalidSettings   = errors.New("invalid repository settings")
+)
+
+type SettingsService struct {
+	Storage SettingsStorage
+	CI      config.CI
+}
+
+type SettingsStorage interface {
+	SaveRepositorySettings(settings storage.RepositorySettingsTable) error
+	GetRepositorySettings(repository string) (*storage.RepositorySettingsTable, error)
+}
+
+func NewSettingsService(s SettingsStorage, ci config.CI) *SettingsService {
+	return &SettingsService{Storage: s, CI: ci}
+}
+
+// Save changes settings which request has, the other ones keep their saved values.
+func (s *SettingsService) Save(dto *models.RepositorySettingsRequest) error {
+	const op = `services.SettingsService.Save`
+
+	if dto.RepositoryUrl == "" {
+		return fmt.Errorf("%w: empty repository_url", ErrInvalidConfigPath)
+	}
+
+	settings := storage.RepositorySettingsTable{Repository: dto.RepositoryUrl}
+	saved, err := s.Storage.GetRepositorySettings(dto.RepositoryUrl)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return fmt.Errorf("op: %s, err: %w", op, err)
+	}
+	if saved != nil {
+		settings = *saved
+	}
+
+	if dto.CiConfigPath != nil {
+		settings.CiConfigPath = *dto.CiConfigPath
+	}
+	if dto.MaxConcurrentPipelines != nil {
+		settings.MaxConcurrentPipelines = *dto.MaxConcurrentPipelines
+	}
+	if dto.AutoCancel != nil {
+		settings.AutoCancel = *dto.AutoCancel
+	}
+	if dto.AutoCancelRunning != nil {
+		settings.AutoCancelRunning = *dto.AutoCancelRunning
+	}
+
+	// NOTE: empty path resets repository to global config path and pipelines directory
+	if settings.CiConfigPath != "" {
+		if err := jobs.ValidateConfigPath(settings.CiConfigPath); err != nil {
+			return err
+		}
+	}
+	// NOTE: zero limit means repository can run as many pipelines as workers are free
+	if settings.MaxConcurrentPipelines < 0 {
+		return fmt.Errorf("%w: max_concurrent_pipelines can't be negative", ErrInvalidSettings)
+	}
+	if settings.AutoCancelRunning && !settings.AutoCancel {
+		return fmt.Errorf("%w: auto_cancel_running requires auto_cancel", ErrInvalidSettings)
+	}
+
+	err = s.Storage.SaveRepositorySettings(settings)
+	if err != nil {
+		return fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *SettingsService) Get(repository string) (*models.RepositorySettingsResponse, error) {
+	const op = `services.SettingsService.Get`
+
+	settings, err := s.Storage.GetRepositorySettings(repository)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, ErrSettingsNotFound
+		}
+		return nil, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	return &models.RepositorySettingsResponse{
+		RepositoryUrl:          settings.Repository,
+		CiConfigPath:           settings.CiConfigPath,
+		MaxConcurrentPipelines: settings.MaxConcurrentPipelines,
+		AutoCancel:             settings.AutoCancel,
+		AutoCancelRunning:      settings.AutoCancelRunning,
+		Privileged:             s.CI.IsPrivilegedRepository(settings.Repository),
+		UpdatedAt:              settings.UpdatedAt,
+	}, nil
+}
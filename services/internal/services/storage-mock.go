@@ -2,14 +2,28 @@ package services
 
 import (
 	"errors"
+	"pipecraft/internal/jobs"
 	"pipecraft/internal/storage"
+	"pipecraft/internal/vcs"
+	"sort"
 	"time"
 )
 
 type StorageMock struct {
 	pipelines      map[int64]*storage.PipelinesTable
 	logs           map[int64]*storage.LogsTable
+	credentials    map[string]*storage.CredentialsTable
+	registries     map[[2]string]*storage.RegistryCredentialsTable
+	settings       map[string]*storage.RepositorySettingsTable
+	approvals      map[int64][]*storage.ApprovalsTable
+	schedules      map[int64]*storage.SchedulesTable
+	canceled       map[int64]bool
+	claimed        map[int64]time.Time
+	runners        map[int64]*storage.RunnersTable
+	runnerTokens   map[string]int64
 	lastPipelineId int64
+	lastRunnerId   int64
+	lastScheduleId int64
 	lastLogId      int64
 }
 
@@ -17,29 +31,43 @@ func NewStorageMock() *StorageMock {
 	return &StorageMock{
 		pipelines:      make(map[int64]*storage.PipelinesTable),
 		logs:           make(map[int64]*storage.LogsTable),
+		credentials:    make(map[string]*storage.CredentialsTable),
+		registries:     make(map[[2]string]*storage.RegistryCredentialsTable),
+		settings:       make(map[string]*storage.RepositorySettingsTable),
+		approvals:      make(map[int64][]*storage.ApprovalsTable),
+		schedules:      make(map[int64]*storage.SchedulesTable),
+		canceled:       make(map[int64]bool),
+		claimed:        make(map[int64]time.Time),
+		runners:        make(map[int64]*storage.RunnersTable),
+		runnerTokens:   make(map[string]int64),
 		lastPipelineId: 0,
 		lastLogId:      0,
 	}
 }
 
-func (s StorageMock) CreatePipeline(repository, branch, commit string) (int64, error) {
+func (s *StorageMock) CreatePipeline(newPipeline storage.PipelinesTable, force bool) (int64, error) {
+	attempt := 1
 	for id, pipeline := range s.pipelines {
-		if pipeline.Repository == repository && pipeline.Commit == commit && pipeline.Branch == branch {
-			return id, storage.ErrPipelineAlreadyExists
+		if pipeline.Repository == newPipeline.Repository && pipeline.Commit == newPipeline.Commit &&
+			pipeline.RefType == newPipeline.RefType && pipeline.Ref == newPipeline.Ref {
+			if !force && pipeline.Inputs == newPipeline.Inputs {
+				return id, storage.ErrPipelineAlreadyExists
+			}
+			attempt = max(attempt, pipeline.Attempt+1)
 		}
 	}
 
 	s.lastPipelineId++
 	s.lastLogId++
 
-	s.pipelines[s.lastPipelineId] = &storage.PipelinesTable{
-		PipelineId: s.lastPipelineId,
-		Status:     storage.PIPELINE_STATUS_WAITING,
-		Repository: repository,
-		Branch:     branch,
-		Commit:     commit,
-		CreatedAt:  time.Now(),
+	newPipeline.PipelineId = s.lastPipelineId
+	newPipeline.Status = storage.PIPELINE_STATUS_WAITING
+	newPipeline.Attempt = attempt
+	newPipeline.CreatedAt = time.Now()
+	if newPipeline.Trigger == "" {
+		newPipeline.Trigger = storage.TRIGGER_API
 	}
+	s.pipelines[s.lastPipelineId] = &newPipeline
 
 	s.logs[s.lastLogId] = &storage.LogsTable{
 		LogId:         s.lastLogId,
@@ -54,7 +82,39 @@ func (s StorageMock) CreatePipeline(repository, branch, commit string) (int64, e
 	return s.lastPipelineId, nil
 }
 
-func (s StorageMock) GetPipelineStatus(id int64) (string, error) {
+func (s *StorageMock) CreateRerun(id int64, failedOnly bool, triggeredBy string) (int64, error) {
+	original, ok := s.pipelines[id]
+	if !ok {
+		return 0, storage.ErrNotFound
+	}
+
+	if original.Status == storage.PIPELINE_STATUS_WAITING || original.Status == storage.PIPELINE_STATUS_RUNNING {
+		return 0, storage.ErrPipelineNotFinished
+	}
+
+	pipelineId, err := s.CreatePipeline(storage.PipelinesTable{
+		Repository:  original.Repository,
+		Branch:      original.Branch,
+		Ref:         original.Ref,
+		RefType:     original.RefType,
+		Commit:      original.Commit,
+		Checkout:    original.Checkout,
+		Trigger:     storage.TRIGGER_RERUN,
+		TriggeredBy: triggeredBy,
+		Inputs:      original.Inputs,
+		Priority:    original.Priority,
+	}, true)
+	if err != nil {
+		return 0, err
+	}
+
+	s.pipelines[pipelineId].RerunOf = id
+	s.pipelines[pipelineId].FailedOnly = failedOnly
+
+	return pipelineId, nil
+}
+
+func (s *StorageMock) GetPipelineStatus(id int64) (string, error) {
 	pipeline, ok := s.pipelines[id]
 	if !ok {
 		return "", storage.ErrNotFound
@@ -63,7 +123,7 @@ func (s StorageMock) GetPipelineStatus(id int64) (string, error) {
 	return pipeline.Status, nil
 }
 
-func (s StorageMock) GetPipelineLogs(id int64) ([]*storage.LogsTable, error) {
+func (s *StorageMock) GetPipelineLogs(id int64) ([]*storage.LogsTable, error) {
 	_, ok := s.pipelines[id]
 	if !ok {
 		return nil, storage.ErrNotFound
@@ -78,13 +138,653 @@ func (s StorageMock) GetPipelineLogs(id int64) ([]*storage.LogsTable, error) {
 	return nil, storage.ErrNotFound
 }
 
+func (s *StorageMock) ListPipelines(filter storage.PipelinesFilter) ([]*storage.PipelinesTable, error) {
+	pipelines := make([]*storage.PipelinesTable, 0)
+	for id := s.lastPipelineId; id > 0 && len(pipelines) < filter.Limit; id-- {
+		pipeline, ok := s.pipelines[id]
+		if !ok {
+			continue
+		}
+		if (filter.Repository != "" && pipeline.Repository != filter.Repository) ||
+			(filter.RefType != "" && pipeline.RefType != filter.RefType) ||
+			(filter.Status != "" && pipeline.Status != filter.Status) {
+			continue
+		}
+		pipelines = append(pipelines, pipeline)
+	}
+
+	return pipelines, nil
+}
+
+func (s *StorageMock) GetPipelineInfo(id int64) (*storage.PipelinesTable, error) {
+	pipeline, ok := s.pipelines[id]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+
+	copied := *pipeline
+	return &copied, nil
+}
+
+func (s *StorageMock) CreateDownstreamPipeline(pipeline storage.PipelinesTable) (int64, error) {
+	for id, existing := range s.pipelines {
+		if existing.ParentPipelineId == pipeline.ParentPipelineId && existing.ParentJob == pipeline.ParentJob {
+			return id, nil
+		}
+	}
+
+	pipeline.Trigger = storage.TRIGGER_UPSTREAM
+	pipeline.Priority = storage.TriggerPriority(storage.TRIGGER_UPSTREAM)
+	return s.CreatePipeline(pipeline, true)
+}
+
+func (s *StorageMock) SupersedePipelines(pipelineId int64, cancelRunning bool) ([]int64, error) {
+	newer, ok := s.pipelines[pipelineId]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+
+	superseded := make([]int64, 0)
+	for id := int64(1); id < pipelineId; id++ {
+		pipeline, ok := s.pipelines[id]
+		if !ok || pipeline.Repository != newer.Repository || pipeline.RefType != newer.RefType || pipeline.Ref != newer.Ref ||
+			pipeline.Commit == newer.Commit || pipeline.ParentPipelineId != 0 || newer.RefType != vcs.REF_TYPE_BRANCH {
+			continue
+		}
+
+		switch {
+		case (pipeline.Status == storage.PIPELINE_STATUS_WAITING || pipeline.Status == storage.PIPELINE_STATUS_WAITING_FOR_RUNNER) &&
+			pipeline.WorkspaceVolume == "":
+			pipeline.Status = storage.PIPELINE_STATUS_SUPERSEDED
+			superseded = append(superseded, id)
+		case cancelRunning && !storage.IsPipelineFinished(pipeline.Status):
+			s.canceled[id] = true
+		}
+	}
+
+	return superseded, nil
+}
+
+// NOTE: repositories don't take turns in mock, waiting pipelines are ordered by priority only
+func (s *StorageMock) ListQueue() ([]*storage.QueueTable, error) {
+	running := make([]*storage.QueueTable, 0)
+	waiting := make([]*storage.QueueTable, 0)
+	for id := int64(1); id <= s.lastPipelineId; id++ {
+		pipeline, ok := s.pipelines[id]
+		if !ok {
+			continue
+		}
+
+		entry := &storage.QueueTable{
+			PipelineId:      pipeline.PipelineId,
+			Status:          pipeline.Status,
+			Repository:      pipeline.Repository,
+			Ref:             pipeline.Ref,
+			Trigger:         pipeline.Trigger,
+			Priority:        pipeline.Priority,
+			AverageDuration: time.Minute,
+			CreatedAt:       pipeline.CreatedAt,
+		}
+		switch pipeline.Status {
+		case storage.PIPELINE_STATUS_RUNNING:
+			entry.StartedAt = &pipeline.CreatedAt
+			running = append(running, entry)
+		case storage.PIPELINE_STATUS_WAITING, storage.PIPELINE_STATUS_WAITING_FOR_RUNNER:
+			waiting = append(waiting, entry)
+		}
+	}
+
+	sort.SliceStable(waiting, func(i, j int) bool {
+		return waiting[i].Priority > waiting[j].Priority
+	})
+
+	return append(running, waiting...), nil
+}
+
+func (s *StorageMock) ListDownstreamPipelines(parentPipelineId int64) ([]*storage.PipelinesTable, error) {
+	pipelines := make([]*storage.PipelinesTable, 0)
+	for id := int64(1); id <= s.lastPipelineId; id++ {
+		pipeline, ok := s.pipelines[id]
+		if ok && pipeline.ParentPipelineId == parentPipelineId {
+			pipelines = append(pipelines, pipeline)
+		}
+	}
+
+	return pipelines, nil
+}
+
+func (s *StorageMock) GetPipelineDiagnostics(id int64) (string, error) {
+	pipeline, ok := s.pipelines[id]
+	if !ok {
+		return "", storage.ErrNotFound
+	}
+	if pipeline.Diagnostics == "" {
+		return "[]", nil
+	}
+
+	return pipeline.Diagnostics, nil
+}
+
+func (s *StorageMock) UpdatePipelineConfig(id int64, config string) error {
+	pipeline, ok := s.pipelines[id]
+	if !ok {
+		return storage.ErrNotFound
+	}
+
+	pipeline.Config = config
+	return nil
+}
+
+func (s *StorageMock) GetPipelineConfig(id int64) (string, string, error) {
+	pipeline, ok := s.pipelines[id]
+	if !ok {
+		return "", "", storage.ErrNotFound
+	}
+
+	return pipeline.ConfigFile, pipeline.Config, nil
+}
+
+func (s *StorageMock) RequestApproval(pipelineId int64, jobName, workspaceVolume string) (string, error) {
+	pipeline, ok := s.pipelines[pipelineId]
+	if !ok {
+		return "", storage.ErrNotFound
+	}
+
+	for _, approval := range s.approvals[pipelineId] {
+		if approval.JobName == jobName {
+			if approval.Status != storage.APPROVAL_STATUS_PENDING {
+				return approval.Status, nil
+			}
+			break
+		}
+	}
+
+	s.approvals[pipelineId] = append(s.approvals[pipelineId], &storage.ApprovalsTable{
+		PipelineId: pipelineId,
+		JobName:    jobName,
+		Status:     storage.APPROVAL_STATUS_PENDING,
+		CreatedAt:  time.Now(),
+	})
+	pipeline.Status = storage.PIPELINE_STATUS_WAITING_FOR_APPROVAL
+	pipeline.WorkspaceVolume = workspaceVolume
+
+	return storage.APPROVAL_STATUS_PENDING, nil
+}
+
+func (s *StorageMock) DecideApproval(pipelineId int64, jobName, status, decidedBy string) error {
+	for _, approval := range s.approvals[pipelineId] {
+		if approval.JobName != jobName {
+			continue
+		}
+		if approval.Status != storage.APPROVAL_STATUS_PENDING {
+			return storage.ErrApprovalDecided
+		}
+
+		decidedAt := time.Now()
+		approval.Status = status
+		approval.DecidedBy = decidedBy
+		approval.DecidedAt = &decidedAt
+		if pipeline := s.pipelines[pipelineId]; pipeline.Status == storage.PIPELINE_STATUS_WAITING_FOR_APPROVAL {
+			pipeline.Status = storage.PIPELINE_STATUS_WAITING
+		}
+		return nil
+	}
+
+	return storage.ErrNotFound
+}
+
+func (s *StorageMock) ListApprovals(pipelineId int64) ([]*storage.ApprovalsTable, error) {
+	return s.approvals[pipelineId], nil
+}
+
+func (s *StorageMock) CreateSchedule(schedule storage.SchedulesTable) (*storage.SchedulesTable, error) {
+	s.lastScheduleId++
+
+	schedule.ScheduleId = s.lastScheduleId
+	schedule.CreatedAt = time.Now()
+	schedule.UpdatedAt = schedule.CreatedAt
+	s.schedules[schedule.ScheduleId] = &schedule
+
+	return &schedule, nil
+}
+
+func (s *StorageMock) UpdateSchedule(schedule storage.SchedulesTable) (*storage.SchedulesTable, error) {
+	existing, ok := s.schedules[schedule.ScheduleId]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+
+	schedule.LastRunAt = existing.LastRunAt
+	schedule.CreatedAt = existing.CreatedAt
+	schedule.UpdatedAt = time.Now()
+	s.schedules[schedule.ScheduleId] = &schedule
+
+	return &schedule, nil
+}
+
+func (s *StorageMock) GetSchedule(id int64) (*storage.SchedulesTable, error) {
+	schedule, ok := s.schedules[id]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+
+	return schedule, nil
+}
+
+func (s *StorageMock) ListSchedules(repository string) ([]*storage.SchedulesTable, error) {
+	schedules := make([]*storage.SchedulesTable, 0)
+	for id := int64(1); id <= s.lastScheduleId; id++ {
+		schedule, ok := s.schedules[id]
+		if ok && (repository == "" || schedule.Repository == repository) {
+			schedules = append(schedules, schedule)
+		}
+	}
+
+	return schedules, nil
+}
+
+func (s *StorageMock) ListDueSchedules(now time.Time) ([]*storage.SchedulesTable, error) {
+	schedules := make([]*storage.SchedulesTable, 0)
+	for id := int64(1); id <= s.lastScheduleId; id++ {
+		schedule, ok := s.schedules[id]
+		if ok && schedule.Enabled && schedule.NextRunAt != nil && !schedule.NextRunAt.After(now) {
+			// NOTE: copy is returned like rows of real storage, so claim compares with value read before
+			copied := *schedule
+			schedules = append(schedules, &copied)
+		}
+	}
+
+	return schedules, nil
+}
+
+func (s *StorageMock) ClaimScheduleRun(id int64, nextRunAt, newNextRunAt time.Time) (bool, error) {
+	schedule, ok := s.schedules[id]
+	if !ok || !schedule.Enabled || schedule.NextRunAt == nil || !schedule.NextRunAt.Equal(nextRunAt) {
+		return false, nil
+	}
+
+	lastRunAt := time.Now()
+	schedule.NextRunAt = &newNextRunAt
+	schedule.LastRunAt = &lastRunAt
+
+	return true, nil
+}
+
+func (s *StorageMock) DeleteSchedule(id int64) error {
+	if _, ok := s.schedules[id]; !ok {
+		return storage.ErrNotFound
+	}
+
+	delete(s.schedules, id)
+	return nil
+}
+
+func (s *StorageMock) SaveRepositoryCredentials(credentials storage.CredentialsTable) error {
+	credentials.UpdatedAt = time.Now()
+	s.credentials[credentials.Repository] = &credentials
+	return nil
+}
+
+func (s *StorageMock) GetRepositoryCredentials(repository string) (*storage.CredentialsTable, error) {
+	credentials, ok := s.credentials[repository]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+
+	return credentials, nil
+}
+
+func (s *StorageMock) DeleteRepositoryCredentials(repository string) error {
+	if _, ok := s.credentials[repository]; !ok {
+		return storage.ErrNotFound
+	}
+
+	delete(s.credentials, repository)
+	return nil
+}
+
+func (s *StorageMock) SaveRegistryCredentials(credentials storage.RegistryCredentialsTable) error {
+	credentials.UpdatedAt = time.Now()
+	s.registries[[2]string{credentials.Repository, credentials.Registry}] = &credentials
+	return nil
+}
+
+func (s *StorageMock) GetRegistryCredentials(repository, registry string) (*storage.RegistryCredentialsTable, error) {
+	credentials, ok := s.registries[[2]string{repository, registry}]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+
+	return credentials, nil
+}
+
+func (s *StorageMock) DeleteRegistryCredentials(repository, registry string) error {
+	if _, ok := s.registries[[2]string{repository, registry}]; !ok {
+		return storage.ErrNotFound
+	}
+
+	delete(s.registries, [2]string{repository, registry})
+	return nil
+}
+
+func (s *StorageMock) SaveRepositorySettings(settings storage.RepositorySettingsTable) error {
+	settings.UpdatedAt = time.Now()
+	s.settings[settings.Repository] = &settings
+	return nil
+}
+
+func (s *StorageMock) GetRepositorySettings(repository string) (*storage.RepositorySettingsTable, error) {
+	settings, ok := s.settings[repository]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+
+	return settings, nil
+}
+
+func (s *StorageMock) UpdatePipelineStatus(id int64, status string) error {
+	pipeline, ok := s.pipelines[id]
+	if !ok {
+		return storage.ErrNotFound
+	}
+
+	pipeline.Status = status
+	return nil
+}
+
+func (s *StorageMock) UpdatePipelineConfigFile(id int64, configFile string) error {
+	pipeline, ok := s.pipelines[id]
+	if !ok {
+		return storage.ErrNotFound
+	}
+
+	pipeline.ConfigFile = configFile
+	return nil
+}
+
+func (s *StorageMock) UpdatePipelineDiagnostics(id int64, diagnostics string) error {
+	pipeline, ok := s.pipelines[id]
+	if !ok {
+		return storage.ErrNotFound
+	}
+
+	pipeline.Diagnostics = diagnostics
+	return nil
+}
+
+func (s *StorageMock) CreateLog(logTable storage.LogsTable) error {
+	if _, ok := s.pipelines[logTable.PipelineId]; !ok {
+		return storage.ErrNotFound
+	}
+
+	s.lastLogId++
+	logTable.LogId = s.lastLogId
+	s.logs[s.lastLogId] = &logTable
+	return nil
+}
+
+func (s *StorageMock) StartLog(logTable storage.LogsTable) (int64, error) {
+	logTable.FinalStatus = storage.LOG_STATUS_RUNNING
+	if err := s.CreateLog(logTable); err != nil {
+		return 0, err
+	}
+	return s.lastLogId, nil
+}
+
+func (s *StorageMock) AppendLog(pipelineId, logId int64, results, finalStatus string) error {
+	log, ok := s.logs[logId]
+	if !ok || log.PipelineId != pipelineId {
+		return storage.ErrNotFound
+	}
+
+	log.Results += results
+	log.FinalStatus = finalStatus
+	return nil
+}
+
+func (s *StorageMock) CreateSiblingPipelines(id int64, configFiles []string) error {
+	original, ok := s.pipelines[id]
+	if !ok {
+		return storage.ErrNotFound
+	}
+
+	for _, configFile := range configFiles {
+		sibling := *original
+		sibling.ConfigFile = configFile
+		if _, err := s.CreatePipeline(sibling, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *StorageMock) GetDownstreamPipeline(parentPipelineId int64, parentJob string) (*storage.PipelinesTable, error) {
+	for _, pipeline := range s.pipelines {
+		if pipeline.ParentPipelineId == parentPipelineId && pipeline.ParentJob == parentJob {
+			copied := *pipeline
+			return &copied, nil
+		}
+	}
+
+	return nil, storage.ErrNotFound
+}
+
+func (s *StorageMock) WaitForDownstream(pipelineId, downstreamPipelineId int64, workspaceVolume string) (string, error) {
+	pipeline, ok := s.pipelines[pipelineId]
+	if !ok {
+		return "", storage.ErrNotFound
+	}
+	downstream, ok := s.pipelines[downstreamPipelineId]
+	if !ok {
+		return "", storage.ErrNotFound
+	}
+
+	if storage.IsPipelineFinished(downstream.Status) {
+		return downstream.Status, nil
+	}
+
+	pipeline.Status = storage.PIPELINE_STATUS_WAITING_FOR_DOWNSTREAM
+	pipeline.WorkspaceVolume = workspaceVolume
+	return storage.PIPELINE_STATUS_WAITING_FOR_DOWNSTREAM, nil
+}
+
+// NOTE: concurrency groups aren't kept in mock, lock is always acquired
+func (s *StorageMock) AcquireConcurrencyLock(group string, pipelineId int64, jobName string, cancelInProgress bool, workspaceVolume string) (bool, error) {
+	if _, ok := s.pipelines[pipelineId]; !ok {
+		return false, storage.ErrNotFound
+	}
+	return true, nil
+}
+
+func (s *StorageMock) ReleaseConcurrencyLock(group string, pipelineId int64) error {
+	return nil
+}
+
+func (s *StorageMock) IsCancelRequested(pipelineId int64) (bool, error) {
+	if _, ok := s.pipelines[pipelineId]; !ok {
+		return false, storage.ErrNotFound
+	}
+	return s.canceled[pipelineId], nil
+}
+
+func (s *StorageMock) RequeuePipeline(pipelineId int64, workspaceVolume, interruptedJob string) (bool, error) {
+	pipeline, ok := s.pipelines[pipelineId]
+	if !ok {
+		return false, storage.ErrNotFound
+	}
+	if pipeline.Status != storage.PIPELINE_STATUS_RUNNING {
+		return false, nil
+	}
+
+	pipeline.Status = storage.PIPELINE_STATUS_WAITING
+	pipeline.WorkspaceVolume = workspaceVolume
+	return true, nil
+}
+
+func (s *StorageMock) HandOffPipeline(pipelineId int64, runsOn []string) (bool, error) {
+	pipeline, ok := s.pipelines[pipelineId]
+	if !ok {
+		return false, storage.ErrNotFound
+	}
+	if pipeline.Status != storage.PIPELINE_STATUS_RUNNING {
+		return false, nil
+	}
+
+	pipeline.Status = storage.PIPELINE_STATUS_WAITING
+	pipeline.RunsOn = runsOn
+	pipeline.WorkspaceVolume = ""
+	pipeline.RunnerId = 0
+	return true, nil
+}
+
+func (s *StorageMock) CreateRunner(name, tokenHash string, labels []string) (int64, error) {
+	s.lastRunnerId++
+	s.runners[s.lastRunnerId] = &storage.RunnersTable{
+		RunnerId:        s.lastRunnerId,
+		Name:            name,
+		Labels:          labels,
+		LastHeartbeatAt: time.Now(),
+		CreatedAt:       time.Now(),
+	}
+	s.runnerTokens[tokenHash] = s.lastRunnerId
+
+	return s.lastRunnerId, nil
+}
+
+func (s *StorageMock) GetRunnerByTokenHash(tokenHash string) (*storage.RunnersTable, error) {
+	runnerId, ok := s.runnerTokens[tokenHash]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+
+	runner := *s.runners[runnerId]
+	return &runner, nil
+}
+
+func (s *StorageMock) GetRunner(runnerId int64) (*storage.RunnersTable, error) {
+	runner, ok := s.runners[runnerId]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+
+	copied := *runner
+	return &copied, nil
+}
+
+func (s *StorageMock) UpdateRunnerHeartbeat(runnerId int64) error {
+	runner, ok := s.runners[runnerId]
+	if !ok {
+		return storage.ErrNotFound
+	}
+
+	runner.LastHeartbeatAt = time.Now()
+	return nil
+}
+
+// NOTE: mock claims waiting pipelines in order of creation, priorities and limits of repositories aren't applied
+func (s *StorageMock) ClaimNextPipeline(runnerId int64, labels []string) (int64, error) {
+	for id := int64(1); id <= s.lastPipelineId; id++ {
+		pipeline, ok := s.pipelines[id]
+		if !ok || (pipeline.Status != storage.PIPELINE_STATUS_WAITING && pipeline.Status != storage.PIPELINE_STATUS_WAITING_FOR_RUNNER) {
+			continue
+		}
+		if pipeline.WorkspaceVolume != "" && pipeline.RunnerId != runnerId {
+			continue
+		}
+		if !jobs.HasLabels(labels, pipeline.RunsOn) {
+			continue
+		}
+
+		pipeline.Status = storage.PIPELINE_STATUS_RUNNING
+		pipeline.RunnerId = runnerId
+		if runnerId != 0 {
+			s.claimed[id] = time.Now()
+		}
+		return id, nil
+	}
+
+	return 0, storage.ErrNotFound
+}
+
+func (s *StorageMock) IsPipelineAssigned(pipelineId, runnerId int64) (bool, error) {
+	pipeline, ok := s.pipelines[pipelineId]
+	if !ok {
+		return false, storage.ErrNotFound
+	}
+
+	return pipeline.RunnerId == runnerId, nil
+}
+
+func (s *StorageMock) AcknowledgePipeline(pipelineId, runnerId int64) error {
+	if pipeline, ok := s.pipelines[pipelineId]; ok && pipeline.RunnerId == runnerId {
+		delete(s.claimed, pipelineId)
+	}
+	return nil
+}
+
+func (s *StorageMock) RequeueLostPipelines(heartbeatTimeout, ackTimeout time.Duration) ([]int64, error) {
+	requeued := make([]int64, 0)
+	for id := int64(1); id <= s.lastPipelineId; id++ {
+		pipeline, ok := s.pipelines[id]
+		if !ok || pipeline.RunnerId == 0 || storage.IsPipelineFinished(pipeline.Status) {
+			continue
+		}
+		claimedAt, unacknowledged := s.claimed[id]
+		lostResponse := pipeline.Status == storage.PIPELINE_STATUS_RUNNING && unacknowledged && time.Since(claimedAt) >= ackTimeout
+		if !lostResponse && time.Since(s.runners[pipeline.RunnerId].LastHeartbeatAt) < heartbeatTimeout {
+			continue
+		}
+		if pipeline.Status != storage.PIPELINE_STATUS_RUNNING && pipeline.WorkspaceVolume == "" {
+			continue
+		}
+
+		if pipeline.Status == storage.PIPELINE_STATUS_RUNNING {
+			pipeline.Status = storage.PIPELINE_STATUS_WAITING
+		}
+		pipeline.WorkspaceVolume = ""
+		pipeline.RunnerId = 0
+		delete(s.claimed, id)
+		requeued = append(requeued, id)
+	}
+
+	return requeued, nil
+}
+
+func (s *StorageMock) UpdateWaitingForRunner(heartbeatTimeout time.Duration, localLabels []string) error {
+	for id := int64(1); id <= s.lastPipelineId; id++ {
+		pipeline, ok := s.pipelines[id]
+		if !ok || pipeline.WorkspaceVolume != "" ||
+			(pipeline.Status != storage.PIPELINE_STATUS_WAITING && pipeline.Status != storage.PIPELINE_STATUS_WAITING_FOR_RUNNER) {
+			continue
+		}
+
+		matched := localLabels != nil && jobs.HasLabels(localLabels, pipeline.RunsOn)
+		for _, runner := range s.runners {
+			if time.Since(runner.LastHeartbeatAt) <= heartbeatTimeout && jobs.HasLabels(runner.Labels, pipeline.RunsOn) {
+				matched = true
+			}
+		}
+
+		pipeline.Status = storage.PIPELINE_STATUS_WAITING_FOR_RUNNER
+		if matched {
+			pipeline.Status = storage.PIPELINE_STATUS_WAITING
+		}
+	}
+
+	return nil
+}
+
 type ErrorStorageMock struct{}
 
 func NewErrorStorageMock() *ErrorStorageMock {
 	return &ErrorStorageMock{}
 }
 
-func (e ErrorStorageMock) CreatePipeline(repository, branch, commit string) (int64, error) {
+func (e ErrorStorageMock) CreatePipeline(pipeline storage.PipelinesTable, force bool) (int64, error) {
+	return 0, errors.New("mocked error")
+}
+
+func (e ErrorStorageMock) CreateRerun(id int64, failedOnly bool, triggeredBy string) (int64, error) {
 	return 0, errors.New("mocked error")
 }
 
@@ -95,3 +795,135 @@ func (e ErrorStorageMock) GetPipelineStatus(id int64) (string, error) {
 func (e ErrorStorageMock) GetPipelineLogs(id int64) ([]*storage.LogsTable, error) {
 	return nil, errors.New("mocked error")
 }
+
+func (e ErrorStorageMock) ListPipelines(filter storage.PipelinesFilter) ([]*storage.PipelinesTable, error) {
+	return nil, errors.New("mocked error")
+}
+
+func (e ErrorStorageMock) GetPipelineInfo(id int64) (*storage.PipelinesTable, error) {
+	return nil, errors.New("mocked error")
+}
+
+func (e ErrorStorageMock) ListDownstreamPipelines(parentPipelineId int64) ([]*storage.PipelinesTable, error) {
+	return nil, errors.New("mocked error")
+}
+
+func (e ErrorStorageMock) GetPipelineDiagnostics(id int64) (string, error) {
+	return "", errors.New("mocked error")
+}
+
+func (e ErrorStorageMock) GetPipelineConfig(id int64) (string, string, error) {
+	return "", "", errors.New("mocked error")
+}
+
+func (e ErrorStorageMock) DecideApproval(pipelineId int64, jobName, status, decidedBy string) error {
+	return errors.New("mocked error")
+}
+
+func (e ErrorStorageMock) ListApprovals(pipelineId int64) ([]*storage.ApprovalsTable, error) {
+	return nil, errors.New("mocked error")
+}
+
+func (e ErrorStorageMock) CreateSchedule(schedule storage.SchedulesTable) (*storage.SchedulesTable, error) {
+	return nil, errors.New("mocked error")
+}
+
+func (e ErrorStorageMock) UpdateSchedule(schedule storage.SchedulesTable) (*storage.SchedulesTable, error) {
+	return nil, errors.New("mocked error")
+}
+
+func (e ErrorStorageMock) GetSchedule(id int64) (*storage.SchedulesTable, error) {
+	return nil, errors.New("mocked error")
+}
+
+func (e ErrorStorageMock) ListSchedules(repository string) ([]*storage.SchedulesTable, error) {
+	return nil, errors.New("mocked error")
+}
+
+func (e ErrorStorageMock) ListDueSchedules(now time.Time) ([]*storage.SchedulesTable, error) {
+	return nil, errors.New("mocked error")
+}
+
+func (e ErrorStorageMock) ClaimScheduleRun(id int64, nextRunAt, newNextRunAt time.Time) (bool, error) {
+	return false, errors.New("mocked error")
+}
+
+func (e ErrorStorageMock) DeleteSchedule(id int64) error {
+	return errors.New("mocked error")
+}
+
+func (e ErrorStorageMock) SaveRepositoryCredentials(credentials storage.CredentialsTable) error {
+	return errors.New("mocked error")
+}
+
+func (e ErrorStorageMock) GetRepositoryCredentials(repository string) (*storage.CredentialsTable, error) {
+	return nil, errors.New("mocked error")
+}
+
+func (e ErrorStorageMock) DeleteRepositoryCredentials(repository string) error {
+	return errors.New("mocked error")
+}
+
+func (e ErrorStorageMock) SaveRegistryCredentials(credentials storage.RegistryCredentialsTable) error {
+	return errors.New("mocked error")
+}
+
+func (e ErrorStorageMock) GetRegistryCredentials(repository, registry string) (*storage.RegistryCredentialsTable, error) {
+	return nil, errors.New("mocked error")
+}
+
+func (e ErrorStorageMock) DeleteRegistryCredentials(repository, registry string) error {
+	return errors.New("mocked error")
+}
+
+func (e ErrorStorageMock) SaveRepositorySettings(settings storage.RepositorySettingsTable) error {
+	return errors.New("mocked error")
+}
+
+func (e ErrorStorageMock) SupersedePipelines(pipelineId int64, cancelRunning bool) ([]int64, error) {
+	return nil, errors.New("mocked error")
+}
+
+func (e ErrorStorageMock) ListQueue() ([]*storage.QueueTable, error) {
+	return nil, errors.New("mocked error")
+}
+
+func (e ErrorStorageMock) GetRepositorySettings(repository string) (*storage.RepositorySettingsTable, error) {
+	return nil, errors.New("mocked error")
+}
+
+func (e ErrorStorageMock) CreateRunner(name, tokenHash string, labels []string) (int64, error) {
+	return 0, errors.New("mocked error")
+}
+
+func (e ErrorStorageMock) GetRunner(runnerId int64) (*storage.RunnersTable, error) {
+	return nil, errors.New("mocked error")
+}
+
+func (e ErrorStorageMock) GetRunnerByTokenHash(tokenHash string) (*storage.RunnersTable, error) {
+	return nil, errors.New("mocked error")
+}
+
+func (e ErrorStorageMock) UpdateRunnerHeartbeat(runnerId int64) error {
+	return errors.New("mocked error")
+}
+
+func (e ErrorStorageMock) ClaimNextPipeline(runnerId int64, labels []string) (int64, error) {
+	return 0, errors.New("mocked error")
+}
+
+func (e ErrorStorageMock) IsPipelineAssigned(pipelineId, runnerId int64) (bool, error) {
+	return false, errors.New("mocked error")
+}
+
+func (e ErrorStorageMock) AcknowledgePipeline(pipelineId, runnerId int64) error {
+	return errors.New("mocked error")
+}
+
+func (e ErrorStorageMock) RequeueLostPipelines(heartbeatTimeout, ackTimeout time.Duration) ([]int64, error) {
+	return nil, errors.New("mocked error")
+}
+
+func (e ErrorStorageMock) UpdateWaitingForRunner(heartbeatTimeout time.Duration, localLabels []string) error {
+	return errors.New("mocked error")
+}
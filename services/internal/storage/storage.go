@@ -8,14 +8,17 @@ import (
 	"log/slog"
 	"os"
 	"pipecraft/internal/logger"
+	"pipecraft/internal/vcs"
 	"time"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
 var (
 	ErrNotFound              = errors.New("not found")
 	ErrPipelineAlreadyExists = errors.New("pipeline already exists")
+	ErrPipelineNotFinished   = errors.New("pipeline is not finished")
+	ErrApprovalDecided       = errors.New("approval is already decided")
 )
 
 const (
@@ -27,8 +30,68 @@ const (
 	PIPELINE_STATUS_ABORTED   = "aborted"
 	PIPELINE_STATUS_FAILED    = "failed"
 	PIPELINE_STATUS_COMPLETED = "completed"
+
+	PIPELINE_STATUS_CONFIG_NOT_FOUND = "config_not_found"
+	PIPELINE_STATUS_INVALID_CONFIG   = "invalid_config"
+
+	PIPELINE_STATUS_WAITING_FOR_APPROVAL    = "waiting_for_approval"
+	PIPELINE_STATUS_WAITING_FOR_DOWNSTREAM  = "waiting_for_downstream"
+	PIPELINE_STATUS_WAITING_FOR_CONCURRENCY = "waiting_for_concurrency"
+	PIPELINE_STATUS_WAITING_FOR_RUNNER      = "waiting_for_runner"
+	PIPELINE_STATUS_REJECTED                = "rejected"
+	PIPELINE_STATUS_CANCELED                = "canceled"
+	PIPELINE_STATUS_SUPERSEDED              = "superseded"
+
+	APPROVAL_STATUS_PENDING  = "pending"
+	APPROVAL_STATUS_APPROVED = "approved"
+	APPROVAL_STATUS_REJECTED = "rejected"
+
+	TRIGGER_API      = "api"
+	TRIGGER_WEBHOOK  = "webhook"
+	TRIGGER_SCHEDULE = "schedule"
+	TRIGGER_RERUN    = "rerun"
+	TRIGGER_UPSTREAM = "upstream"
+
+	LOG_STATUS_RUNNING    = "Running"
+	LOG_STATUS_SUCCEEDED  = "Succeeded"
+	LOG_STATUS_FAILED     = "Failed"
+	LOG_STATUS_SKIPPED    = "Skipped"
+	LOG_STATUS_OOM_KILLED = "OOMKilled"
+
+	PRIORITY_LOW    = -10
+	PRIORITY_NORMAL = 0
+	PRIORITY_HIGH   = 10
+
+	// NOTE: key of advisory lock which serializes claims of pipelines between replicas
+	QUEUE_LOCK_KEY = 7301
+	// NOTE: key of advisory locks which serialize creation of pipelines of one commit, second key is hash of commit
+	COMMIT_LOCK_KEY = 7302
+
+	QUEUE_DURATION_SAMPLE = 20
 )
 
+// IsPipelineFinished reports whether pipeline of status won't run anymore.
+func IsPipelineFinished(status string) bool {
+	switch status {
+	case PIPELINE_STATUS_WAITING, PIPELINE_STATUS_RUNNING, PIPELINE_STATUS_WAITING_FOR_APPROVAL,
+		PIPELINE_STATUS_WAITING_FOR_DOWNSTREAM, PIPELINE_STATUS_WAITING_FOR_CONCURRENCY, PIPELINE_STATUS_WAITING_FOR_RUNNER:
+		return false
+	}
+	return true
+}
+
+// TriggerPriority returns default priority of pipeline run by trigger. Pipelines run by people go before scheduled ones,
+// downstream pipelines go first since their upstream pipelines wait for them.
+func TriggerPriority(trigger string) int {
+	switch trigger {
+	case TRIGGER_UPSTREAM:
+		return PRIORITY_HIGH
+	case TRIGGER_SCHEDULE:
+		return PRIORITY_LOW
+	}
+	return PRIORITY_NORMAL
+}
+
 type Storage struct {
 	Db *sql.DB
 }
@@ -63,7 +126,7 @@ func tryToConnect(dsn string) (*sql.DB, error) {
 	}
 }
 
-func (s *Storage) CreatePipeline(repository, branch, commit string) (int64, error) {
+func (s *Storage) CreatePipeline(pipeline PipelinesTable, force bool) (int64, error) {
 	const op = `storage.CreatePipeline`
 
 	tx, err := s.Db.BeginTx(context.Background(), &sql.TxOptions{Isolation: sql.LevelReadCommitted})
@@ -72,27 +135,152 @@ func (s *Storage) CreatePipeline(repository, branch, commit string) (int64, erro
 	}
 	defer tx.Rollback()
 
+	attempt, err := lockNextAttempt(tx, pipeline.Repository, pipeline.RefType, pipeline.Ref, pipeline.Commit)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
 	selectQuery := `
 		SELECT
-			pipeline_id
+			pipeline_id,
+			inputs = $5::jsonb
 		FROM
 			pipelines
 		WHERE
-			repository = $1 AND branch = $2 AND commit = $3;
+			repository = $1 AND ref_type = $2 AND ref = $3 AND commit = $4 AND source_pipeline_id IS NULL
+		ORDER BY
+			attempt DESC
+		LIMIT 1;
 	`
 
+	if pipeline.Inputs == "" {
+		pipeline.Inputs = "{}"
+	}
+
+	// NOTE: run of the same commit with other inputs is not a duplicate, but it still counts as next attempt
 	var pipelineId int64
-	err = tx.QueryRow(selectQuery, repository, branch, commit).Scan(&pipelineId)
+	var sameInputs bool
+	err = tx.QueryRow(selectQuery, pipeline.Repository, pipeline.RefType, pipeline.Ref, pipeline.Commit, pipeline.Inputs).Scan(&pipelineId, &sameInputs)
 	if err != nil {
 		if !errors.Is(err, sql.ErrNoRows) {
 			return 0, fmt.Errorf("%s: %w", op, err)
 		}
-	} else {
+	} else if !force && sameInputs {
 		return pipelineId, ErrPipelineAlreadyExists
 	}
 
-	insertQuery := `INSERT INTO pipelines (status, repository, branch, commit) VALUES ($1, $2, $3, $4) RETURNING pipeline_id;`
-	err = tx.QueryRow(insertQuery, PIPELINE_STATUS_WAITING, repository, branch, commit).Scan(&pipelineId)
+	if pipeline.Checkout == "" {
+		pipeline.Checkout = "{}"
+	}
+	if pipeline.Trigger == "" {
+		pipeline.Trigger = TRIGGER_API
+	}
+
+	insertQuery := `
+		INSERT INTO pipelines (status, repository, branch, ref, ref_type, commit, attempt, checkout, trigger, triggered_by, inputs, priority)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		RETURNING pipeline_id;
+	`
+	err = tx.QueryRow(
+		insertQuery,
+		PIPELINE_STATUS_WAITING,
+		pipeline.Repository,
+		pipeline.Branch,
+		pipeline.Ref,
+		pipeline.RefType,
+		pipeline.Commit,
+		attempt,
+		pipeline.Checkout,
+		pipeline.Trigger,
+		pipeline.TriggeredBy,
+		pipeline.Inputs,
+		pipeline.Priority,
+	).Scan(&pipelineId)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return pipelineId, nil
+}
+
+func (s *Storage) CreateRerun(id int64, failedOnly bool, triggeredBy string) (int64, error) {
+	const op = `storage.CreateRerun`
+
+	tx, err := s.Db.BeginTx(context.Background(), &sql.TxOptions{Isolation: sql.LevelReadCommitted})
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	selectQuery := `
+		SELECT
+			status,
+			repository,
+			ref_type,
+			ref,
+			commit
+		FROM
+			pipelines
+		WHERE
+			pipeline_id = $1
+		FOR UPDATE;
+	`
+
+	var status string
+	var original PipelinesTable
+	err = tx.QueryRow(selectQuery, id).Scan(&status, &original.Repository, &original.RefType, &original.Ref, &original.Commit)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrNotFound
+		}
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if !IsPipelineFinished(status) {
+		return 0, ErrPipelineNotFinished
+	}
+
+	attempt, err := lockNextAttempt(tx, original.Repository, original.RefType, original.Ref, original.Commit)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	insertQuery := `
+		INSERT INTO pipelines (
+			status, repository, branch, ref, ref_type, commit, checkout, trigger, triggered_by, inputs, priority, config_file,
+			source_pipeline_id, attempt, rerun_of, failed_only
+		)
+		SELECT
+			$1,
+			p.repository,
+			p.branch,
+			p.ref,
+			p.ref_type,
+			p.commit,
+			p.checkout,
+			$4,
+			$5,
+			p.inputs,
+			p.priority,
+			p.config_file,
+			p.source_pipeline_id,
+			$6,
+			p.pipeline_id,
+			$2
+		FROM
+			pipelines p
+		WHERE
+			p.pipeline_id = $3
+		RETURNING pipeline_id;
+	`
+
+	var pipelineId int64
+	err = tx.QueryRow(insertQuery, PIPELINE_STATUS_WAITING, failedOnly, id, TRIGGER_RERUN, triggeredBy, attempt).Scan(&pipelineId)
 	if err != nil {
 		return 0, fmt.Errorf("%s: %w", op, err)
 	}
@@ -105,6 +293,114 @@ func (s *Storage) CreatePipeline(repository, branch, commit string) (int64, erro
 	return pipelineId, nil
 }
 
+// lockNextAttempt locks creation of pipelines of commit until transaction ends and returns its next attempt. Attempts
+// are counted over every pipeline of commit whatever its config file is, since siblings share attempt of their source.
+// NOTE: lock is taken before duplicates are looked for, so concurrent identical runs can't both miss each other
+func lockNextAttempt(tx *sql.Tx, repository, refType, ref, commit string) (int, error) {
+	const op = `storage.lockNextAttempt`
+
+	lockQuery := `SELECT pg_advisory_xact_lock($1, hashtext(concat_ws(':', $2::text, $3::text, $4::text, $5::text)));`
+	if _, err := tx.Exec(lockQuery, COMMIT_LOCK_KEY, repository, refType, ref, commit); err != nil {
+		return 0, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	selectQuery := `
+		SELECT
+			COALESCE(MAX(attempt), 0) + 1
+		FROM
+			pipelines
+		WHERE
+			repository = $1 AND ref_type = $2 AND ref = $3 AND commit = $4;
+	`
+
+	var attempt int
+	if err := tx.QueryRow(selectQuery, repository, refType, ref, commit).Scan(&attempt); err != nil {
+		return 0, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	return attempt, nil
+}
+
+func (s *Storage) CreateSiblingPipelines(id int64, configFiles []string) error {
+	const op = `storage.CreateSiblingPipelines`
+
+	// NOTE: siblings share attempt with source pipeline, repeated creation is ignored by unique index
+	query := `
+		INSERT INTO pipelines (
+			status, repository, branch, ref, ref_type, commit, checkout, trigger, triggered_by, inputs, priority, attempt, config_file,
+			source_pipeline_id
+		)
+		SELECT
+			$1,
+			p.repository,
+			p.branch,
+			p.ref,
+			p.ref_type,
+			p.commit,
+			p.checkout,
+			p.trigger,
+			p.triggered_by,
+			p.inputs,
+			p.priority,
+			p.attempt,
+			$2,
+			p.pipeline_id
+		FROM
+			pipelines p
+		WHERE
+			p.pipeline_id = $3
+		ON CONFLICT (source_pipeline_id, config_file) WHERE rerun_of IS NULL DO NOTHING;
+	`
+
+	tx, err := s.Db.BeginTx(context.Background(), &sql.TxOptions{Isolation: sql.LevelReadCommitted})
+	if err != nil {
+		return fmt.Errorf("op: %s, err: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	for _, configFile := range configFiles {
+		_, err := tx.Exec(query, PIPELINE_STATUS_WAITING, configFile, id)
+		if err != nil {
+			return fmt.Errorf("op: %s, err: %w", op, err)
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) UpdatePipelineConfigFile(id int64, configFile string) error {
+	const op = `storage.UpdatePipelineConfigFile`
+
+	query := `
+		UPDATE pipelines
+		SET config_file = $1
+		WHERE pipeline_id = $2;
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	res, err := s.Db.ExecContext(ctx, query, configFile, id)
+	if err != nil {
+		return fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("op: %s, err: %w", op, err)
+	}
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
 func (s *Storage) GetPipelineStatus(id int64) (string, error) {
 	const op = `storage.GetPipelineStatus`
 
@@ -132,102 +428,74 @@ func (s *Storage) GetPipelineStatus(id int64) (string, error) {
 	return status, nil
 }
 
-func (s *Storage) GetPipelineLogs(id int64) ([]*LogsTable, error) {
-	const op = `storage.GetPipelineLogs`
+func (s *Storage) UpdatePipelineDiagnostics(id int64, diagnostics string) error {
+	const op = `storage.UpdatePipelineDiagnostics`
 
 	query := `
-		SELECT
-			log_id,
-			command_number,
-			command_name,
-			command,
-			results,
-			final_status
-		FROM
-			logs
-		WHERE
-			pipeline_fk_id = $1
-		ORDER BY
-			command_number;
-    `
-
-	logs := make([]*LogsTable, 0)
+		UPDATE pipelines
+		SET diagnostics = $1
+		WHERE pipeline_id = $2;
+	`
 
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
 	defer cancel()
 
-	rows, err := s.Db.QueryContext(ctx, query, id)
+	res, err := s.Db.ExecContext(ctx, query, diagnostics, id)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, ErrNotFound
-		}
-		return nil, fmt.Errorf("op: %s, err: %w", op, err)
+		return fmt.Errorf("op: %s, err: %w", op, err)
 	}
 
-	for rows.Next() {
-		logEntity := &LogsTable{}
-
-		err = rows.Scan(
-			&logEntity.LogId,
-			&logEntity.CommandNumber,
-			&logEntity.CommandName,
-			&logEntity.Command,
-			&logEntity.Results,
-			&logEntity.FinalStatus,
-		)
-		if err != nil {
-			return nil, fmt.Errorf("op: %s, err: %w", op, err)
-		}
-
-		logs = append(logs, logEntity)
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("op: %s, err: %w", op, err)
+	}
+	if rowsAffected == 0 {
+		return ErrNotFound
 	}
 
-	return logs, nil
+	return nil
 }
 
-func (s *Storage) GetLastWaitingPipeline() (int64, error) {
-	const op = `storage.GetLastWaitingPipeline`
+func (s *Storage) GetPipelineDiagnostics(id int64) (string, error) {
+	const op = `storage.GetPipelineDiagnostics`
 
 	query := `
 		SELECT
-			pipeline_id
+			diagnostics
 		FROM
 			pipelines
 		WHERE
-		    status = $1
-		ORDER BY 
-			created_at ASC 
-		LIMIT 1;
+			pipeline_id = $1;
 	`
 
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
 	defer cancel()
 
-	var pipelineId int64
-	err := s.Db.QueryRowContext(ctx, query, PIPELINE_STATUS_WAITING).Scan(&pipelineId)
+	var diagnostics string
+	err := s.Db.QueryRowContext(ctx, query, id).Scan(&diagnostics)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return 0, ErrNotFound
+			return "", ErrNotFound
 		}
-		return 0, fmt.Errorf("op: %s, err: %w", op, err)
+		return "", fmt.Errorf("op: %s, err: %w", op, err)
 	}
 
-	return pipelineId, nil
+	return diagnostics, nil
 }
 
-func (s *Storage) UpdatePipelineStatus(id int64, status string) error {
-	const op = `storage.UpdatePipelineStatus`
+func (s *Storage) UpdatePipelineConfig(id int64, config string) error {
+	const op = `storage.UpdatePipelineConfig`
 
 	query := `
 		UPDATE pipelines
-		SET status = $1
+		SET config = $1
 		WHERE pipeline_id = $2;
 	`
 
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
 	defer cancel()
 
-	res, err := s.Db.ExecContext(ctx, query, status, id)
+	res, err := s.Db.ExecContext(ctx, query, config, id)
 	if err != nil {
 		return fmt.Errorf("op: %s, err: %w", op, err)
 	}
@@ -243,15 +511,14 @@ func (s *Storage) UpdatePipelineStatus(id int64, status string) error {
 	return nil
 }
 
-func (s *Storage) GetPipelineInfo(id int64) (*PipelinesTable, error) {
-	const op = `storage.GetPipelineInfo`
+func (s *Storage) GetPipelineConfig(id int64) (string, string, error) {
+	const op = `storage.GetPipelineConfig`
 
 	query := `
 		SELECT
-			repository,
-			branch,
-			commit
-		FROM 
+			config_file,
+			config
+		FROM
 			pipelines
 		WHERE
 			pipeline_id = $1;
@@ -260,31 +527,2039 @@ func (s *Storage) GetPipelineInfo(id int64) (*PipelinesTable, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
 	defer cancel()
 
-	row := s.Db.QueryRowContext(ctx, query, id)
-	if err := row.Err(); err != nil {
+	var configFile, config string
+	err := s.Db.QueryRowContext(ctx, query, id).Scan(&configFile, &config)
+	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return nil, ErrNotFound
+			return "", "", ErrNotFound
 		}
-		return nil, fmt.Errorf("op: %s, err: %w", op, ErrNotFound)
-	}
-
-	var pipeline PipelinesTable
-	if err := row.Scan(&pipeline.Repository, &pipeline.Branch, &pipeline.Commit); err != nil {
-		return nil, fmt.Errorf("op: %s, err: %w", op, err)
+		return "", "", fmt.Errorf("op: %s, err: %w", op, err)
 	}
 
-	return &pipeline, nil
+	return configFile, config, nil
 }
 
-func (s *Storage) CreateLog(logTable LogsTable) error {
-	const op = `storage.CreateLog`
+func (s *Storage) GetPipelineLogs(id int64) ([]*LogsTable, error) {
+	const op = `storage.GetPipelineLogs`
 
-	query := `INSERT INTO logs(pipeline_fk_id, command_name, command_number, command, results, final_status) VALUES ($1, $2, $3, $4, $5, $6);`
+	query := `
+		SELECT
+			log_id,
+			command_number,
+			command_name,
+			command,
+			results,
+			final_status
+		FROM
+			logs
+		WHERE
+			pipeline_fk_id = $1
+		ORDER BY
+			command_number;
+    `
+
+	logs := make([]*LogsTable, 0)
 
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
 	defer cancel()
 
-	_, err := s.Db.ExecContext(ctx, query, logTable.PipelineId, logTable.CommandName, logTable.CommandNumber, logTable.Command, logTable.Results, logTable.FinalStatus)
+	rows, err := s.Db.QueryContext(ctx, query, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	for rows.Next() {
+		logEntity := &LogsTable{}
+
+		err = rows.Scan(
+			&logEntity.LogId,
+			&logEntity.CommandNumber,
+			&logEntity.CommandName,
+			&logEntity.Command,
+			&logEntity.Results,
+			&logEntity.FinalStatus,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("op: %s, err: %w", op, err)
+		}
+
+		logs = append(logs, logEntity)
+	}
+
+	return logs, nil
+}
+
+// ClaimNextPipeline marks the next waiting pipeline as running on runner and returns its id, runner id is 0 for
+// workers of server. Pipelines of higher priority go first, pipelines of the same priority are taken from repositories
+// in turns, repository which runs its max concurrent pipelines is skipped. Pipeline is claimed only by runner whose
+// labels include every label its jobs run on.
+// NOTE: paused pipeline keeps its workspace on docker host of runner which ran it, so it is resumed only by that runner
+func (s *Storage) ClaimNextPipeline(runnerId int64, labels []string) (int64, error) {
+	const op = `storage.ClaimNextPipeline`
+
+	if labels == nil {
+		labels = []string{}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := s.Db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelReadCommitted})
+	if err != nil {
+		return 0, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	// NOTE: counts of running pipelines are checked and changed by one claim at a time, row locks don't cover them
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1);`, QUEUE_LOCK_KEY); err != nil {
+		return 0, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	selectQuery := `
+		SELECT
+			q.pipeline_id
+		FROM
+			(
+				SELECT
+					pipeline_id,
+					repository,
+					priority,
+					created_at,
+					ROW_NUMBER() OVER (PARTITION BY repository ORDER BY priority DESC, created_at ASC) AS repository_position
+				FROM
+					pipelines
+				WHERE
+					status IN ($1, $4) AND (workspace_volume = '' OR COALESCE(runner_id, 0) = $3) AND runs_on <@ $5
+			) q
+			LEFT JOIN repository_settings rs ON rs.repository = q.repository
+			LEFT JOIN LATERAL (
+				SELECT
+					COUNT(*) FILTER (WHERE r.status = $2) AS running,
+					MAX(r.started_at) AS last_started_at
+				FROM
+					pipelines r
+				WHERE
+					r.repository = q.repository AND r.started_at IS NOT NULL
+			) r ON TRUE
+		WHERE
+			COALESCE(rs.max_concurrent_pipelines, 0) = 0 OR r.running < rs.max_concurrent_pipelines
+		ORDER BY
+			q.priority DESC,
+			q.repository_position ASC,
+			r.last_started_at ASC NULLS FIRST,
+			q.created_at ASC
+		LIMIT 1;
+	`
+
+	var pipelineId int64
+	err = tx.QueryRowContext(
+		ctx,
+		selectQuery,
+		PIPELINE_STATUS_WAITING,
+		PIPELINE_STATUS_RUNNING,
+		runnerId,
+		PIPELINE_STATUS_WAITING_FOR_RUNNER,
+		pq.Array(labels),
+	).Scan(&pipelineId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrNotFound
+		}
+		return 0, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	// NOTE: started_at is the time pipeline was claimed last, resumed pipeline is claimed once more. Pipeline claimed
+	// by runner is acknowledged by it once runner got it, workers of server get it right away
+	updateQuery := `
+		UPDATE pipelines
+		SET
+			status = $1,
+			started_at = NOW(),
+			runner_id = NULLIF($3, 0),
+			acknowledged_at = CASE WHEN $3 = 0 THEN NOW() ELSE NULL END
+		WHERE pipeline_id = $2;
+	`
+
+	if _, err := tx.ExecContext(ctx, updateQuery, PIPELINE_STATUS_RUNNING, pipelineId, runnerId); err != nil {
+		return 0, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	return pipelineId, nil
+}
+
+// ListQueue returns running pipelines ordered by start time followed by waiting ones in the order they are claimed.
+// Average duration is taken from the last finished pipelines of repository, or of all repositories if it has none.
+func (s *Storage) ListQueue() ([]*QueueTable, error) {
+	const op = `storage.ListQueue`
+
+	query := `
+		WITH durations AS (
+			SELECT
+				repository,
+				EXTRACT(EPOCH FROM finished_at - started_at) AS duration,
+				ROW_NUMBER() OVER (PARTITION BY repository ORDER BY finished_at DESC) AS recency
+			FROM
+				pipelines
+			WHERE
+				finished_at IS NOT NULL AND started_at IS NOT NULL AND finished_at >= started_at
+		),
+		repository_durations AS (
+			SELECT repository, AVG(duration) AS duration
+			FROM durations
+			WHERE recency <= $3
+			GROUP BY repository
+		),
+		last_started AS (
+			SELECT repository, MAX(started_at) AS last_started_at
+			FROM pipelines
+			WHERE started_at IS NOT NULL
+			GROUP BY repository
+		)
+		SELECT
+			p.pipeline_id,
+			p.status,
+			p.repository,
+			p.ref,
+			p.trigger,
+			p.priority,
+			p.started_at,
+			COALESCE(rd.duration, (SELECT AVG(duration) FROM durations WHERE recency <= $3)),
+			p.created_at
+		FROM
+			(
+				SELECT
+					*,
+					ROW_NUMBER() OVER (PARTITION BY repository ORDER BY priority DESC, created_at ASC) AS repository_position
+				FROM
+					pipelines
+				WHERE
+					status IN ($1, $2, $4)
+			) p
+			LEFT JOIN repository_durations rd ON rd.repository = p.repository
+			LEFT JOIN last_started ls ON ls.repository = p.repository
+		ORDER BY
+			p.status = $2 DESC,
+			CASE WHEN p.status = $2 THEN p.started_at END ASC,
+			p.priority DESC,
+			p.repository_position ASC,
+			ls.last_started_at ASC NULLS FIRST,
+			p.created_at ASC;
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := s.Db.QueryContext(ctx, query, PIPELINE_STATUS_WAITING, PIPELINE_STATUS_RUNNING, QUEUE_DURATION_SAMPLE, PIPELINE_STATUS_WAITING_FOR_RUNNER)
+	if err != nil {
+		return nil, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+	defer rows.Close()
+
+	queue := make([]*QueueTable, 0)
+	for rows.Next() {
+		var entry QueueTable
+		var averageDuration sql.NullFloat64
+		err := rows.Scan(
+			&entry.PipelineId,
+			&entry.Status,
+			&entry.Repository,
+			&entry.Ref,
+			&entry.Trigger,
+			&entry.Priority,
+			&entry.StartedAt,
+			&averageDuration,
+			&entry.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("op: %s, err: %w", op, err)
+		}
+		if averageDuration.Valid {
+			entry.AverageDuration = time.Duration(averageDuration.Float64 * float64(time.Second))
+		}
+		queue = append(queue, &entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	return queue, nil
+}
+
+// UpdatePipelineStatus sets status of pipeline, once pipeline finishes its concurrency locks are released and
+// pipelines waiting for it are put back to the queue.
+func (s *Storage) UpdatePipelineStatus(id int64, status string) error {
+	const op = `storage.UpdatePipelineStatus`
+
+	tx, err := s.Db.BeginTx(context.Background(), &sql.TxOptions{Isolation: sql.LevelReadCommitted})
+	if err != nil {
+		return fmt.Errorf("op: %s, err: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE pipelines
+		SET status = $1
+		WHERE pipeline_id = $2;
+	`
+
+	res, err := tx.Exec(query, status, id)
+	if err != nil {
+		return fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("op: %s, err: %w", op, err)
+	}
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	if IsPipelineFinished(status) {
+		finishQuery := `
+			UPDATE pipelines
+			SET finished_at = NOW()
+			WHERE pipeline_id = $1;
+		`
+
+		if _, err := tx.Exec(finishQuery, id); err != nil {
+			return fmt.Errorf("op: %s, err: %w", op, err)
+		}
+
+		resumeQuery := `
+			UPDATE pipelines
+			SET status = $1
+			WHERE status = $2 AND pipeline_id = (SELECT parent_pipeline_id FROM pipelines WHERE pipeline_id = $3);
+		`
+
+		if _, err := tx.Exec(resumeQuery, PIPELINE_STATUS_WAITING, PIPELINE_STATUS_WAITING_FOR_DOWNSTREAM, id); err != nil {
+			return fmt.Errorf("op: %s, err: %w", op, err)
+		}
+
+		if err := releaseConcurrencyLocks(tx, id, nil); err != nil {
+			return fmt.Errorf("op: %s, err: %w", op, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) GetPipelineInfo(id int64) (*PipelinesTable, error) {
+	const op = `storage.GetPipelineInfo`
+
+	query := `
+		SELECT
+			pipeline_id,
+			status,
+			repository,
+			branch,
+			ref,
+			ref_type,
+			commit,
+			attempt,
+			COALESCE(rerun_of, 0),
+			failed_only,
+			checkout,
+			config_file,
+			workspace_volume,
+			trigger,
+			triggered_by,
+			inputs,
+			COALESCE(parent_pipeline_id, 0),
+			parent_job,
+			priority,
+			COALESCE(runner_id, 0),
+			runs_on,
+			created_at
+		FROM 
+			pipelines
+		WHERE
+			pipeline_id = $1;
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	row := s.Db.QueryRowContext(ctx, query, id)
+	if err := row.Err(); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("op: %s, err: %w", op, ErrNotFound)
+	}
+
+	var pipeline PipelinesTable
+	if err := row.Scan(
+		&pipeline.PipelineId,
+		&pipeline.Status,
+		&pipeline.Repository,
+		&pipeline.Branch,
+		&pipeline.Ref,
+		&pipeline.RefType,
+		&pipeline.Commit,
+		&pipeline.Attempt,
+		&pipeline.RerunOf,
+		&pipeline.FailedOnly,
+		&pipeline.Checkout,
+		&pipeline.ConfigFile,
+		&pipeline.WorkspaceVolume,
+		&pipeline.Trigger,
+		&pipeline.TriggeredBy,
+		&pipeline.Inputs,
+		&pipeline.ParentPipelineId,
+		&pipeline.ParentJob,
+		&pipeline.Priority,
+		&pipeline.RunnerId,
+		pq.Array(&pipeline.RunsOn),
+		&pipeline.CreatedAt,
+	); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	return &pipeline, nil
+}
+
+func (s *Storage) ListPipelines(filter PipelinesFilter) ([]*PipelinesTable, error) {
+	const op = `storage.ListPipelines`
+
+	query := `
+		SELECT
+			pipeline_id,
+			status,
+			repository,
+			branch,
+			ref,
+			ref_type,
+			commit,
+			attempt,
+			COALESCE(rerun_of, 0),
+			config_file,
+			trigger,
+			triggered_by,
+			inputs,
+			COALESCE(parent_pipeline_id, 0),
+			priority,
+			created_at
+		FROM
+			pipelines
+		WHERE
+			($1 = '' OR repository = $1) AND
+			($2 = '' OR ref_type = $2) AND
+			($3 = '' OR status = $3)
+		ORDER BY
+			created_at DESC
+		LIMIT $4;
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	rows, err := s.Db.QueryContext(ctx, query, filter.Repository, filter.RefType, filter.Status, filter.Limit)
+	if err != nil {
+		return nil, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+	defer rows.Close()
+
+	pipelines := make([]*PipelinesTable, 0)
+	for rows.Next() {
+		pipeline := &PipelinesTable{}
+
+		err = rows.Scan(
+			&pipeline.PipelineId,
+			&pipeline.Status,
+			&pipeline.Repository,
+			&pipeline.Branch,
+			&pipeline.Ref,
+			&pipeline.RefType,
+			&pipeline.Commit,
+			&pipeline.Attempt,
+			&pipeline.RerunOf,
+			&pipeline.ConfigFile,
+			&pipeline.Trigger,
+			&pipeline.TriggeredBy,
+			&pipeline.Inputs,
+			&pipeline.ParentPipelineId,
+			&pipeline.Priority,
+			&pipeline.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("op: %s, err: %w", op, err)
+		}
+
+		pipelines = append(pipelines, pipeline)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	return pipelines, nil
+}
+
+// CreateDownstreamPipeline creates pipeline triggered by job of upstream pipeline, pipeline of job is created only once.
+func (s *Storage) CreateDownstreamPipeline(pipeline PipelinesTable) (int64, error) {
+	const op = `storage.CreateDownstreamPipeline`
+
+	if pipeline.Checkout == "" {
+		pipeline.Checkout = "{}"
+	}
+	if pipeline.Inputs == "" {
+		pipeline.Inputs = "{}"
+	}
+
+	insertQuery := `
+		INSERT INTO pipelines (
+			status, repository, branch, ref, ref_type, commit, checkout, trigger, triggered_by, inputs, parent_pipeline_id, parent_job,
+			priority, attempt
+		)
+		SELECT
+			$1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13,
+			(
+				SELECT COALESCE(MAX(a.attempt), 0) + 1
+				FROM pipelines a
+				WHERE a.repository = $2 AND a.ref_type = $5 AND a.ref = $4 AND a.commit = $6 AND a.source_pipeline_id IS NULL
+			)
+		ON CONFLICT (parent_pipeline_id, parent_job) WHERE parent_pipeline_id IS NOT NULL DO NOTHING;
+	`
+
+	selectQuery := `
+		SELECT
+			pipeline_id
+		FROM
+			pipelines
+		WHERE
+			parent_pipeline_id = $1 AND parent_job = $2;
+	`
+
+	tx, err := s.Db.BeginTx(context.Background(), &sql.TxOptions{Isolation: sql.LevelReadCommitted})
+	if err != nil {
+		return 0, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(
+		insertQuery,
+		PIPELINE_STATUS_WAITING,
+		pipeline.Repository,
+		pipeline.Branch,
+		pipeline.Ref,
+		pipeline.RefType,
+		pipeline.Commit,
+		pipeline.Checkout,
+		TRIGGER_UPSTREAM,
+		pipeline.TriggeredBy,
+		pipeline.Inputs,
+		pipeline.ParentPipelineId,
+		pipeline.ParentJob,
+		TriggerPriority(TRIGGER_UPSTREAM),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	var pipelineId int64
+	if err := tx.QueryRow(selectQuery, pipeline.ParentPipelineId, pipeline.ParentJob).Scan(&pipelineId); err != nil {
+		return 0, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	return pipelineId, nil
+}
+
+// GetDownstreamPipeline returns pipeline triggered by job of upstream pipeline.
+func (s *Storage) GetDownstreamPipeline(parentPipelineId int64, parentJob string) (*PipelinesTable, error) {
+	const op = `storage.GetDownstreamPipeline`
+
+	query := `
+		SELECT
+			pipeline_id
+		FROM
+			pipelines
+		WHERE
+			parent_pipeline_id = $1 AND parent_job = $2;
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	var pipelineId int64
+	err := s.Db.QueryRowContext(ctx, query, parentPipelineId, parentJob).Scan(&pipelineId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	return s.GetPipelineInfo(pipelineId)
+}
+
+func (s *Storage) ListDownstreamPipelines(parentPipelineId int64) ([]*PipelinesTable, error) {
+	const op = `storage.ListDownstreamPipelines`
+
+	query := `
+		SELECT
+			pipeline_id,
+			status,
+			repository,
+			branch,
+			ref,
+			ref_type,
+			commit,
+			parent_job,
+			created_at
+		FROM
+			pipelines
+		WHERE
+			parent_pipeline_id = $1
+		ORDER BY
+			created_at ASC;
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	rows, err := s.Db.QueryContext(ctx, query, parentPipelineId)
+	if err != nil {
+		return nil, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+	defer rows.Close()
+
+	pipelines := make([]*PipelinesTable, 0)
+	for rows.Next() {
+		pipeline := &PipelinesTable{ParentPipelineId: parentPipelineId}
+		if err := rows.Scan(
+			&pipeline.PipelineId,
+			&pipeline.Status,
+			&pipeline.Repository,
+			&pipeline.Branch,
+			&pipeline.Ref,
+			&pipeline.RefType,
+			&pipeline.Commit,
+			&pipeline.ParentJob,
+			&pipeline.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("op: %s, err: %w", op, err)
+		}
+		pipelines = append(pipelines, pipeline)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	return pipelines, nil
+}
+
+// WaitForDownstream pauses upstream pipeline until downstream one finishes.
+// Status of already finished downstream pipeline is returned without pausing upstream one.
+func (s *Storage) WaitForDownstream(pipelineId, downstreamPipelineId int64, workspaceVolume string) (string, error) {
+	const op = `storage.WaitForDownstream`
+
+	tx, err := s.Db.BeginTx(context.Background(), &sql.TxOptions{Isolation: sql.LevelReadCommitted})
+	if err != nil {
+		return "", fmt.Errorf("op: %s, err: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	// NOTE: row of downstream pipeline is locked, so it can't finish between the check and the pause
+	selectQuery := `
+		SELECT
+			status
+		FROM
+			pipelines
+		WHERE
+			pipeline_id = $1
+		FOR UPDATE;
+	`
+
+	var status string
+	if err := tx.QueryRow(selectQuery, downstreamPipelineId).Scan(&status); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrNotFound
+		}
+		return "", fmt.Errorf("op: %s, err: %w", op, err)
+	}
+	if IsPipelineFinished(status) {
+		return status, nil
+	}
+
+	updateQuery := `
+		UPDATE pipelines
+		SET status = $1, workspace_volume = $2
+		WHERE pipeline_id = $3;
+	`
+
+	if _, err := tx.Exec(updateQuery, PIPELINE_STATUS_WAITING_FOR_DOWNSTREAM, workspaceVolume, pipelineId); err != nil {
+		return "", fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	return status, nil
+}
+
+// AcquireConcurrencyLock makes pipeline or its job the running member of concurrency group. Pipeline which can't
+// acquire the lock is paused until the lock is released, with cancelInProgress the other members are canceled.
+func (s *Storage) AcquireConcurrencyLock(group string, pipelineId int64, jobName string, cancelInProgress bool, workspaceVolume string) (bool, error) {
+	const op = `storage.AcquireConcurrencyLock`
+
+	tx, err := s.Db.BeginTx(context.Background(), &sql.TxOptions{Isolation: sql.LevelReadCommitted})
+	if err != nil {
+		return false, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	insertQuery := `
+		INSERT INTO concurrency_locks (concurrency_group, pipeline_id, job_name)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (concurrency_group) DO NOTHING;
+	`
+
+	if _, err := tx.Exec(insertQuery, group, pipelineId, jobName); err != nil {
+		return false, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	selectQuery := `
+		SELECT
+			l.pipeline_id,
+			p.status
+		FROM
+			concurrency_locks l
+			JOIN pipelines p ON p.pipeline_id = l.pipeline_id
+		WHERE
+			l.concurrency_group = $1
+		FOR UPDATE OF l;
+	`
+
+	var holderId int64
+	var holderStatus string
+	if err := tx.QueryRow(selectQuery, group).Scan(&holderId, &holderStatus); err != nil {
+		return false, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	// NOTE: lock of pipeline which finished without releasing it, e.g. on crash of worker, is taken over
+	acquired := holderId == pipelineId
+	if !acquired && IsPipelineFinished(holderStatus) {
+		takeOverQuery := `
+			UPDATE concurrency_locks
+			SET pipeline_id = $1, job_name = $2, acquired_at = NOW()
+			WHERE concurrency_group = $3;
+		`
+
+		if _, err := tx.Exec(takeOverQuery, pipelineId, jobName, group); err != nil {
+			return false, fmt.Errorf("op: %s, err: %w", op, err)
+		}
+		acquired = true
+	}
+
+	if cancelInProgress {
+		// waiting members are put back to the queue, so their workers remove workspaces of canceled pipelines
+		cancelQuery := `
+			UPDATE pipelines
+			SET cancel_requested = TRUE,
+				status = CASE WHEN status = $1 THEN $2 ELSE status END
+			WHERE pipeline_id <> $3 AND (
+				pipeline_id = (SELECT pipeline_id FROM concurrency_locks WHERE concurrency_group = $4) OR
+				(concurrency_group = $4 AND status = $1)
+			);
+		`
+
+		if _, err := tx.Exec(cancelQuery, PIPELINE_STATUS_WAITING_FOR_CONCURRENCY, PIPELINE_STATUS_WAITING, pipelineId, group); err != nil {
+			return false, fmt.Errorf("op: %s, err: %w", op, err)
+		}
+	}
+
+	updateQuery := `
+		UPDATE pipelines
+		SET concurrency_group = $1
+		WHERE pipeline_id = $2;
+	`
+	if acquired {
+		if _, err := tx.Exec(updateQuery, "", pipelineId); err != nil {
+			return false, fmt.Errorf("op: %s, err: %w", op, err)
+		}
+	} else {
+		pauseQuery := `
+			UPDATE pipelines
+			SET status = $1, concurrency_group = $2, workspace_volume = $3
+			WHERE pipeline_id = $4;
+		`
+
+		if _, err := tx.Exec(pauseQuery, PIPELINE_STATUS_WAITING_FOR_CONCURRENCY, group, workspaceVolume, pipelineId); err != nil {
+			return false, fmt.Errorf("op: %s, err: %w", op, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	return acquired, nil
+}
+
+// ReleaseConcurrencyLock releases lock of group held by pipeline and puts the oldest waiting member back to the queue.
+func (s *Storage) ReleaseConcurrencyLock(group string, pipelineId int64) error {
+	const op = `storage.ReleaseConcurrencyLock`
+
+	tx, err := s.Db.BeginTx(context.Background(), &sql.TxOptions{Isolation: sql.LevelReadCommitted})
+	if err != nil {
+		return fmt.Errorf("op: %s, err: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	if err := releaseConcurrencyLocks(tx, pipelineId, &group); err != nil {
+		return fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	return nil
+}
+
+// releaseConcurrencyLocks releases locks held by pipeline, only lock of group if it is given.
+func releaseConcurrencyLocks(tx *sql.Tx, pipelineId int64, group *string) error {
+	deleteQuery := `
+		DELETE FROM concurrency_locks
+		WHERE pipeline_id = $1 AND ($2::VARCHAR IS NULL OR concurrency_group = $2)
+		RETURNING concurrency_group;
+	`
+
+	rows, err := tx.Query(deleteQuery, pipelineId, group)
+	if err != nil {
+		return err
+	}
+
+	var groups []string
+	for rows.Next() {
+		var released string
+		if err := rows.Scan(&released); err != nil {
+			rows.Close()
+			return err
+		}
+		groups = append(groups, released)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	resumeQuery := `
+		UPDATE pipelines
+		SET status = $1
+		WHERE pipeline_id = (
+			SELECT pipeline_id
+			FROM pipelines
+			WHERE concurrency_group = $2 AND status = $3
+			ORDER BY pipeline_id ASC
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		);
+	`
+
+	for _, released := range groups {
+		if _, err := tx.Exec(resumeQuery, PIPELINE_STATUS_WAITING, released, PIPELINE_STATUS_WAITING_FOR_CONCURRENCY); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *Storage) IsCancelRequested(pipelineId int64) (bool, error) {
+	const op = `storage.IsCancelRequested`
+
+	query := `
+		SELECT
+			cancel_requested
+		FROM
+			pipelines
+		WHERE
+			pipeline_id = $1;
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	var cancelRequested bool
+	err := s.Db.QueryRowContext(ctx, query, pipelineId).Scan(&cancelRequested)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, ErrNotFound
+		}
+		return false, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	return cancelRequested, nil
+}
+
+func (s *Storage) CreateLog(logTable LogsTable) error {
+	const op = `storage.CreateLog`
+
+	query := `INSERT INTO logs(pipeline_fk_id, command_name, command_number, command, results, final_status) VALUES ($1, $2, $3, $4, $5, $6);`
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	_, err := s.Db.ExecContext(ctx, query, logTable.PipelineId, logTable.CommandName, logTable.CommandNumber, logTable.Command, logTable.Results, logTable.FinalStatus)
+	if err != nil {
+		return fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	return nil
+}
+
+// StartLog creates log of step which is still running, its output is appended to it as it arrives.
+func (s *Storage) StartLog(logTable LogsTable) (int64, error) {
+	const op = `storage.StartLog`
+
+	query := `
+		INSERT INTO logs(pipeline_fk_id, command_name, command_number, command, results, final_status)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING log_id;
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	var logId int64
+	err := s.Db.QueryRowContext(ctx, query, logTable.PipelineId, logTable.CommandName, logTable.CommandNumber, logTable.Command, logTable.Results, LOG_STATUS_RUNNING).Scan(&logId)
+	if err != nil {
+		return 0, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	return logId, nil
+}
+
+// AppendLog appends output to log of pipeline and sets its status, ErrNotFound is returned for log of another pipeline.
+func (s *Storage) AppendLog(pipelineId, logId int64, results, finalStatus string) error {
+	const op = `storage.AppendLog`
+
+	query := `UPDATE logs SET results = results || $3, final_status = $4 WHERE log_id = $1 AND pipeline_fk_id = $2;`
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	res, err := s.Db.ExecContext(ctx, query, logId, pipelineId, results, finalStatus)
+	if err != nil {
+		return fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("op: %s, err: %w", op, err)
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *Storage) SaveRepositoryCredentials(credentials CredentialsTable) error {
+	const op = `storage.SaveRepositoryCredentials`
+
+	query := `
+		INSERT INTO repository_credentials (repository, kind, secret, updated_at)
+		VALUES ($1, $2, $3, NOW())
+		ON CONFLICT (repository) DO UPDATE
+		SET kind = EXCLUDED.kind, secret = EXCLUDED.secret, updated_at = EXCLUDED.updated_at;
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	_, err := s.Db.ExecContext(ctx, query, credentials.Repository, credentials.Kind, credentials.Secret)
+	if err != nil {
+		return fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) GetRepositoryCredentials(repository string) (*CredentialsTable, error) {
+	const op = `storage.GetRepositoryCredentials`
+
+	query := `
+		SELECT
+			repository,
+			kind,
+			secret,
+			updated_at
+		FROM
+			repository_credentials
+		WHERE
+			repository = $1;
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	var credentials CredentialsTable
+	err := s.Db.QueryRowContext(ctx, query, repository).Scan(
+		&credentials.Repository,
+		&credentials.Kind,
+		&credentials.Secret,
+		&credentials.UpdatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	return &credentials, nil
+}
+
+func (s *Storage) DeleteRepositoryCredentials(repository string) error {
+	const op = `storage.DeleteRepositoryCredentials`
+
+	query := `DELETE FROM repository_credentials WHERE repository = $1;`
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	res, err := s.Db.ExecContext(ctx, query, repository)
+	if err != nil {
+		return fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("op: %s, err: %w", op, err)
+	}
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *Storage) SaveRegistryCredentials(credentials RegistryCredentialsTable) error {
+	const op = `storage.SaveRegistryCredentials`
+
+	query := `
+		INSERT INTO registry_credentials (repository, registry, secret, updated_at)
+		VALUES ($1, $2, $3, NOW())
+		ON CONFLICT (repository, registry) DO UPDATE
+		SET secret = EXCLUDED.secret, updated_at = EXCLUDED.updated_at;
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	_, err := s.Db.ExecContext(ctx, query, credentials.Repository, credentials.Registry, credentials.Secret)
+	if err != nil {
+		return fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) GetRegistryCredentials(repository, registry string) (*RegistryCredentialsTable, error) {
+	const op = `storage.GetRegistryCredentials`
+
+	query := `
+		SELECT
+			repository,
+			registry,
+			secret,
+			updated_at
+		FROM
+			registry_credentials
+		WHERE
+			repository = $1 AND registry = $2;
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	var credentials RegistryCredentialsTable
+	err := s.Db.QueryRowContext(ctx, query, repository, registry).Scan(
+		&credentials.Repository,
+		&credentials.Registry,
+		&credentials.Secret,
+		&credentials.UpdatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	return &credentials, nil
+}
+
+func (s *Storage) DeleteRegistryCredentials(repository, registry string) error {
+	const op = `storage.DeleteRegistryCredentials`
+
+	query := `DELETE FROM registry_credentials WHERE repository = $1 AND registry = $2;`
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	res, err := s.Db.ExecContext(ctx, query, repository, registry)
+	if err != nil {
+		return fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("op: %s, err: %w", op, err)
+	}
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *Storage) SaveRepositorySettings(settings RepositorySettingsTable) error {
+	const op = `storage.SaveRepositorySettings`
+
+	query := `
+		INSERT INTO repository_settings (repository, ci_config_path, max_concurrent_pipelines, auto_cancel, auto_cancel_running, updated_at)
+		VALUES ($1, $2, $3, $4, $5, NOW())
+		ON CONFLICT (repository) DO UPDATE
+		SET ci_config_path = EXCLUDED.ci_config_path, max_concurrent_pipelines = EXCLUDED.max_concurrent_pipelines,
+			auto_cancel = EXCLUDED.auto_cancel, auto_cancel_running = EXCLUDED.auto_cancel_running,
+			updated_at = EXCLUDED.updated_at;
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	_, err := s.Db.ExecContext(ctx, query, settings.Repository, settings.CiConfigPath, settings.MaxConcurrentPipelines,
+		settings.AutoCancel, settings.AutoCancelRunning)
+	if err != nil {
+		return fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) GetRepositorySettings(repository string) (*RepositorySettingsTable, error) {
+	const op = `storage.GetRepositorySettings`
+
+	query := `
+		SELECT
+			repository,
+			ci_config_path,
+			max_concurrent_pipelines,
+			auto_cancel,
+			auto_cancel_running,
+			updated_at
+		FROM
+			repository_settings
+		WHERE
+			repository = $1;
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	var settings RepositorySettingsTable
+	err := s.Db.QueryRowContext(ctx, query, repository).Scan(
+		&settings.Repository,
+		&settings.CiConfigPath,
+		&settings.MaxConcurrentPipelines,
+		&settings.AutoCancel,
+		&settings.AutoCancelRunning,
+		&settings.UpdatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	return &settings, nil
+}
+
+// RequeuePipeline puts running pipeline interrupted by shutdown back to the queue, it is resumed from workspace volume
+// if it is given. Logs of interrupted job are removed, so the job runs once more from its first step.
+func (s *Storage) RequeuePipeline(pipelineId int64, workspaceVolume, interruptedJob string) (bool, error) {
+	const op = `storage.RequeuePipeline`
+
+	tx, err := s.Db.BeginTx(context.Background(), &sql.TxOptions{Isolation: sql.LevelReadCommitted})
+	if err != nil {
+		return false, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	// NOTE: pipeline which was paused or finished before it was interrupted keeps its status
+	updateQuery := `
+		UPDATE pipelines
+		SET status = $1, workspace_volume = $2
+		WHERE pipeline_id = $3 AND status = $4;
+	`
+
+	res, err := tx.Exec(updateQuery, PIPELINE_STATUS_WAITING, workspaceVolume, pipelineId, PIPELINE_STATUS_RUNNING)
+	if err != nil {
+		return false, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+	if rowsAffected == 0 {
+		return false, nil
+	}
+
+	if interruptedJob != "" {
+		deleteQuery := `
+			DELETE FROM logs
+			WHERE pipeline_fk_id = $1 AND LEFT(command_name, LENGTH($2) + 1) = $2 || ':';
+		`
+
+		if _, err := tx.Exec(deleteQuery, pipelineId, interruptedJob); err != nil {
+			return false, fmt.Errorf("op: %s, err: %w", op, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	return true, nil
+}
+
+// SupersedePipelines marks waiting pipelines of older commits of the same branch as superseded and returns their ids.
+// With cancelRunning pipelines which already started are canceled too, paused ones are put back to the queue,
+// so their workers remove workspaces. Pipelines triggered by upstream ones are left to them.
+func (s *Storage) SupersedePipelines(pipelineId int64, cancelRunning bool) ([]int64, error) {
+	const op = `storage.SupersedePipelines`
+
+	tx, err := s.Db.BeginTx(context.Background(), &sql.TxOptions{Isolation: sql.LevelReadCommitted})
+	if err != nil {
+		return nil, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	supersedeQuery := `
+		UPDATE pipelines o
+		SET status = $1, finished_at = NOW()
+		FROM pipelines n
+		WHERE
+			n.pipeline_id = $2 AND o.pipeline_id < n.pipeline_id AND
+			o.repository = n.repository AND o.ref_type = $3 AND n.ref_type = $3 AND o.ref = n.ref AND o.commit <> n.commit AND
+			o.parent_pipeline_id IS NULL AND o.status IN ($4, $5) AND o.workspace_volume = ''
+		RETURNING o.pipeline_id;
+	`
+
+	rows, err := tx.Query(
+		supersedeQuery,
+		PIPELINE_STATUS_SUPERSEDED,
+		pipelineId,
+		vcs.REF_TYPE_BRANCH,
+		PIPELINE_STATUS_WAITING,
+		PIPELINE_STATUS_WAITING_FOR_RUNNER,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	superseded := make([]int64, 0)
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("op: %s, err: %w", op, err)
+		}
+		superseded = append(superseded, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	if cancelRunning {
+		cancelQuery := `
+			UPDATE pipelines o
+			SET cancel_requested = TRUE,
+				status = CASE WHEN o.status = $4 THEN o.status ELSE $5 END
+			FROM pipelines n
+			WHERE
+				n.pipeline_id = $1 AND o.pipeline_id < n.pipeline_id AND
+				o.repository = n.repository AND o.ref_type = $2 AND n.ref_type = $2 AND o.ref = n.ref AND o.commit <> n.commit AND
+				o.parent_pipeline_id IS NULL AND (
+					o.status IN ($3, $4, $6, $7) OR (o.status = $5 AND o.workspace_volume <> '')
+				);
+		`
+
+		_, err := tx.Exec(
+			cancelQuery,
+			pipelineId,
+			vcs.REF_TYPE_BRANCH,
+			PIPELINE_STATUS_WAITING_FOR_APPROVAL,
+			PIPELINE_STATUS_RUNNING,
+			PIPELINE_STATUS_WAITING,
+			PIPELINE_STATUS_WAITING_FOR_DOWNSTREAM,
+			PIPELINE_STATUS_WAITING_FOR_CONCURRENCY,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("op: %s, err: %w", op, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	return superseded, nil
+}
+
+// RequestApproval creates pending approval of job and pauses pipeline until it is decided.
+// Status of already decided approval is returned without pausing pipeline.
+func (s *Storage) RequestApproval(pipelineId int64, jobName, workspaceVolume string) (string, error) {
+	const op = `storage.RequestApproval`
+
+	tx, err := s.Db.BeginTx(context.Background(), &sql.TxOptions{Isolation: sql.LevelReadCommitted})
+	if err != nil {
+		return "", fmt.Errorf("op: %s, err: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	insertQuery := `
+		INSERT INTO approvals (pipeline_id, job_name, status)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (pipeline_id, job_name) DO NOTHING;
+	`
+
+	if _, err := tx.Exec(insertQuery, pipelineId, jobName, APPROVAL_STATUS_PENDING); err != nil {
+		return "", fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	selectQuery := `
+		SELECT
+			status
+		FROM
+			approvals
+		WHERE
+			pipeline_id = $1 AND job_name = $2
+		FOR UPDATE;
+	`
+
+	var status string
+	if err := tx.QueryRow(selectQuery, pipelineId, jobName).Scan(&status); err != nil {
+		return "", fmt.Errorf("op: %s, err: %w", op, err)
+	}
+	if status != APPROVAL_STATUS_PENDING {
+		return status, nil
+	}
+
+	updateQuery := `
+		UPDATE pipelines
+		SET status = $1, workspace_volume = $2
+		WHERE pipeline_id = $3;
+	`
+
+	if _, err := tx.Exec(updateQuery, PIPELINE_STATUS_WAITING_FOR_APPROVAL, workspaceVolume, pipelineId); err != nil {
+		return "", fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	return status, nil
+}
+
+// DecideApproval approves or rejects pending approval and puts paused pipeline back to the queue.
+func (s *Storage) DecideApproval(pipelineId int64, jobName, status, decidedBy string) error {
+	const op = `storage.DecideApproval`
+
+	tx, err := s.Db.BeginTx(context.Background(), &sql.TxOptions{Isolation: sql.LevelReadCommitted})
+	if err != nil {
+		return fmt.Errorf("op: %s, err: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	selectQuery := `
+		SELECT
+			status
+		FROM
+			approvals
+		WHERE
+			pipeline_id = $1 AND job_name = $2
+		FOR UPDATE;
+	`
+
+	var current string
+	err = tx.QueryRow(selectQuery, pipelineId, jobName).Scan(&current)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNotFound
+		}
+		return fmt.Errorf("op: %s, err: %w", op, err)
+	}
+	if current != APPROVAL_STATUS_PENDING {
+		return ErrApprovalDecided
+	}
+
+	updateApprovalQuery := `
+		UPDATE approvals
+		SET status = $1, decided_by = $2, decided_at = NOW()
+		WHERE pipeline_id = $3 AND job_name = $4;
+	`
+
+	if _, err := tx.Exec(updateApprovalQuery, status, decidedBy, pipelineId, jobName); err != nil {
+		return fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	// NOTE: rejected pipelines are resumed too, so the worker removes their workspace
+	updatePipelineQuery := `
+		UPDATE pipelines
+		SET status = $1
+		WHERE pipeline_id = $2 AND status = $3;
+	`
+
+	if _, err := tx.Exec(updatePipelineQuery, PIPELINE_STATUS_WAITING, pipelineId, PIPELINE_STATUS_WAITING_FOR_APPROVAL); err != nil {
+		return fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) ListApprovals(pipelineId int64) ([]*ApprovalsTable, error) {
+	const op = `storage.ListApprovals`
+
+	query := `
+		SELECT
+			approval_id,
+			pipeline_id,
+			job_name,
+			status,
+			decided_by,
+			decided_at,
+			created_at
+		FROM
+			approvals
+		WHERE
+			pipeline_id = $1
+		ORDER BY
+			created_at ASC;
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	rows, err := s.Db.QueryContext(ctx, query, pipelineId)
+	if err != nil {
+		return nil, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+	defer rows.Close()
+
+	approvals := make([]*ApprovalsTable, 0)
+	for rows.Next() {
+		var approval ApprovalsTable
+		if err := rows.Scan(
+			&approval.ApprovalId,
+			&approval.PipelineId,
+			&approval.JobName,
+			&approval.Status,
+			&approval.DecidedBy,
+			&approval.DecidedAt,
+			&approval.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("op: %s, err: %w", op, err)
+		}
+		approvals = append(approvals, &approval)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	return approvals, nil
+}
+
+func (s *Storage) CreateSchedule(schedule SchedulesTable) (*SchedulesTable, error) {
+	const op = `storage.CreateSchedule`
+
+	query := `
+		INSERT INTO schedules (repository, branch, cron_expression, timezone, enabled, next_run_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING schedule_id, created_at, updated_at;
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	err := s.Db.QueryRowContext(
+		ctx,
+		query,
+		schedule.Repository,
+		schedule.Branch,
+		schedule.CronExpression,
+		schedule.Timezone,
+		schedule.Enabled,
+		schedule.NextRunAt,
+	).Scan(&schedule.ScheduleId, &schedule.CreatedAt, &schedule.UpdatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	return &schedule, nil
+}
+
+func (s *Storage) UpdateSchedule(schedule SchedulesTable) (*SchedulesTable, error) {
+	const op = `storage.UpdateSchedule`
+
+	query := `
+		UPDATE schedules
+		SET repository = $1, branch = $2, cron_expression = $3, timezone = $4, enabled = $5, next_run_at = $6, updated_at = NOW()
+		WHERE schedule_id = $7
+		RETURNING last_run_at, created_at, updated_at;
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	err := s.Db.QueryRowContext(
+		ctx,
+		query,
+		schedule.Repository,
+		schedule.Branch,
+		schedule.CronExpression,
+		schedule.Timezone,
+		schedule.Enabled,
+		schedule.NextRunAt,
+		schedule.ScheduleId,
+	).Scan(&schedule.LastRunAt, &schedule.CreatedAt, &schedule.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	return &schedule, nil
+}
+
+func (s *Storage) GetSchedule(id int64) (*SchedulesTable, error) {
+	const op = `storage.GetSchedule`
+
+	query := `
+		SELECT
+			schedule_id,
+			repository,
+			branch,
+			cron_expression,
+			timezone,
+			enabled,
+			next_run_at,
+			last_run_at,
+			created_at,
+			updated_at
+		FROM
+			schedules
+		WHERE
+			schedule_id = $1;
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	schedule, err := scanSchedule(s.Db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	return schedule, nil
+}
+
+// ListSchedules returns schedules of repository, all of them for empty repository.
+func (s *Storage) ListSchedules(repository string) ([]*SchedulesTable, error) {
+	const op = `storage.ListSchedules`
+
+	query := `
+		SELECT
+			schedule_id,
+			repository,
+			branch,
+			cron_expression,
+			timezone,
+			enabled,
+			next_run_at,
+			last_run_at,
+			created_at,
+			updated_at
+		FROM
+			schedules
+		WHERE
+			$1 = '' OR repository = $1
+		ORDER BY
+			schedule_id ASC;
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	rows, err := s.Db.QueryContext(ctx, query, repository)
+	if err != nil {
+		return nil, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+	defer rows.Close()
+
+	return scanSchedules(rows, op)
+}
+
+// ListDueSchedules returns enabled schedules which next run is not later than now.
+func (s *Storage) ListDueSchedules(now time.Time) ([]*SchedulesTable, error) {
+	const op = `storage.ListDueSchedules`
+
+	query := `
+		SELECT
+			schedule_id,
+			repository,
+			branch,
+			cron_expression,
+			timezone,
+			enabled,
+			next_run_at,
+			last_run_at,
+			created_at,
+			updated_at
+		FROM
+			schedules
+		WHERE
+			enabled AND next_run_at <= $1
+		ORDER BY
+			next_run_at ASC;
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	rows, err := s.Db.QueryContext(ctx, query, now)
+	if err != nil {
+		return nil, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+	defer rows.Close()
+
+	return scanSchedules(rows, op)
+}
+
+// ClaimScheduleRun moves next run of schedule only if nobody moved it since it was read,
+// so the run is fired by only one of replicas.
+func (s *Storage) ClaimScheduleRun(id int64, nextRunAt, newNextRunAt time.Time) (bool, error) {
+	const op = `storage.ClaimScheduleRun`
+
+	query := `
+		UPDATE schedules
+		SET next_run_at = $1, last_run_at = NOW()
+		WHERE schedule_id = $2 AND enabled AND next_run_at = $3;
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	res, err := s.Db.ExecContext(ctx, query, newNextRunAt, id, nextRunAt)
+	if err != nil {
+		return false, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	return rowsAffected == 1, nil
+}
+
+func (s *Storage) DeleteSchedule(id int64) error {
+	const op = `storage.DeleteSchedule`
+
+	query := `DELETE FROM schedules WHERE schedule_id = $1;`
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	res, err := s.Db.ExecContext(ctx, query, id)
+	if err != nil {
+		return fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("op: %s, err: %w", op, err)
+	}
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanSchedule(row scanner) (*SchedulesTable, error) {
+	var schedule SchedulesTable
+	err := row.Scan(
+		&schedule.ScheduleId,
+		&schedule.Repository,
+		&schedule.Branch,
+		&schedule.CronExpression,
+		&schedule.Timezone,
+		&schedule.Enabled,
+		&schedule.NextRunAt,
+		&schedule.LastRunAt,
+		&schedule.CreatedAt,
+		&schedule.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &schedule, nil
+}
+
+func scanSchedules(rows *sql.Rows, op string) ([]*SchedulesTable, error) {
+	schedules := make([]*SchedulesTable, 0)
+	for rows.Next() {
+		schedule, err := scanSchedule(rows)
+		if err != nil {
+			return nil, fmt.Errorf("op: %s, err: %w", op, err)
+		}
+		schedules = append(schedules, schedule)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	return schedules, nil
+}
+
+func (s *Storage) CreateRunner(name, tokenHash string, labels []string) (int64, error) {
+	const op = `storage.CreateRunner`
+
+	if labels == nil {
+		labels = []string{}
+	}
+
+	query := `INSERT INTO runners(name, token_hash, labels) VALUES ($1, $2, $3) RETURNING runner_id;`
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	var runnerId int64
+	if err := s.Db.QueryRowContext(ctx, query, name, tokenHash, pq.Array(labels)).Scan(&runnerId); err != nil {
+		return 0, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	return runnerId, nil
+}
+
+func (s *Storage) GetRunnerByTokenHash(tokenHash string) (*RunnersTable, error) {
+	const op = `storage.GetRunnerByTokenHash`
+
+	query := `
+		SELECT
+			runner_id,
+			name,
+			labels,
+			last_heartbeat_at,
+			created_at
+		FROM
+			runners
+		WHERE
+			token_hash = $1;
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	runner, err := scanRunner(s.Db.QueryRowContext(ctx, query, tokenHash))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	return runner, nil
+}
+
+func (s *Storage) GetRunner(runnerId int64) (*RunnersTable, error) {
+	const op = `storage.GetRunner`
+
+	query := `
+		SELECT
+			runner_id,
+			name,
+			labels,
+			last_heartbeat_at,
+			created_at
+		FROM
+			runners
+		WHERE
+			runner_id = $1;
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	runner, err := scanRunner(s.Db.QueryRowContext(ctx, query, runnerId))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	return runner, nil
+}
+
+func scanRunner(row *sql.Row) (*RunnersTable, error) {
+	var runner RunnersTable
+	err := row.Scan(&runner.RunnerId, &runner.Name, pq.Array(&runner.Labels), &runner.LastHeartbeatAt, &runner.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &runner, nil
+}
+
+func (s *Storage) UpdateRunnerHeartbeat(runnerId int64) error {
+	const op = `storage.UpdateRunnerHeartbeat`
+
+	query := `UPDATE runners SET last_heartbeat_at = NOW() WHERE runner_id = $1;`
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	res, err := s.Db.ExecContext(ctx, query, runnerId)
+	if err != nil {
+		return fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("op: %s, err: %w", op, err)
+	}
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// IsPipelineAssigned reports whether pipeline was claimed by runner last.
+func (s *Storage) IsPipelineAssigned(pipelineId, runnerId int64) (bool, error) {
+	const op = `storage.IsPipelineAssigned`
+
+	query := `SELECT COALESCE(runner_id, 0) = $2 FROM pipelines WHERE pipeline_id = $1;`
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	var assigned bool
+	err := s.Db.QueryRowContext(ctx, query, pipelineId, runnerId).Scan(&assigned)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, ErrNotFound
+		}
+		return false, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	return assigned, nil
+}
+
+// AcknowledgePipeline marks pipeline claimed by runner as got by it, acknowledged pipeline isn't requeued while
+// runner sends its heartbeats.
+func (s *Storage) AcknowledgePipeline(pipelineId, runnerId int64) error {
+	const op = `storage.AcknowledgePipeline`
+
+	query := `
+		UPDATE pipelines
+		SET acknowledged_at = NOW()
+		WHERE pipeline_id = $1 AND runner_id = $2 AND acknowledged_at IS NULL;
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if _, err := s.Db.ExecContext(ctx, query, pipelineId, runnerId); err != nil {
+		return fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	return nil
+}
+
+// RequeueLostPipelines puts pipelines of runners which missed heartbeats for timeout back to the queue and returns
+// their ids. Workspaces of such pipelines are lost with runner, so they run once more from the start, paused ones
+// keep their status and run from the start once they are resumed. Running pipeline which runner didn't acknowledge
+// for ack timeout since it was claimed is requeued too, response which gave it to runner was lost.
+func (s *Storage) RequeueLostPipelines(heartbeatTimeout, ackTimeout time.Duration) ([]int64, error) {
+	const op = `storage.RequeueLostPipelines`
+
+	query := `
+		WITH lost AS (
+			SELECT
+				p.pipeline_id
+			FROM
+				pipelines p
+				JOIN runners r ON r.runner_id = p.runner_id
+			WHERE
+				(
+					r.last_heartbeat_at < NOW() - make_interval(secs => $1) AND (
+						p.status = $2 OR (p.workspace_volume <> '' AND p.status IN ($3, $4, $5, $6))
+					)
+				) OR (
+					p.status = $2 AND p.acknowledged_at IS NULL AND p.started_at < NOW() - make_interval(secs => $7)
+				)
+			FOR UPDATE OF p SKIP LOCKED
+		),
+		requeued AS (
+			UPDATE pipelines
+			SET
+				status = CASE WHEN status = $2 THEN $3 ELSE status END,
+				workspace_volume = '',
+				runner_id = NULL
+			WHERE pipeline_id IN (SELECT pipeline_id FROM lost)
+			RETURNING pipeline_id
+		),
+		deleted_logs AS (
+			DELETE FROM logs WHERE pipeline_fk_id IN (SELECT pipeline_id FROM requeued)
+		)
+		SELECT pipeline_id FROM requeued ORDER BY pipeline_id;
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := s.Db.QueryContext(
+		ctx,
+		query,
+		heartbeatTimeout.Seconds(),
+		PIPELINE_STATUS_RUNNING,
+		PIPELINE_STATUS_WAITING,
+		PIPELINE_STATUS_WAITING_FOR_APPROVAL,
+		PIPELINE_STATUS_WAITING_FOR_DOWNSTREAM,
+		PIPELINE_STATUS_WAITING_FOR_CONCURRENCY,
+		ackTimeout.Seconds(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+	defer rows.Close()
+
+	requeued := make([]int64, 0)
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("op: %s, err: %w", op, err)
+		}
+		requeued = append(requeued, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	return requeued, nil
+}
+
+// HandOffPipeline puts pipeline which can't run on its runner back to the queue for runners with labels it runs on,
+// pipeline is checked out once more by such runner. False is returned when pipeline isn't running anymore.
+func (s *Storage) HandOffPipeline(pipelineId int64, runsOn []string) (bool, error) {
+	const op = `storage.HandOffPipeline`
+
+	if runsOn == nil {
+		runsOn = []string{}
+	}
+
+	query := `
+		UPDATE pipelines
+		SET status = $1, runs_on = $2, workspace_volume = '', runner_id = NULL
+		WHERE pipeline_id = $3 AND status = $4;
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	res, err := s.Db.ExecContext(ctx, query, PIPELINE_STATUS_WAITING, pq.Array(runsOn), pipelineId, PIPELINE_STATUS_RUNNING)
+	if err != nil {
+		return false, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	return rowsAffected > 0, nil
+}
+
+// UpdateWaitingForRunner marks waiting pipelines which no online runner can claim as waiting for runner and puts
+// them back to waiting once such runner is online. Runner is online while its heartbeats are within timeout, workers
+// of server are online with local labels unless they are nil.
+// NOTE: status is only shown to users, pipelines of both statuses are claimed by runners with matching labels
+func (s *Storage) UpdateWaitingForRunner(heartbeatTimeout time.Duration, localLabels []string) error {
+	const op = `storage.UpdateWaitingForRunner`
+
+	query := `
+		UPDATE pipelines p
+		SET status = CASE WHEN m.matched THEN $1 ELSE $2 END
+		FROM (
+			SELECT
+				q.pipeline_id,
+				COALESCE(q.runs_on <@ $3, FALSE) OR EXISTS (
+					SELECT 1
+					FROM runners r
+					WHERE r.last_heartbeat_at >= NOW() - make_interval(secs => $4) AND q.runs_on <@ r.labels
+				) AS matched
+			FROM
+				pipelines q
+			WHERE
+				q.status IN ($1, $2) AND q.workspace_volume = ''
+		) m
+		WHERE
+			p.pipeline_id = m.pipeline_id AND p.status IN ($1, $2) AND
+			p.status <> CASE WHEN m.matched THEN $1 ELSE $2 END;
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := s.Db.ExecContext(
+		ctx,
+		query,
+		PIPELINE_STATUS_WAITING,
+		PIPELINE_STATUS_WAITING_FOR_RUNNER,
+		pq.Array(localLabels),
+		heartbeatTimeout.Seconds(),
+	)
 	if err != nil {
 		return fmt.Errorf("op: %s, err: %w", op, err)
 	}
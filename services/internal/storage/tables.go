@@ -3,12 +3,49 @@ package storage
 import "time"
 
 type PipelinesTable struct {
-	PipelineId int64
-	Status     string
+	PipelineId       int64
+	Status           string
+	Repository       string
+	Branch           string
+	Ref              string
+	RefType          string
+	Commit           string
+	Attempt          int
+	RerunOf          int64
+	FailedOnly       bool
+	Checkout         string
+	ConfigFile       string
+	Diagnostics      string
+	Config           string
+	WorkspaceVolume  string
+	Trigger          string
+	TriggeredBy      string
+	Inputs           string
+	ParentPipelineId int64
+	ParentJob        string
+	Priority         int
+	RunnerId         int64
+	RunsOn           []string
+	CreatedAt        time.Time
+}
+
+type PipelinesFilter struct {
 	Repository string
-	Branch     string
-	Commit     string
-	CreatedAt  time.Time
+	RefType    string
+	Status     string
+	Limit      int
+}
+
+type QueueTable struct {
+	PipelineId      int64
+	Status          string
+	Repository      string
+	Ref             string
+	Trigger         string
+	Priority        int
+	StartedAt       *time.Time
+	AverageDuration time.Duration
+	CreatedAt       time.Time
 }
 
 type LogsTable struct {
@@ -20,3 +57,58 @@ type LogsTable struct {
 	FinalStatus   string
 	PipelineId    int64
 }
+
+type RunnersTable struct {
+	RunnerId        int64
+	Name            string
+	Labels          []string
+	LastHeartbeatAt time.Time
+	CreatedAt       time.Time
+}
+
+type CredentialsTable struct {
+	Repository string
+	Kind       string
+	Secret     []byte
+	UpdatedAt  time.Time
+}
+
+// NOTE: registry credentials belong to repository, so pipelines of other repositories can't push with them
+type RegistryCredentialsTable struct {
+	Repository string
+	Registry   string
+	Secret     []byte
+	UpdatedAt  time.Time
+}
+
+type RepositorySettingsTable struct {
+	Repository             string
+	CiConfigPath           string
+	MaxConcurrentPipelines int
+	AutoCancel             bool
+	AutoCancelRunning      bool
+	UpdatedAt              time.Time
+}
+
+type ApprovalsTable struct {
+	ApprovalId int64
+	PipelineId int64
+	JobName    string
+	Status     string
+	DecidedBy  string
+	DecidedAt  *time.Time
+	CreatedAt  time.Time
+}
+
+type SchedulesTable struct {
+	ScheduleId     int64
+	Repository     string
+	Branch         string
+	CronExpression string
+	Timezone       string
+	Enabled        bool
+	NextRunAt      *time.Time
+	LastRunAt      *time.Time
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
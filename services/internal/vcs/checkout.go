@@ -0,0 +1,99 @@
+package vcs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+const (
+	SUBMODULES_DISABLED  Submodules = "false"
+	SUBMODULES_ENABLED   Submodules = "true"
+	SUBMODULES_RECURSIVE Submodules = "recursive"
+)
+
+var ErrInvalidCheckout = errors.New("invalid checkout options")
+
+// Submodules accepts both boolean and "recursive" values.
+type Submodules string
+
+func (s *Submodules) UnmarshalJSON(data []byte) error {
+	var enabled bool
+	if err := json.Unmarshal(data, &enabled); err == nil {
+		*s = SUBMODULES_DISABLED
+		if enabled {
+			*s = SUBMODULES_ENABLED
+		}
+		return nil
+	}
+
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	*s = Submodules(value)
+	return nil
+}
+
+// CheckoutOptions fields left empty are inherited, depth 0 means full history.
+type CheckoutOptions struct {
+	Depth      *int       `json:"depth,omitempty" yaml:"depth,omitempty"`
+	Submodules Submodules `json:"submodules,omitempty" yaml:"submodules,omitempty"`
+	LFS        *bool      `json:"lfs,omitempty" yaml:"lfs,omitempty"`
+	FetchTags  *bool      `json:"fetch_tags,omitempty" yaml:"fetch-tags,omitempty"`
+}
+
+func (o CheckoutOptions) Validate() error {
+	if o.Depth != nil && *o.Depth < 0 {
+		return fmt.Errorf("%w: depth can't be negative", ErrInvalidCheckout)
+	}
+
+	switch o.Submodules {
+	case "", SUBMODULES_DISABLED, SUBMODULES_ENABLED, SUBMODULES_RECURSIVE:
+	default:
+		return fmt.Errorf("%w: submodules has to be true, false or recursive", ErrInvalidCheckout)
+	}
+
+	return nil
+}
+
+// Merge returns options where fields set in override win over o.
+func (o CheckoutOptions) Merge(override CheckoutOptions) CheckoutOptions {
+	if override.Depth != nil {
+		o.Depth = override.Depth
+	}
+	if override.Submodules != "" {
+		o.Submodules = override.Submodules
+	}
+	if override.LFS != nil {
+		o.LFS = override.LFS
+	}
+	if override.FetchTags != nil {
+		o.FetchTags = override.FetchTags
+	}
+	return o
+}
+
+func (o CheckoutOptions) GetDepth() int {
+	if o.Depth == nil {
+		return 0
+	}
+	return *o.Depth
+}
+
+func (o CheckoutOptions) GetLFS() bool {
+	return o.LFS != nil && *o.LFS
+}
+
+func (o CheckoutOptions) GetFetchTags() bool {
+	return o.FetchTags != nil && *o.FetchTags
+}
+
+func (Submodules) JSONSchema() map[string]any {
+	return map[string]any{
+		"oneOf": []any{
+			map[string]any{"type": "boolean"},
+			map[string]any{"enum": []string{string(SUBMODULES_DISABLED), string(SUBMODULES_ENABLED), string(SUBMODULES_RECURSIVE)}},
+		},
+	}
+}
@@ -0,0 +1,146 @@
+package vcs
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	CREDENTIALS_KIND_SSH   = "ssh"
+	CREDENTIALS_KIND_HTTPS = "https"
+
+	SSH_KEY_FILE         = "id_key"
+	KNOWN_HOSTS_FILE     = "known_hosts"
+	GIT_CREDENTIALS_FILE = "git-credentials"
+
+	DEFAULT_HTTPS_USERNAME = "git"
+)
+
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+type Credentials struct {
+	Kind          string `json:"kind"`
+	SSHPrivateKey string `json:"ssh_private_key,omitempty"`
+	KnownHosts    string `json:"known_hosts,omitempty"`
+	Username      string `json:"username,omitempty"`
+	Token         string `json:"token,omitempty"`
+}
+
+type CredentialsProvider interface {
+	Get(repository string) (*Credentials, error)
+}
+
+// ScopedCredentials give credentials only of repository they are scoped to and of trusted repositories, others are
+// read anonymously, so ci config of one repository can't read private repositories of another one.
+type ScopedCredentials struct {
+	Provider   CredentialsProvider
+	Repository string
+	Trusted    func(repository string) bool
+}
+
+func (c ScopedCredentials) Get(repository string) (*Credentials, error) {
+	if c.Provider == nil {
+		return nil, nil
+	}
+	if repository != c.Repository && (c.Trusted == nil || !c.Trusted(repository)) {
+		return nil, nil
+	}
+	return c.Provider.Get(repository)
+}
+
+func (c *Credentials) Validate() error {
+	switch c.Kind {
+	case CREDENTIALS_KIND_SSH:
+		if c.SSHPrivateKey == "" || c.KnownHosts == "" {
+			return fmt.Errorf("%w: ssh credentials require ssh_private_key and known_hosts", ErrInvalidCredentials)
+		}
+	case CREDENTIALS_KIND_HTTPS:
+		if c.Token == "" {
+			return fmt.Errorf("%w: https credentials require token", ErrInvalidCredentials)
+		}
+	default:
+		return fmt.Errorf("%w: unknown kind %q", ErrInvalidCredentials, c.Kind)
+	}
+
+	return nil
+}
+
+// Files returns credential files by their names, they have to be placed into one directory passed to Env.
+func (c *Credentials) Files(repository string) (map[string][]byte, error) {
+	switch c.Kind {
+	case CREDENTIALS_KIND_SSH:
+		return map[string][]byte{
+			SSH_KEY_FILE:     []byte(withTrailingNewline(c.SSHPrivateKey)),
+			KNOWN_HOSTS_FILE: []byte(withTrailingNewline(c.KnownHosts)),
+		}, nil
+	case CREDENTIALS_KIND_HTTPS:
+		repositoryUrl, err := url.Parse(repository)
+		if err != nil || repositoryUrl.Host == "" {
+			return nil, fmt.Errorf("%w: repository url is not https", ErrInvalidCredentials)
+		}
+
+		username := c.Username
+		if username == "" {
+			username = DEFAULT_HTTPS_USERNAME
+		}
+
+		credentialsUrl := url.URL{
+			Scheme: repositoryUrl.Scheme,
+			User:   url.UserPassword(username, c.Token),
+			Host:   repositoryUrl.Host,
+		}
+		return map[string][]byte{
+			GIT_CREDENTIALS_FILE: []byte(credentialsUrl.String() + "\n"),
+		}, nil
+	}
+
+	return nil, fmt.Errorf("%w: unknown kind %q", ErrInvalidCredentials, c.Kind)
+}
+
+// Env points git to credential files in dir, secrets themselves never appear in arguments or environment.
+func (c *Credentials) Env(dir string) []string {
+	switch c.Kind {
+	case CREDENTIALS_KIND_SSH:
+		sshCommand := fmt.Sprintf(
+			"ssh -i %s -o IdentitiesOnly=yes -o UserKnownHostsFile=%s -o StrictHostKeyChecking=yes",
+			filepath.Join(dir, SSH_KEY_FILE),
+			filepath.Join(dir, KNOWN_HOSTS_FILE),
+		)
+		return []string{"GIT_SSH_COMMAND=" + sshCommand}
+	case CREDENTIALS_KIND_HTTPS:
+		return []string{
+			"GIT_CONFIG_COUNT=1",
+			"GIT_CONFIG_KEY_0=credential.helper",
+			"GIT_CONFIG_VALUE_0=store --file=" + filepath.Join(dir, GIT_CREDENTIALS_FILE),
+		}
+	}
+
+	return nil
+}
+
+// Materialize writes credential files into dir on the host and returns git environment for them.
+func (c *Credentials) Materialize(dir, repository string) ([]string, error) {
+	files, err := c.Files(repository)
+	if err != nil {
+		return nil, err
+	}
+
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), content, 0600); err != nil {
+			return nil, fmt.Errorf("error while writing credentials: %w", err)
+		}
+	}
+
+	return c.Env(dir), nil
+}
+
+func withTrailingNewline(s string) string {
+	if strings.HasSuffix(s, "\n") {
+		return s
+	}
+	return s + "\n"
+}
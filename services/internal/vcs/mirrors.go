@@ -0,0 +1,224 @@
+package vcs
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"pipecraft/internal/logger"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DEFAULT_MIRROR_TIMEOUT     = 10 * time.Minute
+	DEFAULT_MIRROR_GC_INTERVAL = time.Hour
+	MIRROR_SUFFIX              = ".git"
+)
+
+// MirrorCache keeps bare mirrors of remote repositories on the host, so pipelines fetch only from local disk.
+type MirrorCache struct {
+	dir         string
+	maxSize     int64
+	credentials CredentialsProvider
+
+	mu    sync.Mutex
+	locks map[string]*sync.RWMutex
+}
+
+func NewMirrorCache(dir string, maxSize int64, credentials CredentialsProvider) (*MirrorCache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("error while creating mirrors directory: %w", err)
+	}
+
+	return &MirrorCache{
+		dir:         dir,
+		maxSize:     maxSize,
+		credentials: credentials,
+		locks:       make(map[string]*sync.RWMutex),
+	}, nil
+}
+
+func (m *MirrorCache) Name(repository string) string {
+	hash := sha256.Sum256([]byte(repository))
+	return hex.EncodeToString(hash[:16]) + MIRROR_SUFFIX
+}
+
+func (m *MirrorCache) Path(repository string) string {
+	return filepath.Join(m.dir, m.Name(repository))
+}
+
+func (m *MirrorCache) lock(name string) *sync.RWMutex {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	lock, ok := m.locks[name]
+	if !ok {
+		lock = &sync.RWMutex{}
+		m.locks[name] = lock
+	}
+	return lock
+}
+
+// Acquire refreshes mirror of repository and keeps it from being removed by GC until release is called.
+// Release may be called more than once.
+func (m *MirrorCache) Acquire(repository string) (string, func(), error) {
+	const op = `vcs.MirrorCache.Acquire`
+
+	name := m.Name(repository)
+	lock := m.lock(name)
+
+	lock.Lock()
+	err := m.sync(repository, filepath.Join(m.dir, name))
+	lock.Unlock()
+	if err != nil {
+		return "", nil, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	lock.RLock()
+	return filepath.Join(m.dir, name), sync.OnceFunc(lock.RUnlock), nil
+}
+
+func (m *MirrorCache) sync(repository, path string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), DEFAULT_MIRROR_TIMEOUT)
+	defer cancel()
+
+	env, cleanup, err := credentialsEnv(m.credentials, repository)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	if _, err := os.Stat(path); err == nil {
+		if _, err := runGit(ctx, env, "-C", path, "fetch", "--prune", "origin"); err != nil {
+			return err
+		}
+	} else {
+		// NOTE: mirror is cloned aside and renamed, so half-cloned mirror is never used
+		tmpPath := path + ".tmp"
+		os.RemoveAll(tmpPath)
+		if _, err := runGit(ctx, env, "clone", "--mirror", "--", repository, tmpPath); err != nil {
+			os.RemoveAll(tmpPath)
+			return err
+		}
+		if err := os.Rename(tmpPath, path); err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	return os.Chtimes(path, now, now)
+}
+
+type mirrorInfo struct {
+	name     string
+	size     int64
+	lastUsed time.Time
+}
+
+// GC compacts mirrors and removes least recently used ones while total size exceeds the limit.
+func (m *MirrorCache) GC() error {
+	const op = `vcs.MirrorCache.GC`
+
+	entries, err := os.ReadDir(m.dir)
+	if err != nil {
+		return fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	var mirrors []mirrorInfo
+	var totalSize int64
+	for _, entry := range entries {
+		if !entry.IsDir() || !strings.HasSuffix(entry.Name(), MIRROR_SUFFIX) {
+			continue
+		}
+
+		path := filepath.Join(m.dir, entry.Name())
+		lock := m.lock(entry.Name())
+
+		// NOTE: mirrors used by running clones are neither compacted nor evicted until next run
+		if lock.TryLock() {
+			ctx, cancel := context.WithTimeout(context.Background(), DEFAULT_MIRROR_TIMEOUT)
+			if _, err := runGit(ctx, nil, "-C", path, "gc", "--auto", "--quiet"); err != nil {
+				slog.Warn("error while compacting mirror", slog.String("mirror", entry.Name()), logger.Err(err))
+			}
+			cancel()
+			lock.Unlock()
+		}
+
+		info, statErr := os.Stat(path)
+		size, sizeErr := dirSize(path)
+
+		if statErr != nil || sizeErr != nil {
+			continue
+		}
+
+		mirrors = append(mirrors, mirrorInfo{name: entry.Name(), size: size, lastUsed: info.ModTime()})
+		totalSize += size
+	}
+
+	if m.maxSize <= 0 || totalSize <= m.maxSize {
+		return nil
+	}
+
+	sort.Slice(mirrors, func(i, j int) bool { return mirrors[i].lastUsed.Before(mirrors[j].lastUsed) })
+	for _, mirror := range mirrors {
+		if totalSize <= m.maxSize {
+			break
+		}
+
+		lock := m.lock(mirror.name)
+		if !lock.TryLock() {
+			continue
+		}
+		err := os.RemoveAll(filepath.Join(m.dir, mirror.name))
+		lock.Unlock()
+		if err != nil {
+			slog.Warn("error while removing mirror", slog.String("mirror", mirror.name), logger.Err(err))
+			continue
+		}
+
+		slog.Info("mirror evicted", slog.String("mirror", mirror.name), slog.Int64("size", mirror.size))
+		totalSize -= mirror.size
+	}
+
+	return nil
+}
+
+func (m *MirrorCache) StartGC(interval time.Duration) {
+	if interval <= 0 {
+		interval = DEFAULT_MIRROR_GC_INTERVAL
+	}
+
+	for {
+		time.Sleep(interval)
+
+		if err := m.GC(); err != nil {
+			slog.Error("error while collecting mirrors garbage", logger.Err(err))
+		}
+	}
+}
+
+func dirSize(path string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		size += info.Size()
+		return nil
+	})
+	return size, err
+}
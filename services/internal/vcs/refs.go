@@ -0,0 +1,65 @@
+package vcs
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	REF_TYPE_BRANCH = "branch"
+	REF_TYPE_TAG    = "tag"
+	REF_TYPE_REF    = "ref"
+	REF_TYPE_COMMIT = "commit"
+)
+
+var (
+	ErrInvalidRef = errors.New("invalid ref")
+
+	commitRegexp = regexp.MustCompile(`^([0-9a-f]{40}|[0-9a-f]{64})$`)
+)
+
+// NormalizeRef infers missing ref type and validates ref against it.
+func NormalizeRef(refType, ref string) (string, string, error) {
+	if ref == "" {
+		return "", "", fmt.Errorf("%w: empty ref", ErrInvalidRef)
+	}
+
+	if refType == "" {
+		refType = REF_TYPE_BRANCH
+		if strings.HasPrefix(ref, "refs/") {
+			refType = REF_TYPE_REF
+		}
+	}
+
+	switch refType {
+	case REF_TYPE_BRANCH, REF_TYPE_TAG:
+		if strings.HasPrefix(ref, "refs/") {
+			return "", "", fmt.Errorf("%w: %s has to be a short name, use ref type %q for full refnames", ErrInvalidRef, refType, REF_TYPE_REF)
+		}
+	case REF_TYPE_REF:
+		if !strings.HasPrefix(ref, "refs/") {
+			return "", "", fmt.Errorf("%w: full refname has to start with refs/", ErrInvalidRef)
+		}
+	case REF_TYPE_COMMIT:
+		if !commitRegexp.MatchString(ref) {
+			return "", "", fmt.Errorf("%w: commit has to be a full sha", ErrInvalidRef)
+		}
+	default:
+		return "", "", fmt.Errorf("%w: unknown ref type %q", ErrInvalidRef, refType)
+	}
+
+	return refType, ref, nil
+}
+
+// FullRef returns name of ref on remote, commits are returned as is.
+func FullRef(refType, ref string) string {
+	switch refType {
+	case REF_TYPE_BRANCH:
+		return "refs/heads/" + ref
+	case REF_TYPE_TAG:
+		return "refs/tags/" + ref
+	}
+	return ref
+}
@@ -0,0 +1,151 @@
+package vcs
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+const DEFAULT_GIT_TIMEOUT = 30 * time.Second
+
+var (
+	ErrRefNotFound  = errors.New("ref not found")
+	ErrFileNotFound = errors.New("file not found")
+)
+
+type Resolver struct {
+	credentials CredentialsProvider
+}
+
+func NewResolver(credentials CredentialsProvider) *Resolver {
+	return &Resolver{credentials: credentials}
+}
+
+func (r *Resolver) ResolveRef(repository, refType, ref string) (string, error) {
+	const op = `vcs.Resolver.ResolveRef`
+
+	if refType == REF_TYPE_COMMIT {
+		return ref, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), DEFAULT_GIT_TIMEOUT)
+	defer cancel()
+
+	env, cleanup, err := credentialsEnv(r.credentials, repository)
+	if err != nil {
+		return "", fmt.Errorf("op: %s, err: %w", op, err)
+	}
+	defer cleanup()
+
+	fullRef := FullRef(refType, ref)
+	output, err := runGit(ctx, env, "ls-remote", "--", repository, fullRef, fullRef+"^{}")
+	if err != nil {
+		return "", fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	// NOTE: annotated tags are peeled to the commit they point to
+	var resolved string
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		sha, name, ok := strings.Cut(scanner.Text(), "\t")
+		if !ok {
+			continue
+		}
+		if name == fullRef+"^{}" {
+			return sha, nil
+		}
+		if name == fullRef {
+			resolved = sha
+		}
+	}
+
+	if resolved == "" {
+		return "", ErrRefNotFound
+	}
+
+	return resolved, nil
+}
+
+// ReadFile returns content of file at ref of remote repository, ref may be a branch, tag, full ref name or commit.
+func (r *Resolver) ReadFile(repository, ref, file string) ([]byte, error) {
+	const op = `vcs.Resolver.ReadFile`
+
+	ctx, cancel := context.WithTimeout(context.Background(), DEFAULT_GIT_TIMEOUT)
+	defer cancel()
+
+	env, cleanup, err := credentialsEnv(r.credentials, repository)
+	if err != nil {
+		return nil, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+	defer cleanup()
+
+	dir, err := os.MkdirTemp("", "pipecraft-file-")
+	if err != nil {
+		return nil, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+	defer os.RemoveAll(dir)
+
+	if _, err := runGit(ctx, env, "init", "-q", "--bare", dir); err != nil {
+		return nil, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+	if _, err := runGit(ctx, env, "-C", dir, "fetch", "-q", "--depth=1", "--no-tags", "--", repository, ref); err != nil {
+		return nil, fmt.Errorf("op: %s, err: %w: %w", op, ErrRefNotFound, err)
+	}
+
+	content, err := runGit(ctx, env, "-C", dir, "show", "FETCH_HEAD:"+file)
+	if err != nil {
+		return nil, fmt.Errorf("op: %s, err: %w: %w", op, ErrFileNotFound, err)
+	}
+
+	return content, nil
+}
+
+func credentialsEnv(provider CredentialsProvider, repository string) ([]string, func(), error) {
+	if provider == nil {
+		return nil, func() {}, nil
+	}
+
+	credentials, err := provider.Get(repository)
+	if err != nil {
+		return nil, nil, err
+	}
+	if credentials == nil {
+		return nil, func() {}, nil
+	}
+
+	dir, err := os.MkdirTemp("", "pipecraft-credentials-")
+	if err != nil {
+		return nil, nil, err
+	}
+	cleanup := func() { os.RemoveAll(dir) }
+
+	env, err := credentials.Materialize(dir, repository)
+	if err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+
+	return env, cleanup, nil
+}
+
+func runGit(ctx context.Context, env []string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	cmd.Env = append(cmd.Env, env...)
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git %s: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+
+	return output, nil
+}
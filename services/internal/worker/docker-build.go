@@ -0,0 +1,369 @@
+package worker
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"path"
+	"pipecraft/internal/jobs"
+	"pipecraft/internal/logger"
+	"pipecraft/internal/storage"
+	"strconv"
+	"strings"
+
+	"github.com/distribution/reference"
+	"github.com/docker/docker/api/types/build"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/api/types/registry"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/jsonmessage"
+)
+
+const (
+	// NOTE: docker keeps credentials of docker hub under its legacy index address
+	DOCKER_HUB_AUTH_SERVER = "https://index.docker.io/v1/"
+	BUILD_CPU_PERIOD       = 100000
+)
+
+var ErrDockerBuildFailed = errors.New("docker build failed")
+
+// imageBuild is what docker-build step gives to docker daemon, auths are credentials of registries by their host.
+// Built tags are removed from daemon afterwards when RemoveTags is set.
+type imageBuild struct {
+	Context    io.Reader
+	Dockerfile string
+	Args       map[string]string
+	Tags       []string
+	Push       bool
+	Limits     jobs.Resources
+	Auths      map[string]registry.AuthConfig
+	RemoveTags bool
+}
+
+// dockerBuild runs docker-build step with docker daemon which steps of pipeline use, context is taken from workspace
+// of pipeline container. Output of build and push is written to out as it arrives, failed step returns
+// ErrDockerBuildFailed. Daemon is the sidecar of pipeline, privileged pipeline which has no sidecar builds with docker
+// host of worker.
+func (w *Worker) dockerBuild(containerId, daemonId string, step *jobs.DockerBuild, pipelineInfo *storage.PipelinesTable, networkName string, limits jobs.Resources, out io.Writer) error {
+	const op = `worker.dockerBuild`
+
+	commit, err := w.headCommit(containerId)
+	if err != nil {
+		return fmt.Errorf("op: %s, err: %w", op, err)
+	}
+	commitShort := commit
+	if len(commitShort) > jobs.COMMIT_SHORT_LENGTH {
+		commitShort = commitShort[:jobs.COMMIT_SHORT_LENGTH]
+	}
+
+	tags, err := step.ExpandTags(map[string]string{
+		jobs.TAG_VARIABLE_COMMIT:       commit,
+		jobs.TAG_VARIABLE_COMMIT_SHORT: commitShort,
+		jobs.TAG_VARIABLE_BRANCH:       pipelineInfo.Branch,
+		jobs.TAG_VARIABLE_REF:          pipelineInfo.Ref,
+		jobs.TAG_VARIABLE_PIPELINE_ID:  strconv.FormatInt(w.pipelineId, 10),
+	})
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrDockerBuildFailed, err)
+	}
+
+	// NOTE: images built on docker host share its image store, so they can't take tags of images worker runs with
+	onHost := daemonId == ""
+	if onHost {
+		if err := checkReservedTags(tags, DIND_GIT_IMAGE_NAME, w.docker.Image); err != nil {
+			return err
+		}
+	}
+
+	auths, err := w.registryAuths(pipelineInfo.Repository, tags)
+	if err != nil {
+		return fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	daemonClient, closeDaemon, err := w.pipelineDaemon(daemonId, networkName)
+	if err != nil {
+		return fmt.Errorf("op: %s, err: %w", op, err)
+	}
+	defer closeDaemon()
+
+	archive, _, err := w.dockerClient.CopyFromContainer(w.ctx, containerId, path.Join(WORKSPACE_DIR, step.ContextDir()))
+	if err != nil {
+		return fmt.Errorf("%w: context %q: %w", ErrDockerBuildFailed, step.ContextDir(), err)
+	}
+	defer archive.Close()
+
+	// context is closed in case daemon doesn't read it to the end, so its rewriting doesn't block
+	buildArchive := buildContext(archive)
+	defer buildArchive.Close()
+
+	return buildImage(w.ctx, daemonClient, imageBuild{
+		Context:    buildArchive,
+		Dockerfile: step.DockerfileName(),
+		Args:       step.Args,
+		Tags:       tags,
+		Push:       step.Push,
+		Limits:     limits,
+		Auths:      auths,
+		RemoveTags: onHost,
+	}, out)
+}
+
+// pipelineDaemon returns client of docker daemon in sidecar of pipeline and function which closes it, docker host of
+// worker is returned when pipeline has no sidecar. Daemon is reached by its address on pipeline network, worker which
+// runs in a container is connected to that network until daemon is closed.
+func (w *Worker) pipelineDaemon(daemonId, networkName string) (*client.Client, func(), error) {
+	const op = `worker.pipelineDaemon`
+
+	if daemonId == "" {
+		return w.dockerClient, func() {}, nil
+	}
+
+	if w.docker.Container != "" {
+		if err := w.dockerClient.NetworkConnect(w.ctx, networkName, w.docker.Container, nil); err != nil {
+			return nil, nil, fmt.Errorf("op: %s, err: %w", op, err)
+		}
+	}
+	disconnect := func() {
+		if w.docker.Container == "" {
+			return
+		}
+		if err := w.dockerClient.NetworkDisconnect(context.Background(), networkName, w.docker.Container, true); err != nil {
+			slog.Warn("failed to disconnect worker from pipeline network", logger.Err(err))
+		}
+	}
+
+	daemon, err := w.dockerClient.ContainerInspect(w.ctx, daemonId)
+	if err != nil {
+		disconnect()
+		return nil, nil, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+	endpoint, ok := daemon.NetworkSettings.Networks[networkName]
+	if !ok || endpoint.IPAddress == "" {
+		disconnect()
+		return nil, nil, fmt.Errorf("op: %s, err: docker daemon of pipeline has no address on %s", op, networkName)
+	}
+
+	daemonClient, err := client.NewClientWithOpts(
+		client.WithHost(fmt.Sprintf("tcp://%s:%d", endpoint.IPAddress, DOCKER_DAEMON_PORT)),
+		client.WithAPIVersionNegotiation(),
+	)
+	if err != nil {
+		disconnect()
+		return nil, nil, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	return daemonClient, func() {
+		daemonClient.Close()
+		disconnect()
+	}, nil
+}
+
+// headCommit returns commit which workspace of pipeline is checked out at.
+func (w *Worker) headCommit(containerId string) (string, error) {
+	const op = `worker.headCommit`
+
+	output, exitCode, err := w.execCommandWithLogs(containerId, container.ExecOptions{
+		Cmd:          []string{"git", "-C", WORKSPACE_DIR, "rev-parse", "HEAD"},
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		return "", fmt.Errorf("op: %s, err: %w", op, err)
+	}
+	if exitCode != 0 {
+		return "", fmt.Errorf("op: %s, err: git rev-parse: exit code: %d", op, exitCode)
+	}
+
+	return strings.TrimSpace(string(output)), nil
+}
+
+// checkReservedTags refuses tags of images worker runs pipelines with, build would replace them on docker host and
+// removal of built tags would untag them for every other pipeline.
+func checkReservedTags(tags []string, images ...string) error {
+	reserved := make(map[string]bool, len(images))
+	for _, image := range images {
+		reserved[imageName(image)] = true
+	}
+
+	for _, tag := range tags {
+		if reserved[imageName(tag)] {
+			return fmt.Errorf("%w: tag %q is reserved for images of worker", ErrDockerBuildFailed, tag)
+		}
+	}
+	return nil
+}
+
+// imageName returns repository of image without its tag, so tags of the same image are compared by it.
+func imageName(image string) string {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return image
+	}
+	return named.Name()
+}
+
+// registryAuths returns credentials of repository for registries which tags are pushed to, registries without
+// credentials are left out.
+func (w *Worker) registryAuths(repository string, tags []string) (map[string]registry.AuthConfig, error) {
+	const op = `worker.registryAuths`
+
+	auths := map[string]registry.AuthConfig{}
+	if w.credentials == nil {
+		return auths, nil
+	}
+
+	for _, tag := range tags {
+		host := jobs.Registry(tag)
+		if _, ok := auths[host]; ok {
+			continue
+		}
+
+		credentials, err := w.credentials.GetRegistry(repository, host)
+		if err != nil {
+			return nil, fmt.Errorf("op: %s, err: %w", op, err)
+		}
+		if credentials == nil {
+			continue
+		}
+
+		server := host
+		if host == jobs.DEFAULT_REGISTRY {
+			server = DOCKER_HUB_AUTH_SERVER
+		}
+		auths[host] = registry.AuthConfig{Username: credentials.Username, Password: credentials.Password, ServerAddress: server}
+	}
+
+	return auths, nil
+}
+
+// buildImage builds image with docker api and pushes its tags when build pushes, output of daemon is written to out
+// as it is streamed.
+// NOTE: image is built with classic builder, it is the one docker api builds with without buildkit session
+func buildImage(ctx context.Context, dockerClient *client.Client, b imageBuild, out io.Writer) error {
+	buildArgs := make(map[string]*string, len(b.Args))
+	for name, value := range b.Args {
+		buildArgs[name] = &value
+	}
+
+	options := build.ImageBuildOptions{
+		Version:     build.BuilderV1,
+		Dockerfile:  b.Dockerfile,
+		Tags:        b.Tags,
+		BuildArgs:   buildArgs,
+		Remove:      true,
+		ForceRemove: true,
+		AuthConfigs: map[string]registry.AuthConfig{},
+	}
+	for host, auth := range b.Auths {
+		options.AuthConfigs[auth.ServerAddress] = auth
+		if host != auth.ServerAddress {
+			options.AuthConfigs[host] = auth
+		}
+	}
+	if b.Limits.Cpus > 0 {
+		options.CPUPeriod = BUILD_CPU_PERIOD
+		options.CPUQuota = int64(b.Limits.Cpus * BUILD_CPU_PERIOD)
+	}
+	if memory, err := jobs.ParseMemory(b.Limits.Memory); err == nil && memory > 0 {
+		options.Memory = memory
+		options.MemorySwap = memory
+	}
+
+	response, err := dockerClient.ImageBuild(ctx, b.Context, options)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrDockerBuildFailed, err)
+	}
+	err = jsonmessage.DisplayJSONMessagesStream(response.Body, out, 0, false, nil)
+	response.Body.Close()
+
+	// NOTE: images built on docker host would pile up there without being removed, sidecar is removed with them
+	if b.RemoveTags {
+		defer removeImages(dockerClient, b.Tags)
+	}
+
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrDockerBuildFailed, err)
+	}
+
+	if !b.Push {
+		return nil
+	}
+
+	for _, tag := range b.Tags {
+		registryAuth, err := registry.EncodeAuthConfig(b.Auths[jobs.Registry(tag)])
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrDockerBuildFailed, err)
+		}
+
+		fmt.Fprintf(out, "pushing %s\n", tag)
+		pushOutput, err := dockerClient.ImagePush(ctx, tag, image.PushOptions{RegistryAuth: registryAuth})
+		if err != nil {
+			return fmt.Errorf("%w: push %s: %w", ErrDockerBuildFailed, tag, err)
+		}
+		err = jsonmessage.DisplayJSONMessagesStream(pushOutput, out, 0, false, nil)
+		pushOutput.Close()
+		if err != nil {
+			return fmt.Errorf("%w: push %s: %w", ErrDockerBuildFailed, tag, err)
+		}
+	}
+
+	return nil
+}
+
+func removeImages(dockerClient *client.Client, tags []string) {
+	for _, tag := range tags {
+		_, err := dockerClient.ImageRemove(context.Background(), tag, image.RemoveOptions{PruneChildren: true})
+		if err != nil && !client.IsErrNotFound(err) {
+			slog.Warn("failed to remove built image", slog.String("tag", tag), logger.Err(err))
+		}
+	}
+}
+
+// buildContext returns archive copied out of container as build context. Docker puts copied directory at the top of
+// archive, context has its content at the top instead.
+// NOTE: .dockerignore of context is not applied, it is applied by docker cli and not by daemon
+func buildContext(archive io.Reader) io.ReadCloser {
+	reader, writer := io.Pipe()
+
+	go func() {
+		tr := tar.NewReader(archive)
+		tw := tar.NewWriter(writer)
+
+		for {
+			header, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				writer.CloseWithError(err)
+				return
+			}
+
+			_, name, found := strings.Cut(header.Name, "/")
+			if !found || name == "" {
+				continue
+			}
+			header.Name = name
+			if header.Typeflag == tar.TypeLink {
+				_, header.Linkname, _ = strings.Cut(header.Linkname, "/")
+			}
+
+			if err := tw.WriteHeader(header); err != nil {
+				writer.CloseWithError(err)
+				return
+			}
+			if _, err := io.Copy(tw, tr); err != nil {
+				writer.CloseWithError(err)
+				return
+			}
+		}
+
+		writer.CloseWithError(tw.Close())
+	}()
+
+	return reader
+}
@@ -0,0 +1,97 @@
+package worker
+
+import (
+	"errors"
+	"sync"
+)
+
+var ErrInvalidPoolSize = errors.New("pool size has to be positive")
+
+// Pool limits how many pipelines run at a time. Size can be changed and claiming of new pipelines paused while
+// pipelines keep running, running pipelines are never stopped by pool.
+// NOTE: state of pool is kept in memory, so every replica has its own pool
+type Pool struct {
+	mu      sync.Mutex
+	size    int
+	busy    int
+	paused  bool
+	changed chan struct{}
+}
+
+func NewPool(size int) *Pool {
+	return &Pool{size: max(size, 1), changed: make(chan struct{}, 1)}
+}
+
+// tryAcquire takes a slot if pool is not paused and has a free one.
+func (p *Pool) tryAcquire() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.paused || p.busy >= p.size {
+		return false
+	}
+	p.busy++
+	return true
+}
+
+func (p *Pool) release() {
+	p.mu.Lock()
+	p.busy--
+	p.mu.Unlock()
+
+	p.notify()
+}
+
+// notify wakes listener waiting for a free slot.
+func (p *Pool) notify() {
+	select {
+	case p.changed <- struct{}{}:
+	default:
+	}
+}
+
+// Resize changes size of pool, pipelines running over the new size finish before new ones are claimed.
+func (p *Pool) Resize(size int) error {
+	if size <= 0 {
+		return ErrInvalidPoolSize
+	}
+
+	p.mu.Lock()
+	p.size = size
+	p.mu.Unlock()
+
+	p.notify()
+	return nil
+}
+
+func (p *Pool) Pause() {
+	p.mu.Lock()
+	p.paused = true
+	p.mu.Unlock()
+}
+
+func (p *Pool) Resume() {
+	p.mu.Lock()
+	p.paused = false
+	p.mu.Unlock()
+
+	p.notify()
+}
+
+func (p *Pool) Size() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.size
+}
+
+func (p *Pool) Busy() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.busy
+}
+
+func (p *Pool) Paused() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.paused
+}
@@ -0,0 +1,216 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"pipecraft/internal/logger"
+	"pipecraft/internal/storage"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/volume"
+	"github.com/docker/docker/client"
+)
+
+const (
+	ORPHAN_KIND_CONTAINER = "container"
+	ORPHAN_KIND_NETWORK   = "network"
+	ORPHAN_KIND_VOLUME    = "volume"
+
+	ORPHAN_REASON_FINISHED    = "finished"
+	ORPHAN_REASON_UNKNOWN     = "unknown"
+	ORPHAN_REASON_NOT_RUNNING = "not_running"
+)
+
+// Orphan is container, network or volume left on docker host by pipeline which is not run anymore.
+type Orphan struct {
+	Kind       string
+	Name       string
+	PipelineId int64
+	Reason     string
+}
+
+// Reaper removes what workers of listener left on docker host when process died in the middle of pipeline, so
+// pipeline which is run again doesn't clash with names of its old containers. Resources of pipelines which are
+// finished or unknown to storage are removed whatever instance labelled them, resources of other pipelines only when
+// they are labelled with instance id of listener, so instances sharing docker host don't reap each other.
+type Reaper struct {
+	dockerClient *client.Client
+	listener     *Listener
+}
+
+func NewReaper(listener *Listener) *Reaper {
+	client, err := client.NewClientWithOpts(client.FromEnv)
+	if err != nil {
+		slog.Error("error while creating docker client", logger.Err(err))
+		panic(err)
+	}
+	return &Reaper{dockerClient: client, listener: listener}
+}
+
+// Start reaps orphans every interval until ctx is done.
+func (r *Reaper) Start(ctx context.Context, interval time.Duration) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+
+		r.Reap(ctx)
+	}
+}
+
+// Reap removes orphans and returns the ones which are removed, resource which fails to be removed is retried on the
+// next run.
+func (r *Reaper) Reap(ctx context.Context) []Orphan {
+	orphans, err := r.Orphans(ctx)
+	if err != nil {
+		slog.Error("error while listing orphans", logger.Err(err))
+		return nil
+	}
+
+	removed := []Orphan{}
+	for _, orphan := range orphans {
+		if err := r.remove(ctx, orphan); err != nil {
+			slog.Warn("failed to remove orphan", slog.String("kind", orphan.Kind), slog.String("name", orphan.Name), logger.Err(err))
+			continue
+		}
+		removed = append(removed, orphan)
+	}
+
+	if len(removed) > 0 {
+		slog.Info("orphans are removed", slog.Int("count", len(removed)))
+	}
+	return removed
+}
+
+// Orphans returns what reaper would remove. Containers are listed before networks and volumes they use, so they are
+// removed first.
+// NOTE: pipeline is terminal or unknown to storage, or it isn't run by listener anymore. Workspace of pipeline
+// which waits to be resumed is kept.
+func (r *Reaper) Orphans(ctx context.Context) ([]Orphan, error) {
+	const op = "worker.Reaper.Orphans"
+
+	filter := filters.NewArgs(filters.Arg("label", LABEL_PIPELINE_ID))
+
+	containers, err := r.dockerClient.ContainerList(ctx, container.ListOptions{All: true, Filters: filter})
+	if err != nil {
+		return nil, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+	networks, err := r.dockerClient.NetworkList(ctx, network.ListOptions{Filters: filter})
+	if err != nil {
+		return nil, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+	volumes, err := r.dockerClient.VolumeList(ctx, volume.ListOptions{Filters: filter})
+	if err != nil {
+		return nil, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	// pipelines are looked up only once, they are shared by containers, network and volume
+	pipelines := map[int64]reapedPipeline{}
+	orphans := []Orphan{}
+
+	check := func(kind, name string, labels map[string]string) error {
+		pipelineId, err := strconv.ParseInt(labels[LABEL_PIPELINE_ID], 10, 64)
+		if err != nil || r.listener.isRunning(pipelineId) {
+			return nil
+		}
+		own := labels[LABEL_INSTANCE_ID] == r.listener.instanceId
+
+		pipeline, ok := pipelines[pipelineId]
+		if !ok {
+			pipeline, err = r.pipelineInfo(pipelineId)
+			if err != nil {
+				return err
+			}
+			pipelines[pipelineId] = pipeline
+		}
+
+		orphan := Orphan{Kind: kind, Name: name, PipelineId: pipelineId}
+		switch {
+		case !pipeline.assigned:
+			// pipeline of another runner may still run on docker host shared with it
+			if !own {
+				return nil
+			}
+			orphan.Reason = ORPHAN_REASON_UNKNOWN
+		case pipeline.info == nil:
+			orphan.Reason = ORPHAN_REASON_UNKNOWN
+		case storage.IsPipelineFinished(pipeline.info.Status):
+			orphan.Reason = ORPHAN_REASON_FINISHED
+		case !own:
+			return nil
+		case kind == ORPHAN_KIND_VOLUME && pipeline.info.WorkspaceVolume == name:
+			return nil
+		default:
+			orphan.Reason = ORPHAN_REASON_NOT_RUNNING
+		}
+		orphans = append(orphans, orphan)
+		return nil
+	}
+
+	for _, c := range containers {
+		name := c.ID
+		if len(c.Names) > 0 {
+			name = strings.TrimPrefix(c.Names[0], "/")
+		}
+		if err := check(ORPHAN_KIND_CONTAINER, name, c.Labels); err != nil {
+			return nil, fmt.Errorf("op: %s, err: %w", op, err)
+		}
+	}
+	for _, n := range networks {
+		if err := check(ORPHAN_KIND_NETWORK, n.Name, n.Labels); err != nil {
+			return nil, fmt.Errorf("op: %s, err: %w", op, err)
+		}
+	}
+	for _, v := range volumes.Volumes {
+		if err := check(ORPHAN_KIND_VOLUME, v.Name, v.Labels); err != nil {
+			return nil, fmt.Errorf("op: %s, err: %w", op, err)
+		}
+	}
+
+	return orphans, nil
+}
+
+// reapedPipeline is pipeline of reaped resources as storage of backend sees it. Info is nil for pipeline storage
+// doesn't know, pipeline given to another runner is not assigned.
+type reapedPipeline struct {
+	info     *storage.PipelinesTable
+	assigned bool
+}
+
+func (r *Reaper) pipelineInfo(pipelineId int64) (reapedPipeline, error) {
+	s, _ := r.listener.backend.Pipeline(pipelineId)
+
+	pipeline, err := s.GetPipelineInfo(pipelineId)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return reapedPipeline{assigned: true}, nil
+		}
+		if errors.Is(err, ErrPipelineNotAssigned) {
+			return reapedPipeline{}, nil
+		}
+		return reapedPipeline{}, err
+	}
+
+	return reapedPipeline{info: pipeline, assigned: true}, nil
+}
+
+func (r *Reaper) remove(ctx context.Context, orphan Orphan) error {
+	switch orphan.Kind {
+	case ORPHAN_KIND_CONTAINER:
+		return r.dockerClient.ContainerRemove(ctx, orphan.Name, container.RemoveOptions{RemoveVolumes: true, Force: true})
+	case ORPHAN_KIND_NETWORK:
+		return r.dockerClient.NetworkRemove(ctx, orphan.Name)
+	case ORPHAN_KIND_VOLUME:
+		return r.dockerClient.VolumeRemove(ctx, orphan.Name, true)
+	}
+	return nil
+}
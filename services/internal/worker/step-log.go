@@ -0,0 +1,64 @@
+package worker
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"pipecraft/internal/logger"
+	"pipecraft/internal/storage"
+	"time"
+)
+
+const STEP_LOG_FLUSH_INTERVAL = time.Second
+
+// stepLog is log of step which is written while step runs, output is appended to it at most once per flush interval,
+// so log of long step is readable before step finishes.
+type stepLog struct {
+	storage    Storage
+	pipelineId int64
+	logId      int64
+	pending    bytes.Buffer
+	flushedAt  time.Time
+}
+
+func (w *Worker) startStepLog(logTable storage.LogsTable) (*stepLog, error) {
+	const op = `worker.startStepLog`
+
+	logId, err := w.storage.StartLog(logTable)
+	if err != nil {
+		return nil, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	return &stepLog{storage: w.storage, pipelineId: logTable.PipelineId, logId: logId, flushedAt: time.Now()}, nil
+}
+
+// Write appends output of step to log.
+// NOTE: output which fails to be appended is kept and appended later, step isn't stopped because of its log
+func (l *stepLog) Write(p []byte) (int, error) {
+	l.pending.Write(p)
+	if time.Since(l.flushedAt) < STEP_LOG_FLUSH_INTERVAL {
+		return len(p), nil
+	}
+
+	if err := l.append(storage.LOG_STATUS_RUNNING); err != nil {
+		slog.Warn("failed to append output of step to log", logger.Err(err))
+	}
+	return len(p), nil
+}
+
+// finish appends rest of output and results to log and sets its final status.
+func (l *stepLog) finish(results, finalStatus string) error {
+	l.pending.WriteString(results)
+	return l.append(finalStatus)
+}
+
+func (l *stepLog) append(status string) error {
+	const op = `worker.stepLog.append`
+
+	l.flushedAt = time.Now()
+	if err := l.storage.AppendLog(l.pipelineId, l.logId, l.pending.String(), status); err != nil {
+		return fmt.Errorf("op: %s, err: %w", op, err)
+	}
+	l.pending.Reset()
+	return nil
+}
@@ -1,76 +1,314 @@
 package worker
 
 import (
+	"archive/tar"
 	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log/slog"
+	"path"
+	"pipecraft/internal/config"
 	"pipecraft/internal/jobs"
 	"pipecraft/internal/logger"
 	"pipecraft/internal/storage"
+	"pipecraft/internal/vcs"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/volume"
 	"github.com/docker/docker/client"
 	"github.com/docker/docker/pkg/stdcopy"
 )
 
 const (
-	MAX_WORKERS     = 5
-	LISTEN_INTERVAL = 10
+	WORKSPACE_DIR       = "/workspace"
+	DIND_GIT_IMAGE_NAME = "dind-git"
+	CREDENTIALS_DIR     = "/run/pipecraft-credentials"
+	MIRROR_DIR          = "/run/pipecraft-mirror.git"
+	PROBE_CLONE_DEPTH   = 1
 
-	DEFAULT_CI_CONFIG_PATH = "/workspace/ci.yaml"
-	DIND_GIT_IMAGE_NAME    = "dind-git"
+	WORKSPACE_VOLUME_FORMAT = "pipeline-%d-workspace"
+	NETWORK_NAME_FORMAT     = "pipeline-%d-network"
+
+	DOCKER_DAEMON_NAME_FORMAT   = "pipeline-%d-docker"
+	DOCKER_DAEMON_HOST          = "docker"
+	DOCKER_DAEMON_PORT          = 2375
+	DOCKER_DAEMON_START_TIMEOUT = 30 * time.Second
+	DOCKER_DAEMON_POLL_INTERVAL = 500 * time.Millisecond
+	HOST_DOCKER_SOCKET          = "/var/run/docker.sock"
+
+	// NOTE: everything worker creates on docker host is labelled, so reaper finds what is left of pipelines
+	LABEL_PIPELINE_ID = "pipecraft.pipeline-id"
+	LABEL_INSTANCE_ID = "pipecraft.instance-id"
+
+	MAX_DOWNSTREAM_DEPTH = 10
+	TRIGGER_STEP_NAME    = "trigger"
+
+	SHUTDOWN_CLEANUP_TIMEOUT = 30 * time.Second
 )
 
+var (
+	ErrConfigNotFound      = errors.New("ci config not found")
+	ErrInvalidConfig       = errors.New("ci config is invalid")
+	ErrPipelineNotAssigned = errors.New("pipeline is not assigned to runner")
+)
+
+// Storage is what worker reads and changes while running pipeline, it is the database on server and the server api
+// on runner.
+type Storage interface {
+	GetPipelineInfo(id int64) (*storage.PipelinesTable, error)
+	UpdatePipelineStatus(id int64, status string) error
+	UpdatePipelineConfigFile(id int64, configFile string) error
+	UpdatePipelineConfig(id int64, config string) error
+	GetPipelineConfig(id int64) (string, string, error)
+	UpdatePipelineDiagnostics(id int64, diagnostics string) error
+	GetPipelineDiagnostics(id int64) (string, error)
+	GetPipelineLogs(id int64) ([]*storage.LogsTable, error)
+	CreateLog(logTable storage.LogsTable) error
+	StartLog(logTable storage.LogsTable) (int64, error)
+	AppendLog(pipelineId, logId int64, results, finalStatus string) error
+	CreateSiblingPipelines(id int64, configFiles []string) error
+	CreateDownstreamPipeline(pipeline storage.PipelinesTable) (int64, error)
+	GetDownstreamPipeline(parentPipelineId int64, parentJob string) (*storage.PipelinesTable, error)
+	WaitForDownstream(pipelineId, downstreamPipelineId int64, workspaceVolume string) (string, error)
+	RequestApproval(pipelineId int64, jobName, workspaceVolume string) (string, error)
+	AcquireConcurrencyLock(group string, pipelineId int64, jobName string, cancelInProgress bool, workspaceVolume string) (bool, error)
+	ReleaseConcurrencyLock(group string, pipelineId int64) error
+	IsCancelRequested(pipelineId int64) (bool, error)
+	SupersedePipelines(pipelineId int64, cancelRunning bool) ([]int64, error)
+	RequeuePipeline(pipelineId int64, workspaceVolume, interruptedJob string) (bool, error)
+	HandOffPipeline(pipelineId int64, runsOn []string) (bool, error)
+	GetRepositorySettings(repository string) (*storage.RepositorySettingsTable, error)
+}
+
+// RegistryCredentials are what docker-build steps log in with to registry they push to.
+type RegistryCredentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// Credentials gives secrets of repository to worker, git credentials for checkout and registry credentials for
+// docker-build steps. Nil is returned for secrets repository doesn't have.
+type Credentials interface {
+	vcs.CredentialsProvider
+	GetRegistry(repository, registry string) (*RegistryCredentials, error)
+}
+
+// Backend gives pipelines to listener and storage to their workers. Labels are what runner of backend advertises,
+// only pipelines whose jobs run on some of them are given to it.
+type Backend interface {
+	ClaimNextPipeline(ctx context.Context) (int64, error)
+	Pipeline(pipelineId int64) (Storage, Credentials)
+	Labels() []string
+}
+
+// LocalBackend claims pipelines right from the database, it is used by workers of server.
+type LocalBackend struct {
+	storage     *storage.Storage
+	credentials Credentials
+	labels      []string
+}
+
+func NewLocalBackend(s *storage.Storage, credentials Credentials, labels []string) *LocalBackend {
+	return &LocalBackend{storage: s, credentials: credentials, labels: labels}
+}
+
+func (b *LocalBackend) ClaimNextPipeline(ctx context.Context) (int64, error) {
+	return b.storage.ClaimNextPipeline(0, b.labels)
+}
+
+func (b *LocalBackend) Labels() []string {
+	return b.labels
+}
+
+func (b *LocalBackend) Pipeline(pipelineId int64) (Storage, Credentials) {
+	return b.storage, b.credentials
+}
+
 type Worker struct {
+	ctx          context.Context
 	dockerClient *client.Client
-	storage      *storage.Storage
+	storage      Storage
+	credentials  Credentials
+	mirrors      *vcs.MirrorCache
+	ci           config.CI
+	resources    config.Resources
+	docker       config.Docker
+	labels       []string
+	instanceId   string
 	pipelineId   int64
+	fetchRemote  string
 	done         chan bool
 }
 
-func StartListener(s *storage.Storage) {
-	workerPool := make(chan struct{}, MAX_WORKERS)
+// Listener claims waiting pipelines while worker pool has free slots and runs them, pipeline is claimed only once
+// a slot is taken.
+type Listener struct {
+	backend        Backend
+	mirrors        *vcs.MirrorCache
+	ci             config.CI
+	resources      config.Resources
+	docker         config.Docker
+	instanceId     string
+	pool           *Pool
+	listenInterval time.Duration
 
-	for {
-		pipelineId, err := s.GetLastWaitingPipeline()
+	runCtx     context.Context
+	cancelRuns context.CancelFunc
+	running    sync.WaitGroup
+	stopped    chan struct{}
+
+	mu         sync.Mutex
+	runningIds map[int64]bool
+}
+
+// NewListener returns listener of backend, instance id is put on everything its workers create on docker host.
+func NewListener(backend Backend, mirrors *vcs.MirrorCache, ci config.CI, resources config.Resources, docker config.Docker, instanceId string, pool *Pool, listenInterval time.Duration) *Listener {
+	runCtx, cancelRuns := context.WithCancel(context.Background())
+	return &Listener{
+		backend:        backend,
+		mirrors:        mirrors,
+		ci:             ci,
+		resources:      resources,
+		docker:         docker,
+		instanceId:     instanceId,
+		pool:           pool,
+		listenInterval: listenInterval,
+		runCtx:         runCtx,
+		cancelRuns:     cancelRuns,
+		stopped:        make(chan struct{}),
+		runningIds:     map[int64]bool{},
+	}
+}
+
+// Start claims pipelines until ctx is done, pipelines which are already running are not affected by ctx.
+func (l *Listener) Start(ctx context.Context) {
+	defer close(l.stopped)
+
+	for ctx.Err() == nil {
+		if !l.pool.tryAcquire() {
+			select {
+			case <-ctx.Done():
+			case <-l.pool.changed:
+			case <-time.After(l.listenInterval):
+			}
+			continue
+		}
+
+		pipelineId, err := l.backend.ClaimNextPipeline(ctx)
 		if err != nil {
 			if !errors.Is(err, storage.ErrNotFound) {
-				slog.Error("error while getting last pipeline waiting pipeline", logger.Err(err))
+				slog.Error("error while claiming waiting pipeline", logger.Err(err))
+			}
+
+			l.pool.release()
+			select {
+			case <-ctx.Done():
+			case <-time.After(l.listenInterval):
 			}
+			continue
 		}
 
-		if pipelineId != 0 {
-			go func(pipelineId int64) {
-				workerPool <- struct{}{}
+		l.running.Add(1)
+		l.setRunning(pipelineId, true)
+		go func(pipelineId int64) {
+			defer l.running.Done()
+			defer l.pool.release()
+			defer l.setRunning(pipelineId, false)
 
-				worker := NewWorker(s, pipelineId)
-				err := worker.storage.UpdatePipelineStatus(pipelineId, storage.PIPELINE_STATUS_RUNNING)
-				if err != nil {
-					slog.Warn("pipeline with known id was not found")
-				} else {
-					go worker.Run()
-				}
+			s, credentials := l.backend.Pipeline(pipelineId)
+			worker := NewWorker(l.runCtx, s, credentials, l.mirrors, l.ci, l.resources, l.docker, l.backend.Labels(), l.instanceId, pipelineId)
+			go worker.Run()
 
-				<-worker.done
-				<-workerPool
-			}(pipelineId)
-		}
+			<-worker.done
+		}(pipelineId)
+	}
+}
+
+func (l *Listener) setRunning(pipelineId int64, running bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if running {
+		l.runningIds[pipelineId] = true
+	} else {
+		delete(l.runningIds, pipelineId)
+	}
+}
+
+// isRunning reports whether pipeline is run by worker of listener.
+func (l *Listener) isRunning(pipelineId int64) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.runningIds[pipelineId]
+}
 
-		time.Sleep(time.Duration(LISTEN_INTERVAL) * time.Second)
+// Shutdown waits for running pipelines until ctx is done, pipelines still running then are interrupted and put back
+// to the queue, so another instance picks them up. Start has to be stopped before shutdown.
+func (l *Listener) Shutdown(ctx context.Context) error {
+	const op = "worker.Listener.Shutdown"
+
+	select {
+	case <-l.stopped:
+	case <-ctx.Done():
+	}
+
+	drained := make(chan struct{})
+	go func() {
+		l.running.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+	}
+
+	slog.Warn("shutdown grace period is over, interrupting running pipelines", slog.Int("running", l.pool.Busy()))
+	l.cancelRuns()
+
+	// NOTE: interrupted workers still remove their containers, so they are waited for a bit more
+	select {
+	case <-drained:
+		return fmt.Errorf("op: %s, err: %w", op, ctx.Err())
+	case <-time.After(SHUTDOWN_CLEANUP_TIMEOUT):
+		return fmt.Errorf("op: %s, err: cleanup of interrupted pipelines timed out", op)
 	}
 }
 
-func NewWorker(s *storage.Storage, pipelineId int64) *Worker {
+// NewWorker returns worker of pipeline, pipeline is interrupted and put back to the queue once ctx is done.
+// Pipeline whose jobs run on labels worker doesn't have is handed off to another runner once its ci config is read.
+// Resources are default limits of pipeline container, docker is daemon which pipeline runs its containers with.
+func NewWorker(ctx context.Context, s Storage, credentials Credentials, mirrors *vcs.MirrorCache, ci config.CI, resources config.Resources, docker config.Docker, labels []string, instanceId string, pipelineId int64) *Worker {
 	client, err := client.NewClientWithOpts(client.FromEnv)
 	if err != nil {
 		slog.Error("error while creating docker client", logger.Err(err))
 		panic(err)
 	}
-	return &Worker{storage: s, pipelineId: pipelineId, done: make(chan bool), dockerClient: client}
+	return &Worker{
+		ctx:          ctx,
+		storage:      s,
+		credentials:  credentials,
+		mirrors:      mirrors,
+		ci:           ci,
+		resources:    resources,
+		docker:       docker,
+		labels:       labels,
+		instanceId:   instanceId,
+		pipelineId:   pipelineId,
+		fetchRemote:  "origin",
+		done:         make(chan bool),
+		dockerClient: client,
+	}
 }
 
 func (w *Worker) Run() {
@@ -80,38 +318,152 @@ func (w *Worker) Run() {
 
 	defer func() { w.done <- true }()
 
-	ctx := context.Background()
+	pipelineInfo, err := w.storage.GetPipelineInfo(w.pipelineId)
+	if err != nil {
+		slog.Error("error while selecting pipeline info", logger.Err(err))
+		w.updateStatus(storage.PIPELINE_STATUS_ABORTED)
+		return
+	}
+
+	// NOTE: paused pipeline keeps its workspace in the volume and is resumed in a fresh container
+	resuming := pipelineInfo.WorkspaceVolume != ""
+	workspaceVolume := fmt.Sprintf(WORKSPACE_VOLUME_FORMAT, w.pipelineId)
+
+	keepWorkspace := false
+	defer func() {
+		if !keepWorkspace {
+			w.removeWorkspace(workspaceVolume)
+		}
+	}()
+
+	// interrupted pipeline is put back to the queue, workspace is kept once ci config is read, so pipeline is resumed
+	// from the interrupted job instead of being checked out again
+	pipelineRead := resuming
+	currentJob := ""
+	defer func() {
+		if w.ctx.Err() == nil {
+			return
+		}
+
+		requeueVolume := ""
+		if pipelineRead {
+			requeueVolume = workspaceVolume
+		}
+		requeued, err := w.storage.RequeuePipeline(w.pipelineId, requeueVolume, currentJob)
+		if err != nil {
+			slog.Error("error while requeueing interrupted pipeline", logger.Err(err))
+			return
+		}
+		if requeued {
+			slog.Info("interrupted pipeline is requeued", slog.Int64("pipeline_id", w.pipelineId), slog.String("job", currentJob))
+			keepWorkspace = pipelineRead
+		}
+	}()
+
+	ctx := w.ctx
+	if !resuming {
+		if _, err := w.dockerClient.VolumeCreate(ctx, volume.CreateOptions{Name: workspaceVolume, Labels: w.resourceLabels()}); err != nil {
+			slog.Error("error while creating workspace volume", logger.Err(err))
+			w.updateStatus(storage.PIPELINE_STATUS_ABORTED)
+			return
+		}
+	}
+
+	if w.canceled() {
+		return
+	}
+
+	privileged := w.ci.IsPrivilegedRepository(pipelineInfo.Repository)
+
+	binds := []string{}
+
+	// NOTE: only mirror of pipeline repository is mounted, so other private repositories are not exposed
+	releaseMirror := func() {}
+	if w.mirrors != nil && !resuming {
+		mirrorPath, release, err := w.mirrors.Acquire(pipelineInfo.Repository)
+		if err != nil {
+			slog.Warn("mirror is unavailable, cloning from remote", logger.Err(err))
+		} else {
+			releaseMirror = release
+			binds = append(binds, fmt.Sprintf("%s:%s:ro", mirrorPath, MIRROR_DIR))
+			w.fetchRemote = "file://" + MIRROR_DIR
+		}
+	}
+	defer releaseMirror()
+
+	// every pipeline has its own bridge network, so containers of concurrent pipelines can't reach each other
+	networkName := fmt.Sprintf(NETWORK_NAME_FORMAT, w.pipelineId)
+	if _, err := w.dockerClient.NetworkCreate(ctx, networkName, network.CreateOptions{Driver: network.NetworkBridge, Labels: w.resourceLabels()}); err != nil {
+		slog.Error("error while creating pipeline network", logger.Err(err))
+		w.updateStatus(storage.PIPELINE_STATUS_ABORTED)
+		return
+	}
+	defer w.removeNetwork(networkName)
+
+	limits, err := w.jobLimits(nil)
+	if err != nil {
+		slog.Error("error while getting limits of pipeline", logger.Err(err))
+		w.updateStatus(storage.PIPELINE_STATUS_ABORTED)
+		return
+	}
+
+	// NOTE: docker socket of host gives root on host to whoever pushes ci config, so only privileged repositories
+	// get it, other pipelines run docker in their own daemon reachable only from pipeline network
+	env := []string{}
+	daemonId := ""
+	if privileged {
+		slog.Warn("privileged pipeline gets docker socket of host", slog.Int64("pipeline_id", w.pipelineId), slog.String("repository", pipelineInfo.Repository))
+		binds = append(binds, fmt.Sprintf("%s:%s", HOST_DOCKER_SOCKET, HOST_DOCKER_SOCKET))
+	} else {
+		daemonId, err = w.startDockerDaemon(networkName, workspaceVolume, limits)
+		if err != nil {
+			slog.Error("error while starting docker daemon of pipeline", logger.Err(err))
+			w.updateStatus(storage.PIPELINE_STATUS_ABORTED)
+			return
+		}
+		defer func() {
+			if err := w.cleanupContainer(daemonId); err != nil {
+				slog.Warn("failed to stop docker daemon of pipeline", logger.Err(err))
+			}
+		}()
+		env = append(env, fmt.Sprintf("DOCKER_HOST=tcp://%s:%d", DOCKER_DAEMON_HOST, DOCKER_DAEMON_PORT))
+	}
+
+	hostConfig := &container.HostConfig{
+		Binds: binds,
+		Mounts: []mount.Mount{
+			{Type: mount.TypeVolume, Source: workspaceVolume, Target: WORKSPACE_DIR},
+		},
+		NetworkMode: container.NetworkMode(networkName),
+		Resources:   containerResources(limits),
+	}
+	if w.resources.Disk != "" {
+		hostConfig.StorageOpt = map[string]string{"size": w.resources.Disk}
+	}
+
 	resp, err := w.dockerClient.ContainerCreate(
 		ctx,
 		&container.Config{
 			Image:      DIND_GIT_IMAGE_NAME,
-			WorkingDir: "/workspace",
+			WorkingDir: WORKSPACE_DIR,
+			Env:        env,
 			Cmd:        []string{"sleep", "infinity"},
+			Labels:     w.resourceLabels(),
 		},
-		&container.HostConfig{
-			Binds: []string{
-				"/var/run/docker.sock:/var/run/docker.sock",
-			},
-		},
+		hostConfig,
 		nil,
 		nil,
 		fmt.Sprintf("pipeline-%d", w.pipelineId),
 	)
 	if err != nil {
 		slog.Error("error while creating docker container", logger.Err(err))
-		err := w.storage.UpdatePipelineStatus(w.pipelineId, storage.PIPELINE_STATUS_ABORTED)
-		if err != nil {
-			slog.Error("error while updating pipeline status", logger.Err(err))
-		}
+		w.updateStatus(storage.PIPELINE_STATUS_ABORTED)
 		return
 	}
 
 	if err := w.dockerClient.ContainerStart(ctx, resp.ID, container.StartOptions{}); err != nil {
 		slog.Error("error while starting container docker container", logger.Err(err))
-		err := w.storage.UpdatePipelineStatus(w.pipelineId, storage.PIPELINE_STATUS_ABORTED)
-		if err != nil {
-			slog.Error("error while updating pipeline status", logger.Err(err))
-		}
+		w.updateStatus(storage.PIPELINE_STATUS_ABORTED)
 		return
 	}
 
@@ -122,59 +474,298 @@ func (w *Worker) Run() {
 		}
 	}()
 
-	pipelineInfo, err := w.storage.GetPipelineInfo(w.pipelineId)
-	if err != nil {
-		slog.Error("error while selecting pipeline info", logger.Err(err))
-		err := w.storage.UpdatePipelineStatus(w.pipelineId, storage.PIPELINE_STATUS_ABORTED)
+	var pipeline *jobs.Pipeline
+	if resuming {
+		pipeline, err = w.storedPipeline()
 		if err != nil {
-			slog.Error("error while updating pipeline status", logger.Err(err))
+			slog.Error("error while reading CI config of paused pipeline", logger.Err(err))
+			w.updateStatus(storage.PIPELINE_STATUS_ABORTED)
+			return
+		}
+	} else {
+		pipeline, err = w.checkoutPipeline(resp.ID, pipelineInfo, releaseMirror)
+		if err != nil {
+			return
+		}
+		pipelineRead = true
+
+		// NOTE: labels are known only from ci config, pipeline claimed by runner without them is checked out once more
+		// by runner which has them
+		if runsOn := pipeline.RunsOn(); !jobs.HasLabels(w.labels, runsOn) {
+			handedOff, err := w.storage.HandOffPipeline(w.pipelineId, runsOn)
+			if err != nil {
+				slog.Error("error while handing off pipeline", logger.Err(err))
+				w.updateStatus(storage.PIPELINE_STATUS_ABORTED)
+				return
+			}
+			if handedOff {
+				slog.Info("pipeline is handed off to runner with its labels", slog.Int64("pipeline_id", w.pipelineId), slog.Any("runs_on", runsOn))
+			}
+			return
 		}
-		return
 	}
+	jobs := pipeline.Jobs
 
-	// cloning repository
-	err = w.cloneRepository(resp.ID, pipelineInfo.Repository, pipelineInfo.Branch, pipelineInfo.Commit)
+	inputsEnv, err := w.resolveInputs(pipeline, pipelineInfo)
 	if err != nil {
-		slog.Warn("error while cloning repository or commit doesn't exist", logger.Err(err))
-		err := w.storage.UpdatePipelineStatus(w.pipelineId, storage.PIPELINE_STATUS_ABORTED)
-		if err != nil {
-			slog.Error("error while updating pipeline status", logger.Err(err))
+		if errors.Is(err, ErrInvalidConfig) {
+			slog.Warn("pipeline inputs don't match ci config", logger.Err(err))
+			w.updateStatus(storage.PIPELINE_STATUS_INVALID_CONFIG)
+			return
 		}
+		slog.Error("error while resolving pipeline inputs", logger.Err(err))
+		w.updateStatus(storage.PIPELINE_STATUS_ABORTED)
 		return
 	}
 
-	// reading ci config file
-	jobs, err := w.readCiConfig(resp.ID)
-	if err != nil {
-		slog.Error("error while reading CI config", logger.Err(err))
-		err := w.storage.UpdatePipelineStatus(w.pipelineId, storage.PIPELINE_STATUS_ABORTED)
+	// newer pipeline of branch supersedes older ones when its ci config asks for it
+	autoCancel := pipeline.AutoCancel
+	if autoCancel != nil && autoCancel.Enabled && !resuming && pipelineInfo.RefType == vcs.REF_TYPE_BRANCH &&
+		!w.ci.IsProtectedBranch(pipelineInfo.Ref) {
+		superseded, err := w.storage.SupersedePipelines(w.pipelineId, autoCancel.Running)
 		if err != nil {
-			slog.Error("error while updating pipeline status", logger.Err(err))
+			slog.Warn("failed to supersede older pipelines", logger.Err(err))
+		} else if len(superseded) > 0 {
+			slog.Info("older pipelines are superseded", slog.Int64("pipeline_id", w.pipelineId), slog.Any("superseded", superseded))
+		}
+	}
+
+	// only one pipeline of concurrency group runs at a time, the others wait in the queue with their workspaces
+	groupVariables := concurrencyGroupVariables(pipelineInfo)
+	if pipeline.Concurrency != nil {
+		group := pipeline.Concurrency.ExpandGroup(groupVariables)
+		acquired, err := w.storage.AcquireConcurrencyLock(group, w.pipelineId, "", pipeline.Concurrency.CancelInProgress, workspaceVolume)
+		if err != nil {
+			slog.Error("error while acquiring concurrency lock", logger.Err(err))
+			w.updateStatus(storage.PIPELINE_STATUS_ABORTED)
+			return
+		}
+		if !acquired {
+			slog.Info("pipeline is waiting for concurrency group", slog.Int64("pipeline_id", w.pipelineId), slog.String("group", group))
+			keepWorkspace = true
+			return
+		}
+	}
+
+	// resumed pipeline skips jobs which ran before it was paused
+	ran := make(map[string]int)
+	if resuming {
+		ran, err = w.completedJobs(w.pipelineId)
+		if err != nil {
+			slog.Error("error while getting logs of paused pipeline", logger.Err(err))
+			w.updateStatus(storage.PIPELINE_STATUS_ABORTED)
+			return
+		}
+	}
+
+	// rerunning only failed jobs, jobs finished in original pipeline are skipped
+	completed := make(map[string]int)
+	if pipelineInfo.FailedOnly && pipelineInfo.RerunOf != 0 && !resuming {
+		completed, err = w.completedJobs(pipelineInfo.RerunOf)
+		if err != nil {
+			slog.Error("error while getting logs of original pipeline", logger.Err(err))
+			w.updateStatus(storage.PIPELINE_STATUS_ABORTED)
+			return
 		}
-		return
 	}
 
 	for jobNumber, job := range jobs {
+		steps := jobSteps(job)
+		if len(steps) > 0 && ran[job.Name] >= len(steps) {
+			continue
+		}
+
+		// NOTE: pipeline superseded by a newer one of its concurrency group is canceled between jobs
+		if jobNumber > 0 && w.canceled() {
+			return
+		}
+
+		currentJob = job.Name
+
+		if len(steps) > 0 && completed[job.Name] >= len(steps) {
+			for _, step := range steps {
+				err = w.storage.CreateLog(storage.LogsTable{
+					CommandNumber: jobNumber,
+					CommandName:   fmt.Sprintf("%s:%s", job.Name, step.Name),
+					Command:       step.Command(),
+					Results:       fmt.Sprintf("succeeded in pipeline %d", pipelineInfo.RerunOf),
+					FinalStatus:   storage.LOG_STATUS_SKIPPED,
+					PipelineId:    w.pipelineId,
+				})
+				if err != nil {
+					slog.Error("error while creating logs", logger.Err(err))
+					return
+				}
+			}
+			continue
+		}
+
+		// manual job pauses pipeline and releases worker until approval is decided
+		if job.Manual {
+			approvalStatus, err := w.storage.RequestApproval(w.pipelineId, job.Name, workspaceVolume)
+			if err != nil {
+				slog.Error("error while requesting approval", logger.Err(err))
+				w.updateStatus(storage.PIPELINE_STATUS_ABORTED)
+				return
+			}
+
+			switch approvalStatus {
+			case storage.APPROVAL_STATUS_PENDING:
+				slog.Info("pipeline is waiting for approval", slog.Int64("pipeline_id", w.pipelineId), slog.String("job", job.Name))
+				keepWorkspace = true
+				return
+			case storage.APPROVAL_STATUS_REJECTED:
+				w.updateStatus(storage.PIPELINE_STATUS_REJECTED)
+				return
+			}
+		}
+
+		releaseJobGroup := func() {}
+		if job.Concurrency != nil {
+			group := job.Concurrency.ExpandGroup(groupVariables)
+			acquired, err := w.storage.AcquireConcurrencyLock(group, w.pipelineId, job.Name, job.Concurrency.CancelInProgress, workspaceVolume)
+			if err != nil {
+				slog.Error("error while acquiring concurrency lock", logger.Err(err))
+				w.updateStatus(storage.PIPELINE_STATUS_ABORTED)
+				return
+			}
+			if !acquired {
+				slog.Info("job is waiting for concurrency group", slog.Int64("pipeline_id", w.pipelineId), slog.String("job", job.Name), slog.String("group", group))
+				keepWorkspace = true
+				return
+			}
+
+			// lock shared with pipeline level group is held until pipeline finishes
+			if pipeline.Concurrency == nil || pipeline.Concurrency.ExpandGroup(groupVariables) != group {
+				releaseJobGroup = func() {
+					if err := w.storage.ReleaseConcurrencyLock(group, w.pipelineId); err != nil {
+						slog.Warn("failed to release concurrency lock", logger.Err(err))
+					}
+				}
+			}
+		}
+
+		// trigger job runs pipeline of another repository, waiting job pauses pipeline until that one finishes
+		if job.Trigger != nil {
+			status, err := w.triggerDownstream(jobNumber, job, steps[0], pipelineInfo, workspaceVolume)
+			if err != nil {
+				slog.Error("error while triggering downstream pipeline", logger.Err(err))
+				w.updateStatus(storage.PIPELINE_STATUS_ABORTED)
+				return
+			}
+
+			switch status {
+			case storage.PIPELINE_STATUS_WAITING_FOR_DOWNSTREAM:
+				slog.Info("pipeline is waiting for downstream pipeline", slog.Int64("pipeline_id", w.pipelineId), slog.String("job", job.Name))
+				keepWorkspace = true
+				return
+			case storage.PIPELINE_STATUS_FAILED:
+				w.updateStatus(storage.PIPELINE_STATUS_FAILED)
+				return
+			}
+			releaseJobGroup()
+			continue
+		}
+
+		// container runs with limits of job which runs in it, job which asks for more than maximums of worker fails
+		jobLimits, err := w.jobLimits(job.Resources)
+		if err != nil {
+			w.updateStatus(storage.PIPELINE_STATUS_FAILED)
+			err = w.storage.CreateLog(storage.LogsTable{
+				CommandNumber: jobNumber,
+				CommandName:   fmt.Sprintf("%s:%s", job.Name, steps[0].Name),
+				Command:       steps[0].Command(),
+				Results:       err.Error(),
+				FinalStatus:   storage.LOG_STATUS_FAILED,
+				PipelineId:    w.pipelineId,
+			})
+			if err != nil {
+				slog.Error("error while creating logs", logger.Err(err))
+			}
+			return
+		}
+		if jobLimits != limits {
+			if err := w.updateLimits(resp.ID, jobLimits); err != nil {
+				slog.Error("error while updating limits of container", logger.Err(err))
+				w.updateStatus(storage.PIPELINE_STATUS_ABORTED)
+				return
+			}
+			limits = jobLimits
+		}
+
 		for _, step := range job.Steps {
+			// docker-build step is run by worker with docker api instead of running in pipeline container, its output
+			// is written to log while it runs
+			if step.DockerBuild != nil {
+				stepLog, err := w.startStepLog(storage.LogsTable{
+					CommandNumber: jobNumber,
+					CommandName:   fmt.Sprintf("%s:%s", job.Name, step.Name),
+					Command:       step.Command(),
+					PipelineId:    w.pipelineId,
+				})
+				if err != nil {
+					slog.Error("error while creating logs", logger.Err(err))
+					return
+				}
+
+				err = w.dockerBuild(resp.ID, daemonId, step.DockerBuild, pipelineInfo, networkName, limits, stepLog)
+				if err != nil && !errors.Is(err, ErrDockerBuildFailed) {
+					slog.Error("error while running docker build step", logger.Err(err))
+					w.updateStatus(storage.PIPELINE_STATUS_ABORTED)
+					if err := stepLog.finish("", storage.LOG_STATUS_FAILED); err != nil {
+						slog.Error("error while updating logs", logger.Err(err))
+					}
+					return
+				}
+
+				finalStatus := storage.LOG_STATUS_SUCCEEDED
+				results := ""
+				if err != nil {
+					w.updateStatus(storage.PIPELINE_STATUS_FAILED)
+					finalStatus = storage.LOG_STATUS_FAILED
+					results = err.Error()
+				}
+
+				if err := stepLog.finish(results, finalStatus); err != nil {
+					slog.Error("error while updating logs", logger.Err(err))
+					return
+				}
+				if finalStatus != storage.LOG_STATUS_SUCCEEDED {
+					return
+				}
+				continue
+			}
+
 			execConfig := container.ExecOptions{
 				Cmd:          strings.Split(step.Run, " "),
+				Env:          inputsEnv,
 				AttachStdout: true,
 				AttachStderr: true,
 			}
 
+			// NOTE: step is killed by oom killer of container cgroup without container being stopped, so kills are
+			// counted around step
+			oomKills, err := w.oomKills(resp.ID)
+			if err != nil {
+				slog.Warn("failed to count oom kills of container", logger.Err(err))
+				oomKills = -1
+			}
+
 			logs, exitCode, err := w.execCommandWithLogs(resp.ID, execConfig)
 			if err != nil {
 				slog.Error("error while executing job step", logger.Err(err))
-				err := w.storage.UpdatePipelineStatus(w.pipelineId, storage.PIPELINE_STATUS_ABORTED)
-				if err != nil {
-					slog.Error("error while updating pipeline status", logger.Err(err))
-				}
+				w.updateStatus(storage.PIPELINE_STATUS_ABORTED)
 				return
 			}
 			if exitCode != 0 {
-				err := w.storage.UpdatePipelineStatus(w.pipelineId, storage.PIPELINE_STATUS_FAILED)
-				if err != nil {
-					slog.Error("error while updating pipeline status", logger.Err(err))
+				w.updateStatus(storage.PIPELINE_STATUS_FAILED)
+
+				finalStatus := fmt.Sprintf("%s, exit code: %d", storage.LOG_STATUS_FAILED, exitCode)
+				if oomKills >= 0 {
+					if kills, err := w.oomKills(resp.ID); err == nil && kills > oomKills {
+						slog.Warn("job step ran out of memory", slog.Int64("pipeline_id", w.pipelineId), slog.String("job", job.Name), slog.String("memory", limits.Memory))
+						finalStatus = storage.LOG_STATUS_OOM_KILLED
+					}
 				}
 
 				err = w.storage.CreateLog(storage.LogsTable{
@@ -182,7 +773,7 @@ func (w *Worker) Run() {
 					CommandName:   fmt.Sprintf("%s:%s", job.Name, step.Name),
 					Command:       step.Run,
 					Results:       string(logs),
-					FinalStatus:   fmt.Sprintf("Failed, exit code: %d", exitCode),
+					FinalStatus:   finalStatus,
 					PipelineId:    w.pipelineId,
 				})
 				if err != nil {
@@ -197,7 +788,7 @@ func (w *Worker) Run() {
 				CommandName:   fmt.Sprintf("%s:%s", job.Name, step.Name),
 				Command:       step.Run,
 				Results:       string(logs),
-				FinalStatus:   "Succeeded",
+				FinalStatus:   storage.LOG_STATUS_SUCCEEDED,
 				PipelineId:    w.pipelineId,
 			})
 			if err != nil {
@@ -205,53 +796,668 @@ func (w *Worker) Run() {
 				return
 			}
 		}
+		releaseJobGroup()
 	}
 
-	err = w.storage.UpdatePipelineStatus(w.pipelineId, storage.PIPELINE_STATUS_COMPLETED)
+	w.updateStatus(storage.PIPELINE_STATUS_COMPLETED)
+}
+
+// canceled reports whether pipeline was superseded by a newer one, status of canceled pipeline is updated.
+func (w *Worker) canceled() bool {
+	cancelRequested, err := w.storage.IsCancelRequested(w.pipelineId)
 	if err != nil {
-		slog.Error("error while updating pipeline status", logger.Err(err))
-		return
+		slog.Warn("failed to check cancellation of pipeline", logger.Err(err))
+		return false
 	}
+	if cancelRequested {
+		slog.Info("pipeline is canceled", slog.Int64("pipeline_id", w.pipelineId))
+		w.updateStatus(storage.PIPELINE_STATUS_CANCELED)
+	}
+	return cancelRequested
 }
 
-func (w *Worker) cloneRepository(containerId, repository, branch, commit string) error {
-	const op = `worker.cloneRepository`
+func concurrencyGroupVariables(pipelineInfo *storage.PipelinesTable) map[string]string {
+	return map[string]string{
+		jobs.GROUP_VARIABLE_REPOSITORY: pipelineInfo.Repository,
+		jobs.GROUP_VARIABLE_BRANCH:     pipelineInfo.Branch,
+		jobs.GROUP_VARIABLE_REF:        pipelineInfo.Ref,
+		jobs.GROUP_VARIABLE_REF_TYPE:   pipelineInfo.RefType,
+	}
+}
 
-	execConfig1 := container.ExecOptions{
-		Cmd: []string{"git", "clone", "--branch", branch, "--single-branch", repository, "/workspace"},
+// checkoutPipeline clones repository into workspace and reads ci config, status of pipeline is updated on failure.
+func (w *Worker) checkoutPipeline(containerId string, pipelineInfo *storage.PipelinesTable, releaseMirror func()) (*jobs.Pipeline, error) {
+	const op = "worker.checkoutPipeline"
+
+	var checkout vcs.CheckoutOptions
+	if err := json.Unmarshal([]byte(pipelineInfo.Checkout), &checkout); err != nil {
+		slog.Error("error while parsing checkout options", logger.Err(err))
+		w.updateStatus(storage.PIPELINE_STATUS_ABORTED)
+		return nil, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	credentialsEnv, err := w.injectCredentials(containerId, pipelineInfo.Repository)
+	if err != nil {
+		slog.Error("error while injecting repository credentials", logger.Err(err))
+		w.updateStatus(storage.PIPELINE_STATUS_ABORTED)
+		return nil, fmt.Errorf("op: %s, err: %w", op, err)
 	}
+	// NOTE: credentials have to be removed before any user step is executed, defer is only a safety net
+	defer w.removeCredentials(containerId)
 
-	execConfig2 := container.ExecOptions{
-		Cmd: []string{"git", "-C", "/workspace", "checkout", commit},
+	// cloning repository, history is deepened after reading ci config which may contain checkout options
+	cloneDepth := PROBE_CLONE_DEPTH
+	if checkout.Depth != nil {
+		cloneDepth = *checkout.Depth
 	}
 
-	logs, exitCode, err := w.execCommandWithLogs(containerId, execConfig1)
+	err = w.cloneRepository(containerId, pipelineInfo, cloneDepth, credentialsEnv)
 	if err != nil {
-		slog.Error("error while cloning repository", logger.Err(err), slog.String("logs", string(logs)), slog.Int("exitCode", exitCode))
-		return fmt.Errorf("op: %s, err: %w", op, err)
+		slog.Warn("error while cloning repository or commit doesn't exist", logger.Err(err))
+		w.updateStatus(storage.PIPELINE_STATUS_ABORTED)
+		return nil, fmt.Errorf("op: %s, err: %w", op, err)
 	}
-	if exitCode != 0 {
-		slog.Error("error while cloning repository", slog.Int("exit_code", exitCode), slog.String("logs", string(logs)), slog.Int("exitCode", exitCode))
-		return fmt.Errorf("op: %s, err: %w", op, errors.New(fmt.Sprintf("exitCode: %d", exitCode)))
+
+	// reading ci config file, pipelines for other files of repository are created on first run
+	configFile, err := w.resolveConfigFile(containerId, pipelineInfo)
+	if err != nil {
+		if errors.Is(err, ErrConfigNotFound) {
+			slog.Warn("ci config not found", slog.String("config_file", configFile))
+			w.updateStatus(storage.PIPELINE_STATUS_CONFIG_NOT_FOUND)
+			return nil, fmt.Errorf("op: %s, err: %w", op, err)
+		}
+		slog.Error("error while resolving CI config", logger.Err(err))
+		w.updateStatus(storage.PIPELINE_STATUS_ABORTED)
+		return nil, fmt.Errorf("op: %s, err: %w", op, err)
 	}
 
-	logs, exitCode, err = w.execCommandWithLogs(containerId, execConfig2)
+	pipeline, err := w.readCiConfig(containerId, pipelineInfo.Repository, configFile)
 	if err != nil {
-		slog.Error("error while cloning repository", logger.Err(err))
-		return fmt.Errorf("op: %s, err: %w", op, err)
+		if errors.Is(err, ErrInvalidConfig) {
+			slog.Warn("ci config is invalid", slog.String("config_file", configFile))
+			w.updateStatus(storage.PIPELINE_STATUS_INVALID_CONFIG)
+			return nil, fmt.Errorf("op: %s, err: %w", op, err)
+		}
+		slog.Error("error while reading CI config", logger.Err(err))
+		w.updateStatus(storage.PIPELINE_STATUS_ABORTED)
+		return nil, fmt.Errorf("op: %s, err: %w", op, err)
 	}
 
-	if exitCode != 0 {
-		return fmt.Errorf("op: %s, err: %w", op, errors.New(fmt.Sprintf("exit code: %d", exitCode)))
+	// options from run request override ones from ci config
+	err = w.finalizeCheckout(containerId, pipelineInfo, pipeline.Checkout.Merge(checkout), cloneDepth, credentialsEnv)
+	if err != nil {
+		slog.Warn("error while finalizing checkout", logger.Err(err))
+		w.updateStatus(storage.PIPELINE_STATUS_ABORTED)
+		return nil, fmt.Errorf("op: %s, err: %w", op, err)
 	}
+	w.removeCredentials(containerId)
+	releaseMirror()
 
-	return nil
+	return pipeline, nil
 }
 
-func (w *Worker) execCommandWithExitCode(containerId string, execOpts container.ExecOptions) (int, error) {
-	const op = `worker.ExecCommandWithExitCode`
+// jobSteps returns steps of job, trigger job has a single step which stands for its downstream pipeline in logs.
+func jobSteps(job jobs.Job) []jobs.Step {
+	if job.Trigger == nil {
+		return job.Steps
+	}
+	return []jobs.Step{{
+		Name: TRIGGER_STEP_NAME,
+		Run:  fmt.Sprintf("trigger %s@%s", job.Trigger.Repository, job.Trigger.Branch),
+	}}
+}
 
-	ctx := context.Background()
+// triggerDownstream creates pipeline of trigger job once and returns status of the job: completed, failed or
+// waiting_for_downstream when pipeline is paused until downstream one finishes.
+func (w *Worker) triggerDownstream(jobNumber int, job jobs.Job, step jobs.Step, pipelineInfo *storage.PipelinesTable, workspaceVolume string) (string, error) {
+	const op = "worker.triggerDownstream"
+
+	fail := func(results string) (string, error) {
+		err := w.storage.CreateLog(storage.LogsTable{
+			CommandNumber: jobNumber,
+			CommandName:   fmt.Sprintf("%s:%s", job.Name, step.Name),
+			Command:       step.Run,
+			Results:       results,
+			FinalStatus:   storage.LOG_STATUS_FAILED,
+			PipelineId:    w.pipelineId,
+		})
+		if err != nil {
+			return "", fmt.Errorf("op: %s, err: %w", op, err)
+		}
+		return storage.PIPELINE_STATUS_FAILED, nil
+	}
+
+	downstream, err := w.storage.GetDownstreamPipeline(w.pipelineId, job.Name)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return "", fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	downstreamId := int64(0)
+	if downstream != nil {
+		downstreamId = downstream.PipelineId
+	} else {
+		depth, err := w.upstreamDepth(pipelineInfo)
+		if err != nil {
+			return "", fmt.Errorf("op: %s, err: %w", op, err)
+		}
+		if depth >= MAX_DOWNSTREAM_DEPTH {
+			return fail(fmt.Sprintf("pipelines are nested deeper than %d triggers", MAX_DOWNSTREAM_DEPTH))
+		}
+
+		refType, ref, err := vcs.NormalizeRef(vcs.REF_TYPE_BRANCH, job.Trigger.Branch)
+		if err != nil {
+			return fail(err.Error())
+		}
+		commit, err := vcs.NewResolver(w.scopedCredentials(pipelineInfo.Repository)).ResolveRef(job.Trigger.Repository, refType, ref)
+		if err != nil {
+			if errors.Is(err, vcs.ErrRefNotFound) {
+				return fail(fmt.Sprintf("branch %s doesn't exist in %s", ref, job.Trigger.Repository))
+			}
+			return "", fmt.Errorf("op: %s, err: %w", op, err)
+		}
+
+		inputs, err := json.Marshal(job.Trigger.Inputs)
+		if err != nil {
+			return "", fmt.Errorf("op: %s, err: %w", op, err)
+		}
+		if job.Trigger.Inputs == nil {
+			inputs = []byte("{}")
+		}
+
+		downstreamId, err = w.storage.CreateDownstreamPipeline(storage.PipelinesTable{
+			Repository:       job.Trigger.Repository,
+			Branch:           ref,
+			Ref:              ref,
+			RefType:          refType,
+			Commit:           commit,
+			TriggeredBy:      pipelineInfo.TriggeredBy,
+			Inputs:           string(inputs),
+			ParentPipelineId: w.pipelineId,
+			ParentJob:        job.Name,
+		})
+		if err != nil {
+			return "", fmt.Errorf("op: %s, err: %w", op, err)
+		}
+	}
+
+	status := storage.PIPELINE_STATUS_COMPLETED
+	results := fmt.Sprintf("pipeline %d triggered", downstreamId)
+	if job.Trigger.Wait {
+		status, err = w.storage.WaitForDownstream(w.pipelineId, downstreamId, workspaceVolume)
+		if err != nil {
+			return "", fmt.Errorf("op: %s, err: %w", op, err)
+		}
+		if !storage.IsPipelineFinished(status) {
+			return storage.PIPELINE_STATUS_WAITING_FOR_DOWNSTREAM, nil
+		}
+		if status != storage.PIPELINE_STATUS_COMPLETED {
+			return fail(fmt.Sprintf("pipeline %d finished with status %s", downstreamId, status))
+		}
+		results = fmt.Sprintf("pipeline %d completed", downstreamId)
+	}
+
+	err = w.storage.CreateLog(storage.LogsTable{
+		CommandNumber: jobNumber,
+		CommandName:   fmt.Sprintf("%s:%s", job.Name, step.Name),
+		Command:       step.Run,
+		Results:       results,
+		FinalStatus:   storage.LOG_STATUS_SUCCEEDED,
+		PipelineId:    w.pipelineId,
+	})
+	if err != nil {
+		return "", fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	return status, nil
+}
+
+// upstreamDepth returns number of pipelines which triggered pipeline one by one.
+func (w *Worker) upstreamDepth(pipelineInfo *storage.PipelinesTable) (int, error) {
+	const op = "worker.upstreamDepth"
+
+	depth := 0
+	for parentId := pipelineInfo.ParentPipelineId; parentId != 0 && depth < MAX_DOWNSTREAM_DEPTH; depth++ {
+		parent, err := w.storage.GetPipelineInfo(parentId)
+		if err != nil {
+			return 0, fmt.Errorf("op: %s, err: %w", op, err)
+		}
+		parentId = parent.ParentPipelineId
+	}
+
+	return depth, nil
+}
+
+// storedPipeline returns pipeline of config expanded on first run, so resumed pipeline runs the same jobs.
+func (w *Worker) storedPipeline() (*jobs.Pipeline, error) {
+	const op = "worker.storedPipeline"
+
+	_, config, err := w.storage.GetPipelineConfig(w.pipelineId)
+	if err != nil {
+		return nil, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	pipeline, err := jobs.ParsePipeline([]byte(config))
+	if err != nil {
+		return nil, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	return pipeline, nil
+}
+
+// resolveInputs returns env of pipeline inputs with defaults of ci config, inputs which don't match config are
+// stored as diagnostic.
+func (w *Worker) resolveInputs(pipeline *jobs.Pipeline, pipelineInfo *storage.PipelinesTable) ([]string, error) {
+	const op = "worker.resolveInputs"
+
+	provided := make(map[string]any)
+	if pipelineInfo.Inputs != "" {
+		if err := json.Unmarshal([]byte(pipelineInfo.Inputs), &provided); err != nil {
+			return nil, fmt.Errorf("op: %s, err: %w", op, err)
+		}
+	}
+
+	values, inputsErr := jobs.ResolveInputs(pipeline.Inputs, provided)
+	if inputsErr == nil {
+		return jobs.InputsEnv(values), nil
+	}
+
+	data, err := w.storage.GetPipelineDiagnostics(w.pipelineId)
+	if err != nil {
+		return nil, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+	diagnostics := []jobs.Diagnostic{}
+	if err := json.Unmarshal([]byte(data), &diagnostics); err != nil {
+		return nil, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+	diagnostics = append(diagnostics, jobs.Diagnostic{Severity: jobs.SEVERITY_ERROR, Message: inputsErr.Error()})
+
+	diagnosticsData, err := json.Marshal(diagnostics)
+	if err != nil {
+		return nil, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+	if err := w.storage.UpdatePipelineDiagnostics(w.pipelineId, string(diagnosticsData)); err != nil {
+		return nil, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	return nil, fmt.Errorf("op: %s, err: %w: %w", op, ErrInvalidConfig, inputsErr)
+}
+
+// startDockerDaemon starts docker daemon of pipeline in a sidecar on pipeline network and waits until it is ready.
+// Workspace is mounted into sidecar at the same path, so steps can bind mount it into their containers.
+func (w *Worker) startDockerDaemon(networkName, workspaceVolume string, limits jobs.Resources) (string, error) {
+	const op = `worker.startDockerDaemon`
+
+	resp, err := w.dockerClient.ContainerCreate(
+		w.ctx,
+		&container.Config{
+			Image: w.docker.Image,
+			// NOTE: daemon listens without tls, it is reachable only from pipeline network
+			Env:    []string{"DOCKER_TLS_CERTDIR="},
+			Labels: w.resourceLabels(),
+		},
+		&container.HostConfig{
+			Privileged:  w.docker.Runtime == "",
+			Runtime:     w.docker.Runtime,
+			NetworkMode: container.NetworkMode(networkName),
+			Mounts: []mount.Mount{
+				{Type: mount.TypeVolume, Source: workspaceVolume, Target: WORKSPACE_DIR},
+			},
+			Resources: containerResources(limits),
+		},
+		&network.NetworkingConfig{
+			EndpointsConfig: map[string]*network.EndpointSettings{
+				networkName: {Aliases: []string{DOCKER_DAEMON_HOST}},
+			},
+		},
+		nil,
+		fmt.Sprintf(DOCKER_DAEMON_NAME_FORMAT, w.pipelineId),
+	)
+	if err != nil {
+		return "", fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	if err := w.dockerClient.ContainerStart(w.ctx, resp.ID, container.StartOptions{}); err != nil {
+		w.cleanupContainer(resp.ID)
+		return "", fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	deadline := time.Now().Add(DOCKER_DAEMON_START_TIMEOUT)
+	for {
+		_, exitCode, err := w.execCommandWithLogs(resp.ID, container.ExecOptions{
+			Cmd:          []string{"docker", "info"},
+			AttachStdout: true,
+			AttachStderr: true,
+		})
+		if err == nil && exitCode == 0 {
+			return resp.ID, nil
+		}
+
+		if time.Now().After(deadline) || w.ctx.Err() != nil {
+			w.cleanupContainer(resp.ID)
+			return "", fmt.Errorf("op: %s, err: docker daemon is not ready after %s", op, DOCKER_DAEMON_START_TIMEOUT)
+		}
+		time.Sleep(DOCKER_DAEMON_POLL_INTERVAL)
+	}
+}
+
+// resourceLabels returns labels of containers, networks and volumes of pipeline.
+func (w *Worker) resourceLabels() map[string]string {
+	return map[string]string{
+		LABEL_PIPELINE_ID: strconv.FormatInt(w.pipelineId, 10),
+		LABEL_INSTANCE_ID: w.instanceId,
+	}
+}
+
+func (w *Worker) removeNetwork(networkName string) {
+	if err := w.dockerClient.NetworkRemove(context.Background(), networkName); err != nil {
+		slog.Warn("failed to remove pipeline network", logger.Err(err))
+	}
+}
+
+// jobLimits returns limits of job container, limits job doesn't set are taken from config of worker, limits which
+// neither job nor worker set are its maximums. Limits above maximums are ErrInvalidResources.
+func (w *Worker) jobLimits(resources *jobs.Resources) (jobs.Resources, error) {
+	defaults := jobs.Resources{Cpus: w.resources.Cpus, Memory: w.resources.Memory, Pids: w.resources.Pids}
+	maximums := jobs.Resources{Cpus: w.resources.MaxCpus, Memory: w.resources.MaxMemory, Pids: w.resources.MaxPids}
+
+	limits := defaults.Merge(resources)
+	if err := limits.Within(maximums); err != nil {
+		return jobs.Resources{}, err
+	}
+	return maximums.Merge(&limits), nil
+}
+
+func containerResources(limits jobs.Resources) container.Resources {
+	resources := container.Resources{NanoCPUs: int64(limits.Cpus * 1e9)}
+
+	// NOTE: memory is validated with configs, limit which can't be parsed is not applied
+	if memory, err := jobs.ParseMemory(limits.Memory); err == nil && memory > 0 {
+		resources.Memory = memory
+		// swap would let container outgrow its memory limit
+		resources.MemorySwap = memory
+	}
+	if limits.Pids > 0 {
+		resources.PidsLimit = &limits.Pids
+	}
+
+	return resources
+}
+
+// updateLimits changes limits of running container.
+// NOTE: docker doesn't lift cpus and memory limits of running container, so job without them keeps limits of
+// previous job unless worker has defaults
+func (w *Worker) updateLimits(containerId string, limits jobs.Resources) error {
+	const op = `worker.updateLimits`
+
+	resources := containerResources(limits)
+	if resources.PidsLimit == nil {
+		unlimited := int64(-1)
+		resources.PidsLimit = &unlimited
+	}
+
+	if _, err := w.dockerClient.ContainerUpdate(w.ctx, containerId, container.UpdateConfig{Resources: resources}); err != nil {
+		return fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	return nil
+}
+
+// oomKills returns how many processes of container were killed for running out of memory, counter is read from
+// memory.events on cgroup v2 and from memory.oom_control on cgroup v1.
+func (w *Worker) oomKills(containerId string) (int, error) {
+	const op = `worker.oomKills`
+
+	output, exitCode, err := w.execCommandWithLogs(containerId, container.ExecOptions{
+		Cmd:          []string{"sh", "-c", "cat /sys/fs/cgroup/memory.events 2>/dev/null || cat /sys/fs/cgroup/memory/memory.oom_control"},
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+	if exitCode != 0 {
+		return 0, fmt.Errorf("op: %s, err: memory events are unavailable: %s", op, strings.TrimSpace(string(output)))
+	}
+
+	for _, line := range strings.Split(string(output), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && fields[0] == "oom_kill" {
+			kills, err := strconv.Atoi(fields[1])
+			if err != nil {
+				return 0, fmt.Errorf("op: %s, err: %w", op, err)
+			}
+			return kills, nil
+		}
+	}
+
+	return 0, fmt.Errorf("op: %s, err: oom kill counter not found", op)
+}
+
+func (w *Worker) removeWorkspace(workspaceVolume string) {
+	if err := w.dockerClient.VolumeRemove(context.Background(), workspaceVolume, true); err != nil {
+		slog.Warn("failed to remove workspace volume", logger.Err(err))
+	}
+}
+
+// NOTE: status of interrupted pipeline is not updated, it is put back to the queue instead
+func (w *Worker) updateStatus(status string) {
+	if w.ctx.Err() != nil {
+		return
+	}
+
+	err := w.storage.UpdatePipelineStatus(w.pipelineId, status)
+	if err != nil {
+		slog.Error("error while updating pipeline status", logger.Err(err))
+	}
+}
+
+func (w *Worker) completedJobs(pipelineId int64) (map[string]int, error) {
+	const op = `worker.completedJobs`
+
+	logs, err := w.storage.GetPipelineLogs(pipelineId)
+	if err != nil {
+		return nil, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	completed := make(map[string]int)
+	for _, log := range logs {
+		if log.FinalStatus != storage.LOG_STATUS_SUCCEEDED && log.FinalStatus != storage.LOG_STATUS_SKIPPED {
+			continue
+		}
+		jobName, _, _ := strings.Cut(log.CommandName, ":")
+		completed[jobName]++
+	}
+
+	return completed, nil
+}
+
+func (w *Worker) cloneRepository(containerId string, pipelineInfo *storage.PipelinesTable, depth int, env []string) error {
+	const op = `worker.cloneRepository`
+
+	// NOTE: ref is fetched explicitly instead of clone --branch, so tags, pull request refs and commits work too
+	fullRef := vcs.FullRef(pipelineInfo.RefType, pipelineInfo.Ref)
+
+	if err := w.execGit(containerId, env, "init", "-q", WORKSPACE_DIR); err != nil {
+		return fmt.Errorf("op: %s, err: %w", op, err)
+	}
+	if err := w.execGit(containerId, env, "-C", WORKSPACE_DIR, "remote", "add", "origin", pipelineInfo.Repository); err != nil {
+		return fmt.Errorf("op: %s, err: %w", op, err)
+	}
+	if err := w.fetch(containerId, env, depth, fullRef); err != nil {
+		return fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	// NOTE: pipelines created before commit resolution may have no commit, fetched ref tip is used then
+	target := pipelineInfo.Commit
+	if target == "" {
+		target = "FETCH_HEAD"
+	}
+
+	err := w.execGit(containerId, env, "-C", WORKSPACE_DIR, "checkout", "-q", "--detach", target)
+	if err != nil {
+		if depth == 0 || target == "FETCH_HEAD" {
+			return fmt.Errorf("op: %s, err: %w", op, err)
+		}
+
+		// commit is outside of shallow history, so it is fetched by sha
+		slog.Debug("commit is outside of shallow clone, fetching it", slog.String("commit", target))
+		if err := w.fetch(containerId, env, depth, target); err != nil {
+			return fmt.Errorf("op: %s, err: %w", op, err)
+		}
+		if err := w.execGit(containerId, env, "-C", WORKSPACE_DIR, "checkout", "-q", "--detach", target); err != nil {
+			return fmt.Errorf("op: %s, err: %w", op, err)
+		}
+	}
+
+	if pipelineInfo.RefType == vcs.REF_TYPE_BRANCH {
+		if err := w.execGit(containerId, env, "-C", WORKSPACE_DIR, "checkout", "-q", "-B", pipelineInfo.Ref); err != nil {
+			return fmt.Errorf("op: %s, err: %w", op, err)
+		}
+	}
+
+	return nil
+}
+
+func (w *Worker) fetch(containerId string, env []string, depth int, ref string) error {
+	fetchArgs := []string{"-C", WORKSPACE_DIR, "fetch", "--no-tags"}
+	if depth > 0 {
+		fetchArgs = append(fetchArgs, fmt.Sprintf("--depth=%d", depth))
+	}
+	fetchArgs = append(fetchArgs, w.fetchRemote, ref)
+
+	return w.execGit(containerId, env, fetchArgs...)
+}
+
+func (w *Worker) finalizeCheckout(containerId string, pipelineInfo *storage.PipelinesTable, checkout vcs.CheckoutOptions, clonedDepth int, env []string) error {
+	const op = `worker.finalizeCheckout`
+
+	fullRef := vcs.FullRef(pipelineInfo.RefType, pipelineInfo.Ref)
+
+	depth := checkout.GetDepth()
+	if depth == 0 && clonedDepth > 0 {
+		if err := w.execGit(containerId, env, "-C", WORKSPACE_DIR, "fetch", "--no-tags", "--unshallow", w.fetchRemote, fullRef); err != nil {
+			return fmt.Errorf("op: %s, err: %w", op, err)
+		}
+	} else if depth > clonedDepth && clonedDepth > 0 {
+		if err := w.fetch(containerId, env, depth, fullRef); err != nil {
+			return fmt.Errorf("op: %s, err: %w", op, err)
+		}
+	}
+
+	if checkout.GetFetchTags() {
+		fetchArgs := []string{"-C", WORKSPACE_DIR, "fetch", "--tags", w.fetchRemote}
+		if depth > 0 {
+			fetchArgs = append(fetchArgs, fmt.Sprintf("--depth=%d", depth))
+		}
+		if err := w.execGit(containerId, env, fetchArgs...); err != nil {
+			return fmt.Errorf("op: %s, err: %w", op, err)
+		}
+	}
+
+	if checkout.Submodules == vcs.SUBMODULES_ENABLED || checkout.Submodules == vcs.SUBMODULES_RECURSIVE {
+		submoduleArgs := []string{"-C", WORKSPACE_DIR, "submodule", "update", "--init"}
+		if checkout.Submodules == vcs.SUBMODULES_RECURSIVE {
+			submoduleArgs = append(submoduleArgs, "--recursive")
+		}
+		if depth > 0 {
+			submoduleArgs = append(submoduleArgs, fmt.Sprintf("--depth=%d", depth))
+		}
+		if err := w.execGit(containerId, env, submoduleArgs...); err != nil {
+			return fmt.Errorf("op: %s, err: %w", op, err)
+		}
+	}
+
+	if checkout.GetLFS() {
+		if err := w.execGit(containerId, env, "-C", WORKSPACE_DIR, "lfs", "install", "--local"); err != nil {
+			return fmt.Errorf("op: %s, err: %w", op, err)
+		}
+		if err := w.execGit(containerId, env, "-C", WORKSPACE_DIR, "lfs", "pull"); err != nil {
+			return fmt.Errorf("op: %s, err: %w", op, err)
+		}
+	}
+
+	return nil
+}
+
+func (w *Worker) execGit(containerId string, env []string, args ...string) error {
+	execConfig := container.ExecOptions{
+		Cmd:          append([]string{"git"}, args...),
+		Env:          env,
+		AttachStdout: true,
+		AttachStderr: true,
+	}
+
+	logs, exitCode, err := w.execCommandWithLogs(containerId, execConfig)
+	if err != nil {
+		return err
+	}
+	if exitCode != 0 {
+		slog.Warn("git command failed", slog.String("command", args[0]), slog.Int("exit_code", exitCode), slog.String("logs", string(logs)))
+		return fmt.Errorf("git %s: exit code: %d", args[0], exitCode)
+	}
+
+	return nil
+}
+
+func (w *Worker) injectCredentials(containerId, repository string) ([]string, error) {
+	const op = `worker.injectCredentials`
+
+	if w.credentials == nil {
+		return nil, nil
+	}
+
+	credentials, err := w.credentials.Get(repository)
+	if err != nil {
+		return nil, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+	if credentials == nil {
+		return nil, nil
+	}
+
+	files, err := credentials.Files(repository)
+	if err != nil {
+		return nil, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	// NOTE: secrets are copied as files, so they never show up in exec arguments, env or logs
+	var archive bytes.Buffer
+	tw := tar.NewWriter(&archive)
+	dir := strings.TrimPrefix(CREDENTIALS_DIR, "/")
+	if err := tw.WriteHeader(&tar.Header{Typeflag: tar.TypeDir, Name: dir + "/", Mode: 0700}); err != nil {
+		return nil, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+	for name, content := range files {
+		header := &tar.Header{Typeflag: tar.TypeReg, Name: dir + "/" + name, Mode: 0600, Size: int64(len(content))}
+		if err := tw.WriteHeader(header); err != nil {
+			return nil, fmt.Errorf("op: %s, err: %w", op, err)
+		}
+		if _, err := tw.Write(content); err != nil {
+			return nil, fmt.Errorf("op: %s, err: %w", op, err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	err = w.dockerClient.CopyToContainer(context.Background(), containerId, "/", &archive, container.CopyToContainerOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	return credentials.Env(CREDENTIALS_DIR), nil
+}
+
+func (w *Worker) removeCredentials(containerId string) {
+	_, _, err := w.execCommandWithLogs(containerId, container.ExecOptions{Cmd: []string{"rm", "-rf", CREDENTIALS_DIR}})
+	if err != nil {
+		slog.Error("error while removing credentials from container", logger.Err(err))
+	}
+}
+
+func (w *Worker) execCommandWithExitCode(containerId string, execOpts container.ExecOptions) (int, error) {
+	const op = `worker.ExecCommandWithExitCode`
+
+	ctx := w.ctx
 
 	execIDResp, err := w.dockerClient.ContainerExecCreate(ctx, containerId, execOpts)
 	if err != nil {
@@ -273,7 +1479,7 @@ func (w *Worker) execCommandWithExitCode(containerId string, execOpts container.
 func (w *Worker) execCommandWithLogs(containerId string, execOpts container.ExecOptions) ([]byte, int, error) {
 	const op = `worker.ExecCommandWithLogs`
 
-	ctx := context.Background()
+	ctx := w.ctx
 
 	execIDResp, err := w.dockerClient.ContainerExecCreate(ctx, containerId, execOpts)
 	if err != nil {
@@ -312,25 +1518,204 @@ func (w *Worker) execCommandWithLogs(containerId string, execOpts container.Exec
 	return outBuf.Bytes(), exitCode, nil
 }
 
-func (w *Worker) readCiConfig(containerId string) ([]jobs.Job, error) {
-	const op = `worker.readCiConfig`
-	execConfig := container.ExecOptions{
-		Cmd:          []string{"cat", DEFAULT_CI_CONFIG_PATH},
+func (w *Worker) resolveConfigFile(containerId string, pipelineInfo *storage.PipelinesTable) (string, error) {
+	const op = `worker.resolveConfigFile`
+
+	configFiles := []string{pipelineInfo.ConfigFile}
+	if pipelineInfo.ConfigFile == "" {
+		var err error
+		configFiles, err = w.discoverConfigFiles(containerId, pipelineInfo.Repository)
+		if err != nil {
+			return "", fmt.Errorf("op: %s, err: %w", op, err)
+		}
+
+		if err := w.storage.UpdatePipelineConfigFile(w.pipelineId, configFiles[0]); err != nil {
+			return "", fmt.Errorf("op: %s, err: %w", op, err)
+		}
+		// NOTE: reruns already have their siblings, so only pipelines created by push fan out
+		if len(configFiles) > 1 && pipelineInfo.RerunOf == 0 {
+			if err := w.storage.CreateSiblingPipelines(w.pipelineId, configFiles[1:]); err != nil {
+				return "", fmt.Errorf("op: %s, err: %w", op, err)
+			}
+		}
+	}
+
+	configFile := configFiles[0]
+	if err := jobs.ValidateConfigPath(configFile); err != nil {
+		return configFile, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	_, exitCode, err := w.execCommandWithLogs(containerId, container.ExecOptions{
+		Cmd: []string{"test", "-f", path.Join(WORKSPACE_DIR, configFile)},
+	})
+	if err != nil {
+		return configFile, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+	if exitCode != 0 {
+		return configFile, ErrConfigNotFound
+	}
+
+	return configFile, nil
+}
+
+// discoverConfigFiles returns repository config path if it is set, every yaml file of pipelines dir if it exists
+// and global config path otherwise.
+func (w *Worker) discoverConfigFiles(containerId, repository string) ([]string, error) {
+	const op = `worker.discoverConfigFiles`
+
+	settings, err := w.storage.GetRepositorySettings(repository)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return nil, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+	if settings != nil && settings.CiConfigPath != "" {
+		return []string{settings.CiConfigPath}, nil
+	}
+
+	pipelinesDir := path.Join(WORKSPACE_DIR, w.ci.PipelinesDir)
+	output, exitCode, err := w.execCommandWithLogs(containerId, container.ExecOptions{
+		Cmd:          []string{"find", pipelinesDir, "-mindepth", "1", "-maxdepth", "1", "-type", "f", "-name", "*.yaml"},
 		AttachStdout: true,
 		AttachStderr: true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+
+	// NOTE: find fails when directory doesn't exist
+	var configFiles []string
+	if exitCode == 0 {
+		for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+			if line == "" {
+				continue
+			}
+			configFiles = append(configFiles, strings.TrimPrefix(line, WORKSPACE_DIR+"/"))
+		}
+	}
+	if len(configFiles) == 0 {
+		return []string{w.ci.ConfigPath}, nil
 	}
 
-	data, _, err := w.execCommandWithLogs(containerId, execConfig)
+	sort.Strings(configFiles)
+	return configFiles, nil
+}
+
+func (w *Worker) readCiConfig(containerId, repository, configFile string) (*jobs.Pipeline, error) {
+	const op = `worker.readCiConfig`
+
+	data, err := w.readWorkspaceFile(containerId, configFile)
 	if err != nil {
 		return nil, fmt.Errorf("op: %s, err: %w", op, err)
 	}
 
-	jobs, err := jobs.ParseJobsOrdered(data)
+	// NOTE: warnings are stored too, so they are visible for pipelines which run
+	diagnostics := jobs.Lint(data)
+	if !jobs.HasErrors(diagnostics) {
+		expanded, err := jobs.Expand(data, &configLoader{worker: w, containerId: containerId, repository: repository})
+		var configErr *jobs.ConfigError
+		switch {
+		case errors.As(err, &configErr):
+			diagnostics = append(diagnostics, jobs.Diagnostic{
+				Line:     configErr.Line,
+				Column:   configErr.Column,
+				Severity: jobs.SEVERITY_ERROR,
+				Message:  configErr.Error(),
+			})
+		case err != nil:
+			return nil, fmt.Errorf("op: %s, err: %w", op, err)
+		default:
+			if err := w.storage.UpdatePipelineConfig(w.pipelineId, string(expanded)); err != nil {
+				return nil, fmt.Errorf("op: %s, err: %w", op, err)
+			}
+			// lines of expanded config differ from the file, they point to config returned by api
+			if string(expanded) != string(data) {
+				for _, diagnostic := range jobs.Lint(expanded) {
+					diagnostic.Message = "expanded config: " + diagnostic.Message
+					diagnostics = append(diagnostics, diagnostic)
+				}
+			}
+			data = expanded
+		}
+	}
+
+	if len(diagnostics) > 0 {
+		diagnosticsData, err := json.Marshal(diagnostics)
+		if err != nil {
+			return nil, fmt.Errorf("op: %s, err: %w", op, err)
+		}
+		if err := w.storage.UpdatePipelineDiagnostics(w.pipelineId, string(diagnosticsData)); err != nil {
+			return nil, fmt.Errorf("op: %s, err: %w", op, err)
+		}
+	}
+	if jobs.HasErrors(diagnostics) {
+		return nil, ErrInvalidConfig
+	}
+
+	pipeline, err := jobs.ParsePipeline(data)
 	if err != nil {
 		return nil, fmt.Errorf("op: %s, err: %w", op, err)
 	}
 
-	return jobs, nil
+	return pipeline, nil
+}
+
+func (w *Worker) readWorkspaceFile(containerId, file string) ([]byte, error) {
+	const op = `worker.readWorkspaceFile`
+	execConfig := container.ExecOptions{
+		Cmd:          []string{"cat", path.Join(WORKSPACE_DIR, file)},
+		AttachStdout: true,
+		AttachStderr: true,
+	}
+
+	data, exitCode, err := w.execCommandWithLogs(containerId, execConfig)
+	if err != nil {
+		return nil, fmt.Errorf("op: %s, err: %w", op, err)
+	}
+	if exitCode != 0 {
+		return nil, vcs.ErrFileNotFound
+	}
+
+	return data, nil
+}
+
+// configLoader loads files included by ci config, local ones from workspace and others from their repositories.
+type configLoader struct {
+	worker      *Worker
+	containerId string
+	repository  string
+}
+
+func (l *configLoader) Load(repository, ref, file string) ([]byte, error) {
+	var (
+		data []byte
+		err  error
+	)
+	if repository == "" {
+		data, err = l.worker.readWorkspaceFile(l.containerId, file)
+	} else {
+		data, err = vcs.NewResolver(l.worker.scopedCredentials(l.repository)).ReadFile(repository, ref, file)
+	}
+
+	switch {
+	case errors.Is(err, vcs.ErrFileNotFound):
+		return nil, vcs.ErrFileNotFound
+	case errors.Is(err, vcs.ErrRefNotFound):
+		return nil, vcs.ErrRefNotFound
+	case err != nil:
+		slog.Error("error while loading included ci config", slog.String("file", file), logger.Err(err))
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// scopedCredentials returns credentials which ci config of repository reads other repositories with, for includes
+// and for branches of pipelines it triggers, only its own and trusted repositories are read with credentials.
+// NOTE: runner is given credentials of the same repositories by server, so config reads the same on both
+func (w *Worker) scopedCredentials(repository string) vcs.CredentialsProvider {
+	if w.credentials == nil {
+		return nil
+	}
+	return vcs.ScopedCredentials{Provider: w.credentials, Repository: repository, Trusted: w.ci.IsTrustedRepository}
 }
 
 func (w *Worker) cleanupContainer(containerID string) error {
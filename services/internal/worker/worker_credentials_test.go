@@ -0,0 +1,45 @@
+package worker
+
+import (
+	"pipecraft/internal/config"
+	"pipecraft/internal/vcs"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type credentialsMap map[string]*vcs.Credentials
+
+func (c credentialsMap) Get(repository string) (*vcs.Credentials, error) {
+	return c[repository], nil
+}
+
+func (c credentialsMap) GetRegistry(repository, registry string) (*RegistryCredentials, error) {
+	return nil, nil
+}
+
+// includes and branches of downstream pipelines are read with credentials of own and trusted repositories only
+func TestScopedCredentials(t *testing.T) {
+	w := &Worker{
+		credentials: credentialsMap{
+			"own":       {Kind: vcs.CREDENTIALS_KIND_HTTPS, Token: "own"},
+			"templates": {Kind: vcs.CREDENTIALS_KIND_HTTPS, Token: "templates"},
+			"other":     {Kind: vcs.CREDENTIALS_KIND_HTTPS, Token: "other"},
+		},
+		ci: config.CI{TrustedRepositories: []string{"templates"}},
+	}
+	scoped := w.scopedCredentials("own")
+
+	for _, repository := range []string{"own", "templates"} {
+		credentials, err := scoped.Get(repository)
+		require.NoError(t, err)
+		require.Equal(t, repository, credentials.Token)
+	}
+
+	credentials, err := scoped.Get("other")
+	require.NoError(t, err)
+	require.Nil(t, credentials)
+
+	// worker without credentials reads every repository anonymously
+	require.Nil(t, (&Worker{}).scopedCredentials("own"))
+}
@@ -0,0 +1,273 @@
+package worker
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"pipecraft/internal/jobs"
+	"pipecraft/internal/storage"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/registry"
+	"github.com/docker/docker/client"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeEngine stands for docker daemon, it streams build and push output like daemon does and records requests.
+type fakeEngine struct {
+	mu            sync.Mutex
+	buildQuery    map[string][]string
+	buildFiles    map[string]string
+	registryAuths map[string]registry.AuthConfig
+	pushed        map[string]registry.AuthConfig
+	removed       []string
+	buildError    string
+}
+
+func (e *fakeEngine) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	path := r.URL.Path[strings.Index(r.URL.Path[1:], "/")+1:]
+	switch {
+	case r.Method == http.MethodPost && path == "/build":
+		e.buildQuery = r.URL.Query()
+		e.buildFiles = map[string]string{}
+		tr := tar.NewReader(r.Body)
+		for {
+			header, err := tr.Next()
+			if err != nil {
+				break
+			}
+			content, _ := io.ReadAll(tr)
+			e.buildFiles[header.Name] = string(content)
+		}
+
+		config, _ := base64.URLEncoding.DecodeString(r.Header.Get("X-Registry-Config"))
+		json.Unmarshal(config, &e.registryAuths)
+
+		fmt.Fprintln(w, `{"stream":"Step 1/1 : FROM scratch\n"}`)
+		if e.buildError != "" {
+			fmt.Fprintf(w, `{"errorDetail":{"message":%q},"error":%q}`+"\n", e.buildError, e.buildError)
+			return
+		}
+		fmt.Fprintln(w, `{"stream":"Successfully built 0123456789ab\n"}`)
+	case r.Method == http.MethodPost && strings.HasSuffix(path, "/push"):
+		var auth registry.AuthConfig
+		data, _ := base64.URLEncoding.DecodeString(r.Header.Get(registry.AuthHeader))
+		json.Unmarshal(data, &auth)
+
+		image := strings.TrimSuffix(strings.TrimPrefix(path, "/images/"), "/push") + ":" + r.URL.Query().Get("tag")
+		e.pushed[image] = auth
+		fmt.Fprintf(w, `{"status":"%s: digest: sha256:0123 size: 42"}`+"\n", r.URL.Query().Get("tag"))
+	case r.Method == http.MethodDelete && strings.HasPrefix(path, "/images/"):
+		e.removed = append(e.removed, strings.TrimPrefix(path, "/images/"))
+		fmt.Fprintln(w, `[]`)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func newFakeEngine(t *testing.T) (*fakeEngine, *client.Client) {
+	engine := &fakeEngine{pushed: map[string]registry.AuthConfig{}}
+	server := httptest.NewServer(engine)
+	t.Cleanup(server.Close)
+
+	dockerClient, err := client.NewClientWithOpts(client.WithHost("tcp://"+server.Listener.Addr().String()), client.WithVersion("1.47"))
+	require.NoError(t, err)
+
+	return engine, dockerClient
+}
+
+// workspaceArchive returns archive of directory like docker copies it out of container.
+func workspaceArchive(t *testing.T, dir string, files map[string]string) *bytes.Buffer {
+	var archive bytes.Buffer
+	tw := tar.NewWriter(&archive)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Typeflag: tar.TypeDir, Name: dir + "/", Mode: 0755}))
+	for name, content := range files {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: dir + "/" + name, Mode: 0644, Size: int64(len(content))}))
+		_, err := tw.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	return &archive
+}
+
+func TestBuildContext(t *testing.T) {
+	archive := workspaceArchive(t, "app", map[string]string{
+		"Dockerfile":  "FROM scratch",
+		"src/main.go": "package main",
+	})
+
+	tr := tar.NewReader(buildContext(archive))
+	files := map[string]string{}
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		content, _ := io.ReadAll(tr)
+		files[header.Name] = string(content)
+	}
+
+	require.Equal(t, map[string]string{"Dockerfile": "FROM scratch", "src/main.go": "package main"}, files)
+}
+
+// logStorage keeps logs of steps, other methods of storage are not called by step log.
+type logStorage struct {
+	Storage
+	logs map[int64]*storage.LogsTable
+}
+
+func (s *logStorage) StartLog(logTable storage.LogsTable) (int64, error) {
+	logTable.LogId = int64(len(s.logs) + 1)
+	logTable.FinalStatus = storage.LOG_STATUS_RUNNING
+	s.logs[logTable.LogId] = &logTable
+	return logTable.LogId, nil
+}
+
+func (s *logStorage) AppendLog(pipelineId, logId int64, results, finalStatus string) error {
+	log, ok := s.logs[logId]
+	if !ok || log.PipelineId != pipelineId {
+		return storage.ErrNotFound
+	}
+	log.Results += results
+	log.FinalStatus = finalStatus
+	return nil
+}
+
+func TestStepLog(t *testing.T) {
+	logs := &logStorage{logs: map[int64]*storage.LogsTable{}}
+	w := &Worker{storage: logs}
+
+	stepLog, err := w.startStepLog(storage.LogsTable{CommandName: "build:image", PipelineId: 1})
+	require.NoError(t, err)
+
+	// output is kept until flush interval passes
+	fmt.Fprintln(stepLog, "Step 1/2 : FROM scratch")
+	require.Equal(t, "", logs.logs[1].Results)
+
+	stepLog.flushedAt = time.Now().Add(-STEP_LOG_FLUSH_INTERVAL)
+	fmt.Fprintln(stepLog, "Step 2/2 : COPY . .")
+	require.Equal(t, "Step 1/2 : FROM scratch\nStep 2/2 : COPY . .\n", logs.logs[1].Results)
+	require.Equal(t, storage.LOG_STATUS_RUNNING, logs.logs[1].FinalStatus)
+
+	fmt.Fprintln(stepLog, "Successfully built 0123456789ab")
+	require.NoError(t, stepLog.finish("", storage.LOG_STATUS_SUCCEEDED))
+	require.Equal(t, "Step 1/2 : FROM scratch\nStep 2/2 : COPY . .\nSuccessfully built 0123456789ab\n", logs.logs[1].Results)
+	require.Equal(t, storage.LOG_STATUS_SUCCEEDED, logs.logs[1].FinalStatus)
+}
+
+func TestCheckReservedTags(t *testing.T) {
+	images := []string{DIND_GIT_IMAGE_NAME, "docker:28-dind"}
+
+	require.NoError(t, checkReservedTags([]string{"localhost:5000/dind-git:latest", "ysayonnar/docker:1.0.0"}, images...))
+
+	for _, tag := range []string{"dind-git:latest", "dind-git:0123456", "docker:latest", "docker.io/library/docker:28-dind"} {
+		err := checkReservedTags([]string{"ysayonnar/pipecraft:latest", tag}, images...)
+		require.ErrorIs(t, err, ErrDockerBuildFailed, tag)
+	}
+}
+
+func TestBuildImage_Push(t *testing.T) {
+	engine, dockerClient := newFakeEngine(t)
+
+	auth := registry.AuthConfig{Username: "ysayonnar", Password: "password", ServerAddress: "localhost:5000"}
+	var output bytes.Buffer
+	err := buildImage(context.Background(), dockerClient, imageBuild{
+		Context:    buildContext(workspaceArchive(t, "workspace", map[string]string{"docker/app.dockerfile": "FROM scratch"})),
+		Dockerfile: "docker/app.dockerfile",
+		Args:       map[string]string{"VERSION": "1.0.0"},
+		Tags:       []string{"localhost:5000/pipecraft:0123456", "ysayonnar/pipecraft:latest"},
+		Push:       true,
+		Limits:     jobs.Resources{Cpus: 1.5, Memory: "512m"},
+		Auths:      map[string]registry.AuthConfig{"localhost:5000": auth},
+		RemoveTags: true,
+	}, &output)
+	require.NoError(t, err)
+
+	require.Equal(t, []string{"localhost:5000/pipecraft:0123456", "ysayonnar/pipecraft:latest"}, engine.buildQuery["t"])
+	require.Equal(t, "docker/app.dockerfile", engine.buildQuery["dockerfile"][0])
+	require.Equal(t, `{"VERSION":"1.0.0"}`, engine.buildQuery["buildargs"][0])
+	require.Equal(t, "150000", engine.buildQuery["cpuquota"][0])
+	require.Equal(t, "536870912", engine.buildQuery["memory"][0])
+	require.Equal(t, "FROM scratch", engine.buildFiles["docker/app.dockerfile"])
+	require.Equal(t, "password", engine.registryAuths["localhost:5000"].Password)
+
+	// registry without credentials is pushed to anonymously
+	require.Equal(t, auth, engine.pushed["localhost:5000/pipecraft:0123456"])
+	require.Equal(t, registry.AuthConfig{}, engine.pushed["ysayonnar/pipecraft:latest"])
+
+	require.Contains(t, output.String(), "Step 1/1 : FROM scratch")
+	require.Contains(t, output.String(), "pushing localhost:5000/pipecraft:0123456")
+	require.Contains(t, output.String(), "0123456: digest: sha256:0123")
+	require.NotContains(t, output.String(), auth.Password)
+
+	require.Len(t, engine.removed, 2)
+}
+
+func TestBuildImage_Failed(t *testing.T) {
+	engine, dockerClient := newFakeEngine(t)
+	engine.buildError = "The command '/bin/sh -c make' returned a non-zero code: 2"
+
+	var output bytes.Buffer
+	err := buildImage(context.Background(), dockerClient, imageBuild{
+		Context: buildContext(workspaceArchive(t, "workspace", map[string]string{"Dockerfile": "FROM scratch"})),
+		Tags:    []string{"localhost:5000/pipecraft:latest"},
+		Push:    true,
+	}, &output)
+	require.ErrorIs(t, err, ErrDockerBuildFailed)
+	require.ErrorContains(t, err, engine.buildError)
+
+	require.Contains(t, output.String(), "Step 1/1 : FROM scratch")
+	require.Empty(t, engine.pushed)
+	// daemon of pipeline keeps built image, it is removed with sidecar
+	require.Empty(t, engine.removed)
+}
+
+// TestBuildImage_Registry builds and pushes image with docker daemon of environment to registry given by
+// PIPECRAFT_TEST_REGISTRY, like one run with docker run -d -p 5000:5000 registry:2.
+func TestBuildImage_Registry(t *testing.T) {
+	registryHost := os.Getenv("PIPECRAFT_TEST_REGISTRY")
+	if registryHost == "" {
+		t.Skip("PIPECRAFT_TEST_REGISTRY is not set")
+	}
+
+	dockerClient, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	require.NoError(t, err)
+
+	tag := fmt.Sprintf("%s/pipecraft-test:%d", registryHost, time.Now().UnixNano())
+	var output bytes.Buffer
+	err = buildImage(context.Background(), dockerClient, imageBuild{
+		Context: buildContext(workspaceArchive(t, "workspace", map[string]string{
+			"Dockerfile": "FROM scratch\nARG VERSION\nLABEL version=$VERSION\nCOPY version /\n",
+			"version":    "1.0.0",
+		})),
+		Dockerfile: jobs.DEFAULT_DOCKERFILE,
+		Args:       map[string]string{"VERSION": "1.0.0"},
+		Tags:       []string{tag},
+		Push:       true,
+	}, &output)
+	require.NoError(t, err, output.String())
+
+	response, err := http.Get(fmt.Sprintf("http://%s/v2/pipecraft-test/tags/list", registryHost))
+	require.NoError(t, err)
+	defer response.Body.Close()
+
+	var tags struct {
+		Tags []string `json:"tags"`
+	}
+	require.NoError(t, json.NewDecoder(response.Body).Decode(&tags))
+	require.Contains(t, tags.Tags, tag[strings.LastIndex(tag, ":")+1:])
+}
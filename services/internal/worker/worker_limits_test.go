@@ -0,0 +1,27 @@
+package worker
+
+import (
+	"pipecraft/internal/config"
+	"pipecraft/internal/jobs"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestJobLimits(t *testing.T) {
+	w := &Worker{resources: config.Resources{Cpus: 2, Memory: "4g", MaxCpus: 8, MaxMemory: "16g", MaxPids: 4096}}
+
+	limits, err := w.jobLimits(nil)
+	require.NoError(t, err)
+	require.Equal(t, jobs.Resources{Cpus: 2, Memory: "4g", Pids: 4096}, limits)
+
+	limits, err = w.jobLimits(&jobs.Resources{Cpus: 8, Memory: "16g", Pids: 100})
+	require.NoError(t, err)
+	require.Equal(t, jobs.Resources{Cpus: 8, Memory: "16g", Pids: 100}, limits)
+
+	// job can't get more of host than maximums of worker
+	_, err = w.jobLimits(&jobs.Resources{Memory: "64g"})
+	require.ErrorIs(t, err, jobs.ErrInvalidResources)
+	_, err = w.jobLimits(&jobs.Resources{Cpus: 16})
+	require.ErrorIs(t, err, jobs.ErrInvalidResources)
+}
@@ -0,0 +1,141 @@
+package worker_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"pipecraft/internal/config"
+	"pipecraft/internal/services"
+	"pipecraft/internal/storage"
+	"pipecraft/internal/worker"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type reaperBackend struct {
+	storage *services.StorageMock
+}
+
+func (b reaperBackend) ClaimNextPipeline(ctx context.Context) (int64, error) {
+	return 0, storage.ErrNotFound
+}
+
+func (b reaperBackend) Pipeline(pipelineId int64) (worker.Storage, worker.Credentials) {
+	return b.storage, nil
+}
+
+func (b reaperBackend) Labels() []string {
+	return nil
+}
+
+type resource struct {
+	Name   string
+	Labels map[string]string
+}
+
+// reaperEngine stands for docker daemon which has containers, networks and volumes of pipelines.
+type reaperEngine struct {
+	mu         sync.Mutex
+	containers []resource
+	networks   []resource
+	volumes    []resource
+	removed    []string
+}
+
+func (e *reaperEngine) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	path := r.URL.Path[strings.Index(r.URL.Path[1:], "/")+1:]
+	switch {
+	case r.Method == http.MethodGet && path == "/containers/json":
+		containers := []map[string]any{}
+		for _, c := range e.containers {
+			containers = append(containers, map[string]any{"Id": c.Name, "Names": []string{"/" + c.Name}, "Labels": c.Labels})
+		}
+		json.NewEncoder(w).Encode(containers)
+	case r.Method == http.MethodGet && path == "/networks":
+		json.NewEncoder(w).Encode(e.networks)
+	case r.Method == http.MethodGet && path == "/volumes":
+		json.NewEncoder(w).Encode(map[string]any{"Volumes": e.volumes})
+	case r.Method == http.MethodDelete:
+		e.removed = append(e.removed, strings.TrimPrefix(path, "/"))
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func labels(pipelineId int64, instanceId string) map[string]string {
+	return map[string]string{worker.LABEL_PIPELINE_ID: fmt.Sprint(pipelineId), worker.LABEL_INSTANCE_ID: instanceId}
+}
+
+// instance of server is recreated with another instance id, what the previous one left is reaped unless pipeline
+// may still run on another instance
+func TestReaper_InstanceIdChanged(t *testing.T) {
+	storageMock := services.NewStorageMock()
+	create := func(ref, status, workspaceVolume string) int64 {
+		pipelineId, err := storageMock.CreatePipeline(storage.PipelinesTable{Repository: "ysayonnar/pipecraft", Ref: ref, WorkspaceVolume: workspaceVolume}, false)
+		require.NoError(t, err)
+		require.NoError(t, storageMock.UpdatePipelineStatus(pipelineId, status))
+		return pipelineId
+	}
+	finishedId := create("finished", storage.PIPELINE_STATUS_COMPLETED, "")
+	runningId := create("running", storage.PIPELINE_STATUS_RUNNING, "")
+	interruptedId := create("interrupted", storage.PIPELINE_STATUS_RUNNING, "")
+	pausedId := create("paused", storage.PIPELINE_STATUS_WAITING_FOR_APPROVAL, "pipeline-4-workspace")
+	unknownId := int64(42)
+
+	engine := &reaperEngine{
+		containers: []resource{
+			{Name: fmt.Sprintf("pipeline-%d", finishedId), Labels: labels(finishedId, "old-hostname")},
+			{Name: fmt.Sprintf("pipeline-%d", unknownId), Labels: labels(unknownId, "old-hostname")},
+			{Name: fmt.Sprintf("pipeline-%d", runningId), Labels: labels(runningId, "other-instance")},
+			{Name: fmt.Sprintf("pipeline-%d", interruptedId), Labels: labels(interruptedId, "pipecraft")},
+		},
+		networks: []resource{
+			{Name: fmt.Sprintf("pipeline-%d-network", finishedId), Labels: labels(finishedId, "old-hostname")},
+			{Name: fmt.Sprintf("pipeline-%d-network", runningId), Labels: labels(runningId, "other-instance")},
+		},
+		volumes: []resource{
+			{Name: fmt.Sprintf("pipeline-%d-workspace", unknownId), Labels: labels(unknownId, "old-hostname")},
+			{Name: "pipeline-4-workspace", Labels: labels(pausedId, "pipecraft")},
+		},
+	}
+	server := httptest.NewServer(engine)
+	t.Cleanup(server.Close)
+	t.Setenv("DOCKER_HOST", "tcp://"+server.Listener.Addr().String())
+	t.Setenv("DOCKER_API_VERSION", "1.47")
+
+	listener := worker.NewListener(reaperBackend{storage: storageMock}, nil, config.CI{}, config.Resources{}, config.Docker{}, "pipecraft", worker.NewPool(1), time.Second)
+	reaper := worker.NewReaper(listener)
+
+	orphans, err := reaper.Orphans(context.Background())
+	require.NoError(t, err)
+	require.ElementsMatch(t, []worker.Orphan{
+		{Kind: worker.ORPHAN_KIND_CONTAINER, Name: "pipeline-1", PipelineId: finishedId, Reason: worker.ORPHAN_REASON_FINISHED},
+		{Kind: worker.ORPHAN_KIND_CONTAINER, Name: "pipeline-42", PipelineId: unknownId, Reason: worker.ORPHAN_REASON_UNKNOWN},
+		{Kind: worker.ORPHAN_KIND_CONTAINER, Name: "pipeline-3", PipelineId: interruptedId, Reason: worker.ORPHAN_REASON_NOT_RUNNING},
+		{Kind: worker.ORPHAN_KIND_NETWORK, Name: "pipeline-1-network", PipelineId: finishedId, Reason: worker.ORPHAN_REASON_FINISHED},
+		{Kind: worker.ORPHAN_KIND_VOLUME, Name: "pipeline-42-workspace", PipelineId: unknownId, Reason: worker.ORPHAN_REASON_UNKNOWN},
+	}, orphans)
+
+	removed := reaper.Reap(context.Background())
+	require.Len(t, removed, len(orphans))
+
+	sort.Strings(engine.removed)
+	require.Equal(t, []string{
+		"containers/pipeline-1",
+		"containers/pipeline-3",
+		"containers/pipeline-42",
+		"networks/pipeline-1-network",
+		"volumes/pipeline-42-workspace",
+	}, engine.removed)
+}
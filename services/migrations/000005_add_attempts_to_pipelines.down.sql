@@ -0,0 +1,3 @@
+ALTER TABLE pipelines DROP COLUMN failed_only;
+ALTER TABLE pipelines DROP COLUMN rerun_of;
+ALTER TABLE pipelines DROP COLUMN attempt;
@@ -0,0 +1,3 @@
+ALTER TABLE pipelines ADD COLUMN attempt INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE pipelines ADD COLUMN rerun_of INTEGER REFERENCES pipelines(pipeline_id);
+ALTER TABLE pipelines ADD COLUMN failed_only BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,6 @@
+CREATE TABLE repository_credentials (
+    repository VARCHAR(255) PRIMARY KEY,
+    kind VARCHAR(16) NOT NULL,
+    secret BYTEA NOT NULL,
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
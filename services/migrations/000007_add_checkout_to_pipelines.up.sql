@@ -0,0 +1 @@
+ALTER TABLE pipelines ADD COLUMN checkout JSONB NOT NULL DEFAULT '{}';
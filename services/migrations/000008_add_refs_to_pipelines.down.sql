@@ -0,0 +1,3 @@
+DROP INDEX pipelines_ref_type_idx;
+ALTER TABLE pipelines DROP COLUMN ref_type;
+ALTER TABLE pipelines DROP COLUMN ref;
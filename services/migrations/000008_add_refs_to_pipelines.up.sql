@@ -0,0 +1,5 @@
+ALTER TABLE pipelines ADD COLUMN ref VARCHAR(255);
+UPDATE pipelines SET ref = COALESCE(branch, '');
+ALTER TABLE pipelines ALTER COLUMN ref SET NOT NULL;
+ALTER TABLE pipelines ADD COLUMN ref_type VARCHAR(16) NOT NULL DEFAULT 'branch';
+CREATE INDEX pipelines_ref_type_idx ON pipelines (ref_type, created_at);
@@ -0,0 +1,5 @@
+DROP TABLE repository_settings;
+
+DROP INDEX pipelines_source_config_file_idx;
+ALTER TABLE pipelines DROP COLUMN source_pipeline_id;
+ALTER TABLE pipelines DROP COLUMN config_file;
@@ -0,0 +1,9 @@
+ALTER TABLE pipelines ADD COLUMN config_file VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE pipelines ADD COLUMN source_pipeline_id INTEGER REFERENCES pipelines(pipeline_id);
+CREATE UNIQUE INDEX pipelines_source_config_file_idx ON pipelines (source_pipeline_id, config_file) WHERE rerun_of IS NULL;
+
+CREATE TABLE repository_settings (
+    repository VARCHAR(255) PRIMARY KEY,
+    ci_config_path VARCHAR(255) NOT NULL DEFAULT '',
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
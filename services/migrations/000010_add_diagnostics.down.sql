@@ -0,0 +1 @@
+ALTER TABLE pipelines DROP COLUMN diagnostics;
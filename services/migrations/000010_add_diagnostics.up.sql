@@ -0,0 +1 @@
+ALTER TABLE pipelines ADD COLUMN diagnostics JSONB NOT NULL DEFAULT '[]';
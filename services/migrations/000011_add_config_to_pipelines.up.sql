@@ -0,0 +1 @@
+ALTER TABLE pipelines ADD COLUMN config TEXT NOT NULL DEFAULT '';
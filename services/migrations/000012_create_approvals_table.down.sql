@@ -0,0 +1,3 @@
+DROP TABLE approvals;
+
+ALTER TABLE pipelines DROP COLUMN workspace_volume;
@@ -0,0 +1,12 @@
+ALTER TABLE pipelines ADD COLUMN workspace_volume VARCHAR(255) NOT NULL DEFAULT '';
+
+CREATE TABLE approvals (
+    approval_id SERIAL PRIMARY KEY,
+    pipeline_id INTEGER NOT NULL REFERENCES pipelines(pipeline_id),
+    job_name VARCHAR(255) NOT NULL,
+    status VARCHAR(16) NOT NULL,
+    decided_by VARCHAR(255) NOT NULL DEFAULT '',
+    decided_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    UNIQUE (pipeline_id, job_name)
+);
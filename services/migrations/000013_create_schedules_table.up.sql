@@ -0,0 +1,13 @@
+CREATE TABLE schedules (
+    schedule_id SERIAL PRIMARY KEY,
+    repository VARCHAR(255) NOT NULL,
+    branch VARCHAR(255) NOT NULL,
+    cron_expression VARCHAR(255) NOT NULL,
+    timezone VARCHAR(64) NOT NULL DEFAULT 'UTC',
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    next_run_at TIMESTAMPTZ,
+    last_run_at TIMESTAMPTZ,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+CREATE INDEX schedules_next_run_at_idx ON schedules (next_run_at) WHERE enabled;
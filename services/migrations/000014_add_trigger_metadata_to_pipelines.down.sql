@@ -0,0 +1,3 @@
+ALTER TABLE pipelines DROP COLUMN inputs;
+ALTER TABLE pipelines DROP COLUMN triggered_by;
+ALTER TABLE pipelines DROP COLUMN trigger;
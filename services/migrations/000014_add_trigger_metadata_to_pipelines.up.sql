@@ -0,0 +1,3 @@
+ALTER TABLE pipelines ADD COLUMN trigger VARCHAR(16) NOT NULL DEFAULT 'api';
+ALTER TABLE pipelines ADD COLUMN triggered_by VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE pipelines ADD COLUMN inputs JSONB NOT NULL DEFAULT '{}';
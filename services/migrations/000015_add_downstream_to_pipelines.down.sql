@@ -0,0 +1,3 @@
+DROP INDEX pipelines_parent_job_idx;
+ALTER TABLE pipelines DROP COLUMN parent_job;
+ALTER TABLE pipelines DROP COLUMN parent_pipeline_id;
@@ -0,0 +1,3 @@
+ALTER TABLE pipelines ADD COLUMN parent_pipeline_id INTEGER REFERENCES pipelines(pipeline_id);
+ALTER TABLE pipelines ADD COLUMN parent_job VARCHAR(255) NOT NULL DEFAULT '';
+CREATE UNIQUE INDEX pipelines_parent_job_idx ON pipelines (parent_pipeline_id, parent_job) WHERE parent_pipeline_id IS NOT NULL;
@@ -0,0 +1,5 @@
+DROP INDEX pipelines_concurrency_group_idx;
+ALTER TABLE pipelines DROP COLUMN cancel_requested;
+ALTER TABLE pipelines DROP COLUMN concurrency_group;
+
+DROP TABLE concurrency_locks;
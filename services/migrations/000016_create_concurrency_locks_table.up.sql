@@ -0,0 +1,11 @@
+CREATE TABLE concurrency_locks (
+    concurrency_group VARCHAR(255) PRIMARY KEY,
+    pipeline_id INTEGER NOT NULL REFERENCES pipelines(pipeline_id),
+    job_name VARCHAR(255) NOT NULL DEFAULT '',
+    acquired_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+CREATE INDEX concurrency_locks_pipeline_id_idx ON concurrency_locks (pipeline_id);
+
+ALTER TABLE pipelines ADD COLUMN concurrency_group VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE pipelines ADD COLUMN cancel_requested BOOLEAN NOT NULL DEFAULT FALSE;
+CREATE INDEX pipelines_concurrency_group_idx ON pipelines (concurrency_group) WHERE concurrency_group <> '';
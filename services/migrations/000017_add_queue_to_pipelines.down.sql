@@ -0,0 +1,7 @@
+ALTER TABLE repository_settings DROP COLUMN max_concurrent_pipelines;
+
+DROP INDEX pipelines_repository_started_at_idx;
+DROP INDEX pipelines_status_idx;
+ALTER TABLE pipelines DROP COLUMN finished_at;
+ALTER TABLE pipelines DROP COLUMN started_at;
+ALTER TABLE pipelines DROP COLUMN priority;
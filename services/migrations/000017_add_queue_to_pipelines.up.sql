@@ -0,0 +1,7 @@
+ALTER TABLE pipelines ADD COLUMN priority INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE pipelines ADD COLUMN started_at TIMESTAMP;
+ALTER TABLE pipelines ADD COLUMN finished_at TIMESTAMP;
+CREATE INDEX pipelines_status_idx ON pipelines (status, priority);
+CREATE INDEX pipelines_repository_started_at_idx ON pipelines (repository, started_at);
+
+ALTER TABLE repository_settings ADD COLUMN max_concurrent_pipelines INTEGER NOT NULL DEFAULT 0;
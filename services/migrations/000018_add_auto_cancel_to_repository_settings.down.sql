@@ -0,0 +1,2 @@
+ALTER TABLE repository_settings DROP COLUMN auto_cancel_running;
+ALTER TABLE repository_settings DROP COLUMN auto_cancel;
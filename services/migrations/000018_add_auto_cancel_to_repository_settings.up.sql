@@ -0,0 +1,2 @@
+ALTER TABLE repository_settings ADD COLUMN auto_cancel BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE repository_settings ADD COLUMN auto_cancel_running BOOLEAN NOT NULL DEFAULT FALSE;
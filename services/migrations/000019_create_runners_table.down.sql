@@ -0,0 +1,2 @@
+ALTER TABLE pipelines DROP COLUMN runner_id;
+DROP TABLE runners;
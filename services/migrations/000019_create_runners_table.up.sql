@@ -0,0 +1,10 @@
+CREATE TABLE runners (
+    runner_id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    last_heartbeat_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+ALTER TABLE pipelines ADD COLUMN runner_id INTEGER REFERENCES runners(runner_id) ON DELETE SET NULL;
+CREATE INDEX pipelines_runner_id_idx ON pipelines (runner_id) WHERE runner_id IS NOT NULL;
@@ -0,0 +1,2 @@
+ALTER TABLE pipelines DROP COLUMN runs_on;
+ALTER TABLE runners DROP COLUMN labels;
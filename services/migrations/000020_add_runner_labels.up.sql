@@ -0,0 +1,2 @@
+ALTER TABLE runners ADD COLUMN labels TEXT[] NOT NULL DEFAULT '{}';
+ALTER TABLE pipelines ADD COLUMN runs_on TEXT[] NOT NULL DEFAULT '{}';
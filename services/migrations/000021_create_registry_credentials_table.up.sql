@@ -0,0 +1,7 @@
+CREATE TABLE registry_credentials (
+    repository VARCHAR(255) NOT NULL,
+    registry VARCHAR(255) NOT NULL,
+    secret BYTEA NOT NULL,
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (repository, registry)
+);
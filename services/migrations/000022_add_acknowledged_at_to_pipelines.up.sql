@@ -0,0 +1 @@
+ALTER TABLE pipelines ADD COLUMN acknowledged_at TIMESTAMP;